@@ -0,0 +1,64 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// encrypts path in the age format to opts.OutputPath, or the file plus
+// .age, and returns the output written
+func encryptAge(path string, passphrase []byte, recipients []*crypt.Recipient, opts crypt.Options) (string, error) {
+
+	output := opts.OutputPath
+	if output == "" {
+		output = path + ".age"
+		if path == crypt.Stdio {
+			output = crypt.Stdio
+		}
+	}
+	return output, crypt.EncryptAge(path, output, passphrase, recipients, opts)
+}
+
+// decrypts the age file at path to output, or the file without its .age
+// suffix, falling back to out like other files without an extension, and
+// returns the output written
+func decryptAge(path string, passphrase []byte, identities []*crypt.Identity, output string, force bool, mode string, progress bool) (string, error) {
+
+	if output == "" {
+		output = "out"
+		if strings.HasSuffix(path, ".age") && len(path) > len(".age") {
+			output = strings.TrimSuffix(path, ".age")
+		}
+	}
+	if err := checkOverwrite(output, force); err != nil {
+		return output, err
+	}
+	m, err := parseMode(mode)
+	if err != nil {
+		return output, err
+	}
+
+	opts := crypt.Options{Mode: m, Overwrite: force}
+	bar := newProgressBar(os.Stderr, "decrypting")
+	if progress {
+		opts.Progress = bar.report()
+	}
+	err = crypt.DecryptAge(path, output, passphrase, identities, opts)
+	bar.finish()
+	return output, err
+}
@@ -0,0 +1,101 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// reads the salts and nonces of every cloak file under paths and prints
+// the ones found more than once along with the files to encrypt again.
+// reports whether anything was reused and whether any file failed.
+func auditRandomness(paths []string) (bool, bool) {
+
+	failed := false
+	files := make(map[string]crypt.Randomness)
+
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Println(err)
+				failed = true
+				return nil
+			}
+
+			if info.IsDir() && crypt.IsVirtualPath(path) {
+				log.Printf("skipping %s, it is a virtual filesystem", path)
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			encrypted, err := crypt.IsEncrypted(path)
+			if err != nil {
+				log.Println(err)
+				failed = true
+				return nil
+			}
+			if !encrypted {
+				return nil
+			}
+
+			r, err := crypt.ReadRandomness(path)
+			if err != nil {
+				log.Printf("%s: %v", path, err)
+				failed = true
+				return nil
+			}
+			files[path] = r
+			return nil
+		})
+		if err != nil {
+			log.Println(err)
+			failed = true
+		}
+	}
+
+	reused := crypt.FindReuse(files)
+	affected := make(map[string]bool)
+	for _, r := range reused {
+		fmt.Printf("%s %s reused by:\n", r.Kind, hex.EncodeToString(r.Value))
+		for _, p := range r.Paths {
+			fmt.Printf("  %s\n", p)
+			affected[p] = true
+		}
+	}
+
+	if len(affected) > 0 {
+		var rekey []string
+		for p := range affected {
+			rekey = append(rekey, p)
+		}
+		sort.Strings(rekey)
+		fmt.Println("files to encrypt again:")
+		for _, p := range rekey {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	log.Printf("audited %d encrypted files", len(files))
+
+	return len(reused) > 0, failed
+}
@@ -15,12 +15,18 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/drish/cloak/crypt"
+	"github.com/drish/cloak/internal/term"
 )
 
 var usage = `Usage: cloak [options...] [flags...]
@@ -28,73 +34,1918 @@ var usage = `Usage: cloak [options...] [flags...]
 Example:
 
 cloak encrypt -p rlycoolpass -f file.pdf
+cloak decrypt -prompt -o file.pdf file.cloak
+tar cz dir | cloak encrypt -pass-env PASS - > dir.tar.cloak
 
 Options:
-  encrypt	encrypts file
-  decrypt	decrypts file
+  encrypt	encrypts file, cloak encrypt [flags...] file
+  decrypt	decrypts file, cloak decrypt [flags...] file
+  hash  	prints checksums of files, cloak hash [-a blake3|blake2b|sha256] files...
+  diff  	shows changes between two encrypted files, cloak diff -p pass [-p2 pass] [-U n] a b
+  grep  	searches encrypted files, cloak grep -p pass [-l] [-i] [-C n] [-label k=v] pattern paths...
+  compare	checks that an encrypted file matches a plaintext file, cloak compare -p pass plain encrypted
+  meta  	describes commands, flags and exit codes, cloak meta [-json]
+  spec  	describes the encrypted file formats, cloak spec [-json]
+  conform	checks that encrypted files follow their format without the passphrase, cloak conform files...
+  info  	describes the format, cipher, key derivation and size of encrypted files without the passphrase, cloak info [-json] files...
+  exec  	runs a command with decrypted files, cloak exec -p pass [-allow-disk] -file enc=target... -- command args...
+  doctor	checks the environment and encrypted files under paths, cloak doctor [paths...]
+  audit-randomness	finds salts and nonces repeated across encrypted files, cloak audit-randomness dirs...
+  verify	authenticates encrypted files without writing the plaintext, cloak verify [-p pass] [-label k=v] files...
+  labels	prints the labels of encrypted files under paths, cloak labels [-p pass] [-label k=v] paths...
+  rekey 	encrypts files again in place with a new passphrase, salt and the default parameters, cloak rekey [-p pass] [-new-p pass] files...
+  migrate	rewrites encrypted files in an old format in the current one with the same passphrase, cloak migrate [-p pass] [-n] paths...
+  wipe  	overwrites files with random data, scrambles their names and removes them, cloak wipe [-passes n] [-r] paths...
+  prompt	asks for a secret without echoing it and writes it encrypted, cloak prompt -out secret.cloak [-p pass]
+  pack  	encrypts several files as named streams of one container, cloak pack -out file.cloak [-p pass] name=path...
+  extract	writes one stream of a container, or lists them without -stream, cloak extract -p pass [-stream name] [-o path] file
+  archive	encrypts a directory tree into one file as a tar archive, cloak archive -out project.cloak [-p pass] [-compress gzip] [-scrypt N,r,p | -argon2id costs] [-include glob] [-exclude glob] [-no-dotfiles] [-symlinks preserve|skip|follow] [-manifest file] dir
+  unarchive	restores a directory tree written by archive, cloak unarchive [-p pass] -o dir file
+  audit 	checks that an archive still holds the files of its manifest unchanged, cloak audit [-p pass] -manifest file archive
+  watch 	encrypts files as they appear or change in a directory until interrupted, cloak watch [-p pass] [-interval 1s] [-shred] [-include glob] [-exclude glob] [-n [-json]] dir
+  mount 	presents the files encrypted under a directory decrypted on a mount point until interrupted, or with -audit only their metadata and verification status, Linux only, cloak mount [-p pass] [-audit] dir mountpoint
+  serve 	serves encrypt, decrypt and verify over HTTP on a unix socket for other programs, cloak serve [-socket path] [-addr host:port [-allow-remote]] [-p pass] [-scrypt N,r,p | -argon2id costs], without authentication: whoever reaches it encrypts and decrypts with the passphrase
+  passgen	generates random passphrases, diceware phrases or characters of a charset, cloak passgen [-words n | -length n -charset hex|alnum|printable|chars] [-sep s] [-n count] [-json]
+  keygen	generates an X25519 identity to encrypt files to, or a key to sign them with, cloak keygen [-age | -sign] [-o key.txt]
+  escrow	splits a recovery key or passphrase among trustees and assembles it again, cloak escrow create|split -shares n -threshold k [-dir d] [-p pass] | status shares... | assemble|combine [-o file] shares...
+  completion	prints a shell completion script, cloak completion bash|zsh|fish
+  shell 	unlocks a passphrase or identities once and runs encrypt, decrypt and inspect commands, cloak shell [-p pass] [-i key.txt]
 
 Flags:
-  -f 	[required] file to encrypt
-  -p 	[optional] user provided passphrase, if not provided /dev/urandom is used
+  -f 	[required] file to encrypt or decrypt, can also be given as the last argument, - reads standard input
+  -p 	[optional] user provided passphrase, if not provided /dev/urandom is used when encrypting
+  -pass-env	[optional] reads the passphrase from the named environment variable
+  -pass-file	[optional] reads the passphrase from the first line of a file
+  -passphrase-fd	[optional] reads the passphrase from the first line of an open file descriptor, such as 3
+  -prompt	[optional] prompts for the passphrase without echoing it, the default when decrypting on a terminal
+  -o 	[optional] path of the output file, encrypt defaults to the file with its extension replaced by .cloak, - writes standard output, the default when reading standard input, encrypt also uploads a stream to a storage URL such as s3://bucket/key
+  -force	[optional] overwrites the output file if it exists
+  -verify	[optional] decrypts the output in memory and compares it with the original
+  -rm 	[optional] removes the original file after a successful verification, implies -verify
+  -shred	[optional] overwrites the original with random data and removes it once the output is flushed and read back, can't be combined with -verify and -rm
+  -mode	[optional] octal permissions of the output file, defaults to 0666 minus umask when encrypting and the recorded mode, or 0600, when decrypting
+  -rotate-after	[optional] duration after which the passphrase should be rotated, such as 2160h, decrypt warns once it passed
+  -split	[optional] splits the encrypted file into parts of at most this size, such as 25M, decrypt any part to restore it
+  -armor	[optional] writes a hex encoded, line based file instead of the smaller binary format
+  -pem  	[optional] wraps the binary file in a PEM block to paste into email, tickets or YAML, decrypt detects it
+  -scrypt	[optional] scrypt cost parameters N,r,p of the key derivation, such as 1048576,8,1, stored in the file, streams included
+  -argon2id	[optional] derives the key with argon2id instead, optionally with costs time,memory KiB,threads such as 3,65536,4
+  -kdf-time	[optional] measures this host and picks the scrypt, or -argon2id default, costs that take about this long to derive the key, such as 500ms, for encrypt and rekey, calibrate on the slowest host that decrypts
+  -compress	[optional] compresses the file with this algorithm before encrypting it, such as gzip, unless that doesn't make it smaller
+  -cipher	[optional] seals the file with secretbox, xchacha20-poly1305 or aes-256-gcm, recorded in the file so decrypt needs no flag, defaults to secretbox
+  -strict	[optional] refuses to decrypt files encrypted with parameters below the recommended minimums
+  -allow-special	[optional] encrypts named pipes, devices and files under /proc, /sys and /dev instead of refusing them
+  -no-metadata	[optional] doesn't record the permissions, modification time and owner when encrypting, or restore them when decrypting
+  -check-entropy	[optional] fails instead of encrypting when the random source isn't ready or looks broken
+  -r 	[optional] encrypts to a recipient public key instead of a passphrase, or to an ssh-ed25519 or ssh-rsa public key, repeatable
+  -R 	[optional] encrypts to the recipients listed in a file, one per line, such as ~/.ssh/id_ed25519.pub, repeatable
+  -add-pass-file	[optional] also lets the passphrase on the first line of this file decrypt, repeatable
+  -i 	[optional] decrypts with the identities of a file written by keygen, or with an SSH private key, prompting for its passphrase
+  -key 	[optional] encrypts or decrypts with the raw 32 byte key of a file instead of a passphrase, skipping the key derivation
+  -sign 	[optional] signs the encrypted file with the Ed25519 key of a file written by keygen -sign, only binary files can be signed
+  -signer	[optional] decrypts only files signed by this public key, or by one listed in this file, repeatable, decrypt and info report the signer of signed files either way
+  -progress	[optional] shows a progress bar on stderr while encrypt or decrypt read the file
+  -convergent	[optional] derives the salt and nonces from the passphrase and contents, so the same file encrypted twice gives the same bytes for deduplicating backups, at the cost of revealing which files are equal
+  -resume	[optional] encrypts the file as a stream, or decrypts a stream, recording the progress in this state file, running the same command again after an interruption continues from the last checkpoint
+  -in-place	[optional] encrypts the file into a stream by overwriting it chunk by chunk, then renames it, so there needn't be room for a second copy, running the same command again after a crash completes it from its journal
+  -lock-memory	[optional] locks the plaintext in memory with mlock while encrypt or decrypt hold it, so it isn't written to swap, Linux only
+  -sandbox	[optional] decrypts with a passphrase in a child process confined with seccomp that can't open files, sockets or programs, for files from untrusted sources, the output defaults to out and no metadata is restored, Linux on amd64 and arm64 only
+  -age  	[optional] writes the age v1 format so age can decrypt the file, with a passphrase or to recipients, decrypt detects age files and reads age1 recipients and AGE-SECRET-KEY-1 identities, keygen -age writes them
+  -vault-key	[optional] wraps the file key with a HashiCorp Vault transit key instead of a passphrase, or unwraps it when decrypting, the server and token are read from VAULT_ADDR and VAULT_TOKEN
+  -token	[optional] wraps the file key with a secret a hardware token derives from a challenge, or unwraps it when decrypting, the token is asked by this command, such as "ykchalresp -2 -x" for a YubiKey
+  -gen-words	[optional] generates a diceware phrase of this many common words, about 11 bits each, when encrypt is given no passphrase, -gen-sep separates them, defaults to -
+  -gen-length	[optional] number of characters of the passphrase encrypt generates, defaults to 32
+  -gen-charset	[optional] characters of the passphrase encrypt generates, hex, alnum, printable or the characters themselves, defaults to hex
+  -keyring	[optional] stores the generated passphrase in the OS keychain, keyed by the checksum of the encrypted file, instead of printing it, decrypt looks it up when no passphrase is given
+  -trace	[optional] logs every decision behind the file to stderr, such as the cipher, key derivation parameters, layout and fallbacks taken
+  -trace-json	[optional] like -trace but logs json lines
+  -json 	[optional] prints a json report of what encrypt or decrypt did on stdout, such as the output, salt, key derivation parameters and duration, or of the error they failed with, see cloak meta for the exit codes
+  -label	[optional] key=value label sealed with the file when encrypting, or a selector limiting grep, verify and labels to files carrying it, repeatable
+  -new-p	[optional] new passphrase of rekey, -new-pass-env, -new-pass-file, -new-passphrase-fd and -new-prompt read it like their -pass counterparts, prompted for if not provided
+  -weak-passphrase	[optional] warn, refuse or allow a passphrase given to encrypt, rekey, pack, archive or watch that is estimated weaker than -min-entropy or is on the -deny-list, defaults to warn
+  -min-entropy	[optional] least estimated entropy of a passphrase in bits, counting common passwords, words, keyboard patterns, sequences and repeats as the few guesses they take, defaults to 40
+  -deny-list	[optional] file of refused passphrases, one per line, such as leaked or former ones, also counted as known words when estimating the strength
 `
 
 func main() {
 
 	encryptCommand := flag.NewFlagSet("encrypt", flag.ExitOnError)
 	encPassphrase := encryptCommand.String("p", "", "[optional] user provided passphrase to encrypt file")
-	encFilepath := encryptCommand.String("f", "", "[required] file to encrypt")
+	encFilepath := encryptCommand.String("f", "", "[required] file to encrypt, - reads standard input")
+	encVerify := encryptCommand.Bool("verify", false, "[optional] decrypts the output in memory and compares it with the original")
+	encRemove := encryptCommand.Bool("rm", false, "[optional] removes the original file after a successful verification, implies -verify")
+	encShred := encryptCommand.Bool("shred", false, "[optional] overwrites the original with random data and removes it")
+	encMode := encryptCommand.String("mode", "", "[optional] octal permissions of the encrypted file")
+	encRotateAfter := encryptCommand.Duration("rotate-after", 0, "[optional] duration after which the passphrase should be rotated")
+	encSplit := encryptCommand.String("split", "", "[optional] maximum size of each part, such as 25M")
+	encArmor := encryptCommand.Bool("armor", false, "[optional] writes a hex encoded, line based file")
+	encPEM := encryptCommand.Bool("pem", false, "[optional] wraps the binary file in a PEM block to paste into email, tickets or YAML")
+	encScrypt := encryptCommand.String("scrypt", "", "[optional] scrypt cost parameters N,r,p such as 1048576,8,1")
+	encArgon2id := encryptCommand.String("argon2id", "", "[optional] argon2id costs time,memory KiB,threads such as 3,65536,4, or default")
+	encKDFTime := encryptCommand.Duration("kdf-time", 0, "[optional] measures this host and picks the costs of the key derivation that take about this long, such as 500ms")
+	encCompress := encryptCommand.String("compress", "", "[optional] compresses the file before encrypting it, such as gzip")
+	encCipher := encryptCommand.String("cipher", "", "[optional] cipher sealing the file, secretbox, xchacha20-poly1305 or aes-256-gcm")
+	encPassSource := addPassphraseFlags(encryptCommand, encPassphrase)
+	encPolicy := addPolicyFlags(encryptCommand)
+	encGenerator := addGeneratorFlags(encryptCommand, "gen-")
+	encOutput := encryptCommand.String("o", "", "[optional] path of the encrypted file, defaults to the file with its extension replaced by .cloak, - writes standard output, s3://bucket/key uploads a stream")
+	encForce := encryptCommand.Bool("force", false, "[optional] overwrites the encrypted file if it exists")
+	encAllowSpecial := encryptCommand.Bool("allow-special", false, "[optional] encrypts named pipes, devices and virtual filesystem files")
+	encNoMetadata := encryptCommand.Bool("no-metadata", false, "[optional] doesn't record the permissions, modification time and owner of the file")
+	encCheckEntropy := encryptCommand.Bool("check-entropy", false, "[optional] fails instead of encrypting when the random source isn't ready or looks broken")
+	encKeyFile := encryptCommand.String("key", "", "[optional] file holding a raw 32 byte key used instead of a passphrase")
+	encProgress := encryptCommand.Bool("progress", false, "[optional] shows a progress bar on stderr while the file is read")
+	encKeyring := encryptCommand.Bool("keyring", false, "[optional] stores the generated passphrase in the OS keychain instead of printing it")
+	encConvergent := encryptCommand.Bool("convergent", false, "[optional] derives the salt and nonces from the passphrase and contents so equal files encrypt to equal bytes")
+	encResume := encryptCommand.String("resume", "", "[optional] encrypts the file as a stream recording its progress in this state file, the same command continues it after an interruption")
+	encInPlace := encryptCommand.Bool("in-place", false, "[optional] overwrites the file with its encrypted stream chunk by chunk instead of writing a copy, running it again after a crash completes it")
+	encLockMemory := encryptCommand.Bool("lock-memory", false, "[optional] keeps the plaintext out of swap with mlock while it's encrypted, Linux only")
+	encAge := encryptCommand.Bool("age", false, "[optional] writes the age v1 format to a passphrase or age1 recipients, the output defaults to the file plus .age")
+	encVaultKey := encryptCommand.String("vault-key", "", "[optional] wraps the file key with this vault transit key instead of a passphrase, configured by VAULT_ADDR and VAULT_TOKEN")
+	encToken := encryptCommand.String("token", "", "[optional] wraps the file key with a secret the hardware token answering this command derives, such as \"ykchalresp -2 -x\"")
+	encTrace := encryptCommand.Bool("trace", false, "[optional] logs the cipher, key derivation, layout and fallbacks chosen to stderr")
+	encTraceJSON := encryptCommand.Bool("trace-json", false, "[optional] like -trace but logs json lines")
+	encJSON := encryptCommand.Bool("json", false, "[optional] prints a json report of the result, or of the error, on stdout")
+	var encRecipients, encRecipientFiles stringList
+	encryptCommand.Var(&encRecipients, "r", "[optional] recipient public key to encrypt to instead of a passphrase, or an ssh-ed25519 or ssh-rsa key line, repeatable")
+	encryptCommand.Var(&encRecipientFiles, "R", "[optional] file listing recipient public keys, such as ~/.ssh/id_ed25519.pub or authorized_keys, repeatable")
+	var encExtraPassFiles stringList
+	encryptCommand.Var(&encExtraPassFiles, "add-pass-file", "[optional] file with an additional passphrase that can decrypt, repeatable")
+	var encLabels stringList
+	encryptCommand.Var(&encLabels, "label", "[optional] key=value label sealed in the file's authenticated metadata, repeatable")
+	encSign := encryptCommand.String("sign", "", "[optional] signs the encrypted file with the key of this file, written by keygen -sign")
 
 	decryptCommand := flag.NewFlagSet("decrypt", flag.ExitOnError)
 	decPassphrase := decryptCommand.String("p", "", "[optional] user provided passphrase to decrypt")
-	decFilepath := decryptCommand.String("f", "", "[required] file to decrypt")
+	decFilepath := decryptCommand.String("f", "", "[required] file to decrypt, - reads standard input")
+	decMode := decryptCommand.String("mode", "", "[optional] octal permissions of the decrypted file")
+	decPassSource := addPassphraseFlags(decryptCommand, decPassphrase)
+	decOutput := decryptCommand.String("o", "", "[optional] path of the decrypted file, defaults to out plus the original extension, - writes standard output")
+	decForce := decryptCommand.Bool("force", false, "[optional] overwrites the decrypted file if it exists")
+	decStrict := decryptCommand.Bool("strict", false, "[optional] refuses files encrypted with weak parameters")
+	decAllowLegacy := decryptCommand.Bool("allow-legacy", false, "[optional] decrypts armored files without a trailer, whose extension isn't authenticated, migrate them instead when they're yours")
+	decNoMetadata := decryptCommand.Bool("no-metadata", false, "[optional] doesn't restore the recorded permissions, modification time and owner")
+	decIdentity := decryptCommand.String("i", "", "[optional] file of identities to decrypt files encrypted to recipients, or an SSH private key")
+	decKeyFile := decryptCommand.String("key", "", "[optional] file holding the raw 32 byte key the file was encrypted with")
+	decVaultKey := decryptCommand.String("vault-key", "", "[optional] unwraps the file key with this vault transit key, configured by VAULT_ADDR and VAULT_TOKEN")
+	decToken := decryptCommand.String("token", "", "[optional] unwraps the file key with a secret the hardware token answering this command derives")
+	decResume := decryptCommand.String("resume", "", "[optional] decrypts a stream recording its progress in this state file, the same command continues it after an interruption")
+	decLockMemory := decryptCommand.Bool("lock-memory", false, "[optional] keeps the restored plaintext out of swap with mlock until it's written, Linux only")
+	decProgress := decryptCommand.Bool("progress", false, "[optional] shows a progress bar on stderr while the file is read")
+	decTrace := decryptCommand.Bool("trace", false, "[optional] logs the layout, cipher, key derivation and checks of the file to stderr")
+	decTraceJSON := decryptCommand.Bool("trace-json", false, "[optional] like -trace but logs json lines")
+	decJSON := decryptCommand.Bool("json", false, "[optional] prints a json report of the result, or of the error, on stdout")
+	decSandbox := decryptCommand.Bool("sandbox", false, "[optional] parses and decrypts the file in a child process that can't open files, sockets or programs, Linux only")
+	var decSigners stringList
+	decryptCommand.Var(&decSigners, "signer", "[optional] only decrypts files signed by this public key, or by one listed in this file, repeatable")
+
+	hashCommand := flag.NewFlagSet("hash", flag.ExitOnError)
+	hashAlgorithm := hashCommand.String("a", "blake3", "[optional] hash algorithm, blake3, blake2b or sha256")
+
+	diffCommand := flag.NewFlagSet("diff", flag.ExitOnError)
+	diffPassphrase := diffCommand.String("p", "", "[required] passphrase of the encrypted files")
+	diffPassphrase2 := diffCommand.String("p2", "", "[optional] passphrase of the second file if it differs")
+	diffContext := diffCommand.Int("U", 3, "[optional] number of context lines")
+
+	grepCommand := flag.NewFlagSet("grep", flag.ExitOnError)
+	grepPassphrase := grepCommand.String("p", "", "[required] passphrase of the encrypted files")
+	grepFilesOnly := grepCommand.Bool("l", false, "[optional] only print names of matching files")
+	grepIgnoreCase := grepCommand.Bool("i", false, "[optional] case insensitive matching")
+	grepContext := grepCommand.Int("C", 0, "[optional] number of context lines")
+	var grepLabels stringList
+	grepCommand.Var(&grepLabels, "label", "[optional] only searches files with this key=value label, repeatable")
+
+	compareCommand := flag.NewFlagSet("compare", flag.ExitOnError)
+	comparePassphrase := compareCommand.String("p", "", "[required] passphrase of the encrypted file")
+
+	execCommand := flag.NewFlagSet("exec", flag.ExitOnError)
+	execPassphrase := execCommand.String("p", "", "[required] passphrase of the encrypted files")
+	var execFiles stringList
+	execCommand.Var(&execFiles, "file", "[required] encrypted=target, decrypts encrypted to a private directory and links target to it, repeatable")
+	execAllowDisk := execCommand.Bool("allow-disk", false, "[optional] writes the decrypted files to the temporary directory when there's no memory backed one, such as on macOS")
+
+	doctorCommand := flag.NewFlagSet("doctor", flag.ExitOnError)
+
+	auditCommand := flag.NewFlagSet("audit-randomness", flag.ExitOnError)
+
+	verifyCommand := flag.NewFlagSet("verify", flag.ExitOnError)
+	verifyPassphrase := verifyCommand.String("p", "", "[optional] passphrase of the encrypted files, prompted for if not provided")
+	verifyPassSource := addPassphraseFlags(verifyCommand, verifyPassphrase)
+	var verifyLabels stringList
+	verifyCommand.Var(&verifyLabels, "label", "[optional] only verifies files with this key=value label, repeatable")
+
+	labelsCommand := flag.NewFlagSet("labels", flag.ExitOnError)
+	labelsPassphrase := labelsCommand.String("p", "", "[optional] passphrase of the encrypted files, prompted for if not provided")
+	labelsPassSource := addPassphraseFlags(labelsCommand, labelsPassphrase)
+	var labelsSelector stringList
+	labelsCommand.Var(&labelsSelector, "label", "[optional] only prints files with this key=value label, repeatable")
+
+	rekeyCommand := flag.NewFlagSet("rekey", flag.ExitOnError)
+	rekeyPassphrase := rekeyCommand.String("p", "", "[optional] current passphrase of the encrypted files, prompted for if not provided")
+	rekeyPassSource := addPassphraseFlags(rekeyCommand, rekeyPassphrase)
+	rekeyNewPassphrase := rekeyCommand.String("new-p", "", "[optional] new passphrase of the encrypted files, prompted for if not provided")
+	rekeyNewPassSource := addPrefixedPassphraseFlags(rekeyCommand, rekeyNewPassphrase, "new-", "new passphrase")
+	rekeyPolicy := addPolicyFlags(rekeyCommand)
+	rekeyScrypt := rekeyCommand.String("scrypt", "", "[optional] scrypt cost parameters N,r,p such as 1048576,8,1")
+	rekeyArgon2id := rekeyCommand.String("argon2id", "", "[optional] argon2id costs time,memory KiB,threads such as 3,65536,4, or default")
+	rekeyKDFTime := rekeyCommand.Duration("kdf-time", 0, "[optional] measures this host and picks the costs of the new key derivation that take about this long, such as 500ms")
+	rekeyCipher := rekeyCommand.String("cipher", "", "[optional] cipher sealing the files, secretbox, xchacha20-poly1305 or aes-256-gcm")
+	rekeyTrace := rekeyCommand.Bool("trace", false, "[optional] logs the cipher, key derivation, layout and fallbacks chosen to stderr")
+	rekeyTraceJSON := rekeyCommand.Bool("trace-json", false, "[optional] like -trace but logs json lines")
+
+	migrateCommand := flag.NewFlagSet("migrate", flag.ExitOnError)
+	migratePassphrase := migrateCommand.String("p", "", "[optional] passphrase of the encrypted files, prompted for if not provided")
+	migratePassSource := addPassphraseFlags(migrateCommand, migratePassphrase)
+	migrateDryRun := migrateCommand.Bool("n", false, "[optional] lists the files in an old format without rewriting them, exits with 1 if there are any")
+	migrateTrace := migrateCommand.Bool("trace", false, "[optional] logs the layout, cipher and key derivation chosen to stderr")
+	migrateTraceJSON := migrateCommand.Bool("trace-json", false, "[optional] like -trace but logs json lines")
+
+	wipeCommand := flag.NewFlagSet("wipe", flag.ExitOnError)
+	wipePasses := wipeCommand.Int("passes", 3, "[optional] number of times the files are overwritten")
+	wipeRecursive := wipeCommand.Bool("r", false, "[optional] wipes directories and everything below them")
+
+	promptCommand := flag.NewFlagSet("prompt", flag.ExitOnError)
+	promptOut := promptCommand.String("out", "", "[required] encrypted file to write")
+	promptPassphrase := promptCommand.String("p", "", "[optional] passphrase to encrypt the secret, prompted for if not provided")
+	promptMode := promptCommand.String("mode", "", "[optional] octal permissions of the encrypted file")
+	promptArmor := promptCommand.Bool("armor", false, "[optional] writes a hex encoded, line based file")
+
+	packCommand := flag.NewFlagSet("pack", flag.ExitOnError)
+	packOut := packCommand.String("out", "", "[required] container file to write")
+	packPassphrase := packCommand.String("p", "", "[optional] passphrase to encrypt the container, generated if not provided")
+	packPassSource := addPassphraseFlags(packCommand, packPassphrase)
+	packPolicy := addPolicyFlags(packCommand)
+	packMode := packCommand.String("mode", "", "[optional] octal permissions of the container")
+	packArmor := packCommand.Bool("armor", false, "[optional] writes a hex encoded, line based file")
+	packForce := packCommand.Bool("force", false, "[optional] overwrites the container if it exists")
+
+	extractCommand := flag.NewFlagSet("extract", flag.ExitOnError)
+	extractPassphrase := extractCommand.String("p", "", "[optional] passphrase of the container")
+	extractPassSource := addPassphraseFlags(extractCommand, extractPassphrase)
+	extractStreamName := extractCommand.String("stream", "", "[optional] name of the stream to write, lists the streams if not provided")
+	extractOutput := extractCommand.String("o", "", "[optional] path of the written stream, defaults to the stream name")
+	extractForce := extractCommand.Bool("force", false, "[optional] overwrites the output file if it exists")
+
+	archiveCommand := flag.NewFlagSet("archive", flag.ExitOnError)
+	archiveOut := archiveCommand.String("out", "", "[required] encrypted archive to write")
+	archivePassphrase := archiveCommand.String("p", "", "[optional] passphrase to encrypt the archive, prompted for if not provided")
+	archivePassSource := addPassphraseFlags(archiveCommand, archivePassphrase)
+	archivePolicy := addPolicyFlags(archiveCommand)
+	archiveMode := archiveCommand.String("mode", "", "[optional] octal permissions of the archive")
+	archiveCompress := archiveCommand.String("compress", "", "[optional] compresses the tar archive before encrypting it, gzip")
+	archiveCipher := archiveCommand.String("cipher", "", "[optional] cipher sealing the archive, secretbox or xchacha20-poly1305")
+	archiveScrypt := archiveCommand.String("scrypt", "", "[optional] scrypt cost parameters N,r,p such as 1048576,8,1")
+	archiveArgon2id := archiveCommand.String("argon2id", "", "[optional] argon2id costs time,memory KiB,threads such as 3,65536,4, or default")
+	archiveForce := archiveCommand.Bool("force", false, "[optional] overwrites the archive if it exists")
+	archiveProgress := archiveCommand.Bool("progress", false, "[optional] shows the bytes archived on stderr")
+	var archiveInclude, archiveExclude stringList
+	archiveCommand.Var(&archiveInclude, "include", "[optional] only archives the files matching this glob, such as *.go or docs/*, repeatable")
+	archiveCommand.Var(&archiveExclude, "exclude", "[optional] leaves out the files and directories matching this glob, such as .git or *.log, repeatable")
+	archiveNoDotfiles := archiveCommand.Bool("no-dotfiles", false, "[optional] leaves out the files and directories whose name starts with a dot")
+	archiveSymlinks := archiveCommand.String("symlinks", "preserve", "[optional] preserve archives symlinks as links, skip leaves them out, follow archives what they point to")
+	archiveManifest := archiveCommand.String("manifest", "", "[optional] also writes a manifest of the archived files signed with the passphrase, for audit")
+
+	auditManifestCommand := flag.NewFlagSet("audit", flag.ExitOnError)
+	auditManifestPassphrase := auditManifestCommand.String("p", "", "[optional] passphrase of the archive and manifest, prompted for if not provided")
+	auditManifestPassSource := addPassphraseFlags(auditManifestCommand, auditManifestPassphrase)
+	auditManifest := auditManifestCommand.String("manifest", "", "[required] manifest written by archive -manifest")
+
+	unarchiveCommand := flag.NewFlagSet("unarchive", flag.ExitOnError)
+	unarchivePassphrase := unarchiveCommand.String("p", "", "[optional] passphrase of the archive, prompted for if not provided")
+	unarchivePassSource := addPassphraseFlags(unarchiveCommand, unarchivePassphrase)
+	unarchiveOutput := unarchiveCommand.String("o", "", "[required] directory the tree is restored under, created if missing")
+	unarchiveProgress := unarchiveCommand.Bool("progress", false, "[optional] shows a progress bar on stderr while the archive is read")
+
+	watchCommand := flag.NewFlagSet("watch", flag.ExitOnError)
+	watchPassphrase := watchCommand.String("p", "", "[optional] passphrase to encrypt the files, prompted for if not provided")
+	watchPassSource := addPassphraseFlags(watchCommand, watchPassphrase)
+	watchPolicy := addPolicyFlags(watchCommand)
+	watchInterval := watchCommand.Duration("interval", time.Second, "[optional] time between two scans of the directory, a file is encrypted once it held still that long")
+	watchShred := watchCommand.Bool("shred", false, "[optional] overwrites the originals with random data and removes them once encrypted")
+	watchMode := watchCommand.String("mode", "", "[optional] octal permissions of the encrypted files")
+	watchCompress := watchCommand.String("compress", "", "[optional] compresses the files before encrypting them, gzip")
+	watchCipher := watchCommand.String("cipher", "", "[optional] cipher sealing the files, secretbox, xchacha20-poly1305 or aes-256-gcm")
+	var watchInclude, watchExclude stringList
+	watchCommand.Var(&watchInclude, "include", "[optional] only encrypts the files matching this glob, such as *.pdf, repeatable")
+	watchCommand.Var(&watchExclude, "exclude", "[optional] leaves out the files and directories matching this glob, such as *.part, repeatable")
+	watchDryRun := watchCommand.Bool("n", false, "[optional] lists the files that would be encrypted, overwritten, shredded or skipped and exits without touching them")
+	watchJSON := watchCommand.Bool("json", false, "[optional] lists the files of -n as json")
+
+	mountCommand := flag.NewFlagSet("mount", flag.ExitOnError)
+	mountPassphrase := mountCommand.String("p", "", "[optional] passphrase of the files, prompted for if not provided")
+	mountPassSource := addPassphraseFlags(mountCommand, mountPassphrase)
+	mountAudit := mountCommand.Bool("audit", false, "[optional] presents every encrypted file as a directory of an info file and a status file instead of its plaintext, the status only decrypts in memory when a passphrase is given")
+
+	serveCommand := flag.NewFlagSet("serve", flag.ExitOnError)
+	serveSocket := serveCommand.String("socket", "", "[optional] unix socket to listen on, defaults to cloak.sock in XDG_RUNTIME_DIR or the temporary directory")
+	serveAddr := serveCommand.String("addr", "", "[optional] loopback tcp address to listen on instead of a socket, such as 127.0.0.1:8600, every local user can reach it and use the passphrase")
+	serveAllowRemote := serveCommand.Bool("allow-remote", false, "[optional] lets -addr listen on an address other hosts reach, anyone on the network can then encrypt and decrypt with the passphrase")
+	servePassphrase := serveCommand.String("p", "", "[optional] passphrase used for requests that don't send a Cloak-Passphrase header")
+	servePassSource := addPassphraseFlags(serveCommand, servePassphrase)
+	serveCipher := serveCommand.String("cipher", "", "[optional] cipher sealing the streams unless a request asks for another, secretbox or xchacha20-poly1305")
+	serveScrypt := serveCommand.String("scrypt", "", "[optional] scrypt cost parameters N,r,p of the streams encrypted, such as 1048576,8,1")
+	serveArgon2id := serveCommand.String("argon2id", "", "[optional] derives the key of the streams encrypted with argon2id, costs time,memory KiB,threads such as 3,65536,4, or default")
+
+	passgenCommand := flag.NewFlagSet("passgen", flag.ExitOnError)
+	passgenGenerator := addGeneratorFlags(passgenCommand, "")
+	passgenCount := passgenCommand.Int("n", 1, "[optional] number of passphrases to generate")
+	passgenJSON := passgenCommand.Bool("json", false, "[optional] prints json lines with the passphrase and its entropy in bits")
+
+	keygenCommand := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keygenOutput := keygenCommand.String("o", "", "[optional] file to write the identity to, printed if not provided")
+	keygenForce := keygenCommand.Bool("force", false, "[optional] overwrites the identity file if it exists")
+	keygenAge := keygenCommand.Bool("age", false, "[optional] encodes the keys like age-keygen so age can use them")
+	keygenSign := keygenCommand.Bool("sign", false, "[optional] generates an Ed25519 key to sign encrypted files with instead")
+
+	escrowCommand := flag.NewFlagSet("escrow", flag.ExitOnError)
+	escrowShares := escrowCommand.Int("shares", 5, "[optional] number of trustees the recovery key or passphrase is split among, create and split only")
+	escrowThreshold := escrowCommand.Int("threshold", 3, "[optional] number of shares needed to assemble the key or passphrase, create and split only")
+	escrowDir := escrowCommand.String("dir", ".", "[optional] directory the shares and public key are written to, create and split only")
+	escrowOutput := escrowCommand.String("o", "", "[optional] file the assembled key or passphrase is written to, printed if not provided")
+	escrowPassphrase := escrowCommand.String("p", "", "[optional] passphrase to split, prompted for if not provided, split only")
+	escrowPassSource := addPassphraseFlags(escrowCommand, escrowPassphrase)
+	escrowForce := escrowCommand.Bool("force", false, "[optional] overwrites existing share and key files")
+
+	metaCommand := flag.NewFlagSet("meta", flag.ExitOnError)
+	metaJSON := metaCommand.Bool("json", false, "[optional] prints the description as json")
+
+	specCommand := flag.NewFlagSet("spec", flag.ExitOnError)
+	specJSON := specCommand.Bool("json", false, "[optional] prints the specification as json")
+
+	conformCommand := flag.NewFlagSet("conform", flag.ExitOnError)
+
+	infoCommand := flag.NewFlagSet("info", flag.ExitOnError)
+	infoJSON := infoCommand.Bool("json", false, "[optional] prints the descriptions as a json array")
+
+	completionCommand := flag.NewFlagSet("completion", flag.ExitOnError)
+
+	shellCommand := flag.NewFlagSet("shell", flag.ExitOnError)
+	shellPassphrase := shellCommand.String("p", "", "[optional] passphrase of the session, prompted for if not provided")
+	shellPassSource := addPassphraseFlags(shellCommand, shellPassphrase)
+	shellIdentity := shellCommand.String("i", "", "[optional] file of identities to encrypt to and decrypt with instead of a passphrase")
+
+	commands := []*flag.FlagSet{
+		encryptCommand,
+		decryptCommand,
+		hashCommand,
+		diffCommand,
+		grepCommand,
+		compareCommand,
+		execCommand,
+		doctorCommand,
+		auditCommand,
+		verifyCommand,
+		labelsCommand,
+		rekeyCommand,
+		migrateCommand,
+		wipeCommand,
+		promptCommand,
+		packCommand,
+		extractCommand,
+		archiveCommand,
+		unarchiveCommand,
+		auditManifestCommand,
+		watchCommand,
+		mountCommand,
+		serveCommand,
+		passgenCommand,
+		keygenCommand,
+		escrowCommand,
+		metaCommand,
+		specCommand,
+		conformCommand,
+		infoCommand,
+		completionCommand,
+		shellCommand,
+	}
 
 	flag.Usage = func() {
-		fmt.Fprint(os.Stderr, fmt.Sprintf(usage))
+		fmt.Fprint(os.Stderr, usage)
+	}
+
+	// the confined child of decrypt -sandbox
+	if os.Getenv(sandboxEnv) != "" {
+		sandboxedChild()
+		return
+	}
+
+	if len(os.Args) < 2 {
+		usageAndExit("")
+	}
+
+	// called by the completion scripts with the words typed so far
+	if os.Args[1] == "__complete" {
+		complete(os.Stdout, commands, os.Args[2:])
+		return
+	}
+
+	switch os.Args[1] {
+	case "encrypt":
+		encryptCommand.Parse(os.Args[2:])
+	case "decrypt":
+		decryptCommand.Parse(os.Args[2:])
+	case "hash":
+		hashCommand.Parse(os.Args[2:])
+	case "diff":
+		diffCommand.Parse(os.Args[2:])
+	case "grep":
+		grepCommand.Parse(os.Args[2:])
+	case "compare":
+		compareCommand.Parse(os.Args[2:])
+	case "exec":
+		execCommand.Parse(os.Args[2:])
+	case "doctor":
+		doctorCommand.Parse(os.Args[2:])
+	case "audit-randomness":
+		auditCommand.Parse(os.Args[2:])
+	case "verify":
+		verifyCommand.Parse(os.Args[2:])
+	case "labels":
+		labelsCommand.Parse(os.Args[2:])
+	case "rekey":
+		rekeyCommand.Parse(os.Args[2:])
+	case "migrate":
+		migrateCommand.Parse(os.Args[2:])
+	case "wipe":
+		wipeCommand.Parse(os.Args[2:])
+	case "prompt":
+		promptCommand.Parse(os.Args[2:])
+	case "pack":
+		packCommand.Parse(os.Args[2:])
+	case "extract":
+		extractCommand.Parse(os.Args[2:])
+	case "archive":
+		archiveCommand.Parse(os.Args[2:])
+	case "unarchive":
+		unarchiveCommand.Parse(os.Args[2:])
+	case "audit":
+		auditManifestCommand.Parse(os.Args[2:])
+	case "watch":
+		watchCommand.Parse(os.Args[2:])
+	case "mount":
+		mountCommand.Parse(os.Args[2:])
+	case "serve":
+		serveCommand.Parse(os.Args[2:])
+	case "passgen":
+		passgenCommand.Parse(os.Args[2:])
+	case "keygen":
+		keygenCommand.Parse(os.Args[2:])
+	case "escrow":
+		escrowCommand.Parse(os.Args[2:])
+	case "meta":
+		metaCommand.Parse(os.Args[2:])
+	case "spec":
+		specCommand.Parse(os.Args[2:])
+	case "conform":
+		conformCommand.Parse(os.Args[2:])
+	case "info":
+		infoCommand.Parse(os.Args[2:])
+	case "completion":
+		completionCommand.Parse(os.Args[2:])
+	case "shell":
+		shellCommand.Parse(os.Args[2:])
+	default:
+		usageAndExit("")
+	}
+
+	if encryptCommand.Parsed() {
+
+		path := fileArg(encryptCommand, *encFilepath)
+		if path == "" {
+			usageAndExit("Path to file to encrypt is required. Flag -f ")
+		}
+
+		recipients, err := readRecipients(encRecipients, encRecipientFiles)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		extra, err := readPassphraseFiles(encExtraPassFiles)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		labels, err := parseLabelFlags(encLabels)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		signingKey, err := readSigningKey(*encSign)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		provider, err := keyProvider(*encVaultKey, *encToken)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		passphrase, err := encPassSource.resolve(true, len(recipients) == 0 && *encKeyFile == "" && provider == nil)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if err := encPolicy.check(passphrase); err != nil {
+			log.Println(err)
+			failAndExit("encrypt", path, nil, err, *encJSON)
+		}
+		generator, err := encGenerator.generator()
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if encGenerator.given() && (passphrase != nil || len(recipients) > 0 || len(extra) > 0 || *encKeyFile != "" || provider != nil) {
+			usageAndExit("-gen-words, -gen-length, -gen-charset and -gen-sep describe a generated passphrase, they can't be used with a passphrase, recipients, -add-pass-file, -key, -vault-key or -token")
+		}
+		stdio := path == crypt.Stdio || *encOutput == crypt.Stdio
+		if stdio && *encJSON {
+			usageAndExit("-json prints its report on stdout, it can't be used with standard input or output")
+		}
+		if stdio && (*encVerify || *encRemove || *encShred) {
+			usageAndExit("-verify, -rm and -shred need files on disk, they can't be used with standard input or output")
+		}
+		if *encShred && (*encVerify || *encRemove) {
+			usageAndExit("-shred can't be combined with -verify and -rm, it reads the output back itself")
+		}
+		if len(recipients) > 0 && passphrase == nil && len(extra) == 0 && (*encVerify || *encRemove) {
+			usageAndExit("-verify and -rm need a passphrase when encrypting to recipients")
+		}
+		if *encConvergent && (passphrase == nil || len(recipients) > 0 || len(extra) > 0 || provider != nil || *encAge) {
+			usageAndExit("-convergent needs a passphrase, it can't be used with recipients, -add-pass-file, -vault-key, -token or -age")
+		}
+		if *encInPlace && *encResume != "" {
+			usageAndExit("-in-place and -resume can't be combined, -in-place resumes from its journal")
+		}
+		if *encResume != "" || *encInPlace {
+			if passphrase == nil || stdio || len(recipients) > 0 || len(extra) > 0 || *encKeyFile != "" || provider != nil || *encKeyring || *encAge || *encConvergent {
+				usageAndExit("-resume and -in-place need a passphrase and files on disk, they can't be used with recipients, -add-pass-file, -key, -vault-key, -token, -keyring, -age or -convergent")
+			}
+			if *encArmor || *encPEM || *encSplit != "" || *encCompress != "" || *encRotateAfter != 0 || len(encLabels) > 0 || *encVerify || *encRemove || *encShred {
+				usageAndExit("-resume and -in-place write a stream, they can't be used with -armor, -pem, -split, -compress, -rotate-after, -label, -verify, -rm or -shred")
+			}
+		}
+		if crypt.IsStorageURL(*encOutput) {
+			if passphrase == nil || len(recipients) > 0 || len(extra) > 0 || *encKeyFile != "" || provider != nil || *encKeyring || *encAge || *encConvergent || *encResume != "" || *encInPlace {
+				usageAndExit("-o with a storage URL needs a passphrase, it can't be used with recipients, -add-pass-file, -key, -vault-key, -token, -keyring, -age, -convergent, -resume or -in-place")
+			}
+			if *encArmor || *encPEM || *encSplit != "" || *encCompress != "" || *encRotateAfter != 0 || len(encLabels) > 0 || *encVerify || *encRemove || *encShred {
+				usageAndExit("-o with a storage URL uploads a stream, it can't be used with -armor, -pem, -split, -compress, -rotate-after, -label, -verify, -rm or -shred")
+			}
+		}
+		if *encAge {
+			if *encArmor || *encPEM || *encSplit != "" || *encKeyFile != "" || provider != nil || *encKeyring || len(extra) > 0 || len(encLabels) > 0 {
+				usageAndExit("-age can't be used with -armor, -pem, -split, -key, -vault-key, -token, -keyring, -add-pass-file or -label")
+			}
+			if *encArgon2id != "" || *encCompress != "" || *encCipher != "" || *encRotateAfter != 0 || *encVerify || *encRemove || *encShred {
+				usageAndExit("-age can't be used with -argon2id, -compress, -cipher, -rotate-after, -verify, -rm or -shred")
+			}
+			if (passphrase == nil) == (len(recipients) == 0) {
+				usageAndExit("-age needs either a passphrase or recipients, age files can't have both")
+			}
+		}
+		if signingKey != nil && (*encArmor || *encPEM || *encAge || *encResume != "" || *encInPlace || crypt.IsStorageURL(*encOutput)) {
+			usageAndExit("-sign can't be used with -armor, -pem, -age, -resume, -in-place or a storage URL, only binary files are signed")
+		}
+		if provider != nil && (passphrase != nil || len(recipients) > 0 || len(extra) > 0 || *encKeyFile != "" || *encKeyring) {
+			usageAndExit("-vault-key and -token can't be used with a passphrase, recipients, -key or -keyring")
+		}
+		if provider != nil && (*encVerify || *encRemove) {
+			usageAndExit("-verify and -rm need a passphrase, they can't be used with -vault-key or -token")
+		}
+		if *encKeyring {
+			if passphrase != nil || len(recipients) > 0 || len(extra) > 0 || *encKeyFile != "" {
+				usageAndExit("-keyring stores a generated passphrase, it can't be used with a passphrase, recipients or -key")
+			}
+			if stdio || *encSplit != "" {
+				usageAndExit("-keyring needs one encrypted file on disk, it can't be used with standard output or -split")
+			}
+		}
+		if *encKeyFile != "" {
+			if passphrase != nil || len(recipients) > 0 || len(extra) > 0 {
+				usageAndExit("-key can't be used with a passphrase or recipients")
+			}
+			if *encVerify || *encRemove {
+				usageAndExit("-verify and -rm need a passphrase, they can't be used with -key")
+			}
+		}
+
+		mode, err := parseMode(*encMode)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		partSize, err := parseSize(*encSplit)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		kdf, err := parseKDF(*encScrypt, *encArgon2id, *encKDFTime)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		compressor, err := parseCompressor(*encCompress)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		cipher, err := parseCipher(*encCipher)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		opts := crypt.Options{
+			Mode:          mode,
+			RotateAfter:   *encRotateAfter,
+			PartSize:      partSize,
+			Armor:         *encArmor,
+			PEM:           *encPEM,
+			KDF:           kdf,
+			OutputPath:    *encOutput,
+			AllowSpecial:  *encAllowSpecial,
+			ShredOriginal: *encShred,
+			Overwrite:     *encForce,
+			NoMetadata:    *encNoMetadata,
+			Compress:      compressor,
+			Cipher:        cipher,
+			Quiet:         true,
+			CheckEntropy:  *encCheckEntropy,
+			KeyFile:       *encKeyFile,
+			Labels:        labels,
+			Convergent:    *encConvergent,
+			Generator:     generator,
+			LockMemory:    *encLockMemory,
+			Sign:          signingKey,
+			Logger:        traceLogger(os.Stderr, *encTrace, *encTraceJSON),
+		}
+		bar := newProgressBar(os.Stderr, "encrypting")
+		if *encProgress {
+			opts.Progress = bar.report()
+		}
+		if crypt.IsStorageURL(*encOutput) {
+			err = crypt.EncryptToURL(path, *encOutput, passphrase, opts)
+			bar.finish()
+			res := &crypt.Result{Output: *encOutput}
+			if err != nil {
+				log.Println(err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			log.Println("uploaded to: ", *encOutput)
+			if *encJSON {
+				writeReport(os.Stdout, "encrypt", path, res, nil)
+			}
+			log.Println("finished ! ")
+			return
+		}
+		if *encResume != "" || *encInPlace {
+			var output string
+			if *encInPlace {
+				output, err = encryptInPlace(path, passphrase, opts)
+			} else {
+				output, err = encryptResumable(path, *encResume, passphrase, opts)
+			}
+			bar.finish()
+			res := &crypt.Result{Output: output}
+			if errors.Is(err, crypt.ErrOutputExists) {
+				log.Printf("%v, use -force to overwrite it", err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			if err != nil {
+				log.Println(err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			log.Println("output file: ", output)
+			if *encJSON {
+				writeReport(os.Stdout, "encrypt", path, res, nil)
+			}
+			log.Println("finished ! ")
+			return
+		}
+		if *encAge {
+			output, err := encryptAge(path, passphrase, recipients, opts)
+			bar.finish()
+			res := &crypt.Result{Output: output}
+			if errors.Is(err, crypt.ErrOutputExists) {
+				log.Printf("%v, use -force to overwrite it", err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			if err != nil {
+				log.Println(err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			if output != crypt.Stdio {
+				log.Println("output file: ", output)
+			}
+			if *encJSON {
+				writeReport(os.Stdout, "encrypt", path, res, nil)
+			}
+			log.Println("finished ! ")
+			return
+		}
+
+		var res *crypt.Result
+		if provider != nil {
+			res, err = crypt.EncryptWithKeyProvider(path, provider, opts)
+		} else if len(recipients) > 0 || len(extra) > 0 {
+			var passphrases [][]byte
+			if passphrase != nil {
+				passphrases = append(passphrases, passphrase)
+			}
+			passphrases = append(passphrases, extra...)
+			res, err = crypt.EncryptMulti(path, passphrases, recipients, opts)
+		} else {
+			res, err = crypt.EncryptWithOptions(path, passphrase, opts)
+		}
+		bar.finish()
+		if errors.Is(err, crypt.ErrOutputExists) {
+			log.Printf("%v, use -force to overwrite it", err)
+			failAndExit("encrypt", path, res, err, *encJSON)
+		}
+		if err != nil {
+			log.Println(err)
+			failAndExit("encrypt", path, res, err, *encJSON)
+		}
+		if *encKeyring {
+			if err := storeInKeyring(res.Output, res.Secret.Reveal()); err != nil {
+				// the passphrase would be lost otherwise
+				log.Println(err)
+				showGenerated(passphrase, res)
+			} else {
+				log.Println("stored the generated passphrase in the keychain")
+			}
+		} else if len(extra) == 0 && *encKeyFile == "" && provider == nil {
+			showGenerated(passphrase, res)
+		}
+		if len(res.Parts) > 0 {
+			for _, p := range res.Parts {
+				log.Println("output part: ", p)
+			}
+		} else if !stdio {
+			log.Println("output file: ", res.Output)
+		}
+
+		if *encVerify || *encRemove {
+			err = crypt.VerifyEncrypted(res.Output, path, res.Secret.Reveal())
+			if err != nil {
+				log.Println("verification failed: ", err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			log.Println("verified output file")
+		}
+
+		res.Secret.Destroy()
+
+		if *encShred {
+			log.Println("shredded original file: ", path)
+		}
+
+		if *encRemove {
+			err = os.Remove(path)
+			if err != nil {
+				log.Println(err)
+				failAndExit("encrypt", path, res, err, *encJSON)
+			}
+			log.Println("removed original file: ", path)
+		}
+
+		if *encJSON {
+			writeReport(os.Stdout, "encrypt", path, res, nil)
+		}
+		log.Println("finished ! ")
+		return
+	}
+
+	if hashCommand.Parsed() {
+
+		if hashCommand.NArg() == 0 {
+			usageAndExit("At least one file to hash is required.")
+		}
+
+		err := hashFiles(*hashAlgorithm, hashCommand.Args())
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if diffCommand.Parsed() {
+
+		if *diffPassphrase == "" {
+			usageAndExit("Passphrase to decrypt files is required.")
+		}
+
+		if diffCommand.NArg() != 2 {
+			usageAndExit("Two files to compare are required.")
+		}
+
+		if *diffPassphrase2 == "" {
+			diffPassphrase2 = diffPassphrase
+		}
+
+		// exit codes follow diff(1), 1 when files differ, 2 on errors
+		differ, err := diffFiles(diffCommand.Arg(0), diffCommand.Arg(1), []byte(*diffPassphrase), []byte(*diffPassphrase2), *diffContext)
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+		if differ {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if grepCommand.Parsed() {
+
+		if *grepPassphrase == "" {
+			usageAndExit("Passphrase to decrypt files is required.")
+		}
+
+		if grepCommand.NArg() < 2 {
+			usageAndExit("A pattern and at least one path are required.")
+		}
+
+		pattern := grepCommand.Arg(0)
+		if *grepIgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+		selector, err := parseLabelFlags(grepLabels)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		// exit codes follow grep(1), 1 when nothing matched, 2 on errors
+		opts := grepOptions{filesOnly: *grepFilesOnly, context: *grepContext, labels: selector}
+		matched, failed := grepFiles(re, grepCommand.Args()[1:], []byte(*grepPassphrase), opts)
+		if failed {
+			os.Exit(2)
+		}
+		if !matched {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if compareCommand.Parsed() {
+
+		if *comparePassphrase == "" {
+			usageAndExit("Passphrase to decrypt file is required.")
+		}
+
+		if compareCommand.NArg() != 2 {
+			usageAndExit("A plaintext and an encrypted file are required.")
+		}
+
+		// exit codes follow cmp(1), 1 when files differ, 2 on errors
+		plain, encrypted := compareCommand.Arg(0), compareCommand.Arg(1)
+		err := crypt.VerifyEncrypted(encrypted, plain, []byte(*comparePassphrase))
+		if err == crypt.ErrMismatch {
+			log.Printf("%s and %s differ", plain, encrypted)
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+		log.Printf("%s and %s are identical", plain, encrypted)
+		return
+	}
+
+	if doctorCommand.Parsed() {
+
+		if doctor(doctorCommand.Args()) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if auditCommand.Parsed() {
+
+		if auditCommand.NArg() == 0 {
+			usageAndExit("At least one directory to audit is required.")
+		}
+
+		reused, failed := auditRandomness(auditCommand.Args())
+		if failed {
+			os.Exit(2)
+		}
+		if reused {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if verifyCommand.Parsed() {
+
+		if verifyCommand.NArg() == 0 {
+			usageAndExit("At least one encrypted file is required.")
+		}
+
+		passphrase, err := verifyPassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase of the encrypted files is required.")
+			}
+			passphrase, err = promptHidden("passphrase", false)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		selector, err := parseLabelFlags(verifyLabels)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		failed := false
+		for _, path := range verifyCommand.Args() {
+			if len(selector) > 0 {
+				labels, err := crypt.Labels(path, passphrase)
+				if err != nil {
+					fmt.Printf("%s: %v\n", path, err)
+					failed = true
+					continue
+				}
+				if !crypt.MatchLabels(labels, selector) {
+					continue
+				}
+			}
+			if err := crypt.Verify(path, passphrase); err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: ok\n", path)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if labelsCommand.Parsed() {
+
+		if labelsCommand.NArg() == 0 {
+			usageAndExit("At least one path is required.")
+		}
+
+		selector, err := parseLabelFlags(labelsSelector)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		passphrase, err := labelsPassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase of the encrypted files is required.")
+			}
+			passphrase, err = promptHidden("passphrase", false)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		if listLabels(labelsCommand.Args(), passphrase, selector) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if rekeyCommand.Parsed() {
+
+		if rekeyCommand.NArg() == 0 {
+			usageAndExit("At least one encrypted file is required.")
+		}
+
+		passphrase, err := rekeyPassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		newPass, err := rekeyNewPassSource.resolve(true, false)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil || newPass == nil {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("The current and new passphrases are required. Flags -p and -new-p")
+			}
+		}
+		if passphrase == nil {
+			passphrase, err = promptHidden("current passphrase", false)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		if newPass == nil {
+			newPass, err = promptHidden("new passphrase", true)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		if err := rekeyPolicy.check(newPass); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		kdf, err := parseKDF(*rekeyScrypt, *rekeyArgon2id, *rekeyKDFTime)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		cipher, err := parseCipher(*rekeyCipher)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		opts := crypt.Options{
+			KDF:    kdf,
+			Cipher: cipher,
+			Quiet:  true,
+			Logger: traceLogger(os.Stderr, *rekeyTrace, *rekeyTraceJSON),
+		}
+		failed := false
+		for _, path := range rekeyCommand.Args() {
+			res, err := crypt.RekeyWithOptions(path, passphrase, newPass, opts)
+			if err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				failed = true
+				continue
+			}
+			res.Secret.Destroy()
+			fmt.Printf("%s: rekeyed\n", path)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if migrateCommand.Parsed() {
+
+		if migrateCommand.NArg() == 0 {
+			usageAndExit("At least one encrypted file or directory is required.")
+		}
+
+		var passphrase []byte
+		if !*migrateDryRun {
+			var err error
+			passphrase, err = migratePassSource.resolve(false, true)
+			if err != nil {
+				usageAndExit(err.Error())
+			}
+			if passphrase == nil {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					usageAndExit("Passphrase of the encrypted files is required. Flag -p")
+				}
+				passphrase, err = promptHidden("passphrase", false)
+				if err != nil {
+					log.Println(err)
+					os.Exit(1)
+				}
+			}
+		}
+
+		opts := crypt.Options{
+			Quiet:  true,
+			Logger: traceLogger(os.Stderr, *migrateTrace, *migrateTraceJSON),
+		}
+		outdated, failed := migrateFiles(migrateCommand.Args(), passphrase, *migrateDryRun, opts)
+		if failed || (*migrateDryRun && outdated) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if wipeCommand.Parsed() {
+
+		if wipeCommand.NArg() == 0 {
+			usageAndExit("At least one path to wipe is required.")
+		}
+		if *wipePasses < 1 {
+			usageAndExit("-passes must be at least 1")
+		}
+
+		failed := false
+		for _, path := range wipeCommand.Args() {
+			if info, err := os.Lstat(path); err == nil && info.IsDir() && !*wipeRecursive {
+				fmt.Fprintf(os.Stderr, "%s is a directory, use -r to wipe it\n", path)
+				failed = true
+				continue
+			}
+			report, err := crypt.Wipe(path, *wipePasses)
+			if report != nil {
+				for _, w := range report.Warnings {
+					fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+				}
+				for _, f := range report.Files {
+					fmt.Printf("wiped %s\n", f)
+				}
+			}
+			if err != nil {
+				log.Println(err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if shellCommand.Parsed() {
+
+		session := &shellSession{}
+		if *shellIdentity != "" {
+			if shellPassSource.given() {
+				usageAndExit("-i can't be used with a passphrase")
+			}
+			var err error
+			session.identities, err = readIdentities(*shellIdentity)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		interactive := term.IsTerminal(int(os.Stdin.Fd()))
+		passphrase, err := shellPassSource.resolve(true, *shellIdentity == "")
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil && session.identities == nil {
+			if !interactive {
+				usageAndExit("Passphrase of the session is required.")
+			}
+			passphrase, err = promptHidden("passphrase", true)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		session.passphrase = passphrase
+
+		runShell(os.Stdin, os.Stdout, session, interactive)
+		return
+	}
+
+	if promptCommand.Parsed() {
+
+		if *promptOut == "" {
+			usageAndExit("Encrypted file to write is required. Flag -out ")
+		}
+
+		mode, err := parseMode(*promptMode)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		err = promptToFile(*promptOut, []byte(*promptPassphrase), crypt.Options{Mode: mode, Armor: *promptArmor})
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		log.Println("output file: ", *promptOut)
+		return
+	}
+
+	if packCommand.Parsed() {
+
+		if *packOut == "" {
+			usageAndExit("Container file to write is required. Flag -out ")
+		}
+		if packCommand.NArg() == 0 {
+			usageAndExit("At least one name=path stream is required.")
+		}
+
+		passphrase, err := packPassSource.resolve(true, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if err := packPolicy.check(passphrase); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		mode, err := parseMode(*packMode)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		streams, err := readStreams(packCommand.Args())
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		res, err := crypt.EncryptContainer(*packOut, passphrase, streams, crypt.Options{Mode: mode, Armor: *packArmor, Overwrite: *packForce, Quiet: true})
+		if errors.Is(err, crypt.ErrOutputExists) {
+			log.Printf("%v, use -force to overwrite it", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		showGenerated(passphrase, res)
+		res.Secret.Destroy()
+		log.Println("output file: ", *packOut)
+		return
+	}
+
+	if extractCommand.Parsed() {
+
+		path := extractCommand.Arg(0)
+		if path == "" {
+			usageAndExit("Container file is required.")
+		}
+
+		passphrase, err := extractPassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			usageAndExit("Passphrase to decrypt the container is required.")
+		}
+
+		if *extractStreamName == "" {
+			err = listStreams(path, passphrase)
+		} else {
+			err = extractStream(path, passphrase, *extractStreamName, *extractOutput, *extractForce)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if archiveCommand.Parsed() {
+
+		if *archiveOut == "" {
+			usageAndExit("Archive file to write is required. Flag -out ")
+		}
+		if archiveCommand.NArg() != 1 {
+			usageAndExit("The directory to archive is required.")
+		}
+
+		passphrase, err := archivePassSource.resolve(true, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase to encrypt the archive is required.")
+			}
+			passphrase, err = promptHidden("passphrase", true)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		if err := archivePolicy.check(passphrase); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		mode, err := parseMode(*archiveMode)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		compressor, err := parseCompressor(*archiveCompress)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		cipher, err := parseCipher(*archiveCipher)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		kdf, err := parseKDF(*archiveScrypt, *archiveArgon2id, 0)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		symlinks, err := parseSymlinks(*archiveSymlinks)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		opts := crypt.Options{
+			Mode:       mode,
+			Compress:   compressor,
+			Cipher:     cipher,
+			KDF:        kdf,
+			Overwrite:  *archiveForce,
+			Include:    archiveInclude,
+			Exclude:    archiveExclude,
+			NoDotfiles: *archiveNoDotfiles,
+			Symlinks:   symlinks,
+			Manifest:   *archiveManifest,
+		}
+		bar := newProgressBar(os.Stderr, "archiving")
+		if *archiveProgress {
+			opts.Progress = bar.report()
+		}
+		err = crypt.EncryptArchiveWithOptions(archiveCommand.Arg(0), *archiveOut, passphrase, opts)
+		bar.finish()
+		if errors.Is(err, crypt.ErrOutputExists) {
+			log.Printf("%v, use -force to overwrite it", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		log.Println("output file: ", *archiveOut)
+		if *archiveManifest != "" {
+			log.Println("manifest: ", *archiveManifest)
+		}
+		return
+	}
+
+	if auditManifestCommand.Parsed() {
+
+		if *auditManifest == "" {
+			usageAndExit("Manifest to audit the archive against is required. Flag -manifest ")
+		}
+		path := auditManifestCommand.Arg(0)
+		if path == "" {
+			usageAndExit("Archive file is required.")
+		}
+
+		passphrase, err := auditManifestPassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			if path == crypt.Stdio || !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase of the archive is required.")
+			}
+			passphrase, err = promptHidden("passphrase", false)
+			if err != nil {
+				log.Println(err)
+				os.Exit(2)
+			}
+		}
+
+		report, err := crypt.Audit(path, *auditManifest, passphrase)
+		if err != nil {
+			log.Println(err)
+			os.Exit(2)
+		}
+		for _, name := range report.Missing {
+			fmt.Printf("missing: %s\n", name)
+		}
+		for _, name := range report.Altered {
+			fmt.Printf("altered: %s\n", name)
+		}
+		for _, name := range report.Extra {
+			fmt.Printf("extra: %s\n", name)
+		}
+		if !report.OK() {
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %d files match the manifest\n", path, report.Checked)
+		return
+	}
+
+	if unarchiveCommand.Parsed() {
+
+		if *unarchiveOutput == "" {
+			usageAndExit("Directory to restore the archive under is required. Flag -o ")
+		}
+		path := unarchiveCommand.Arg(0)
+		if path == "" {
+			usageAndExit("Archive file is required.")
+		}
+
+		passphrase, err := unarchivePassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			if path == crypt.Stdio || !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase to decrypt the archive is required.")
+			}
+			passphrase, err = promptHidden("passphrase", false)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		var opts crypt.Options
+		bar := newProgressBar(os.Stderr, "extracting")
+		if *unarchiveProgress {
+			opts.Progress = bar.report()
+		}
+		err = crypt.ExtractArchiveWithOptions(path, *unarchiveOutput, passphrase, opts)
+		bar.finish()
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		log.Println("restored under: ", *unarchiveOutput)
+		return
 	}
 
-	if len(os.Args) < 2 {
-		usageAndExit("")
+	if watchCommand.Parsed() {
+
+		if watchCommand.NArg() != 1 {
+			usageAndExit("The directory to watch is required.")
+		}
+		if *watchInterval <= 0 {
+			usageAndExit("-interval must be positive.")
+		}
+		if *watchJSON && !*watchDryRun {
+			usageAndExit("-json requires -n.")
+		}
+
+		mode, err := parseMode(*watchMode)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		compressor, err := parseCompressor(*watchCompress)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		cipher, err := parseCipher(*watchCipher)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		opts := crypt.Options{
+			Mode:          mode,
+			Compress:      compressor,
+			Cipher:        cipher,
+			ShredOriginal: *watchShred,
+			Include:       watchInclude,
+			Exclude:       watchExclude,
+		}
+
+		if *watchDryRun {
+			if err := planWatch(os.Stdout, watchCommand.Arg(0), opts, *watchJSON); err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		passphrase, err := watchPassSource.resolve(true, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase to encrypt the files is required.")
+			}
+			passphrase, err = promptHidden("passphrase", true)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+		if err := watchPolicy.check(passphrase); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+
+		err = watch(watchCommand.Arg(0), passphrase, *watchInterval, opts)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	switch os.Args[1] {
-	case "encrypt":
-		encryptCommand.Parse(os.Args[2:])
-	case "decrypt":
-		decryptCommand.Parse(os.Args[2:])
-	default:
-		usageAndExit("")
+	if mountCommand.Parsed() {
+
+		if mountCommand.NArg() != 2 {
+			usageAndExit("The encrypted directory and the mount point are required.")
+		}
+
+		passphrase, err := mountPassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if passphrase == nil && !*mountAudit {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				usageAndExit("Passphrase of the files is required.")
+			}
+			passphrase, err = promptHidden("passphrase", false)
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		if err := mount(mountCommand.Arg(0), mountCommand.Arg(1), passphrase, *mountAudit); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	if encryptCommand.Parsed() {
+	if serveCommand.Parsed() {
 
-		if *encFilepath == "" {
-			usageAndExit("Path to file to encrypt is required. Flag -f ")
+		if *serveSocket != "" && *serveAddr != "" {
+			usageAndExit("-socket and -addr can't be combined")
+		}
+		if *serveAddr != "" && !*serveAllowRemote && !loopbackAddr(*serveAddr) {
+			usageAndExit(*serveAddr + " isn't a loopback address, the API has no authentication so anyone reaching it could encrypt and decrypt with the passphrase, pass -allow-remote to listen on it anyway")
+		}
+		socket := *serveSocket
+		if socket == "" {
+			socket = defaultSocket()
+		}
+		passphrase, err := servePassSource.resolve(false, true)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		cipher, err := parseCipher(*serveCipher)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		kdf, err := parseKDF(*serveScrypt, *serveArgon2id, 0)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+
+		if err := serve(socket, *serveAddr, passphrase, cipher, kdf); err != nil {
+			log.Println(err)
+			os.Exit(1)
 		}
+		return
+	}
+
+	if passgenCommand.Parsed() {
 
-		_, output, err := crypt.Encrypt(*encFilepath, []byte(*encPassphrase))
+		gen, err := passgenGenerator.generator()
 		if err != nil {
+			usageAndExit(err.Error())
+		}
+		if *passgenCount < 1 {
+			usageAndExit("-n must be at least 1.")
+		}
+		if err := passgen(gen, *passgenCount, *passgenJSON); err != nil {
 			log.Println(err)
 			os.Exit(1)
 		}
-		log.Println("output file: ", output)
-		log.Println("finished ! ")
 		return
 	}
 
-	if *decPassphrase == "" {
-		usageAndExit("Passphrase to decrypt file is required.")
+	if keygenCommand.Parsed() {
+
+		err := keygen(*keygenOutput, *keygenForce, *keygenAge, *keygenSign)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if escrowCommand.Parsed() {
+
+		if escrowCommand.NArg() == 0 {
+			usageAndExit("One of create, split, status, assemble or combine is required.")
+		}
+
+		// flags may also follow the action
+		action := escrowCommand.Arg(0)
+		escrowCommand.Parse(escrowCommand.Args()[1:])
+
+		switch action {
+		case "create":
+			if err := escrowCreate(*escrowDir, *escrowShares, *escrowThreshold, *escrowForce); err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		case "split":
+			passphrase, err := escrowPassSource.resolve(true, true)
+			if err != nil {
+				usageAndExit(err.Error())
+			}
+			if passphrase == nil {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					usageAndExit("Passphrase to split is required.")
+				}
+				passphrase, err = promptHidden("passphrase", true)
+				if err != nil {
+					log.Println(err)
+					os.Exit(1)
+				}
+			}
+			if err := escrowSplit(passphrase, *escrowDir, *escrowShares, *escrowThreshold, *escrowForce); err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		case "status":
+			if escrowCommand.NArg() == 0 {
+				usageAndExit("At least one share file is required.")
+			}
+			ready, err := escrowStatus(escrowCommand.Args())
+			if err != nil {
+				log.Println(err)
+				os.Exit(2)
+			}
+			if !ready {
+				os.Exit(1)
+			}
+		case "assemble":
+			if escrowCommand.NArg() == 0 {
+				usageAndExit("The share files to assemble are required.")
+			}
+			if err := escrowAssemble(escrowCommand.Args(), *escrowOutput, *escrowForce); err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		case "combine":
+			if escrowCommand.NArg() == 0 {
+				usageAndExit("The share files to combine are required.")
+			}
+			if err := escrowCombine(escrowCommand.Args(), *escrowOutput, *escrowForce); err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+		default:
+			usageAndExit("Unknown escrow action " + action + ", expected create, split, status, assemble or combine.")
+		}
+		return
+	}
+
+	if completionCommand.Parsed() {
+
+		if completionCommand.NArg() != 1 {
+			usageAndExit("The shell to print the completion script for is required.")
+		}
+
+		err := printCompletion(os.Stdout, completionCommand.Arg(0))
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		return
+	}
+
+	if metaCommand.Parsed() {
+
+		err := printMeta(os.Stdout, commands, *metaJSON)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if specCommand.Parsed() {
+
+		err := printSpec(os.Stdout, *specJSON)
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if conformCommand.Parsed() {
+
+		if conformCommand.NArg() == 0 {
+			usageAndExit("At least one encrypted file is required.")
+		}
+
+		failed := false
+		for _, path := range conformCommand.Args() {
+			if err := crypt.Conform(path); err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: ok\n", path)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if infoCommand.Parsed() {
+
+		if infoCommand.NArg() == 0 {
+			usageAndExit("At least one encrypted file is required.")
+		}
+
+		if err := printInfo(os.Stdout, infoCommand.Args(), *infoJSON); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if execCommand.Parsed() {
+
+		if *execPassphrase == "" {
+			usageAndExit("Passphrase to decrypt files is required.")
+		}
+
+		if len(execFiles) == 0 || execCommand.NArg() == 0 {
+			usageAndExit("At least one -file and a command are required.")
+		}
+
+		code, err := execWithFiles(execFiles, []byte(*execPassphrase), execCommand.Args(), *execAllowDisk)
+		if err != nil {
+			log.Println(err)
+		}
+		os.Exit(code)
 	}
 
-	if *decFilepath == "" {
+	path := fileArg(decryptCommand, *decFilepath)
+	if path == "" {
 		usageAndExit("File to decrypt is required.")
 	}
 
-	_, _, err := crypt.Decrypt(*decFilepath, []byte(*decPassphrase))
+	if *decKeyFile != "" && (*decIdentity != "" || decPassSource.given()) {
+		usageAndExit("-key can't be used with a passphrase or -i")
+	}
+	usesProvider := *decVaultKey != "" || *decToken != ""
+	if usesProvider && (*decIdentity != "" || *decKeyFile != "" || decPassSource.given()) {
+		usageAndExit("-vault-key and -token can't be used with a passphrase, -i or -key")
+	}
+	if *decJSON && (path == crypt.Stdio || *decOutput == crypt.Stdio) {
+		usageAndExit("-json prints its report on stdout, it can't be used with standard input or output")
+	}
+	if *decResume != "" && (path == crypt.Stdio || *decOutput == crypt.Stdio || *decIdentity != "" || *decKeyFile != "" || usesProvider) {
+		usageAndExit("-resume decrypts a stream on disk with a passphrase, it can't be used with standard input or output, -i, -key, -vault-key or -token")
+	}
+	if *decSandbox && (*decIdentity != "" || *decKeyFile != "" || usesProvider || *decResume != "" || len(decSigners) > 0 || *decLockMemory || *decProgress || *decTrace || *decTraceJSON) {
+		usageAndExit("-sandbox decrypts with a passphrase, it can't be used with -i, -key, -vault-key, -token, -resume, -signer, -lock-memory, -progress, -trace or -trace-json")
+	}
+	signers, err := readSigners(decSigners)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	if len(signers) > 0 && *decResume != "" {
+		usageAndExit("-signer can't be used with -resume, streams aren't signed")
+	}
+
+	var identities []*crypt.Identity
+	if *decIdentity != "" {
+		if decPassSource.given() {
+			usageAndExit("-i can't be used with a passphrase")
+		}
+		var err error
+		identities, err = readIdentities(*decIdentity)
+		if err != nil {
+			log.Println(err)
+			failAndExit("decrypt", path, nil, err, *decJSON)
+		}
+	}
+
+	provider, err := keyProvider(*decVaultKey, *decToken)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+
+	passphrase, err := decPassSource.resolve(false, *decIdentity == "" && *decKeyFile == "" && provider == nil)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+	if passphrase == nil && identities == nil && *decKeyFile == "" && provider == nil && path != crypt.Stdio {
+		// files encrypted with -keyring unlock without asking
+		passphrase, err = lookupInKeyring(path)
+		if err == nil {
+			log.Println("using the passphrase stored in the keychain")
+		} else if !errors.Is(err, errNotInKeyring) {
+			log.Println(err)
+		}
+	}
+	if passphrase == nil && identities == nil && *decKeyFile == "" && provider == nil {
+		if !term.IsTerminal(int(os.Stdin.Fd())) || path == crypt.Stdio {
+			usageAndExit("Passphrase to decrypt file is required.")
+		}
+		passphrase, err = promptHidden("passphrase", false)
+		if err != nil {
+			log.Println(err)
+			failAndExit("decrypt", path, nil, err, *decJSON)
+		}
+	}
+
+	if *decSandbox {
+		mode, err := parseMode(*decMode)
+		if err != nil {
+			usageAndExit(err.Error())
+		}
+		report, err := decryptSandboxed(path, *decOutput, passphrase, *decForce, *decStrict, *decAllowLegacy, mode)
+		if err != nil {
+			log.Println(err)
+			failAndExit("decrypt", path, &crypt.Result{Output: report.Output}, err, *decJSON)
+		}
+		reportSandboxed(report, *decJSON)
+		log.Println("finished ! ")
+		return
+	}
+
+	if *decResume != "" {
+		output, err := decryptResumable(path, *decResume, passphrase, *decOutput, *decForce, *decMode, *decProgress)
+		res := &crypt.Result{Output: output}
+		if err != nil {
+			log.Println(err)
+			failAndExit("decrypt", path, res, err, *decJSON)
+		}
+		if *decJSON {
+			writeReport(os.Stdout, "decrypt", path, res, nil)
+		}
+		log.Println("finished ! ")
+		return
+	}
+
+	if path != crypt.Stdio {
+		if isAge, _ := crypt.IsAgeFile(path); isAge {
+			if *decKeyFile != "" || provider != nil {
+				usageAndExit("age files are decrypted with a passphrase or -i")
+			}
+			if len(signers) > 0 {
+				err := fmt.Errorf("%w, age files aren't signed", crypt.ErrUntrustedSigner)
+				log.Printf("%s: %v", path, err)
+				failAndExit("decrypt", path, nil, err, *decJSON)
+			}
+			output, err := decryptAge(path, passphrase, identities, *decOutput, *decForce, *decMode, *decProgress)
+			res := &crypt.Result{Output: output}
+			if err != nil {
+				log.Println(err)
+				failAndExit("decrypt", path, res, err, *decJSON)
+			}
+			if *decJSON {
+				writeReport(os.Stdout, "decrypt", path, res, nil)
+			}
+			log.Println("finished ! ")
+			return
+		}
+	}
+
+	target := *decOutput
+	if target == "" && path != crypt.Stdio {
+		if info, err := crypt.ReadFormat(path); err == nil {
+			target = "out" + info.Ext
+		}
+	}
+	err = checkOverwrite(target, *decForce)
+	if err != nil {
+		log.Println(err)
+		failAndExit("decrypt", path, &crypt.Result{Output: target}, err, *decJSON)
+	}
+
+	mode, err := parseMode(*decMode)
+	if err != nil {
+		usageAndExit(err.Error())
+	}
+
+	opts := crypt.Options{
+		Mode:        mode,
+		OutputPath:  *decOutput,
+		Strict:      *decStrict,
+		AllowLegacy: *decAllowLegacy,
+		NoMetadata:  *decNoMetadata,
+		KeyFile:     *decKeyFile,
+		LockMemory:  *decLockMemory,
+		Signers:     signers,
+		Logger:      traceLogger(os.Stderr, *decTrace, *decTraceJSON),
+	}
+	bar := newProgressBar(os.Stderr, "decrypting")
+	if *decProgress {
+		opts.Progress = bar.report()
+	}
+	var res *crypt.Result
+	if identities != nil {
+		res, err = crypt.DecryptWithIdentities(path, identities, opts)
+	} else if provider != nil {
+		res, err = crypt.DecryptWithKeyProvider(path, provider, opts)
+	} else {
+		res, err = crypt.DecryptWithOptions(path, passphrase, opts)
+	}
+	bar.finish()
 	if err != nil {
 		log.Println(err)
-		os.Exit(1)
+		failAndExit("decrypt", path, res, err, *decJSON)
+	}
+
+	if res.Signer != nil {
+		log.Println("signed by: ", res.Signer)
+	}
+	for _, w := range res.Warnings {
+		log.Printf("warning: %s", w)
+	}
+	if res.RotationDue(time.Now()) {
+		log.Printf("warning: passphrase is due for rotation, file was encrypted %s and should be rotated every %s", res.Created.Format("2006-01-02"), res.RotateAfter)
 	}
 
+	if *decJSON {
+		writeReport(os.Stdout, "decrypt", path, res, nil)
+	}
 	log.Println("finished ! ")
 	return
 }
@@ -107,3 +1958,138 @@ func usageAndExit(msg string) {
 	flag.Usage()
 	os.Exit(1)
 }
+
+// parses an octal permission flag, an empty value keeps the default
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m == 0 || m > 0777 {
+		return 0, fmt.Errorf("invalid -mode %q, expected octal permissions such as 0600", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// parses a size flag such as 512K, 25M or 1G, an empty value means unset
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes such as 25M", s)
+	}
+	return n * multiplier, nil
+}
+
+// parses the -scrypt N,r,p and -argon2id time,memory,threads flags, empty
+// means the defaults and an argon2id value of "default" its default costs
+func parseKDF(scrypt, argon2id string, target time.Duration) (crypt.KDFParams, error) {
+
+	switch {
+	case scrypt != "" && argon2id != "":
+		return crypt.KDFParams{}, errors.New("-scrypt and -argon2id can't be used together")
+	case target != 0 && (scrypt != "" || argon2id != "" && argon2id != "default"):
+		return crypt.KDFParams{}, errors.New("-kdf-time picks the costs itself, it can only be combined with -argon2id default")
+	case target != 0:
+		kdf := crypt.Scrypt
+		if argon2id != "" {
+			kdf = crypt.Argon2id
+		}
+		params, err := crypt.CalibrateKDF(kdf, target)
+		if err != nil {
+			return crypt.KDFParams{}, err
+		}
+		log.Printf("calibrated the key derivation: %s", kdfString(params))
+		return params, nil
+	case scrypt != "":
+		v, err := parseCosts(scrypt)
+		if err != nil {
+			return crypt.KDFParams{}, fmt.Errorf("invalid scrypt parameters %q, expected N,r,p such as 1048576,8,1", scrypt)
+		}
+		return crypt.KDFParams{KDF: crypt.Scrypt, N: v[0], R: v[1], P: v[2]}, nil
+	case argon2id == "default":
+		return crypt.KDFParams{KDF: crypt.Argon2id}, nil
+	case argon2id != "":
+		v, err := parseCosts(argon2id)
+		if err != nil {
+			return crypt.KDFParams{}, fmt.Errorf("invalid argon2id parameters %q, expected time,memory,threads such as 3,65536,4", argon2id)
+		}
+		return crypt.KDFParams{KDF: crypt.Argon2id, Time: v[0], Memory: v[1], Threads: v[2]}, nil
+	}
+	return crypt.KDFParams{}, nil
+}
+
+// parses three positive comma separated numbers
+func parseCosts(s string) ([3]int, error) {
+
+	var values [3]int
+	fields := strings.Split(s, ",")
+	if len(fields) != len(values) {
+		return values, errors.New("expected three values")
+	}
+	for i, f := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v <= 0 {
+			return values, errors.New("expected positive numbers")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// parses the -compress flag, the name of a registered compressor
+func parseCompressor(name string) (crypt.CompressorID, error) {
+
+	if name == "" {
+		return crypt.NoCompression, nil
+	}
+	for _, id := range crypt.Compressors() {
+		if c, err := crypt.LookupCompressor(id); err == nil && c.Name() == name {
+			return id, nil
+		}
+	}
+	return crypt.NoCompression, fmt.Errorf("unknown compressor %q, supported: %s", name, strings.Join(crypt.SupportedCompressors(), ", "))
+}
+
+// parses the -symlinks flag of archive
+func parseSymlinks(name string) (crypt.SymlinkPolicy, error) {
+
+	switch name {
+	case "", "preserve":
+		return crypt.PreserveSymlinks, nil
+	case "skip":
+		return crypt.SkipSymlinks, nil
+	case "follow":
+		return crypt.FollowSymlinks, nil
+	}
+	return 0, fmt.Errorf("unknown symlink policy %q, supported: preserve, skip, follow", name)
+}
+
+// parses the -cipher flag, the name of a registered cipher
+func parseCipher(name string) (crypt.CipherID, error) {
+
+	if name == "" {
+		return 0, nil
+	}
+	id, err := crypt.LookupCipherName(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown cipher %q, supported: %s", name, strings.Join(crypt.SupportedCiphers(), ", "))
+	}
+	return id, nil
+}
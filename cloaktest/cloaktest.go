@@ -0,0 +1,161 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cloaktest provides fakes and helpers for testing programs that
+// embed cloak, so their encryption flows can be tested quickly and without
+// touching anything outside of the test's temporary directory.
+//
+// FastOptions skips the cost of key derivation, Provider stands in for a
+// key management service behind a config.Provider, Keyring writes
+// identities to a temporary file and DeterministicRand makes salts, nonces
+// and generated passphrases repeat from run to run.
+package cloaktest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/cryptotest"
+
+	"github.com/drish/cloak/config"
+	"github.com/drish/cloak/crypt"
+)
+
+// FastKDF are the cheapest key derivation parameters cloak accepts. files
+// encrypted with them decrypt with a warning about weak parameters and
+// are refused by Options.Strict.
+var FastKDF = crypt.KDFParams{KDF: crypt.Scrypt, N: 2, R: 1, P: 1}
+
+// FastOptions returns Options deriving keys with FastKDF, so encrypting
+// takes microseconds instead of the default derivation's tenth of a
+// second. they must never be used outside of tests.
+func FastOptions() crypt.Options {
+	return crypt.Options{KDF: FastKDF, Quiet: true}
+}
+
+// DeterministicRand makes every source of cryptographic randomness, and so
+// the salts, nonces, keys and passphrases cloak generates, a deterministic
+// stream derived from seed until t ends. it affects the whole process, so
+// t and its ancestors can't be parallel.
+func DeterministicRand(t *testing.T, seed uint64) {
+	t.Helper()
+	cryptotest.SetGlobalRandom(t, seed)
+}
+
+// WriteFile writes data to name in a temporary directory removed when t
+// ends and returns its path.
+func WriteFile(t testing.TB, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("cloaktest: %v", err)
+	}
+	return path
+}
+
+// EncryptFile encrypts data as a file called name with passphrase and
+// FastOptions, returning the path of the encrypted file. it fails t on
+// errors.
+func EncryptFile(t testing.TB, name string, data, passphrase []byte) string {
+	t.Helper()
+
+	res, err := crypt.EncryptWithOptions(WriteFile(t, name, data), passphrase, FastOptions())
+	if err != nil {
+		t.Fatalf("cloaktest: encrypting %s: %v", name, err)
+	}
+	return res.Output
+}
+
+// Provider is a fake config.Provider, such as for a key management service
+// or keychain, that counts its calls and can be made to fail. its methods
+// are safe for concurrent use.
+type Provider struct {
+	mu         sync.Mutex
+	passphrase []byte
+	err        error
+	calls      int
+}
+
+var _ config.Provider = (*Provider)(nil)
+
+// NewProvider returns a Provider handing out passphrase, or reporting
+// config.ErrNoPassphrase when it is empty.
+func NewProvider(passphrase []byte) *Provider {
+	return &Provider{passphrase: passphrase}
+}
+
+// Passphrase returns the passphrase of p, or the error set by Fail.
+func (p *Provider) Passphrase() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.passphrase) == 0 {
+		return nil, config.ErrNoPassphrase
+	}
+	return append([]byte(nil), p.passphrase...), nil
+}
+
+// Fail makes later calls return err, such as a network error of the
+// service. a nil err makes them succeed again.
+func (p *Provider) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Calls returns how many times the passphrase was asked for.
+func (p *Provider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// Keyring is a set of identities written to a temporary identity file, in
+// the format of cloak keygen.
+type Keyring struct {
+	// path of the identity file, for cloak decrypt -i
+	Path string
+
+	Identities []*crypt.Identity
+	Recipients []*crypt.Recipient
+}
+
+// NewKeyring generates n identities and writes them to an identity file
+// in a temporary directory removed when t ends.
+func NewKeyring(t testing.TB, n int) *Keyring {
+	t.Helper()
+
+	k := &Keyring{}
+	var contents strings.Builder
+	for i := 0; i < n; i++ {
+		id, err := crypt.GenerateIdentity()
+		if err != nil {
+			t.Fatalf("cloaktest: %v", err)
+		}
+		k.Identities = append(k.Identities, id)
+		k.Recipients = append(k.Recipients, id.Recipient())
+		fmt.Fprintf(&contents, "# public key: %s\n%s\n", id.Recipient(), id)
+	}
+
+	k.Path = WriteFile(t, "key.txt", []byte(contents.String()))
+	return k
+}
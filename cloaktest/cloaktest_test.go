@@ -0,0 +1,111 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloaktest
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/drish/cloak/config"
+	"github.com/drish/cloak/crypt"
+)
+
+type settings struct {
+	Name string `json:"name"`
+}
+
+func TestEncryptFile(t *testing.T) {
+
+	path := EncryptFile(t, "notes.txt", []byte("fast"), []byte("pass"))
+
+	plain, err := crypt.Plaintext(path, []byte("pass"))
+	if err != nil || string(plain) != "fast" {
+		t.Fatalf("Plaintext = %q, %v", plain, err)
+	}
+	info, err := crypt.ReadFormat(path)
+	if err != nil || info.KDF != FastKDF {
+		t.Fatalf("encrypted with %+v, %v", info.KDF, err)
+	}
+}
+
+func TestDeterministicRand(t *testing.T) {
+
+	encrypt := func() []byte {
+		DeterministicRand(t, 42)
+		output := filepath.Join(t.TempDir(), "out.cloak")
+		opts := FastOptions()
+		opts.NoMetadata = true
+		res, err := crypt.EncryptData([]byte("same"), output, nil, opts)
+		if err != nil {
+			t.Fatalf("EncryptData: %v", err)
+		}
+		return res.Salt
+	}
+
+	if a, b := encrypt(), encrypt(); !bytes.Equal(a, b) {
+		t.Fatalf("salts %x and %x differ with the same seed", a, b)
+	}
+}
+
+func TestProvider(t *testing.T) {
+
+	path := EncryptFile(t, "app.json", []byte(`{"name": "cloak"}`), []byte("kms"))
+	p := NewProvider([]byte("kms"))
+
+	var s settings
+	if err := config.Load(path, &s, p); err != nil || s.Name != "cloak" {
+		t.Fatalf("Load = %+v, %v", s, err)
+	}
+
+	outage := errors.New("service unavailable")
+	p.Fail(outage)
+	if err := config.Load(path, &s, p); !errors.Is(err, outage) {
+		t.Fatalf("Load returned %v, expected the provider's error", err)
+	}
+	if p.Calls() != 2 {
+		t.Fatalf("provider asked %d times, expected 2", p.Calls())
+	}
+
+	if _, err := NewProvider(nil).Passphrase(); !errors.Is(err, config.ErrNoPassphrase) {
+		t.Fatalf("empty provider returned %v", err)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+
+	k := NewKeyring(t, 2)
+	path := WriteFile(t, "secret.txt", []byte("for two"))
+
+	res, err := crypt.EncryptToRecipients(path, k.Recipients[1:], crypt.Options{})
+	if err != nil {
+		t.Fatalf("EncryptToRecipients: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(k.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := crypt.ParseIdentities(b)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("ParseIdentities found %d identities, %v", len(ids), err)
+	}
+	plain, err := crypt.PlaintextWithIdentities(res.Output, ids)
+	if err != nil || string(plain) != "for two" {
+		t.Fatalf("PlaintextWithIdentities = %q, %v", plain, err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// commands whose arguments are encrypted files
+var encryptedArgs = map[string]bool{
+	"conform":   true,
+	"decrypt":   true,
+	"diff":      true,
+	"extract":   true,
+	"info":      true,
+	"migrate":   true,
+	"rekey":     true,
+	"unarchive": true,
+	"verify":    true,
+}
+
+// values offered for flags that take one of a few words, other flags
+// taking a value complete file names
+func flagValues(name string) []string {
+
+	switch name {
+	case "a":
+		var names []string
+		for n := range hashes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return names
+	case "compress":
+		return crypt.SupportedCompressors()
+	case "cipher":
+		return crypt.SupportedCiphers()
+	case "argon2id":
+		return []string{"default"}
+	}
+	return nil
+}
+
+var completionScripts = map[string]string{
+	"bash": `_cloak() {
+	local IFS=$'\n'
+	COMPREPLY=($(cloak __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+		compopt -o nospace
+	fi
+}
+complete -F _cloak cloak
+`,
+	"zsh": `#compdef cloak
+_cloak() {
+	local c
+	for c in "${(@f)$(cloak __complete "${words[@]:1:$((CURRENT-1))}" 2>/dev/null)}"; do
+		if [[ $c == */ ]]; then
+			compadd -S '' -- "$c"
+		elif [[ -n $c ]]; then
+			compadd -- "$c"
+		fi
+	done
+}
+compdef _cloak cloak
+`,
+	"fish": `function __cloak_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	cloak __complete $tokens[2..-1]
+end
+complete -c cloak -f -a '(__cloak_complete)'
+`,
+}
+
+// prints the completion script for shell
+func printCompletion(w io.Writer, shell string) error {
+
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+	}
+
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// prints the candidates for the last of words, the arguments typed after
+// cloak so far
+func complete(w io.Writer, commands []*flag.FlagSet, words []string) {
+
+	cur := ""
+	if len(words) > 0 {
+		cur = words[len(words)-1]
+	}
+
+	if len(words) <= 1 {
+		for _, cmd := range commands {
+			if strings.HasPrefix(cmd.Name(), cur) {
+				fmt.Fprintln(w, cmd.Name())
+			}
+		}
+		return
+	}
+
+	var cmd *flag.FlagSet
+	for _, c := range commands {
+		if c.Name() == words[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		return
+	}
+
+	if cmd.Name() == "completion" {
+		printMatches(w, []string{"bash", "fish", "zsh"}, cur)
+		return
+	}
+
+	// the value of the previous flag
+	if prev := words[len(words)-2]; len(words) > 2 && strings.HasPrefix(prev, "-") && !strings.Contains(prev, "=") {
+		if f := cmd.Lookup(strings.TrimLeft(prev, "-")); f != nil && !isBoolFlag(f) {
+			if values := flagValues(f.Name); values != nil {
+				printMatches(w, values, cur)
+			} else {
+				completeFiles(w, cur, nil)
+			}
+			return
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		var names []string
+		cmd.VisitAll(func(f *flag.Flag) {
+			names = append(names, "-"+f.Name)
+		})
+		printMatches(w, names, cur)
+		return
+	}
+
+	if encryptedArgs[cmd.Name()] {
+		completeFiles(w, cur, func(name string) bool {
+			return strings.HasSuffix(name, crypt.Extension)
+		})
+		return
+	}
+	completeFiles(w, cur, nil)
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func printMatches(w io.Writer, candidates []string, prefix string) {
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			fmt.Fprintln(w, c)
+		}
+	}
+}
+
+// lists the files and directories starting with prefix, directories end
+// with a slash and files are only listed when keep accepts them
+func completeFiles(w io.Writer, prefix string, keep func(string) bool) {
+
+	dir, base := filepath.Split(prefix)
+	list := dir
+	if list == "" {
+		list = "."
+	}
+
+	entries, err := ioutil.ReadDir(list)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Mode()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(list, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			fmt.Fprintln(w, dir+name+"/")
+		case keep == nil || keep(name):
+			fmt.Fprintln(w, dir+name)
+		}
+	}
+}
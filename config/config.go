@@ -0,0 +1,130 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package config loads configuration files encrypted with cloak and
+// unmarshals them into Go values, so services can keep their configs
+// encrypted at rest.
+//
+//	var cfg struct {
+//		DatabaseURL string `json:"database_url"`
+//	}
+//	err := config.Load("config", &cfg, config.Chain(config.Env("APP_PASSPHRASE"), kms))
+//
+// The format is picked from the extension of the original file, JSON is
+// supported out of the box and other formats such as YAML or TOML can be
+// added with RegisterFormat.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// Decoder unmarshals decrypted configuration data into v.
+type Decoder func(data []byte, v interface{}) error
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Decoder{}
+)
+
+// RegisterFormat makes a decoder available for files with the given
+// extension, such as ".yaml". Registering an extension twice replaces the
+// earlier decoder.
+func RegisterFormat(ext string, d Decoder) {
+	if d == nil {
+		panic("config: RegisterFormat decoder is nil")
+	}
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[normalizeExt(ext)] = d
+}
+
+func lookupFormat(ext string) (Decoder, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	d, ok := formats[normalizeExt(ext)]
+	if !ok {
+		return nil, fmt.Errorf("config: no decoder registered for %q files", ext)
+	}
+	return d, nil
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// Load decrypts the cloak encrypted file at path with the passphrase
+// supplied by p and unmarshals it into v using the decoder registered for
+// the original file's extension.
+func Load(path string, v interface{}, p Provider) error {
+
+	if p == nil {
+		return errors.New("config: no passphrase provider")
+	}
+
+	passphrase, err := p.Passphrase()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	data, ext, err := crypt.PlaintextExt(path, passphrase)
+	if err != nil {
+		return fmt.Errorf("config: decrypting %s: %w", path, err)
+	}
+
+	return unmarshal(ext, data, v)
+}
+
+// LoadFormat is like Load but ignores the stored extension and decodes
+// the file with the decoder registered for ext.
+func LoadFormat(path, ext string, v interface{}, p Provider) error {
+
+	if p == nil {
+		return errors.New("config: no passphrase provider")
+	}
+
+	passphrase, err := p.Passphrase()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	data, err := crypt.Plaintext(path, passphrase)
+	if err != nil {
+		return fmt.Errorf("config: decrypting %s: %w", path, err)
+	}
+
+	return unmarshal(ext, data, v)
+}
+
+func unmarshal(ext string, data []byte, v interface{}) error {
+
+	d, err := lookupFormat(ext)
+	if err != nil {
+		return err
+	}
+
+	if err := d(data, v); err != nil {
+		return fmt.Errorf("config: decoding %s: %w", ext, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/drish/cloak/crypt"
+)
+
+var passphrase = []byte("grace")
+
+type settings struct {
+	Name  string `json:"name"`
+	Port  int    `json:"port"`
+	Debug bool   `json:"debug"`
+}
+
+// writes contents to name in a temporary directory and encrypts it
+func encrypted(t *testing.T, name, contents string) string {
+
+	dir, err := ioutil.TempDir("", "cloak-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	filename := filepath.Join(dir, name)
+	ioutil.WriteFile(filename, []byte(contents), 0644)
+
+	res, err := crypt.Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	return res.Output
+}
+
+func TestLoadJSON(t *testing.T) {
+
+	path := encrypted(t, "app.json", `{"name": "cloak", "port": 8080, "debug": true}`)
+
+	var s settings
+	if err := Load(path, &s, Static(passphrase)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if s != (settings{"cloak", 8080, true}) {
+		t.Fatalf("unexpected settings %+v", s)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+
+	path := encrypted(t, "app.conf", "name=cloak\nport=9000\n")
+
+	var s settings
+	if err := Load(path, &s, Static(passphrase)); err == nil {
+		t.Fatalf("expected an error for an unregistered format")
+	}
+
+	RegisterFormat("conf", func(data []byte, v interface{}) error {
+		s := v.(*settings)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			kv := strings.SplitN(line, "=", 2)
+			switch kv[0] {
+			case "name":
+				s.Name = kv[1]
+			case "port":
+				s.Port, _ = strconv.Atoi(kv[1])
+			}
+		}
+		return nil
+	})
+
+	if err := Load(path, &s, Static(passphrase)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if s.Name != "cloak" || s.Port != 9000 {
+		t.Fatalf("unexpected settings %+v", s)
+	}
+
+	// the stored extension can be overridden
+	json := encrypted(t, "app.txt", `{"name": "override"}`)
+	if err := LoadFormat(json, "json", &s, Static(passphrase)); err != nil {
+		t.Fatalf("LoadFormat: %v", err)
+	}
+	if s.Name != "override" {
+		t.Fatalf("unexpected settings %+v", s)
+	}
+}
+
+func TestLoadWrongPassphrase(t *testing.T) {
+
+	path := encrypted(t, "app.json", `{"name": "cloak"}`)
+
+	var s settings
+	if err := Load(path, &s, Static([]byte("wrong"))); err == nil {
+		t.Fatalf("expected an error with a wrong passphrase")
+	}
+}
+
+func TestChain(t *testing.T) {
+
+	os.Unsetenv("CLOAK_CONFIG_TEST")
+
+	dir, _ := ioutil.TempDir("", "cloak-config")
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	ioutil.WriteFile(secret, []byte("from-file\n"), 0600)
+
+	env := Env("CLOAK_CONFIG_TEST")
+	missing := File(filepath.Join(dir, "missing"))
+
+	got, err := Chain(env, missing, File(secret), Static([]byte("static"))).Passphrase()
+	if err != nil || string(got) != "from-file" {
+		t.Fatalf("Chain = %q, %v, want from-file", got, err)
+	}
+
+	os.Setenv("CLOAK_CONFIG_TEST", "from-env")
+	defer os.Unsetenv("CLOAK_CONFIG_TEST")
+
+	got, err = Chain(env, File(secret)).Passphrase()
+	if err != nil || string(got) != "from-env" {
+		t.Fatalf("Chain = %q, %v, want from-env", got, err)
+	}
+
+	if _, err := Chain(missing).Passphrase(); !errors.Is(err, ErrNoPassphrase) {
+		t.Fatalf("expected ErrNoPassphrase, got %v", err)
+	}
+
+	// real errors stop the chain
+	failing := ProviderFunc(func() ([]byte, error) { return nil, errors.New("agent unreachable") })
+	if _, err := Chain(failing, Static([]byte("static"))).Passphrase(); err == nil || errors.Is(err, ErrNoPassphrase) {
+		t.Fatalf("expected the provider error, got %v", err)
+	}
+}
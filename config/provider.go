@@ -0,0 +1,106 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrNoPassphrase is returned by a Provider that has no passphrase to
+// offer, Chain moves on to the next provider when it sees it.
+var ErrNoPassphrase = errors.New("no passphrase available")
+
+// Provider supplies the passphrase of an encrypted configuration file.
+// Agents, key management services and keychains plug in by implementing
+// it, or with ProviderFunc.
+type Provider interface {
+	Passphrase() ([]byte, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func() ([]byte, error)
+
+// Passphrase calls f.
+func (f ProviderFunc) Passphrase() ([]byte, error) {
+	return f()
+}
+
+// Env returns a Provider reading the passphrase from the environment
+// variable name.
+func Env(name string) Provider {
+	return ProviderFunc(func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return nil, ErrNoPassphrase
+		}
+		return []byte(v), nil
+	})
+}
+
+// Static returns a Provider that always returns passphrase.
+func Static(passphrase []byte) Provider {
+	return ProviderFunc(func() ([]byte, error) {
+		if len(passphrase) == 0 {
+			return nil, ErrNoPassphrase
+		}
+		return passphrase, nil
+	})
+}
+
+// Chain returns a Provider asking each of providers in turn and returning
+// the first passphrase found. Errors other than ErrNoPassphrase stop the
+// chain.
+func Chain(providers ...Provider) Provider {
+	return ProviderFunc(func() ([]byte, error) {
+		for _, p := range providers {
+			passphrase, err := p.Passphrase()
+			if errors.Is(err, ErrNoPassphrase) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return passphrase, nil
+		}
+		return nil, fmt.Errorf("%w from %d providers", ErrNoPassphrase, len(providers))
+	})
+}
+
+// trims the trailing newline files and secret managers tend to add
+func trimPassphrase(b []byte) []byte {
+	return []byte(strings.TrimRight(string(b), "\r\n"))
+}
+
+// File returns a Provider reading the passphrase from the file at path,
+// such as a mounted secret. A missing file yields ErrNoPassphrase.
+func File(path string) Provider {
+	return ProviderFunc(func() ([]byte, error) {
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, ErrNoPassphrase
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = trimPassphrase(b)
+		if len(b) == 0 {
+			return nil, ErrNoPassphrase
+		}
+		return b, nil
+	})
+}
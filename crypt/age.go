@@ -0,0 +1,737 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// files in the age v1 format of age-encryption.org/v1, so files can be
+// exchanged with age and its other implementations:
+//
+//	age-encryption.org/v1
+//	-> X25519 <ephemeral share>
+//	<file key wrapped for the recipient>
+//	--- <hmac-sha256 of the header>
+//	<16 byte nonce><payload sealed in chunks of 64 KiB>
+//
+// all binary fields of the header are base64 without padding, stanza
+// bodies wrapped at 64 columns. the payload is sealed with
+// chacha20-poly1305 and a key derived from the file key and nonce, each
+// chunk with a 11 byte big endian counter followed by 1 for the last
+// chunk, 0 otherwise, as its nonce. SSH recipients get the ssh-ed25519
+// and ssh-rsa stanzas of age, so age decrypts them with the SSH key.
+const (
+	ageMagic       = "age-encryption.org/v1"
+	ageFooter      = "---"
+	ageFileKeySize = 16
+	ageChunkSize   = 64 << 10
+	ageColumns     = 64
+
+	ageX25519Label     = "age-encryption.org/v1/X25519"
+	ageScryptLabel     = "age-encryption.org/v1/scrypt"
+	ageSSHEd25519Label = "age-encryption.org/v1/ssh-ed25519"
+	ageSSHRSALabel     = "age-encryption.org/v1/ssh-rsa"
+
+	// age's default work factor for passphrases, and the largest it
+	// accepts when decrypting so a file can't make it derive for hours
+	ageDefaultLogN = 18
+	ageMaxLogN     = 22
+
+	ageRecipientHRP = "age"
+	ageIdentityHRP  = "AGE-SECRET-KEY-"
+)
+
+var ageBase64 = base64.RawStdEncoding.Strict()
+
+// ErrNotAge is returned when a file opened as an age file doesn't start
+// with the age v1 header.
+var ErrNotAge = errors.New("not an age v1 file")
+
+// a recipient stanza of an age header
+type ageStanza struct {
+	kind string
+	args []string
+	body []byte
+}
+
+// IsAge reports whether b, the start of a file, begins with the age v1
+// header line.
+func IsAge(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(ageMagic+"\n"))
+}
+
+// IsAgeFile reports whether the file at path is in the age v1 format.
+func IsAgeFile(path string) (bool, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	b := make([]byte, len(ageMagic)+1)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return false, nil
+	}
+	return IsAge(b), nil
+}
+
+// EncryptAge encrypts the file at path in the age v1 format to out, for
+// the age recipients given as X25519 recipients, or with passphrase when
+// there are none, as age files with a passphrase can have no other
+// recipient. path and out may be Stdio. out is only replaced with
+// opts.Overwrite and is created with opts.Mode when set. the scrypt work
+// factor is opts.KDF.N when set, which must be a power of two with R 8 and
+// P 1, age's default of 2^18 otherwise. the other options are ignored.
+func EncryptAge(path, out string, passphrase []byte, recipients []*Recipient, opts Options) error {
+
+	var r io.Reader = stdin
+	if path != Stdio {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	r = withProgress(r, opts.Progress)
+
+	if out == Stdio {
+		return EncryptAgeStream(r, stdout, passphrase, recipients, opts)
+	}
+	if !opts.Overwrite {
+		if _, err := os.Lstat(out); err == nil {
+			return fmt.Errorf("%w: %s", ErrOutputExists, out)
+		}
+	}
+	return writeFileWith(out, defaultEncryptedMode, opts.Mode, func(w io.Writer) error {
+		return EncryptAgeStream(r, w, passphrase, recipients, opts)
+	})
+}
+
+// EncryptAgeStream is like EncryptAge but reads the plaintext from r and
+// writes the age file to w.
+func EncryptAgeStream(r io.Reader, w io.Writer, passphrase []byte, recipients []*Recipient, opts Options) error {
+
+	if len(passphrase) > 0 && len(recipients) > 0 {
+		return errors.New("age files with a passphrase can't have other recipients")
+	}
+	if len(passphrase) == 0 && len(recipients) == 0 {
+		return errors.New("a passphrase or recipients are required")
+	}
+
+	fileKey, err := random(ageFileKeySize)
+	if err != nil {
+		return err
+	}
+	defer wipe(fileKey)
+
+	var stanzas []ageStanza
+	if len(passphrase) > 0 {
+		logN, err := ageWorkFactor(opts.KDF)
+		if err != nil {
+			return err
+		}
+		s, err := ageWrapScrypt(fileKey, passphrase, logN)
+		if err != nil {
+			return err
+		}
+		stanzas = append(stanzas, s)
+		opts.trace("wrapped the age file key with scrypt", "logN", logN)
+	}
+	for _, rcpt := range recipients {
+		wrap := ageWrapX25519
+		if rcpt.ssh != nil {
+			wrap = ageWrapSSH
+		}
+		s, err := wrap(fileKey, rcpt)
+		if err != nil {
+			return err
+		}
+		stanzas = append(stanzas, s)
+	}
+	opts.trace("wrapped the age file key", "recipients", len(recipients))
+
+	header, err := marshalAgeHeader(fileKey, stanzas)
+	if err != nil {
+		return err
+	}
+	nonce, err := random(16)
+	if err != nil {
+		return err
+	}
+	aead, err := agePayloadAEAD(fileKey, nonce)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header)
+	bw.Write(nonce)
+
+	// a chunk is only known to be the last once the next read is empty
+	buf := make([]byte, ageChunkSize)
+	next := make([]byte, ageChunkSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	var counter uint64
+	for {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		m := 0
+		if n == ageChunkSize {
+			m, err = io.ReadFull(r, next)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+		last := m == 0
+		if _, err := bw.Write(aead.Seal(nil, ageNonce(counter, last), buf[:n], nil)); err != nil {
+			return err
+		}
+		if last {
+			break
+		}
+		counter++
+		buf, next, n = next, buf, m
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	opts.log(slog.LevelInfo, "encrypted an age file", "chunks", counter+1)
+
+	return nil
+}
+
+// DecryptAge decrypts the age v1 file at path to out with the passphrase
+// of a scrypt stanza or the first identity matching an X25519 stanza.
+// path and out may be Stdio. the plaintext is written to a temporary file
+// renamed to out once the whole file was authenticated, only standard
+// output can receive chunks of a file that turns out to be truncated or
+// modified. out is only replaced with opts.Overwrite and is created with
+// opts.Mode when set, 0600 otherwise.
+func DecryptAge(path, out string, passphrase []byte, identities []*Identity, opts Options) error {
+
+	var r io.Reader = stdin
+	if path != Stdio {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	r = withProgress(r, opts.Progress)
+
+	if out == Stdio {
+		return DecryptAgeStream(r, stdout, passphrase, identities, opts)
+	}
+	if !opts.Overwrite {
+		if _, err := os.Lstat(out); err == nil {
+			return fmt.Errorf("%w: %s", ErrOutputExists, out)
+		}
+	}
+	return writeFileWith(out, 0600, opts.Mode, func(w io.Writer) error {
+		return DecryptAgeStream(r, w, passphrase, identities, opts)
+	})
+}
+
+// DecryptAgeStream is like DecryptAge but reads the age file from r and
+// writes the plaintext to w. like DecryptStream, what was written to w
+// before an error must be discarded.
+func DecryptAgeStream(r io.Reader, w io.Writer, passphrase []byte, identities []*Identity, opts Options) error {
+
+	br := bufio.NewReader(r)
+	stanzas, header, mac, err := parseAgeHeader(br)
+	if err != nil {
+		return err
+	}
+	opts.trace("parsed the age header", "stanzas", len(stanzas))
+
+	fileKey, err := ageUnwrap(stanzas, passphrase, identities)
+	if err != nil {
+		return err
+	}
+	defer wipe(fileKey)
+
+	if !hmac.Equal(ageHeaderMAC(fileKey, header), mac) {
+		return ErrHeaderModified
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return ErrTruncated
+	}
+	aead, err := agePayloadAEAD(fileKey, nonce)
+	if err != nil {
+		return err
+	}
+
+	sealedSize := ageChunkSize + aead.Overhead()
+	buf := make([]byte, sealedSize)
+	var counter uint64
+	for {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if n < aead.Overhead() {
+			return ErrTruncated
+		}
+		last := n < sealedSize
+		if !last {
+			// a full chunk is the last one when nothing follows
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+
+		plain, err := aead.Open(nil, ageNonce(counter, last), buf[:n], nil)
+		if err != nil {
+			if !last {
+				return corrupt("unable to decrypt chunk, the file was modified or truncated")
+			}
+			return corrupt("unable to decrypt the last chunk, the file was modified or truncated")
+		}
+		if last && len(plain) == 0 && counter > 0 {
+			return malformed("empty last chunk")
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			break
+		}
+		counter++
+	}
+	opts.log(slog.LevelInfo, "decrypted an age file", "chunks", counter+1)
+
+	return nil
+}
+
+// the log2 of the scrypt cost of params, which age restricts to r 8 and
+// p 1
+func ageWorkFactor(params KDFParams) (int, error) {
+
+	if params.KDF == 0 && params.N == 0 {
+		return ageDefaultLogN, nil
+	}
+	if params.KDF != Scrypt {
+		return 0, fmt.Errorf("age files can only be encrypted with %s", Scrypt)
+	}
+	if params.N < 2 || params.N&(params.N-1) != 0 || (params.R != 0 && params.R != 8) || (params.P != 0 && params.P != 1) {
+		return 0, errors.New("age files need a power of two scrypt N with r 8 and p 1")
+	}
+	return bits.TrailingZeros(uint(params.N)), nil
+}
+
+func ageWrapScrypt(fileKey, passphrase []byte, logN int) (ageStanza, error) {
+
+	salt, err := random(16)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	key, err := scrypt.Key(passphrase, append([]byte(ageScryptLabel), salt...), 1<<uint(logN), 8, 1, 32)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	defer wipe(key)
+
+	body, err := ageSealKey(key, fileKey)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{kind: "scrypt", args: []string{ageBase64.EncodeToString(salt), strconv.Itoa(logN)}, body: body}, nil
+}
+
+func ageWrapX25519(fileKey []byte, r *Recipient) (ageStanza, error) {
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	shared, err := ephemeral.ECDH(r.key)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	share := ephemeral.PublicKey().Bytes()
+	key, err := hkdf.Key(sha256.New, shared, append(append([]byte(nil), share...), r.key.Bytes()...), ageX25519Label, 32)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	defer wipe(key)
+
+	body, err := ageSealKey(key, fileKey)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{kind: "X25519", args: []string{ageBase64.EncodeToString(share)}, body: body}, nil
+}
+
+// wraps the file key for an SSH recipient in the ssh-ed25519 or ssh-rsa
+// stanza of age, whose first argument is the tag of the key
+func ageWrapSSH(fileKey []byte, r *Recipient) (ageStanza, error) {
+
+	k := r.ssh
+	tag := ageBase64.EncodeToString(k.tag())
+	if k.rsa != nil {
+		body, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, k.rsa, fileKey, []byte(ageSSHRSALabel))
+		if err != nil {
+			return ageStanza{}, err
+		}
+		return ageStanza{kind: sshRSA, args: []string{tag}, body: body}, nil
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	shared, err := sshEd25519Shared(ephemeral, k.x25519, k, ageSSHEd25519Label)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	share := ephemeral.PublicKey().Bytes()
+	key, err := hkdf.Key(sha256.New, shared, append(append([]byte(nil), share...), k.x25519.Bytes()...), ageSSHEd25519Label, 32)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	defer wipe(key)
+
+	body, err := ageSealKey(key, fileKey)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{kind: sshEd25519, args: []string{tag, ageBase64.EncodeToString(share)}, body: body}, nil
+}
+
+// unwraps the file key from the scrypt stanza with passphrase, or from
+// the first X25519, ssh-ed25519 or ssh-rsa stanza one of identities
+// matches
+func ageUnwrap(stanzas []ageStanza, passphrase []byte, identities []*Identity) ([]byte, error) {
+
+	for _, s := range stanzas {
+		if s.kind == "scrypt" && len(stanzas) != 1 {
+			return nil, malformed("scrypt stanza isn't the only stanza")
+		}
+	}
+
+	for _, s := range stanzas {
+		switch s.kind {
+		case "scrypt":
+			if len(passphrase) == 0 {
+				return nil, errors.New("file is encrypted with a passphrase")
+			}
+			if len(s.args) != 2 {
+				return nil, malformed("invalid scrypt stanza")
+			}
+			salt, err := ageBase64.DecodeString(s.args[0])
+			if err != nil || len(salt) != 16 {
+				return nil, malformed("invalid scrypt salt")
+			}
+			logN, err := strconv.Atoi(s.args[1])
+			if err != nil || logN <= 0 || strconv.Itoa(logN) != s.args[1] {
+				return nil, malformed("invalid scrypt work factor")
+			}
+			if logN > ageMaxLogN {
+				return nil, fmt.Errorf("%w: scrypt work factor 2^%d is above the maximum of 2^%d", ErrWeakParams, logN, ageMaxLogN)
+			}
+			key, err := scrypt.Key(passphrase, append([]byte(ageScryptLabel), salt...), 1<<uint(logN), 8, 1, 32)
+			if err != nil {
+				return nil, err
+			}
+			defer wipe(key)
+			fileKey, err := ageOpenKey(key, s.body)
+			if err != nil {
+				return nil, ErrWrongPassphrase
+			}
+			return fileKey, nil
+
+		case "X25519":
+			if len(s.args) != 1 {
+				return nil, malformed("invalid X25519 stanza")
+			}
+			share, err := ageBase64.DecodeString(s.args[0])
+			if err != nil || len(share) != x25519KeySize {
+				return nil, malformed("invalid X25519 share")
+			}
+			pub, err := ecdh.X25519().NewPublicKey(share)
+			if err != nil {
+				return nil, malformed("invalid X25519 share")
+			}
+			for _, id := range identities {
+				if id.ssh != nil {
+					continue
+				}
+				shared, err := id.key.ECDH(pub)
+				if err != nil {
+					continue
+				}
+				salt := append(append([]byte(nil), share...), id.key.PublicKey().Bytes()...)
+				key, err := hkdf.Key(sha256.New, shared, salt, ageX25519Label, 32)
+				if err != nil {
+					return nil, err
+				}
+				fileKey, err := ageOpenKey(key, s.body)
+				wipe(key)
+				if err == nil {
+					return fileKey, nil
+				}
+			}
+
+		case sshEd25519, sshRSA:
+			args := 1
+			if s.kind == sshEd25519 {
+				args = 2
+			}
+			if len(s.args) != args {
+				return nil, malformed("invalid " + s.kind + " stanza")
+			}
+			tag, err := ageBase64.DecodeString(s.args[0])
+			if err != nil || len(tag) != sshTagSize {
+				return nil, malformed("invalid " + s.kind + " tag")
+			}
+			for _, id := range identities {
+				if id.ssh == nil || !bytes.Equal(tag, id.ssh.pub.tag()) {
+					continue
+				}
+				if fileKey, err := ageUnwrapSSH(s, id.ssh); err == nil {
+					return fileKey, nil
+				}
+			}
+		}
+	}
+
+	if len(passphrase) > 0 {
+		return nil, errors.New("file is encrypted to recipients, decrypt it with an identity")
+	}
+	return nil, ErrNoIdentity
+}
+
+// unwraps the file key of an age ssh-ed25519 or ssh-rsa stanza whose tag
+// matches k
+func ageUnwrapSSH(s ageStanza, k *sshIdentity) ([]byte, error) {
+
+	if s.kind == sshRSA {
+		if k.rsa == nil {
+			return nil, ErrNoIdentity
+		}
+		return rsa.DecryptOAEP(sha256.New(), nil, k.rsa, s.body, []byte(ageSSHRSALabel))
+	}
+
+	if k.x25519 == nil {
+		return nil, ErrNoIdentity
+	}
+	share, err := ageBase64.DecodeString(s.args[1])
+	if err != nil || len(share) != x25519KeySize {
+		return nil, malformed("invalid ssh-ed25519 share")
+	}
+	pub, err := ecdh.X25519().NewPublicKey(share)
+	if err != nil {
+		return nil, malformed("invalid ssh-ed25519 share")
+	}
+	shared, err := sshEd25519Shared(k.x25519, pub, k.pub, ageSSHEd25519Label)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, shared, append(append([]byte(nil), share...), k.pub.x25519.Bytes()...), ageSSHEd25519Label, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	return ageOpenKey(key, s.body)
+}
+
+// seals the file key with a key used once, hence the zero nonce
+func ageSealKey(key, fileKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil), nil
+}
+
+func ageOpenKey(key, body []byte) ([]byte, error) {
+	if len(body) != ageFileKeySize+chacha20poly1305.Overhead {
+		return nil, malformed("invalid wrapped file key")
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), body, nil)
+}
+
+// the payload is sealed with a key of its own for every file
+func agePayloadAEAD(fileKey, nonce []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, nonce, "payload", 32)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+func ageNonce(counter uint64, last bool) []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	for i := 10; i >= 3; i-- {
+		n[i] = byte(counter)
+		counter >>= 8
+	}
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+// the mac of the header up to and including the --- of the footer
+func ageHeaderMAC(fileKey, header []byte) []byte {
+	key, err := hkdf.Key(sha256.New, fileKey, nil, "header", 32)
+	if err != nil {
+		return nil
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(header)
+	return h.Sum(nil)
+}
+
+func marshalAgeHeader(fileKey []byte, stanzas []ageStanza) ([]byte, error) {
+
+	var b bytes.Buffer
+	b.WriteString(ageMagic + "\n")
+	for _, s := range stanzas {
+		b.WriteString("-> " + s.kind)
+		for _, a := range s.args {
+			b.WriteString(" " + a)
+		}
+		b.WriteByte('\n')
+		body := ageBase64.EncodeToString(s.body)
+		// the last line is always shorter than a full one, even empty
+		for len(body) >= ageColumns {
+			b.WriteString(body[:ageColumns] + "\n")
+			body = body[ageColumns:]
+		}
+		b.WriteString(body + "\n")
+	}
+	b.WriteString(ageFooter)
+
+	mac := ageHeaderMAC(fileKey, b.Bytes())
+	if mac == nil {
+		return nil, errors.New("unable to authenticate the age header")
+	}
+	b.WriteString(" " + ageBase64.EncodeToString(mac) + "\n")
+	return b.Bytes(), nil
+}
+
+// reads the header from r and returns its stanzas, the bytes its mac
+// covers and the mac
+func parseAgeHeader(r *bufio.Reader) ([]ageStanza, []byte, []byte, error) {
+
+	var header bytes.Buffer
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return "", ErrTruncated
+		}
+		if err != nil {
+			return "", err
+		}
+		header.WriteString(line)
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	magic, err := readLine()
+	if err == ErrTruncated || (err == nil && magic != ageMagic) {
+		return nil, nil, nil, ErrNotAge
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var stanzas []ageStanza
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if strings.HasPrefix(line, ageFooter+" ") {
+			mac, err := ageBase64.DecodeString(line[len(ageFooter)+1:])
+			if err != nil || len(mac) != sha256.Size {
+				return nil, nil, nil, malformed("invalid header mac")
+			}
+			if len(stanzas) == 0 {
+				return nil, nil, nil, malformed("no recipients")
+			}
+			covered := header.Bytes()[:header.Len()-len(line)-1+len(ageFooter)]
+			return stanzas, covered, mac, nil
+		}
+
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, nil, nil, malformed("invalid stanza line")
+		}
+		args := strings.Split(line[3:], " ")
+		for _, a := range args {
+			if a == "" || strings.IndexFunc(a, func(c rune) bool { return c < 33 || c > 126 }) >= 0 {
+				return nil, nil, nil, malformed("invalid stanza argument")
+			}
+		}
+		s := ageStanza{kind: args[0], args: args[1:]}
+
+		var body strings.Builder
+		for {
+			l, err := readLine()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if len(l) > ageColumns {
+				return nil, nil, nil, malformed("stanza body line too long")
+			}
+			body.WriteString(l)
+			if len(l) < ageColumns {
+				break
+			}
+		}
+		s.body, err = ageBase64.DecodeString(body.String())
+		if err != nil {
+			return nil, nil, nil, malformed("invalid stanza body")
+		}
+		stanzas = append(stanzas, s)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// cheap enough for tests, age requires r 8 and p 1
+var ageTestKDF = KDFParams{KDF: Scrypt, N: 1 << 10, R: 8, P: 1}
+
+func TestAge(t *testing.T) {
+
+	id, _ := GenerateIdentity()
+	other, _ := GenerateIdentity()
+
+	for _, size := range []int{0, 1, ageChunkSize - 1, ageChunkSize, ageChunkSize + 1, 2*ageChunkSize + 100} {
+		plain := bytes.Repeat([]byte{'a'}, size)
+
+		var enc bytes.Buffer
+		if err := EncryptAgeStream(bytes.NewReader(plain), &enc, nil, []*Recipient{other.Recipient(), id.Recipient()}, Options{}); err != nil {
+			t.Fatalf("EncryptAgeStream %d bytes: %v", size, err)
+		}
+		if !IsAge(enc.Bytes()) {
+			t.Fatalf("expected the age header")
+		}
+		var dec bytes.Buffer
+		if err := DecryptAgeStream(bytes.NewReader(enc.Bytes()), &dec, nil, []*Identity{id}, Options{}); err != nil {
+			t.Fatalf("DecryptAgeStream %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(dec.Bytes(), plain) {
+			t.Fatalf("unexpected plaintext of %d bytes", dec.Len())
+		}
+
+		// dropping the last chunk is noticed, even on a chunk boundary
+		if size > ageChunkSize {
+			cut := enc.Len() - (size%ageChunkSize + 16)
+			if err := DecryptAgeStream(bytes.NewReader(enc.Bytes()[:cut]), &bytes.Buffer{}, nil, []*Identity{id}, Options{}); err == nil {
+				t.Fatalf("expected an error for a truncated file of %d bytes", size)
+			}
+		}
+	}
+
+	var enc bytes.Buffer
+	if err := EncryptAgeStream(strings.NewReader(data), &enc, passphrase, nil, Options{KDF: ageTestKDF}); err != nil {
+		t.Fatalf("EncryptAgeStream with a passphrase: %v", err)
+	}
+	if !strings.Contains(enc.String(), "\n-> scrypt ") || !strings.Contains(enc.String(), " 10\n") {
+		t.Fatalf("expected a scrypt stanza with work factor 10:\n%s", enc.String())
+	}
+	var dec bytes.Buffer
+	if err := DecryptAgeStream(bytes.NewReader(enc.Bytes()), &dec, passphrase, nil, Options{}); err != nil || dec.String() != data {
+		t.Fatalf("DecryptAgeStream with a passphrase: %q, %v", dec.String(), err)
+	}
+	if err := DecryptAgeStream(bytes.NewReader(enc.Bytes()), &bytes.Buffer{}, []byte("wrong"), nil, Options{}); err == nil {
+		t.Fatalf("expected an error with a wrong passphrase")
+	}
+
+	// the header mac covers the stanzas
+	modified := bytes.Replace(enc.Bytes(), []byte(" 10\n"), []byte(" 11\n"), 1)
+	if err := DecryptAgeStream(bytes.NewReader(modified), &bytes.Buffer{}, passphrase, nil, Options{}); err == nil {
+		t.Fatalf("expected an error for a modified header")
+	}
+
+	if err := EncryptAgeStream(strings.NewReader(data), &bytes.Buffer{}, passphrase, []*Recipient{id.Recipient()}, Options{KDF: ageTestKDF}); err == nil {
+		t.Fatalf("expected an error mixing a passphrase and recipients")
+	}
+	if err := EncryptAgeStream(strings.NewReader(data), &bytes.Buffer{}, passphrase, nil, Options{KDF: KDFParams{KDF: Scrypt, N: 1000, R: 8, P: 1}}); err == nil {
+		t.Fatalf("expected an error for an N that isn't a power of two")
+	}
+	if err := DecryptAgeStream(strings.NewReader(data), &bytes.Buffer{}, passphrase, nil, Options{}); err != ErrNotAge {
+		t.Fatalf("expected ErrNotAge, got %v", err)
+	}
+}
+
+func TestAgeKeys(t *testing.T) {
+
+	// the X25519 identity of age's test kit
+	kit, err := ParseIdentity("AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX")
+	if err != nil {
+		t.Fatalf("ParseIdentity: %v", err)
+	}
+	if got := kit.Recipient().AgeString(); got != "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj" {
+		t.Fatalf("unexpected recipient %s", got)
+	}
+
+	id, _ := GenerateIdentity()
+
+	s := id.AgeString()
+	if !strings.HasPrefix(s, "AGE-SECRET-KEY-1") {
+		t.Fatalf("unexpected identity encoding %s", s)
+	}
+	parsed, err := ParseIdentity(s)
+	if err != nil || parsed.String() != id.String() {
+		t.Fatalf("ParseIdentity(%s): %v", s, err)
+	}
+
+	r := id.Recipient().AgeString()
+	if !strings.HasPrefix(r, "age1") {
+		t.Fatalf("unexpected recipient encoding %s", r)
+	}
+	rcpt, err := ParseRecipient(r)
+	if err != nil || rcpt.String() != id.Recipient().String() {
+		t.Fatalf("ParseRecipient(%s): %v", r, err)
+	}
+
+	swapped := "q"
+	if strings.HasSuffix(r, swapped) {
+		swapped = "p"
+	}
+	if _, err := ParseRecipient(r[:len(r)-1] + swapped); err == nil {
+		t.Fatalf("expected an error for a bad checksum")
+	}
+	if _, err := ParseRecipient(id.AgeString()); err == nil {
+		t.Fatalf("expected an error parsing an identity as a recipient")
+	}
+}
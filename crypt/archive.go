@@ -0,0 +1,357 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// an archive is a stream, as written by EncryptStream, whose plaintext is
+// a tar archive of a directory tree, optionally gzip compressed. the
+// archive holds directories, regular files and symlinks, other files are
+// skipped.
+
+// EncryptArchive writes the tree under dir to a tar archive and encrypts
+// it as a stream to out, so a whole project is shared as one file without
+// ever being held in memory. ExtractArchive restores it.
+func EncryptArchive(dir, out string, passphrase []byte) error {
+	return EncryptArchiveWithOptions(dir, out, passphrase, Options{})
+}
+
+// EncryptArchiveWithOptions is like EncryptArchive but compresses the tar
+// archive with opts.Compress, which can only be Gzip, and seals it with
+// opts.Cipher like EncryptStreamWithOptions. out is only replaced with
+// opts.Overwrite and is created with opts.Mode when set. opts.Include,
+// opts.Exclude and opts.NoDotfiles select what is archived, and
+// opts.Symlinks whether links are kept, left out or followed. with
+// opts.Manifest a Manifest of the archived files is written once the
+// archive is. the other options are ignored.
+func EncryptArchiveWithOptions(dir, out string, passphrase []byte, opts Options) error {
+
+	if opts.Compress != NoCompression && opts.Compress != Gzip {
+		return fmt.Errorf("archives can only be compressed with %s", compressorName(Gzip))
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if inside(dir, out) {
+		return errors.New("the archive can't be written inside the directory it archives")
+	}
+	if !opts.Overwrite {
+		for _, name := range []string{out, opts.Manifest} {
+			if _, err := os.Lstat(name); name != "" && err == nil {
+				return fmt.Errorf("%w: %s", ErrOutputExists, name)
+			}
+		}
+	}
+	if opts.Manifest != "" && len(passphrase) == 0 {
+		return errors.New("a passphrase is required to sign a manifest")
+	}
+
+	var m *Manifest
+	if opts.Manifest != "" {
+		m = &Manifest{}
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, dir, opts, m))
+	}()
+
+	err = writeFileWith(out, defaultEncryptedMode, opts.Mode, func(w io.Writer) error {
+		return EncryptStreamWithOptions(pr, w, passphrase, opts)
+	})
+	// unblocks the archive writer when sealing failed
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+	opts.log(slog.LevelInfo, "archived", "dir", dir, "output", out)
+
+	if m != nil {
+		if err := WriteManifest(opts.Manifest, m, passphrase); err != nil {
+			return err
+		}
+		opts.log(slog.LevelInfo, "wrote manifest", "files", len(m.Entries), "output", opts.Manifest)
+	}
+
+	return nil
+}
+
+// reports whether path is dir or below it
+func inside(dir, path string) bool {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writes the tree under dir to w as a tar archive, compressed when
+// opts.Compress is set, listing the regular files archived in m unless it
+// is nil
+func writeTar(w io.Writer, dir string, opts Options, m *Manifest) error {
+
+	var zw *gzip.Writer
+	if opts.Compress == Gzip {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+
+	err := walkTree(dir, opts, func(e treeEntry) error {
+
+		var link string
+		switch {
+		case e.fi.Mode()&os.ModeSymlink != 0:
+			var err error
+			link, err = os.Readlink(e.path)
+			if err != nil {
+				return err
+			}
+		case !e.fi.IsDir() && !e.fi.Mode().IsRegular():
+			opts.trace("skipped, not a regular file", "path", e.rel, "mode", e.fi.Mode())
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(e.fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.rel
+		if e.fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if e.fi.Mode().IsRegular() {
+			f, err := os.Open(e.path)
+			if err != nil {
+				return err
+			}
+			var dst io.Writer = tw
+			h, _ := blake2b.New256(nil)
+			if m != nil {
+				dst = io.MultiWriter(tw, h)
+			}
+			size, err := io.Copy(dst, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			if m != nil {
+				m.Entries = append(m.Entries, ManifestEntry{Path: e.rel, Size: size, Hash: h.Sum(nil)})
+			}
+		}
+		opts.trace("archived", "path", hdr.Name, "bytes", hdr.Size)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
+
+// ExtractArchive decrypts an archive written by EncryptArchive and
+// restores its tree under dir, creating dir when it doesn't exist. entries
+// can't escape dir: absolute names, .. elements and paths through symlinks
+// are refused, and existing files are never replaced. like DecryptStream,
+// files written before an error must be discarded.
+func ExtractArchive(path, dir string, passphrase []byte) error {
+	return ExtractArchiveWithOptions(path, dir, passphrase, Options{})
+}
+
+// ExtractArchiveWithOptions is like ExtractArchive but reports the
+// encrypted bytes read to opts.Progress. path may be Stdio to read
+// standard input. the other options are ignored.
+func ExtractArchiveWithOptions(path, dir string, passphrase []byte, opts Options) error {
+
+	return readArchive(path, passphrase, opts, func() error {
+		return os.MkdirAll(dir, 0777)
+	}, func(hdr *tar.Header, r io.Reader) error {
+		return extractEntry(r, hdr, dir, opts)
+	})
+}
+
+// decrypts the archive at path and calls entry with each of its entries,
+// once start returned when the passphrase opened it
+func readArchive(path string, passphrase []byte, opts Options, start func() error, entry func(*tar.Header, io.Reader) error) error {
+
+	var r io.Reader = stdin
+	if path != Stdio {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dr, err := DecryptReader(withProgress(r, opts.Progress), passphrase)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(dr)
+	r = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		opts.trace("archive is gzip compressed")
+		r = zr
+	}
+
+	if err := start(); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		if err := entry(hdr, tr); err != nil {
+			return err
+		}
+	}
+
+	// the end of the tar archive isn't the end of the stream, reading
+	// the rest authenticates the last chunk
+	_, err = io.Copy(ioutil.Discard, br)
+	return err
+}
+
+// writes the tar entry hdr under dir
+func extractEntry(r io.Reader, hdr *tar.Header, dir string, opts Options) error {
+
+	target, err := archiveTarget(dir, hdr.Name)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		err = os.Mkdir(target, mode|0700)
+		if os.IsExist(err) {
+			if fi, statErr := os.Lstat(target); statErr == nil && fi.IsDir() {
+				err = nil
+			}
+		}
+
+	case tar.TypeReg:
+		var f *os.File
+		f, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+
+	case tar.TypeSymlink:
+		// links are restored as they were but never followed while
+		// extracting, archiveTarget refuses paths through them
+		err = os.Symlink(hdr.Linkname, target)
+
+	default:
+		opts.trace("skipped, unsupported entry", "path", hdr.Name, "type", hdr.Typeflag)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	opts.trace("extracted", "path", hdr.Name, "bytes", hdr.Size)
+	return nil
+}
+
+// the path the archive entry name is extracted to under dir, creating the
+// directories leading to it
+func archiveTarget(dir, name string) (string, error) {
+
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", malformed(fmt.Sprintf("archive entry %q escapes the directory", name))
+	}
+
+	// a symlink extracted earlier could point anywhere
+	parent := dir
+	elems := strings.Split(filepath.Dir(clean), string(filepath.Separator))
+	for _, elem := range elems {
+		if elem == "." {
+			break
+		}
+		parent = filepath.Join(parent, elem)
+		fi, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !fi.IsDir() {
+			return "", malformed(fmt.Sprintf("archive entry %q goes through %s, which isn't a directory", name, parent))
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(clean)), 0777); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, clean), nil
+}
@@ -0,0 +1,196 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-archive")
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "project")
+	os.MkdirAll(filepath.Join(src, "docs", "empty"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "main.go"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, "docs", "notes.txt"), []byte("notes"), 0600)
+	os.Symlink("docs/notes.txt", filepath.Join(src, "notes"))
+
+	for _, compressor := range []CompressorID{NoCompression, Gzip} {
+		out := filepath.Join(dir, "project.cloak")
+		if err := EncryptArchiveWithOptions(src, out, passphrase, Options{Compress: compressor, Overwrite: true}); err != nil {
+			t.Fatalf("EncryptArchiveWithOptions %d: %v", compressor, err)
+		}
+
+		restored := filepath.Join(dir, "restored")
+		os.RemoveAll(restored)
+		if err := ExtractArchive(out, restored, passphrase); err != nil {
+			t.Fatalf("ExtractArchive %d: %v", compressor, err)
+		}
+
+		if b, _ := ioutil.ReadFile(filepath.Join(restored, "main.go")); string(b) != data {
+			t.Fatalf("main.go restored as %q", b)
+		}
+		fi, err := os.Stat(filepath.Join(restored, "docs", "notes.txt"))
+		if err != nil || fi.Mode().Perm() != 0600 {
+			t.Fatalf("docs/notes.txt restored with %v: %v", fi, err)
+		}
+		if fi, err := os.Stat(filepath.Join(restored, "docs", "empty")); err != nil || !fi.IsDir() {
+			t.Fatalf("empty directory wasn't restored: %v", err)
+		}
+		if link, _ := os.Readlink(filepath.Join(restored, "notes")); link != "docs/notes.txt" {
+			t.Fatalf("symlink restored as %q", link)
+		}
+
+		// existing files are never replaced
+		if err := ExtractArchive(out, restored, passphrase); !os.IsExist(err) {
+			t.Fatalf("expected an error extracting over existing files, got %v", err)
+		}
+	}
+
+	out := filepath.Join(dir, "project.cloak")
+	if err := EncryptArchive(src, out, passphrase); !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("expected ErrOutputExists, got %v", err)
+	}
+	if err := EncryptArchive(src, filepath.Join(src, "inside.cloak"), passphrase); err == nil {
+		t.Fatalf("expected an error writing the archive inside its directory")
+	}
+	if err := ExtractArchive(out, filepath.Join(dir, "wrong"), []byte("wrong")); err == nil {
+		t.Fatalf("expected an error with a wrong passphrase")
+	}
+}
+
+func TestArchiveEscapes(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-archive")
+	defer os.RemoveAll(dir)
+
+	entries := map[string][]*tar.Header{
+		"parent":   {{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}},
+		"absolute": {{Name: "/tmp/evil", Typeflag: tar.TypeReg, Mode: 0644}},
+		"symlink": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: dir},
+			{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+	}
+
+	for name, headers := range entries {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		for _, hdr := range headers {
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+
+		out := filepath.Join(dir, name+".cloak")
+		f, _ := os.Create(out)
+		if err := EncryptStream(&archive, f, passphrase); err != nil {
+			t.Fatalf("EncryptStream: %v", err)
+		}
+		f.Close()
+
+		err := ExtractArchive(out, filepath.Join(dir, name), passphrase)
+		if !errors.Is(err, ErrMalformed) {
+			t.Fatalf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Fatalf("an entry escaped the directory")
+	}
+}
+
+func TestArchiveFilters(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-archive")
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "project")
+	outside := filepath.Join(dir, "outside")
+	os.MkdirAll(filepath.Join(src, "docs"), 0755)
+	os.MkdirAll(filepath.Join(src, "build", "cache"), 0755)
+	os.MkdirAll(filepath.Join(src, ".git"), 0755)
+	os.MkdirAll(outside, 0755)
+	ioutil.WriteFile(filepath.Join(src, "main.go"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, "debug.log"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, ".env"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, ".git", "HEAD"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, "docs", "notes.md"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, "build", "cache", "main.go"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte(data), 0644)
+	os.Symlink(outside, filepath.Join(src, "linked"))
+
+	archived := func(opts Options) map[string]bool {
+		out := filepath.Join(dir, "project.cloak")
+		restored := filepath.Join(dir, "restored")
+		os.RemoveAll(restored)
+		opts.Overwrite = true
+		if err := EncryptArchiveWithOptions(src, out, passphrase, opts); err != nil {
+			t.Fatalf("EncryptArchiveWithOptions %+v: %v", opts, err)
+		}
+		if err := ExtractArchive(out, restored, passphrase); err != nil {
+			t.Fatalf("ExtractArchive: %v", err)
+		}
+		names := make(map[string]bool)
+		filepath.Walk(restored, func(path string, fi os.FileInfo, err error) error {
+			rel, _ := filepath.Rel(restored, path)
+			if rel != "." {
+				names[filepath.ToSlash(rel)] = true
+			}
+			return nil
+		})
+		return names
+	}
+
+	names := archived(Options{Exclude: []string{"*.log", "build/cache"}, NoDotfiles: true, Symlinks: SkipSymlinks})
+	for _, name := range []string{"main.go", "docs/notes.md", "build"} {
+		if !names[name] {
+			t.Fatalf("%s wasn't archived, got %v", name, names)
+		}
+	}
+	for _, name := range []string{"debug.log", ".env", ".git", "build/cache", "linked"} {
+		if names[name] {
+			t.Fatalf("%s was archived", name)
+		}
+	}
+
+	// directories are only archived for the files included under them
+	names = archived(Options{Include: []string{"*.go"}, Exclude: []string{"build"}})
+	if len(names) != 1 || !names["main.go"] {
+		t.Fatalf("expected only main.go archived, got %v", names)
+	}
+	names = archived(Options{Include: []string{"docs/*"}})
+	if len(names) != 2 || !names["docs/notes.md"] {
+		t.Fatalf("expected only docs/notes.md archived, got %v", names)
+	}
+
+	names = archived(Options{Symlinks: FollowSymlinks})
+	if fi, err := os.Lstat(filepath.Join(dir, "restored", "linked")); err != nil || !fi.IsDir() || !names["linked/secret.txt"] {
+		t.Fatalf("expected the linked directory archived as a directory, got %v, %v", fi, err)
+	}
+
+	os.Symlink("..", filepath.Join(src, "docs", "loop"))
+	if err := EncryptArchiveWithOptions(src, filepath.Join(dir, "loop.cloak"), passphrase, Options{Symlinks: FollowSymlinks}); err == nil {
+		t.Fatalf("expected an error following a link to a parent")
+	}
+	if err := EncryptArchiveWithOptions(src, filepath.Join(dir, "bad.cloak"), passphrase, Options{Exclude: []string{"["}}); err == nil {
+		t.Fatalf("expected an error with a malformed pattern")
+	}
+}
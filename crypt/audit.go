@@ -0,0 +1,218 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// kinds of random values recorded in encrypted files
+const (
+	RandomSalt         = "salt"
+	RandomNonce        = "nonce"
+	RandomEphemeralKey = "ephemeral key"
+)
+
+// Randomness holds the random values of an encrypted file that are
+// readable without the passphrase, keyed by their kind.
+type Randomness map[string][][]byte
+
+// Reuse is a random value found more than once, in one or more files.
+// with values this long it means the random number generator repeated
+// itself, such as in a cloned virtual machine, and the files should be
+// encrypted again.
+type Reuse struct {
+	Kind  string
+	Value []byte
+	Paths []string
+}
+
+// ReadRandomness returns the salts, nonces and ephemeral keys of the
+// encrypted file at path, it doesn't need the passphrase. the nonces of
+// chunks and sealed trailers aren't included, only the ones the other
+// nonces of the file are derived from or stored next to.
+func ReadRandomness(path string) (Randomness, error) {
+
+	file, release, _, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	file, _, err = unwrapSigned(file)
+	if err != nil {
+		return nil, err
+	}
+	file, err = unwrapPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Randomness{}
+	add := func(kind string, v []byte) {
+		r[kind] = append(r[kind], append([]byte(nil), v...))
+	}
+
+	switch {
+	case isStream(file):
+		if len(file) < streamHeaderSize {
+			return nil, ErrTruncated
+		}
+		if _, err := parseStreamHeader(file[:streamHeaderSize]); err != nil {
+			return nil, err
+		}
+		header := file[len(streamMagic)+1 : streamHeaderSize]
+		add(RandomSalt, header[:32])
+		add(RandomNonce, header[32+4:])
+
+	case isBinary(file):
+		if err := binaryRandomness(file, add); err != nil {
+			return nil, err
+		}
+
+	default:
+		if !looksEncrypted(file) {
+			return nil, ErrNotEncrypted
+		}
+		lines := strings.Split(string(file), "\n")
+		salt, _ := hex.DecodeString(lines[1])
+		add(RandomSalt, salt)
+		// the data and checksum lines both start with a secretbox nonce
+		for _, i := range []int{0, 3} {
+			if i >= len(lines) {
+				break
+			}
+			sealed, err := hex.DecodeString(lines[i])
+			if err != nil || len(sealed) < 24 {
+				return nil, malformed("ciphertext is too short")
+			}
+			add(RandomNonce, sealed[:24])
+		}
+	}
+
+	return r, nil
+}
+
+// reads the random values of a binary file, the salt or wrapped keys of
+// its header and the nonces of its metadata and data
+func binaryRandomness(file []byte, add func(string, []byte)) error {
+
+	h, err := parseBinaryHeader(file)
+	if err != nil {
+		return err
+	}
+	c, err := LookupCipher(h.cipher)
+	if err != nil {
+		return err
+	}
+	sizes, err := c.New(make([]byte, c.KeySize()))
+	if err != nil {
+		return err
+	}
+	nonceSize := sizes.NonceSize()
+
+	if h.version == formatRecipients {
+		for _, s := range h.stanzas {
+			switch {
+			case s.kind == stanzaPassphrase && len(s.body) >= passphraseStanzaSize+nonceSize:
+				add(RandomSalt, s.body[passphraseSaltOffset:passphraseStanzaSize])
+				add(RandomNonce, s.body[passphraseStanzaSize:passphraseStanzaSize+nonceSize])
+			case s.kind == stanzaX25519 && len(s.body) >= x25519KeySize+nonceSize:
+				add(RandomEphemeralKey, s.body[:x25519KeySize])
+				add(RandomNonce, s.body[x25519KeySize:x25519KeySize+nonceSize])
+			case s.kind == stanzaSSHEd25519 && len(s.body) >= sshTagSize+x25519KeySize+nonceSize:
+				add(RandomEphemeralKey, s.body[sshTagSize:sshTagSize+x25519KeySize])
+				add(RandomNonce, s.body[sshTagSize+x25519KeySize:sshTagSize+x25519KeySize+nonceSize])
+			case s.kind == stanzaProvider || s.kind == stanzaSSHRSA:
+				// wrapped by the provider, or padded by RSA-OAEP, which
+				// chose their own randomness
+			default:
+				return malformed("invalid recipient stanza")
+			}
+		}
+	} else {
+		add(RandomSalt, h.salt)
+	}
+
+	rest := file[len(h.raw):]
+	if len(rest) < 4+nonceSize {
+		return ErrTruncated
+	}
+	metaLen := uint64(binary.BigEndian.Uint32(rest))
+	add(RandomNonce, rest[4:4+nonceSize])
+
+	if uint64(len(rest)) < 4+metaLen+uint64(nonceSize) {
+		return ErrTruncated
+	}
+	add(RandomNonce, rest[4+metaLen:4+metaLen+uint64(nonceSize)])
+
+	return nil
+}
+
+// FindReuse returns the random values that appear more than once in
+// files, which maps each path to what ReadRandomness returned for it.
+// the result is sorted by kind and then by the first path.
+func FindReuse(files map[string]Randomness) []Reuse {
+
+	type key struct {
+		kind  string
+		value string
+	}
+	seen := make(map[key][]string)
+	for path, r := range files {
+		for kind, values := range r {
+			for _, v := range values {
+				k := key{kind, string(v)}
+				seen[k] = append(seen[k], path)
+			}
+		}
+	}
+
+	var reused []Reuse
+	for k, paths := range seen {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		reused = append(reused, Reuse{Kind: k.kind, Value: []byte(k.value), Paths: dedupe(paths)})
+	}
+	sort.Slice(reused, func(i, j int) bool {
+		a, b := reused[i], reused[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Paths[0] != b.Paths[0] {
+			return a.Paths[0] < b.Paths[0]
+		}
+		return bytes.Compare(a.Value, b.Value) < 0
+	})
+
+	return reused
+}
+
+// removes repeats from sorted paths
+func dedupe(paths []string) []string {
+	out := paths[:1]
+	for _, p := range paths[1:] {
+		if p != out[len(out)-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRandomness(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-audit")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "audit.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	armored, err := EncryptData([]byte(data), filepath.Join(dir, "armored.cloak"), passphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	plain, err := EncryptData([]byte(data), filepath.Join(dir, "binary.cloak"), passphrase, Options{})
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+
+	var stream bytes.Buffer
+	if err := EncryptStream(bytes.NewReader([]byte(data)), &stream, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	streamed := filepath.Join(dir, "stream.cloak")
+	ioutil.WriteFile(streamed, stream.Bytes(), 0600)
+
+	id, _ := GenerateIdentity()
+	multi, err := EncryptMulti(filename, [][]byte{passphrase}, []*Recipient{id.Recipient()}, Options{})
+	if err != nil {
+		t.Fatalf("EncryptMulti: %v", err)
+	}
+
+	// salts, nonces and ephemeral keys each file should hold
+	want := map[string][3]int{
+		armored.Output: {1, 2, 0},
+		plain.Output:   {1, 2, 0},
+		streamed:       {1, 1, 0},
+		multi.Output:   {1, 4, 1},
+	}
+
+	files := make(map[string]Randomness)
+	for path, counts := range want {
+		r, err := ReadRandomness(path)
+		if err != nil {
+			t.Fatalf("ReadRandomness %s: %v", path, err)
+		}
+		got := [3]int{len(r[RandomSalt]), len(r[RandomNonce]), len(r[RandomEphemeralKey])}
+		if got != counts {
+			t.Fatalf("%s: expected %v random values, got %v", path, counts, got)
+		}
+		files[path] = r
+	}
+
+	if reused := FindReuse(files); len(reused) != 0 {
+		t.Fatalf("expected no reuse, got %+v", reused)
+	}
+
+	if _, err := ReadRandomness(filename); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestFindReuse(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-audit")
+	defer os.RemoveAll(dir)
+
+	res, err := EncryptData([]byte(data), filepath.Join(dir, "a.cloak"), passphrase, Options{})
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	other, err := EncryptData([]byte(data), filepath.Join(dir, "b.cloak"), passphrase, Options{})
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+
+	// a copy has the same salt and nonces, as if the generator repeated
+	sealed, _ := ioutil.ReadFile(res.Output)
+	clone := filepath.Join(dir, "c.cloak")
+	ioutil.WriteFile(clone, sealed, 0600)
+
+	files := make(map[string]Randomness)
+	for _, path := range []string{res.Output, other.Output, clone} {
+		r, err := ReadRandomness(path)
+		if err != nil {
+			t.Fatalf("ReadRandomness %s: %v", path, err)
+		}
+		files[path] = r
+	}
+
+	reused := FindReuse(files)
+	if len(reused) != 3 {
+		t.Fatalf("expected a salt and two nonces reused, got %+v", reused)
+	}
+	for _, r := range reused {
+		if len(r.Paths) != 2 || r.Paths[0] != res.Output || r.Paths[1] != clone {
+			t.Fatalf("unexpected paths %v for %s", r.Paths, r.Kind)
+		}
+	}
+	if reused[0].Kind != RandomNonce || reused[2].Kind != RandomSalt || !bytes.Equal(reused[2].Value, files[clone][RandomSalt][0]) {
+		t.Fatalf("unexpected reuse %+v", reused)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BatchResult is the outcome of encrypting one of the files given to
+// EncryptMany.
+type BatchResult struct {
+	Path   string
+	Result *Result
+	Err    error
+}
+
+// EncryptMany encrypts paths concurrently with at most workers goroutines
+// and returns one BatchResult per path, in the order of paths. a file that
+// fails doesn't stop the others. workers below 1 means one per CPU.
+func EncryptMany(paths []string, passphrase []byte, workers int) []BatchResult {
+	return EncryptManyWithOptions(paths, passphrase, workers, Options{})
+}
+
+// EncryptManyWithOptions is like EncryptMany but configured with opts,
+// opts.OutputPath is ignored so every file is written next to its
+// original.
+func EncryptManyWithOptions(paths []string, passphrase []byte, workers int, opts Options) []BatchResult {
+
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	opts.OutputPath = ""
+
+	results := make([]BatchResult, len(paths))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res, err := EncryptWithOptions(paths[i], passphrase, opts)
+				results[i] = BatchResult{Path: paths[i], Result: res, Err: err}
+			}
+		}()
+	}
+
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,66 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptMany(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-batch")
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for i := 0; i < 10; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+		ioutil.WriteFile(p, []byte(fmt.Sprintf("%s %d", data, i)), 0644)
+		paths = append(paths, p)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	paths = append(paths[:5], append([]string{missing}, paths[5:]...)...)
+
+	results := EncryptMany(paths, passphrase, 3)
+	if len(results) != len(paths) {
+		t.Fatalf("got %d results for %d paths", len(results), len(paths))
+	}
+
+	for i, r := range results {
+		if r.Path != paths[i] {
+			t.Fatalf("result %d is for %s, want %s", i, r.Path, paths[i])
+		}
+		if r.Path == missing {
+			if r.Err == nil {
+				t.Fatalf("expected an error for %s", missing)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatalf("EncryptMany %s: %v", r.Path, r.Err)
+		}
+		want, _ := ioutil.ReadFile(r.Path)
+		plain, err := Plaintext(r.Result.Output, passphrase)
+		if err != nil || string(plain) != string(want) {
+			t.Fatalf("%s didn't decrypt to its original: %v", r.Result.Output, err)
+		}
+	}
+
+	if results := EncryptMany(nil, passphrase, 0); len(results) != 0 {
+		t.Fatalf("expected no results for no paths")
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// the binary layout written by Encrypt:
+// header = magic (8 bytes) + version byte + cipher id byte + kdf id byte
+// + big endian scrypt N, r and p or argon2id time, memory and threads
+// (4 bytes each) + big endian size of the sealed plaintext (8 bytes) +
+// salt (32 bytes) + extension length byte + extension
+// metadata = big endian length (4 bytes) + nonce + sealed sha256 of the
+// header, blake2b checksum of the plaintext, rotation metadata and
+// optional records, each a tag byte, a length byte and the value
+// data = nonce + sealed plaintext, up to the end of the file
+//
+// the records hold the mode, modification time, owner and attributes of
+// the original, the compressor id byte followed by the big endian size of
+// the plaintext before compression (8 bytes) and the labels of the file
+//
+// the header is readable without the passphrase so truncation is reported
+// before key derivation, the sealed hash of the header authenticates it.
+const (
+	binaryMagic     = "CLOAKBIN"
+	binaryFixedSize = len(binaryMagic) + 3 + 12 + 8 + 32 + 1
+	binaryMetaSize  = sha256.Size + blake2b.Size + rotationSize
+
+	// longest run of records sealed after the fixed metadata
+	maxRecordsSize = 255
+
+	recordFileMeta    = 1
+	recordCompression = 2
+	recordLabels      = 3
+)
+
+// the part of a binary file readable without the passphrase
+type binaryHeader struct {
+	// formatBinary, or formatRecipients for files with wrapped keys
+	version   byte
+	cipher    CipherID
+	kdf       KDFParams
+	plainSize uint64
+	salt      []byte
+	ext       []byte
+
+	// wrapped file keys of formatRecipients files
+	stanzas []stanza
+
+	// metadata of the original, sealed with the checksum rather than
+	// readable. nil when it wasn't recorded
+	meta *fileMeta
+
+	// compressor of the sealed plaintext and its size before compression,
+	// sealed like meta
+	compressor CompressorID
+	origSize   uint64
+
+	// labels of the file, sealed like meta
+	labels map[string]string
+
+	// encoded header, hashed into the sealed metadata
+	raw []byte
+}
+
+func (h *binaryHeader) marshal() []byte {
+	if h.version == formatRecipients {
+		return h.marshalRecipients()
+	}
+
+	b := make([]byte, 0, binaryFixedSize+len(h.ext))
+	b = append(b, binaryMagic...)
+	b = append(b, formatBinary, byte(h.cipher), byte(h.kdf.KDF))
+	for _, v := range h.kdf.costs() {
+		b = binary.BigEndian.AppendUint32(b, uint32(v))
+	}
+	b = binary.BigEndian.AppendUint64(b, h.plainSize)
+	b = append(b, h.salt...)
+	b = append(b, byte(len(h.ext)))
+	return append(b, h.ext...)
+}
+
+// reports whether file starts like a binary encrypted file
+func isBinary(file []byte) bool {
+	return bytes.HasPrefix(file, []byte(binaryMagic))
+}
+
+// parses the header at the start of file, returning ErrTruncated when
+// file is too short to hold it
+func parseBinaryHeader(file []byte) (*binaryHeader, error) {
+
+	if !isBinary(file) {
+		return nil, ErrNotEncrypted
+	}
+	if len(file) < binaryFixedSize {
+		return nil, ErrTruncated
+	}
+
+	b := file[len(binaryMagic):]
+	if b[0] == formatRecipients {
+		return parseRecipientHeader(file)
+	}
+	if b[0] != formatBinary {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, b[0])
+	}
+	kdf := KDF(b[2])
+	if kdf != Scrypt && kdf != Argon2id && kdf != RawKey {
+		return nil, malformed("unknown key derivation function")
+	}
+
+	h := &binaryHeader{
+		version: formatBinary,
+		cipher:  CipherID(b[1]),
+		kdf: kdfFromCosts(kdf, [3]int{
+			int(binary.BigEndian.Uint32(b[3:])),
+			int(binary.BigEndian.Uint32(b[7:])),
+			int(binary.BigEndian.Uint32(b[11:])),
+		}),
+		plainSize: binary.BigEndian.Uint64(b[15:]),
+		salt:      b[23:55],
+	}
+
+	if !h.kdf.valid() {
+		return nil, malformed("invalid " + kdf.String() + " parameters")
+	}
+
+	extLen := int(b[55])
+	if len(file) < binaryFixedSize+extLen {
+		return nil, ErrTruncated
+	}
+	h.ext = file[binaryFixedSize : binaryFixedSize+extLen]
+	if !validExt(h.ext) {
+		return nil, malformed("invalid extension")
+	}
+	h.raw = file[:binaryFixedSize+extLen]
+
+	return h, nil
+}
+
+// encodes a binary encrypted file, sealed is the nonce and sealed plaintext
+func encodeBinary(h *binaryHeader, aead cipher.AEAD, sealed, checksum []byte, rot rotation, opts Options) ([]byte, error) {
+
+	h.raw = h.marshal()
+	headerSum := sha256.Sum256(h.raw)
+
+	meta := make([]byte, 0, binaryMetaSize+maxRecordsSize)
+	meta = append(meta, headerSum[:]...)
+	meta = append(meta, checksum...)
+	meta = append(meta, rot.marshal()...)
+	meta = append(meta, h.records()...)
+
+	nonce, err := opts.nonce(aead.NonceSize(), nonceMeta, meta)
+	if err != nil {
+		return nil, err
+	}
+	meta = aead.Seal(nonce, nonce, meta, nil)
+
+	body := make([]byte, 0, len(h.raw)+4+len(meta)+len(sealed))
+	body = append(body, h.raw...)
+	body = binary.BigEndian.AppendUint32(body, uint32(len(meta)))
+	body = append(body, meta...)
+	return append(body, sealed...), nil
+}
+
+// encodes the optional records sealed after the fixed metadata
+func (h *binaryHeader) records() []byte {
+
+	var b []byte
+	if h.meta != nil {
+		b = append(b, recordFileMeta, fileMetaSize)
+		b = append(b, h.meta.marshal()...)
+	}
+	if h.compressor != NoCompression {
+		b = append(b, recordCompression, 9, byte(h.compressor))
+		b = binary.BigEndian.AppendUint64(b, h.origSize)
+	}
+	if len(h.labels) > 0 {
+		labels := marshalLabels(h.labels)
+		b = append(b, recordLabels, byte(len(labels)))
+		b = append(b, labels...)
+	}
+
+	return b
+}
+
+// parses the records sealed after the fixed metadata into h
+func (h *binaryHeader) parseRecords(b []byte) error {
+
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return malformed("truncated metadata record")
+		}
+		tag, value := b[0], b[2:2+int(b[1])]
+		b = b[2+len(value):]
+
+		switch {
+		case tag == recordFileMeta && len(value) == fileMetaSize:
+			h.meta = parseFileMeta(value)
+		case tag == recordCompression && len(value) == 9 && value[0] != byte(NoCompression):
+			h.compressor = CompressorID(value[0])
+			h.origSize = binary.BigEndian.Uint64(value[1:])
+		case tag == recordLabels:
+			labels, err := parseLabels(value)
+			if err != nil {
+				return err
+			}
+			h.labels = labels
+		default:
+			return malformed("unknown metadata record")
+		}
+	}
+
+	return nil
+}
+
+// decrypts a binary encrypted file in memory
+func openBinary(file, passphrase []byte) (*plainFile, error) {
+
+	h, err := parseBinaryHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if h.version == formatRecipients {
+		return openPassphraseStanzas(file, h, passphrase)
+	}
+	if h.kdf.KDF == RawKey {
+		return nil, ErrKeyFileRequired
+	}
+
+	return openBinaryKey(file, h, func(c Cipher) ([]byte, error) {
+		return deriveKey(passphrase, h.salt, h.kdf, c.KeySize())
+	})
+}
+
+// splits what follows the header h of file into the sealed metadata and
+// data, checking their sizes against the cipher c. the nonce size of c is
+// returned as well.
+func splitBinary(file []byte, h *binaryHeader, c Cipher) ([]byte, []byte, int, error) {
+
+	sizes, err := c.New(make([]byte, c.KeySize()))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	nonceSize, overhead := sizes.NonceSize(), sizes.Overhead()
+	metaLen := uint64(nonceSize + binaryMetaSize + overhead)
+
+	rest := file[len(h.raw):]
+	if len(rest) < 4 {
+		return nil, nil, 0, ErrTruncated
+	}
+	stored := uint64(binary.BigEndian.Uint32(rest))
+	if stored < metaLen || stored > metaLen+maxRecordsSize {
+		return nil, nil, 0, malformed("invalid metadata length")
+	}
+	metaLen = stored
+	// checked before the sizes are added, a forged size would wrap around.
+	// a size no slice can hold is forged, a smaller one was cut off
+	if h.plainSize > uint64(len(rest)) {
+		if h.plainSize > math.MaxInt {
+			return nil, nil, 0, malformed("invalid plaintext size")
+		}
+		return nil, nil, 0, ErrTruncated
+	}
+	want := 4 + metaLen + uint64(nonceSize+overhead) + h.plainSize
+	if uint64(len(rest)) < want {
+		return nil, nil, 0, ErrTruncated
+	}
+	if uint64(len(rest)) > want {
+		return nil, nil, 0, malformed("data after the end of the file")
+	}
+
+	return rest[4 : 4+metaLen], rest[4+metaLen:], nonceSize, nil
+}
+
+// decrypts a binary file whose header was parsed into h, fileKey returns
+// the key of the cipher once the sizes were checked. the key is wiped
+// once the cipher is keyed.
+func openBinaryKey(file []byte, h *binaryHeader, fileKey func(Cipher) ([]byte, error)) (*plainFile, error) {
+
+	c, err := LookupCipher(h.cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	// sizes are known from the header, check them before deriving the key
+	meta, data, nonceSize, err := splitBinary(file, h, c)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := fileKey(c)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.New(key)
+	wipe(key)
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := aead.Open(nil, meta[:nonceSize], meta[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	headerSum := sha256.Sum256(h.raw)
+	if subtle.ConstantTimeCompare(opened[:sha256.Size], headerSum[:]) != 1 {
+		return nil, ErrHeaderModified
+	}
+
+	if err := h.parseRecords(opened[binaryMetaSize:]); err != nil {
+		return nil, err
+	}
+
+	decrypted, err := aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, corrupt("encrypted file was modified")
+	}
+	if h.compressor != NoCompression {
+		decrypted, err = decompress(decrypted, h.compressor, h.origSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plain := &plainFile{
+		data:     decrypted,
+		ext:      h.ext,
+		salt:     h.salt,
+		kdf:      h.kdf,
+		cipher:   c.Name(),
+		checksum: opened[sha256.Size : sha256.Size+blake2b.Size],
+		rotation: parseRotation(opened[sha256.Size+blake2b.Size:]),
+		aead:     aead,
+		trailer:  true,
+		meta:     h.meta,
+		labels:   h.labels,
+	}
+	if !checksumMatches(plain.data, plain.checksum) {
+		return nil, ErrChecksum
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,130 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-binary")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "binary.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+	if !isBinary(file) {
+		t.Fatalf("Encrypt didn't write the binary format")
+	}
+
+	// no hex encoding, so only the header and sealing overhead is added
+	if overhead := len(file) - len(data); overhead > 512 {
+		t.Fatalf("binary file adds %d bytes", overhead)
+	}
+
+	plain, err := open(file, passphrase)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if string(plain.data) != data || string(plain.ext) != ".txt" || plain.kdf != DefaultKDFParams {
+		t.Fatalf("unexpected decryption result")
+	}
+	if plain.rotation.created.Unix() != res.Created.Unix() {
+		t.Fatalf("rotation metadata wasn't stored")
+	}
+
+	armored, err := EncryptWithOptions(filename, passphrase, Options{Armor: true, Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if got, _ := Plaintext(armored.Output, passphrase); string(got) != data {
+		t.Fatalf("armored file returned different contents")
+	}
+}
+
+func TestBinaryTampering(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-binary")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "binary.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+
+	// truncation is reported from the header alone
+	for _, cut := range []int{10, binaryFixedSize + 2, len(file) / 2, len(file) - 1} {
+		if _, err := open(file[:cut], []byte("wrong")); err != ErrTruncated {
+			t.Fatalf("open truncated at %d of %d: expected ErrTruncated, got %v", cut, len(file), err)
+		}
+	}
+
+	if _, err := open(append(file, 0), passphrase); err == nil {
+		t.Fatalf("expected an error for data after the end of the file")
+	}
+
+	// the extension is outside of the ciphertext but authenticated
+	modified := append([]byte(nil), file...)
+	modified[binaryFixedSize+1] = 'x'
+	if _, err := open(modified, passphrase); err == nil {
+		t.Fatalf("expected an error for a modified header")
+	}
+
+	// the ciphertext
+	modified = append([]byte(nil), file...)
+	modified[len(modified)-20] ^= 1
+	if _, err := open(modified, passphrase); err == nil {
+		t.Fatalf("expected an error for modified data")
+	}
+
+	// costly scrypt parameters are refused before deriving the key
+	modified = append([]byte(nil), file...)
+	binary.BigEndian.PutUint32(modified[len(binaryMagic)+3:], 1<<30)
+	if _, err := open(modified, passphrase); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected invalid scrypt parameters, got %v", err)
+	}
+
+	// N and r·p within their bounds, but 512 GiB together
+	modified = append([]byte(nil), file...)
+	binary.BigEndian.PutUint32(modified[len(binaryMagic)+3:], 1<<22)
+	binary.BigEndian.PutUint32(modified[len(binaryMagic)+7:], 1024)
+	binary.BigEndian.PutUint32(modified[len(binaryMagic)+11:], 1)
+	if _, err := open(modified, passphrase); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected scrypt parameters using 512 GiB to be refused, got %v", err)
+	}
+
+	// a size wrapping the expected file length around
+	modified = append([]byte(nil), file...)
+	binary.BigEndian.PutUint64(modified[len(binaryMagic)+15:], 1<<64-1)
+	if _, err := open(modified, passphrase); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected an invalid plaintext size, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// largest scrypt N CalibrateKDF picks, deriving with it takes 1 GiB
+const maxCalibratedScryptN = 1 << 20
+
+// CalibrateKDF measures how fast this host derives keys with kdf, Scrypt
+// when zero, and returns the costs that take about target, such as 500ms,
+// to set as Options.KDF. like any parameters they are stored in the
+// header of the files encrypted with them, so calibrate on the slowest
+// host that has to decrypt them: a host half as fast takes twice as long.
+//
+// scrypt keeps r and p of DefaultKDFParams and raises N up to 1<<20.
+// argon2id keeps the threads of DefaultArgon2idParams. below its memory
+// and the passes of MinArgon2idParams it lowers the memory, above them it
+// raises the passes up to 16 and then the memory up to 1 GiB. the costs
+// never go below MinKDFParams and MinArgon2idParams, so a slow host or a
+// short target can take longer than target. a longer target never picks
+// lower costs.
+func CalibrateKDF(kdf KDF, target time.Duration) (KDFParams, error) {
+	return calibrateKDF(kdf, target, measureKDF)
+}
+
+// calibrates like CalibrateKDF, measure returns how long deriving a key
+// with the given parameters takes
+func calibrateKDF(kdf KDF, target time.Duration, measure func(KDFParams) (time.Duration, error)) (KDFParams, error) {
+
+	if target <= 0 {
+		return KDFParams{}, errors.New("the calibration target must be positive")
+	}
+
+	switch kdf {
+	case 0, Scrypt:
+		p := KDFParams{KDF: Scrypt, N: MinKDFParams.N, R: DefaultKDFParams.R, P: DefaultKDFParams.P}
+		took, err := measure(p)
+		if err != nil {
+			return KDFParams{}, err
+		}
+		// the time grows with N
+		base := p.N
+		for p.N < maxCalibratedScryptN && took*time.Duration(2*p.N/base) <= target {
+			p.N *= 2
+		}
+		return p, nil
+
+	case Argon2id:
+		p := KDFParams{KDF: Argon2id, Time: 1, Memory: DefaultArgon2idParams.Memory, Threads: DefaultArgon2idParams.Threads}
+		took, err := measure(p)
+		if err != nil {
+			return KDFParams{}, err
+		}
+		// the time grows with the passes and the memory, passes counts
+		// how many of the measured one fit in target
+		passes := float64(target) / float64(took)
+		switch {
+		case passes < float64(MinArgon2idParams.Time):
+			p.Time = MinArgon2idParams.Time
+			p.Memory = int(float64(p.Memory) * passes / float64(p.Time))
+			if p.Memory < MinArgon2idParams.Memory {
+				p.Memory = MinArgon2idParams.Memory
+			}
+		case passes <= maxArgon2Time:
+			p.Time = int(passes)
+		default:
+			p.Time = maxArgon2Time
+			if passes < float64(maxArgon2KiB)/float64(p.Memory)*maxArgon2Time {
+				p.Memory = int(float64(p.Memory) * passes / maxArgon2Time)
+			} else {
+				p.Memory = maxArgon2KiB
+			}
+		}
+		return p, nil
+	}
+
+	return KDFParams{}, fmt.Errorf("%s can't be calibrated", kdf)
+}
+
+// the fastest of two derivations with p
+func measureKDF(p KDFParams) (time.Duration, error) {
+
+	salt := make([]byte, 32)
+	fastest := time.Duration(0)
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		key, err := deriveKey([]byte("calibration"), salt, p, 32)
+		if err != nil {
+			return 0, err
+		}
+		took := time.Since(start)
+		wipe(key)
+		if fastest == 0 || took < fastest {
+			fastest = took
+		}
+	}
+	// never zero, the costs are divided by it
+	if fastest <= 0 {
+		fastest = time.Nanosecond
+	}
+	return fastest, nil
+}
@@ -0,0 +1,78 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalibrateKDF(t *testing.T) {
+
+	// a derivation with the measured parameters takes 50ms
+	measure := func(KDFParams) (time.Duration, error) { return 50 * time.Millisecond, nil }
+
+	targets := []time.Duration{time.Millisecond, 20 * time.Millisecond, 60 * time.Millisecond, 100 * time.Millisecond,
+		500 * time.Millisecond, time.Second, 2 * time.Second, 10 * time.Second, time.Minute, time.Hour}
+	for _, kdf := range []KDF{Scrypt, Argon2id} {
+		var prev KDFParams
+		for i, target := range targets {
+			p, err := calibrateKDF(kdf, target, measure)
+			if err != nil {
+				t.Fatalf("calibrateKDF %s %v: %v", kdf, target, err)
+			}
+			if !p.valid() || p.KDF != kdf || len(WeakParams(p, "secretbox")) != 0 {
+				t.Fatalf("%s %v: unexpected parameters %+v", kdf, target, p)
+			}
+			if i > 0 {
+				for j, c := range p.costs() {
+					if c < prev.costs()[j] {
+						t.Fatalf("%s: %v picked %+v, lower than %+v for a shorter target", kdf, target, p, prev)
+					}
+				}
+			}
+			prev = p
+		}
+	}
+
+	for _, tc := range []struct {
+		kdf    KDF
+		target time.Duration
+		want   KDFParams
+	}{
+		{Scrypt, time.Millisecond, MinKDFParams},
+		{Scrypt, 400 * time.Millisecond, KDFParams{KDF: Scrypt, N: 1 << 17, R: 8, P: 1}},
+		{Scrypt, time.Hour, KDFParams{KDF: Scrypt, N: maxCalibratedScryptN, R: 8, P: 1}},
+		{Argon2id, time.Millisecond, KDFParams{KDF: Argon2id, Time: 2, Memory: MinArgon2idParams.Memory, Threads: 4}},
+		{Argon2id, 75 * time.Millisecond, KDFParams{KDF: Argon2id, Time: 2, Memory: 48 << 10, Threads: 4}},
+		{Argon2id, 500 * time.Millisecond, KDFParams{KDF: Argon2id, Time: 10, Memory: 64 << 10, Threads: 4}},
+		{Argon2id, 1600 * time.Millisecond, KDFParams{KDF: Argon2id, Time: 16, Memory: 128 << 10, Threads: 4}},
+		{Argon2id, time.Hour, KDFParams{KDF: Argon2id, Time: 16, Memory: maxArgon2KiB, Threads: 4}},
+	} {
+		if p, _ := calibrateKDF(tc.kdf, tc.target, measure); p != tc.want {
+			t.Fatalf("%s %v: got %+v, want %+v", tc.kdf, tc.target, p, tc.want)
+		}
+	}
+
+	if _, err := calibrateKDF(Argon2id, time.Second, func(KDFParams) (time.Duration, error) { return 0, errors.New("failed") }); err == nil {
+		t.Fatalf("expected the measurement error")
+	}
+	if _, err := CalibrateKDF(RawKey, time.Second); err == nil {
+		t.Fatalf("expected an error calibrating a key file")
+	}
+	if _, err := CalibrateKDF(Argon2id, 0); err == nil {
+		t.Fatalf("expected an error for a zero target")
+	}
+}
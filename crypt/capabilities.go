@@ -0,0 +1,73 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+// the hex and newline separated layout, including its checksum and
+// trailer lines, is format version 0
+const formatV0 = 0
+
+// the binary chunked layout written by EncryptStream is format version 1
+const formatStream = 1
+
+// the binary layout written by Encrypt is format version 2
+const formatBinary = 2
+
+// the binary layout with a random file key wrapped for each recipient,
+// written by EncryptToRecipients, is format version 3
+const formatRecipients = 3
+
+// SupportedCiphers returns the names of the registered ciphers, ordered
+// by their header id.
+func SupportedCiphers() []string {
+
+	ids := Ciphers()
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		c, err := LookupCipher(id)
+		if err != nil {
+			continue
+		}
+		names = append(names, c.Name())
+	}
+
+	return names
+}
+
+// SupportedCompressors returns the names of the registered compressors,
+// ordered by their header id.
+func SupportedCompressors() []string {
+
+	ids := Compressors()
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		c, err := LookupCompressor(id)
+		if err != nil {
+			continue
+		}
+		names = append(names, c.Name())
+	}
+
+	return names
+}
+
+// SupportedKDFs returns the names of the key derivation functions this
+// build can use.
+func SupportedKDFs() []string {
+	return []string{Scrypt.String(), Argon2id.String()}
+}
+
+// FormatVersions returns the file format versions this build can read.
+func FormatVersions() []int {
+	return []int{formatV0, formatStream, formatBinary, formatRecipients}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import "testing"
+
+func TestSupportedCiphers(t *testing.T) {
+
+	found := false
+	for _, name := range SupportedCiphers() {
+		if name == "secretbox" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("secretbox missing from %v", SupportedCiphers())
+	}
+}
+
+func TestSupportedKDFsAndFormats(t *testing.T) {
+
+	if len(SupportedKDFs()) == 0 {
+		t.Fatalf("no supported KDFs")
+	}
+
+	if len(FormatVersions()) == 0 {
+		t.Fatalf("no supported format versions")
+	}
+}
+
+func TestSupportedCompressors(t *testing.T) {
+
+	names := SupportedCompressors()
+	if len(names) == 0 || names[0] != "gzip" {
+		t.Fatalf("gzip missing from %v", names)
+	}
+}
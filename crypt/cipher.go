@@ -0,0 +1,199 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// CipherID identifies a cipher in the file header.
+type CipherID uint8
+
+// ids of the ciphers shipped with cloak, ids below 128 are reserved for
+// cloak itself, out-of-tree ciphers should register ids >= 128.
+const (
+	SecretBox         CipherID = 1
+	XChaCha20Poly1305 CipherID = 2
+	AES256GCM         CipherID = 3
+)
+
+// Cipher is an authenticated cipher used to seal file contents.
+type Cipher interface {
+	// Name returns a short human readable name for the cipher
+	Name() string
+
+	// KeySize returns the size of the key expected by New
+	KeySize() int
+
+	// New returns an AEAD keyed with key. the AEAD must keep its own
+	// copy, key is zeroed once New returns.
+	New(key []byte) (cipher.AEAD, error)
+}
+
+var (
+	ciphersMu sync.RWMutex
+	ciphers   = make(map[CipherID]Cipher)
+)
+
+// RegisterCipher makes a cipher available under the given header id.
+// it panics if c is nil or if the id is already taken.
+func RegisterCipher(id CipherID, c Cipher) {
+	ciphersMu.Lock()
+	defer ciphersMu.Unlock()
+
+	if c == nil {
+		panic("crypt: RegisterCipher cipher is nil")
+	}
+	if _, dup := ciphers[id]; dup {
+		panic(fmt.Sprintf("crypt: RegisterCipher called twice for id %d", id))
+	}
+	ciphers[id] = c
+}
+
+// LookupCipher returns the cipher registered under id.
+func LookupCipher(id CipherID) (Cipher, error) {
+	ciphersMu.RLock()
+	defer ciphersMu.RUnlock()
+
+	c, ok := ciphers[id]
+	if !ok {
+		return nil, fmt.Errorf("crypt: unknown cipher id %d", id)
+	}
+	return c, nil
+}
+
+// Ciphers returns the ids of all registered ciphers in ascending order.
+func Ciphers() []CipherID {
+	ciphersMu.RLock()
+	defer ciphersMu.RUnlock()
+
+	ids := make([]CipherID, 0, len(ciphers))
+	for id := range ciphers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// LookupCipherName returns the id of the cipher registered under name,
+// such as "aes-256-gcm".
+func LookupCipherName(name string) (CipherID, error) {
+	for _, id := range Ciphers() {
+		if c, err := LookupCipher(id); err == nil && c.Name() == name {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("crypt: unknown cipher %q", name)
+}
+
+func init() {
+	RegisterCipher(SecretBox, secretBoxCipher{})
+	RegisterCipher(XChaCha20Poly1305, xChaCha20Poly1305Cipher{})
+	RegisterCipher(AES256GCM, aes256GCMCipher{})
+}
+
+// nacl secretbox, XSalsa20 + Poly1305
+type secretBoxCipher struct{}
+
+func (secretBoxCipher) Name() string { return "secretbox" }
+
+func (secretBoxCipher) KeySize() int { return 32 }
+
+func (secretBoxCipher) New(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("crypt: secretbox key must be 32 bytes")
+	}
+	b := &secretBoxAEAD{}
+	copy(b.key[:], key)
+	return b, nil
+}
+
+// adapts secretbox to the cipher.AEAD interface.
+// secretbox has no notion of additional data, so it must be empty.
+type secretBoxAEAD struct {
+	key [32]byte
+}
+
+func (b *secretBoxAEAD) NonceSize() int { return 24 }
+
+func (b *secretBoxAEAD) Overhead() int { return secretbox.Overhead }
+
+func (b *secretBoxAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != 24 {
+		panic("crypt: incorrect nonce length given to secretbox")
+	}
+	if len(additionalData) != 0 {
+		panic("crypt: secretbox does not support additional data")
+	}
+	var n [24]byte
+	copy(n[:], nonce)
+	return secretbox.Seal(dst, plaintext, &n, &b.key)
+}
+
+func (b *secretBoxAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != 24 {
+		panic("crypt: incorrect nonce length given to secretbox")
+	}
+	if len(additionalData) != 0 {
+		panic("crypt: secretbox does not support additional data")
+	}
+	var n [24]byte
+	copy(n[:], nonce)
+	out, ok := secretbox.Open(dst, ciphertext, &n, &b.key)
+	if !ok {
+		return nil, errors.New("crypt: message authentication failed")
+	}
+	return out, nil
+}
+
+// XChaCha20 + Poly1305 with 24 byte nonces, as fast as secretbox without
+// AES hardware and able to authenticate additional data
+type xChaCha20Poly1305Cipher struct{}
+
+func (xChaCha20Poly1305Cipher) Name() string { return "xchacha20-poly1305" }
+
+func (xChaCha20Poly1305Cipher) KeySize() int { return chacha20poly1305.KeySize }
+
+func (xChaCha20Poly1305Cipher) New(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.NewX(key)
+}
+
+// AES-256 in GCM mode, for environments that mandate AES or have AES
+// hardware. its 12 byte nonces are drawn at random, every file gets its
+// own key except with key files, which shouldn't seal billions of files.
+type aes256GCMCipher struct{}
+
+func (aes256GCMCipher) Name() string { return "aes-256-gcm" }
+
+func (aes256GCMCipher) KeySize() int { return 32 }
+
+func (aes256GCMCipher) New(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("crypt: aes-256-gcm key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
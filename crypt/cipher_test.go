@@ -0,0 +1,117 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupSecretBox(t *testing.T) {
+
+	c, err := LookupCipher(SecretBox)
+	if err != nil {
+		t.Fatalf("LookupCipher: %v", err)
+	}
+
+	aead, err := c.New(make([]byte, c.KeySize()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nil, nonce, []byte(data), nil)
+
+	if len(sealed) != len(data)+aead.Overhead() {
+		t.Fatalf("unexpected sealed length %d", len(sealed))
+	}
+
+	opened, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if !bytes.Equal(opened, []byte(data)) {
+		t.Fatalf("opened data doesn't match")
+	}
+
+	sealed[0] ^= 1
+	if _, err := aead.Open(nil, nonce, sealed, nil); err == nil {
+		t.Fatalf("Open accepted tampered ciphertext")
+	}
+}
+
+func TestLookupUnknownCipher(t *testing.T) {
+
+	if _, err := LookupCipher(255); err == nil {
+		t.Fatalf("LookupCipher returned no error for unknown id")
+	}
+}
+
+func TestRegisterCipherTwice(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("RegisterCipher didn't panic on duplicate id")
+		}
+	}()
+
+	RegisterCipher(SecretBox, secretBoxCipher{})
+}
+
+func TestEncryptCiphers(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-cipher")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "plain.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	for _, name := range []string{"secretbox", "xchacha20-poly1305", "aes-256-gcm"} {
+		id, err := LookupCipherName(name)
+		if err != nil {
+			t.Fatalf("LookupCipherName %s: %v", name, err)
+		}
+
+		output := filepath.Join(dir, name+".cloak")
+		res, err := EncryptWithOptions(filename, passphrase, Options{Cipher: id, OutputPath: output})
+		if err != nil {
+			t.Fatalf("EncryptWithOptions %s: %v", name, err)
+		}
+		if res.Cipher != name {
+			t.Fatalf("encrypted with %s, expected %s", res.Cipher, name)
+		}
+
+		// the cipher is picked from the header when decrypting
+		info, err := ReadFormat(output)
+		if err != nil || info.Cipher != name {
+			t.Fatalf("ReadFormat reports %q, %v, expected %s", info.Cipher, err, name)
+		}
+		plain, err := Plaintext(output, passphrase)
+		if err != nil || string(plain) != data {
+			t.Fatalf("Plaintext %s: %v", name, err)
+		}
+	}
+
+	if _, err := LookupCipherName("rot13"); err == nil {
+		t.Fatal("LookupCipherName found an unknown cipher")
+	}
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Cipher: AES256GCM, Armor: true, Overwrite: true}); err == nil {
+		t.Fatal("armored a file with aes-256-gcm")
+	}
+}
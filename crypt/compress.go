@@ -0,0 +1,193 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// CompressorID identifies a compression algorithm in the file header.
+type CompressorID uint8
+
+// ids of the compressors shipped with cloak. zero means the plaintext is
+// stored as is. like cipher ids, ids below 128 are reserved for cloak
+// itself, out-of-tree compressors should register ids >= 128.
+const (
+	NoCompression CompressorID = 0
+	Gzip          CompressorID = 1
+)
+
+// ErrDecompressedSize is returned when inflating data would produce more
+// than the expected number of bytes.
+var ErrDecompressedSize error = corruption("decompressed data exceeds its expected size")
+
+// Compressor compresses plaintext before it is sealed.
+type Compressor interface {
+	// Name returns a short human readable name for the algorithm
+	Name() string
+
+	// Compress returns the compressed form of data
+	Compress(data []byte) ([]byte, error)
+
+	// Decompress inflates data, it must fail with ErrDecompressedSize
+	// rather than return more than limit bytes
+	Decompress(data []byte, limit int64) ([]byte, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = make(map[CompressorID]Compressor)
+)
+
+// RegisterCompressor makes a compressor available under the given header
+// id. it panics if c is nil, if the id is already taken or if it is zero.
+func RegisterCompressor(id CompressorID, c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	if c == nil {
+		panic("crypt: RegisterCompressor compressor is nil")
+	}
+	if id == NoCompression {
+		panic("crypt: RegisterCompressor id 0 means no compression")
+	}
+	if _, dup := compressors[id]; dup {
+		panic(fmt.Sprintf("crypt: RegisterCompressor called twice for id %d", id))
+	}
+	compressors[id] = c
+}
+
+// LookupCompressor returns the compressor registered under id.
+func LookupCompressor(id CompressorID) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	c, ok := compressors[id]
+	if !ok {
+		return nil, fmt.Errorf("crypt: unknown compressor id %d", id)
+	}
+	return c, nil
+}
+
+// name of the compressor registered under id, or its number if it is
+// unknown
+func compressorName(id CompressorID) string {
+	c, err := LookupCompressor(id)
+	if err != nil {
+		return fmt.Sprintf("compressor %d", id)
+	}
+	return c.Name()
+}
+
+// Compressors returns the ids of all registered compressors in ascending
+// order.
+func Compressors() []CompressorID {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	ids := make([]CompressorID, 0, len(compressors))
+	for id := range compressors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func init() {
+	RegisterCompressor(Gzip, gzipCompressor{})
+}
+
+// compresses data with the compressor registered under id, returning
+// data itself when compressing doesn't make it smaller
+func compress(data []byte, id CompressorID) ([]byte, CompressorID, error) {
+
+	c, err := LookupCompressor(id)
+	if err != nil {
+		return nil, NoCompression, err
+	}
+	packed, err := c.Compress(data)
+	if err != nil {
+		return nil, NoCompression, err
+	}
+	if len(packed) >= len(data) {
+		return data, NoCompression, nil
+	}
+
+	return packed, id, nil
+}
+
+// inflates data compressed with id back to its size of size bytes
+func decompress(data []byte, id CompressorID, size uint64) ([]byte, error) {
+
+	c, err := LookupCompressor(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.Decompress(data, int64(size))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) != size {
+		return nil, malformed("decompressed size doesn't match")
+	}
+
+	return out, nil
+}
+
+// reads at most limit bytes from r, failing if there are more
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, ErrDecompressedSize
+	}
+
+	return out, nil
+}
+
+// gzip from the standard library at its default level
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r, limit)
+}
@@ -0,0 +1,124 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+
+	c, err := LookupCompressor(Gzip)
+	if err != nil {
+		t.Fatalf("LookupCompressor: %v", err)
+	}
+
+	plain := bytes.Repeat([]byte(data), 100)
+	packed, err := c.Compress(plain)
+	if err != nil {
+		t.Fatalf("Compress: %v", err)
+	}
+	if len(packed) >= len(plain) {
+		t.Fatalf("repeated data didn't shrink: %d >= %d", len(packed), len(plain))
+	}
+
+	out, err := c.Decompress(packed, int64(len(plain)))
+	if err != nil {
+		t.Fatalf("Decompress: %v", err)
+	}
+	if !bytes.Equal(out, plain) {
+		t.Fatalf("decompressed data doesn't match")
+	}
+
+	// stops inflating past the expected size
+	if _, err := c.Decompress(packed, int64(len(plain)-1)); !errors.Is(err, ErrDecompressedSize) {
+		t.Fatalf("expected ErrDecompressedSize, got %v", err)
+	}
+}
+
+func TestLookupUnknownCompressor(t *testing.T) {
+
+	if _, err := LookupCompressor(255); err == nil {
+		t.Fatalf("LookupCompressor returned no error for unknown id")
+	}
+	if _, err := LookupCompressor(NoCompression); err == nil {
+		t.Fatalf("LookupCompressor returned a compressor for id 0")
+	}
+}
+
+func TestRegisterCompressorTwice(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("RegisterCompressor didn't panic on duplicate id")
+		}
+	}()
+
+	RegisterCompressor(Gzip, gzipCompressor{})
+}
+
+func TestEncryptCompressed(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-compress")
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte(data), 200)
+	filename := filepath.Join(dir, "log.txt")
+	ioutil.WriteFile(filename, content, 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Compress: Gzip})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if res.BytesOut >= int64(len(content))/2 {
+		t.Fatalf("compressed file is %d bytes for %d bytes of plaintext", res.BytesOut, len(content))
+	}
+
+	plain, err := Plaintext(res.Output, passphrase)
+	if err != nil {
+		t.Fatalf("Plaintext: %v", err)
+	}
+	if !bytes.Equal(plain, content) {
+		t.Fatalf("decompressed data doesn't match")
+	}
+	if !checksumMatches(content, res.PlaintextHash) {
+		t.Fatalf("checksum wasn't computed over the original")
+	}
+
+	// data that doesn't shrink is stored as is
+	noise, _ := random(4096)
+	ioutil.WriteFile(filename, noise, 0644)
+	res, err = EncryptWithOptions(filename, passphrase, Options{Compress: Gzip, Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	file, _ := ioutil.ReadFile(res.Output)
+	h, err := parseBinaryHeader(file)
+	if err != nil || h.plainSize != uint64(len(noise)) {
+		t.Fatalf("incompressible data was compressed: %v", err)
+	}
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Compress: Gzip, Armor: true, Overwrite: true}); err == nil {
+		t.Fatalf("expected an error compressing an armored file")
+	}
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Compress: 200, Overwrite: true}); err == nil {
+		t.Fatalf("expected an error for an unknown compressor")
+	}
+}
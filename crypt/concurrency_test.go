@@ -0,0 +1,93 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// run with go test -race to catch shared state between calls
+func TestConcurrentEncryptDecrypt(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-concurrency")
+	defer os.RemoveAll(dir)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			filename := filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+			content := fmt.Sprintf("%s %d", data, i)
+			ioutil.WriteFile(filename, []byte(content), 0644)
+
+			res, err := Encrypt(filename, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			plain, err := Plaintext(res.Output, []byte(res.Passphrase))
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if string(plain) != content {
+				errs <- fmt.Errorf("file %d: decrypted data doesn't match", i)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentCipherRegistry(t *testing.T) {
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterCipher(CipherID(200+i), secretBoxCipher{})
+		}(i)
+		go func() {
+			defer wg.Done()
+			SupportedCiphers()
+			LookupCipher(SecretBox)
+		}()
+	}
+
+	wg.Wait()
+
+	ciphersMu.Lock()
+	for i := 0; i < 8; i++ {
+		delete(ciphers, CipherID(200+i))
+	}
+	ciphersMu.Unlock()
+}
@@ -0,0 +1,150 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// a container is an encrypted file whose plaintext holds several named
+// streams:
+// magic (8 bytes) + version byte + big endian stream count (4 bytes)
+// then for each stream a name length byte + name + big endian data
+// length (8 bytes) + data
+const (
+	containerMagic   = "CLOAKCTR"
+	containerVersion = 1
+)
+
+// ErrNotContainer is returned when reading streams of a file that was not
+// written by EncryptContainer.
+var ErrNotContainer = errors.New("file is not a container")
+
+// ErrNoStream is returned by ExtractStream when the container has no
+// stream of the given name.
+var ErrNoStream = errors.New("no such stream in container")
+
+// Stream is a named payload of a container.
+type Stream struct {
+	Name string
+	Data []byte
+}
+
+// EncryptContainer packs the streams into a single encrypted file written
+// to output. names must be unique, at most 255 bytes long and can't
+// contain path separators.
+func EncryptContainer(output string, passphrase []byte, streams []Stream, opts Options) (*Result, error) {
+
+	seen := make(map[string]bool, len(streams))
+	for _, s := range streams {
+		if err := validStreamName(s.Name); err != nil {
+			return nil, err
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("duplicate stream name %q", s.Name)
+		}
+		seen[s.Name] = true
+	}
+
+	return EncryptData(encodeContainer(streams), output, passphrase, opts)
+}
+
+// OpenContainer decrypts the container at path and returns its streams in
+// the order they were packed.
+func OpenContainer(path string, passphrase []byte) ([]Stream, error) {
+
+	data, err := Plaintext(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return decodeContainer(data)
+}
+
+// ExtractStream returns the data of the named stream of the container at
+// path.
+func ExtractStream(path string, passphrase []byte, name string) ([]byte, error) {
+
+	streams, err := OpenContainer(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range streams {
+		if s.Name == name {
+			return s.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNoStream, name)
+}
+
+func validStreamName(name string) error {
+	if name == "" || len(name) > 255 || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("invalid stream name %q", name)
+	}
+	return nil
+}
+
+func encodeContainer(streams []Stream) []byte {
+
+	var b bytes.Buffer
+	b.WriteString(containerMagic)
+	b.WriteByte(containerVersion)
+	b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(streams))))
+	for _, s := range streams {
+		b.WriteByte(byte(len(s.Name)))
+		b.WriteString(s.Name)
+		b.Write(binary.BigEndian.AppendUint64(nil, uint64(len(s.Data))))
+		b.Write(s.Data)
+	}
+	return b.Bytes()
+}
+
+func decodeContainer(data []byte) ([]Stream, error) {
+
+	if len(data) < len(containerMagic)+5 || string(data[:len(containerMagic)]) != containerMagic {
+		return nil, ErrNotContainer
+	}
+	if data[len(containerMagic)] != containerVersion {
+		return nil, fmt.Errorf("%w %d of container", ErrUnsupportedVersion, data[len(containerMagic)])
+	}
+
+	// the plaintext is authenticated, a bad length means a writer bug
+	// rather than tampering, but it must not panic either
+	count := binary.BigEndian.Uint32(data[len(containerMagic)+1:])
+	rest := data[len(containerMagic)+5:]
+	var streams []Stream
+	for i := uint32(0); i < count; i++ {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0])+8 {
+			return nil, malformed("container stream header")
+		}
+		name := string(rest[1 : 1+int(rest[0])])
+		rest = rest[1+len(name):]
+
+		size := binary.BigEndian.Uint64(rest)
+		rest = rest[8:]
+		if size > uint64(len(rest)) {
+			return nil, malformed("container stream length")
+		}
+		streams = append(streams, Stream{Name: name, Data: rest[:size]})
+		rest = rest[size:]
+	}
+	if len(rest) != 0 {
+		return nil, malformed("data after the last container stream")
+	}
+
+	return streams, nil
+}
@@ -0,0 +1,95 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainer(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-container")
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "packed")
+	streams := []Stream{
+		{Name: "data", Data: []byte(data)},
+		{Name: "meta.json", Data: []byte("{}")},
+		{Name: "empty"},
+	}
+
+	_, err := EncryptContainer(output, passphrase, streams, Options{})
+	if err != nil {
+		t.Fatalf("EncryptContainer: %v", err)
+	}
+
+	got, err := OpenContainer(output, passphrase)
+	if err != nil {
+		t.Fatalf("OpenContainer: %v", err)
+	}
+	if len(got) != len(streams) {
+		t.Fatalf("expected %d streams, got %d", len(streams), len(got))
+	}
+	for i, s := range streams {
+		if got[i].Name != s.Name || string(got[i].Data) != string(s.Data) {
+			t.Fatalf("stream %d: expected %q, got %q", i, s.Name, got[i].Name)
+		}
+	}
+
+	meta, err := ExtractStream(output, passphrase, "meta.json")
+	if err != nil || string(meta) != "{}" {
+		t.Fatalf("ExtractStream meta.json: %q %v", meta, err)
+	}
+
+	if _, err := ExtractStream(output, passphrase, "thumbnail"); !errors.Is(err, ErrNoStream) {
+		t.Fatalf("expected ErrNoStream, got %v", err)
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-container")
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "packed")
+	for _, bad := range [][]Stream{
+		{{Name: ""}},
+		{{Name: "../x"}},
+		{{Name: "a"}, {Name: "a"}},
+	} {
+		if _, err := EncryptContainer(output, passphrase, bad, Options{}); err == nil {
+			t.Fatalf("expected an error for streams %v", bad)
+		}
+	}
+
+	// a regular encrypted file is not a container
+	if _, err := EncryptData([]byte(data), output, passphrase, Options{}); err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	if _, err := OpenContainer(output, passphrase); err != ErrNotContainer {
+		t.Fatalf("expected ErrNotContainer, got %v", err)
+	}
+
+	// cut streams are reported, not read past
+	packed := encodeContainer([]Stream{{Name: "data", Data: []byte(data)}})
+	for _, cut := range []int{len(containerMagic) + 6, len(packed) - 1} {
+		if _, err := decodeContainer(packed[:cut]); err == nil || err == ErrNotContainer {
+			t.Fatalf("expected a malformed error at %d, got %v", cut, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import "context"
+
+// EncryptContext is like EncryptWithOptions but gives up once ctx is
+// canceled or past its deadline, returning its error. reading the file is
+// abandoned right away, even when the read is stuck such as on an
+// unresponsive network filesystem. key derivation runs to completion and
+// ctx is checked after it, nothing is written once ctx is done.
+func EncryptContext(ctx context.Context, path string, passphrase []byte, opts Options) (*Result, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts.ctx = ctx
+	return EncryptWithOptions(path, passphrase, opts)
+}
+
+// DecryptContext is like DecryptWithOptions but gives up once ctx is
+// canceled or past its deadline, see EncryptContext.
+func DecryptContext(ctx context.Context, path string, passphrase []byte, opts Options) (*Result, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts.ctx = ctx
+	return DecryptWithOptions(path, passphrase, opts)
+}
+
+// reads the file at path, returning the error of ctx as soon as it is
+// done. a read that is stuck keeps going in the background and its result
+// is dropped.
+func readFileContext(ctx context.Context, path string, progress ProgressFunc) ([]byte, error) {
+
+	if ctx.Done() == nil {
+		return readFileProgress(path, progress)
+	}
+	if progress != nil {
+		// an abandoned read keeps going, it shouldn't keep reporting
+		report := progress
+		progress = func(done, total int64) {
+			if ctx.Err() == nil {
+				report(done, total)
+			}
+		}
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := readFileProgress(path, progress)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
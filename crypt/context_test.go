@@ -0,0 +1,59 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-context")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "context.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+	output := filepath.Join(dir, "context.cloak")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err := EncryptContext(ctx, filename, passphrase, Options{OutputPath: output})
+	if err != nil {
+		t.Fatalf("EncryptContext: %v", err)
+	}
+
+	restored := filepath.Join(dir, "restored.txt")
+	if _, err := DecryptContext(ctx, res.Output, passphrase, Options{OutputPath: restored}); err != nil {
+		t.Fatalf("DecryptContext: %v", err)
+	}
+	if got, _ := ioutil.ReadFile(restored); string(got) != data {
+		t.Fatalf("decrypted content doesn't match")
+	}
+
+	cancel()
+	os.Remove(output)
+	if _, err := EncryptContext(ctx, filename, passphrase, Options{OutputPath: output}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("output written after cancellation: %v", err)
+	}
+	if _, err := DecryptContext(ctx, res.Output, passphrase, Options{OutputPath: filepath.Join(dir, "canceled")}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// in Convergent mode the salt is hmac-sha256 of the contents keyed with
+// the passphrase, so the key derived from it is the same for the same
+// contents and passphrase. each nonce is hmac-sha256 of a purpose byte
+// and the message it seals, keyed with a key derived from the file key,
+// so a nonce only repeats for the same message.
+const (
+	convergentSaltInfo  = "cloak convergent salt"
+	convergentNonceInfo = "cloak convergent nonce"
+
+	// purposes of the derived nonces
+	nonceData = 1
+	nonceMeta = 2
+)
+
+func convergentSalt(passphrase, data []byte) []byte {
+	mac := hmac.New(sha256.New, passphrase)
+	mac.Write([]byte(convergentSaltInfo))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// refuses the options that would make copies of a file differ, or that
+// convergent files can't be written with
+func checkConvergent(passphrase []byte, opts Options) error {
+
+	switch {
+	case len(passphrase) == 0:
+		return errors.New("convergent encryption needs a passphrase, a generated one would never repeat")
+	case opts.Armor:
+		return errors.New("armored files can't be encrypted convergently")
+	case opts.KeyFile != "":
+		return errors.New("key files can't be used with convergent encryption")
+	case opts.PartSize > 0:
+		return errors.New("split files can't be encrypted convergently")
+	case opts.RotateAfter != 0:
+		return errors.New("rotation records the time of encryption, which convergent files leave out")
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConvergent(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-convergent")
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	ioutil.WriteFile(a, []byte(data), 0644)
+	ioutil.WriteFile(b, []byte(data), 0600)
+	os.Chtimes(b, time.Unix(1, 0), time.Unix(1, 0))
+
+	opts := Options{Convergent: true, Compress: Gzip, Labels: map[string]string{"backup": "deep"}, Overwrite: true}
+	encrypt := func(path string, pass []byte) []byte {
+		res, err := EncryptWithOptions(path, pass, opts)
+		if err != nil {
+			t.Fatalf("EncryptWithOptions %s: %v", path, err)
+		}
+		file, _ := ioutil.ReadFile(res.Output)
+		return file
+	}
+
+	first := encrypt(a, passphrase)
+	if !bytes.Equal(encrypt(b, passphrase), first) {
+		t.Fatalf("expected copies with other metadata to encrypt to the same bytes")
+	}
+	if bytes.Equal(encrypt(b, []byte("another passphrase")), first) {
+		t.Fatalf("expected another passphrase to give other bytes")
+	}
+	ioutil.WriteFile(b, []byte(data+"."), 0644)
+	if bytes.Equal(encrypt(b, passphrase), first) {
+		t.Fatalf("expected other contents to give other bytes")
+	}
+
+	plain, err := Plaintext(filepath.Join(dir, "a.cloak"), passphrase)
+	if err != nil || string(plain) != data {
+		t.Fatalf("Plaintext: %q, %v", plain, err)
+	}
+
+	for _, o := range []Options{
+		{Convergent: true, Armor: true},
+		{Convergent: true, PartSize: 1 << 20},
+		{Convergent: true, RotateAfter: time.Hour},
+	} {
+		if _, err := EncryptWithOptions(a, passphrase, o); err == nil {
+			t.Fatalf("expected an error for %+v", o)
+		}
+	}
+	if _, err := EncryptWithOptions(a, nil, Options{Convergent: true}); err == nil {
+		t.Fatalf("expected an error without a passphrase")
+	}
+}
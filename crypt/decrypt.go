@@ -15,89 +15,534 @@
 package crypt
 
 import (
+	"context"
+	"crypto/cipher"
+	"crypto/subtle"
 	"encoding/hex"
-	"io/ioutil"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
-	"golang.org/x/crypto/nacl/secretbox"
-	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/blake2b"
 )
 
-// creates an output file
-func createPlainTextFile(data, ext []byte) error {
+// ErrWrongPassphrase is returned when the key derived from the
+// passphrase, or read from the key file, doesn't open the file.
+// authenticated encryption can't tell a wrong key from a modified
+// ciphertext, so a file modified where the key is first checked fails
+// with this error too.
+var ErrWrongPassphrase = errors.New("unable to decrypt, wrong passphrase or key")
 
-	outputFile := "out" + string(ext)
+// ErrCorruptFile is matched by errors.Is for every error returned because
+// an encrypted file was damaged or modified: ErrMalformed, ErrTruncated,
+// ErrHeaderModified, ErrChecksum, ErrDecompressedSize and data that fails
+// to open once the key was checked.
+var ErrCorruptFile = errors.New("corrupt encrypted file")
 
-	err := ioutil.WriteFile(outputFile, data, 0644)
+// an error matching ErrCorruptFile
+type corruption string
+
+func (c corruption) Error() string {
+	return string(c)
+}
+
+func (c corruption) Is(target error) bool {
+	return target == ErrCorruptFile
+}
+
+// returns an error matching ErrCorruptFile
+func corrupt(what string) error {
+	return fmt.Errorf("%w: %s", ErrCorruptFile, what)
+}
+
+// ErrChecksum is returned when the restored file doesn't match the
+// plaintext checksum stored at encryption time.
+var ErrChecksum error = corruption("restored file doesn't match the stored checksum")
+
+// ErrMalformed is returned when an encrypted file doesn't follow the
+// expected layout, errors wrapping it describe the offending part.
+var ErrMalformed error = corruption("malformed encrypted file")
+
+// longest file extension accepted when decrypting
+const maxExtLen = 255
+
+func malformed(what string) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, what)
+}
+
+// creates an output file, or writes to standard output when the output
+// path is Stdio
+func createPlainTextFile(data, ext []byte, opts Options) (string, error) {
+
+	outputFile := "out" + safeExt(string(ext))
+	if opts.OutputPath != "" {
+		outputFile = opts.OutputPath
+	}
+	if outputFile == Stdio {
+		_, err := stdout.Write(data)
+		return outputFile, err
+	}
+
+	err := writeFile(outputFile, data, defaultDecryptedMode, opts.Mode)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return outputFile, nil
 }
 
-// encrypted file is encoded in hex and has the following structure:
-// first 24 bytes = nonce
-// last line = salt
-func Decrypt(path string, passphrase []byte) (string, string, error) {
+// a decrypted file
+type plainFile struct {
+	data   []byte
+	ext    []byte
+	salt   []byte
+	kdf    KDFParams
+	cipher string
 
-	file, err := readFile(path)
+	// blake2b-512 of data, nil for files written before checksums were stored
+	checksum []byte
+
+	// zero for files written before rotation metadata was stored
+	rotation rotation
+
+	// the file key, used to authenticate the parts of split files
+	aead cipher.AEAD
+
+	// truncation of the file is detected, false for old armored files
+	trailer bool
+
+	// metadata of the original, nil when it wasn't recorded
+	meta *fileMeta
+
+	// labels the file was encrypted with, see Options.Labels
+	labels map[string]string
+
+	// key the file was signed with, nil when it isn't signed
+	signer *VerifyingKey
+}
+
+// Decrypt restores a file written by Encrypt. armored encrypted files are
+// encoded in hex and have the following structure:
+// first line = nonce (first 24 bytes) + ciphertext
+// second line = salt
+// third line = file extension
+// fourth line = nonce + sealed blake2b checksum of the plaintext and the
+// rotation metadata
+// fifth line = trailer with the file length and a sealed hash of the file
+//
+// once written, the restored file is read back and checked against the
+// stored checksum so corruption while writing it out is detected.
+func Decrypt(path string, passphrase []byte) (*Result, error) {
+	return DecryptWithOptions(path, passphrase, Options{})
+}
+
+// DecryptWithOptions is like Decrypt but configured with opts. path may
+// be Stdio to read standard input, the plaintext is then written to
+// standard output unless opts.OutputPath is set.
+func DecryptWithOptions(path string, passphrase []byte, opts Options) (*Result, error) {
+
+	if opts.KeyFile != "" {
+		if len(passphrase) > 0 {
+			return nil, errKeyFilePassphrase
+		}
+		key, err := readKeyFile(opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(key)
+		return decryptWith(path, nil, opts, func(file []byte) (*plainFile, error) {
+			return openKeyFile(file, key)
+		})
+	}
+
+	return decryptWith(path, passphrase, opts, func(file []byte) (*plainFile, error) {
+		return open(file, passphrase)
+	})
+}
+
+// decrypts the file at path with openFile and writes the restored file
+func decryptWith(path string, passphrase []byte, opts Options, openFile func([]byte) (*plainFile, error)) (*Result, error) {
+
+	start := time.Now()
+
+	plain, file, err := openPathContext(opts.context(), path, opts.Progress, openFile)
 	if err != nil {
-		return handleError(err)
+		return nil, err
 	}
+	opts.trace("opened", "layout", layoutName(file), "cipher", plain.cipher, "kdf", plain.kdf, "checksum", plain.checksum != nil, "trailer", plain.trailer, "metadata", plain.meta != nil, "labels", len(plain.labels), "signed", plain.signer != nil)
+	defer opts.hold(plain.data)()
+
+	if len(opts.Signers) > 0 && !trustedSigner(plain.signer, opts.Signers) {
+		return nil, ErrUntrustedSigner
+	}
+	if !plain.trailer && !opts.AllowLegacy {
+		return nil, ErrLegacyFormat
+	}
+
+	warnings := plain.weaknesses()
+	if opts.Strict && len(warnings) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrWeakParams, strings.Join(warnings, ", "))
+	}
+
+	if err := opts.canceled(); err != nil {
+		return nil, err
+	}
+	if path == Stdio && opts.OutputPath == "" {
+		opts.OutputPath = Stdio
+	}
+	output, err := createPlainTextFile(plain.data, plain.ext, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// standard output can't be read back or given metadata, the
+	// checksum was already checked when the file was opened
+	stdio := output == Stdio
+	if plain.checksum != nil && !stdio {
+		restored, err := readFile(output)
+		if err != nil {
+			return nil, err
+		}
+		if !checksumMatches(restored, plain.checksum) {
+			return nil, ErrChecksum
+		}
+		opts.trace("read back the restored file, it matches the checksum")
+	}
+
+	if plain.meta != nil && !opts.NoMetadata && !stdio {
+		if err := plain.meta.restore(output, opts); err != nil {
+			return nil, err
+		}
+		opts.trace("restored the recorded metadata", "output", output)
+	}
+	opts.log(slog.LevelInfo, "decrypted", "output", output, "bytes", len(plain.data))
+
+	sum := blake2b.Sum512(plain.data)
+
+	return &Result{
+		Passphrase:    string(passphrase),
+		Output:        output,
+		BytesIn:       int64(len(file)),
+		BytesOut:      int64(len(plain.data)),
+		Salt:          plain.salt,
+		KDF:           plain.kdf,
+		Cipher:        plain.cipher,
+		Duration:      time.Since(start),
+		PlaintextHash: sum[:],
+		Created:       plain.rotation.created,
+		RotateAfter:   plain.rotation.after,
+		Warnings:      warnings,
+		Labels:        plain.labels,
+		Signer:        plain.signer,
+	}, nil
+}
+
+// Plaintext decrypts the encrypted file at path in memory and returns the
+// original contents, nothing is written to disk.
+func Plaintext(path string, passphrase []byte) ([]byte, error) {
+
+	plain, _, err := openPath(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return plain.data, nil
+}
+
+// PlaintextExt is like Plaintext but also returns the extension of the
+// original file, including the leading dot.
+func PlaintextExt(path string, passphrase []byte) ([]byte, string, error) {
+
+	plain, _, err := openPath(path, passphrase)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return plain.data, string(plain.ext), nil
+}
+
+// reads and decrypts the encrypted file at path, reassembling it first
+// when path is one of its parts. the encrypted file is returned as well.
+func openPath(path string, passphrase []byte) (*plainFile, []byte, error) {
+	return openPathWith(path, func(file []byte) (*plainFile, error) {
+		return open(file, passphrase)
+	})
+}
+
+// like openPath but decrypts the reassembled file with openFile
+func openPathWith(path string, openFile func([]byte) (*plainFile, error)) (*plainFile, []byte, error) {
+	return openPathContext(context.Background(), path, nil, openFile)
+}
+
+// like openPathWith but gives up reading path once ctx is done, reporting
+// the read to progress when it is set
+func openPathContext(ctx context.Context, path string, progress ProgressFunc, openFile func([]byte) (*plainFile, error)) (*plainFile, []byte, error) {
+
+	file, err := readFileContext(ctx, path, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var parts []*part
+	if isPart(file) {
+		file, parts, err = readParts(path, file)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	unwrapped, signer, err := unwrapSigned(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	unwrapped, err = unwrapPEM(unwrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	plain, err := openFile(unwrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain.signer = signer
+
+	if parts != nil {
+		err = verifyParts(plain.aead, parts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return plain, file, nil
+}
+
+// decrypts the contents of an encrypted file in memory
+func open(file, passphrase []byte) (*plainFile, error) {
+
+	if isBinary(file) {
+		return openBinary(file, passphrase)
+	}
+	if isStream(file) {
+		return openStream(file, passphrase)
+	}
+	return openArmored(file, passphrase)
+}
+
+// decrypts the contents of an armored encrypted file in memory
+func openArmored(file, passphrase []byte) (*plainFile, error) {
 
 	// split the file by new line
 	full := strings.Split(string(file), "\n")
+	if len(full) < 3 {
+		return nil, ErrTruncated
+	}
+	if len(full) > 5 {
+		return nil, malformed("too many lines")
+	}
 
 	encryptedData := full[0]
 	salt := full[1]
 	ext := full[2]
 
+	// files written by older versions end after the checksum line or
+	// even the extension line, newer ones with the trailer
+	hasTrailer := len(full) > 4
+	var body []byte
+	var trailer string
+	if hasTrailer {
+		trailer = full[len(full)-1]
+		body = file[:len(file)-len(trailer)]
+
+		err := checkTrailerLength(body, trailer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// decodes salt last line
 	decodedSalt, err := hex.DecodeString(salt)
 	if err != nil {
-		return handleError(err)
+		return nil, malformed("salt is not hex encoded")
 	}
 
 	// salt should be 32 bytes
 	if len(decodedSalt) != 32 {
-		return handleError(err)
+		return nil, malformed("invalid salt")
 	}
 
 	// decodes encrypted file
 	decodedEncryptedData, err := hex.DecodeString(encryptedData)
 	if err != nil {
-		return handleError(err)
+		return nil, malformed("ciphertext is not hex encoded")
 	}
 
 	// decodes file extension
 	decodedFileExt, err := hex.DecodeString(ext)
 	if err != nil {
-		return handleError(err)
+		// a cut off extension line is the last line of a legacy file
+		if len(full) == 3 {
+			return nil, ErrTruncated
+		}
+		return nil, malformed("extension is not hex encoded")
+	}
+	if !validExt(decodedFileExt) {
+		return nil, malformed("invalid extension")
+	}
+
+	c, err := LookupCipher(SecretBox)
+	if err != nil {
+		return nil, err
 	}
 
 	// reconstruct the key from the passphrase provided by the user + salt saved on file
-	var key [32]byte
-	keyBytes, err := scrypt.Key(passphrase, []byte(decodedSalt), 16384, 8, 1, 32)
+	params := legacyKDFParams
+	key, err := deriveKey(passphrase, decodedSalt, params, c.KeySize())
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	aead, err := c.New(key)
 	if err != nil {
-		return handleError(err)
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(decodedEncryptedData) < nonceSize+aead.Overhead() {
+		return nil, malformed("ciphertext is too short")
+	}
+
+	if hasTrailer {
+		err = openTrailer(aead, body, trailer)
+		if err != nil {
+			return nil, err
+		}
 	}
-	copy(key[:], keyBytes)
 
-	var decryptNonce [24]byte
-	copy(decryptNonce[:], decodedEncryptedData[:24])
+	decrypted, err := aead.Open(nil, decodedEncryptedData[:nonceSize], decodedEncryptedData[nonceSize:], nil)
+	if err != nil {
+		// the trailer already checked the key
+		if hasTrailer {
+			return nil, corrupt("encrypted file was modified")
+		}
+		return nil, ErrWrongPassphrase
+	}
+
+	plain := &plainFile{
+		data:    decrypted,
+		ext:     decodedFileExt,
+		salt:    decodedSalt,
+		kdf:     params,
+		cipher:  c.Name(),
+		aead:    aead,
+		trailer: hasTrailer,
+	}
 
-	decrypted, ok := secretbox.Open([]byte{}, []byte(decodedEncryptedData[24:]), &decryptNonce, &key)
-	if !ok {
-		log.Fatal("Unable to decrypt")
-		return "", "", nil
+	// files written by older versions have no checksum line
+	if len(full) > 3 {
+		sealed, err := hex.DecodeString(full[3])
+		// older files seal the checksum alone, newer ones append the
+		// rotation metadata
+		short := nonceSize + blake2b.Size + aead.Overhead()
+		if err != nil || (len(sealed) != short && len(sealed) != short+rotationSize) {
+			// without a trailer a short checksum line is the last line
+			if !hasTrailer {
+				return nil, ErrTruncated
+			}
+			return nil, malformed("invalid checksum")
+		}
+		opened, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+		if err != nil {
+			return nil, corrupt("unable to decrypt checksum")
+		}
+		plain.checksum = opened[:blake2b.Size]
+		if len(opened) > blake2b.Size {
+			// every version sealing the rotation metadata writes the
+			// trailer too, so it was stripped to pass as an older file
+			if !hasTrailer {
+				return nil, corrupt("trailer was removed")
+			}
+			plain.rotation = parseRotation(opened[blake2b.Size:])
+		}
+		if !checksumMatches(plain.data, plain.checksum) {
+			return nil, ErrChecksum
+		}
 	}
 
-	err = createPlainTextFile(decrypted, decodedFileExt)
+	return plain, nil
+}
+
+// the extension is appended to the output name, so it must not be able to
+// point outside of the working directory
+func validExt(ext []byte) bool {
+	if len(ext) == 0 {
+		return true
+	}
+	if len(ext) > maxExtLen || ext[0] != '.' {
+		return false
+	}
+	return !strings.ContainsAny(string(ext), "/\\\x00")
+}
+
+// reports whether data hashes to the given blake2b-512 checksum
+func checksumMatches(data, checksum []byte) bool {
+	sum := blake2b.Sum512(data)
+	return subtle.ConstantTimeCompare(sum[:], checksum) == 1
+}
+
+// IsEncrypted reports whether the file at path looks like a cloak
+// encrypted file. it only checks the layout, not the passphrase.
+func IsEncrypted(path string) (bool, error) {
+
+	file, err := readFile(path)
 	if err != nil {
-		return handleError(err)
+		return false, err
+	}
+
+	return looksEncrypted(file), nil
+}
+
+// binary encrypted files and streams start with a valid header, every
+// line of an armored one is hex, with the salt on the second line
+func looksEncrypted(file []byte) bool {
+
+	if isSigned(file) {
+		unwrapped, _, err := unwrapSigned(file)
+		return err == nil && looksEncrypted(unwrapped)
+	}
+
+	if isPEM(file) {
+		unwrapped, err := unwrapPEM(file)
+		return err == nil && looksEncrypted(unwrapped)
+	}
+
+	if isStream(file) {
+		if len(file) < streamHeaderSize {
+			return false
+		}
+		_, err := parseStreamHeader(file[:streamHeaderSize])
+		return err == nil
+	}
+
+	if isBinary(file) {
+		_, err := parseBinaryHeader(file)
+		return err == nil
+	}
+
+	lines := strings.Split(string(file), "\n")
+	if len(lines) < 3 || len(lines) > 5 || len(lines[1]) != hex.EncodedLen(32) {
+		return false
+	}
+
+	for _, line := range lines {
+		if _, err := hex.DecodeString(line); err != nil {
+			return false
+		}
 	}
 
-	return string(passphrase), "", nil
+	return true
 }
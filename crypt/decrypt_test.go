@@ -15,9 +15,12 @@
 package crypt
 
 import (
+	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -34,11 +37,13 @@ func TestDecryptWithGivenPassphrase(t *testing.T) {
 
 	ioutil.WriteFile(filename, []byte(data), 0644)
 
-	Encrypt(filename, decPassphrase)
-
-	name := filename[0 : len(filename) - len(ext)]
+	res, err := Encrypt(filename, decPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+	defer os.Remove(res.Output)
 
-	_, _, err := Decrypt(name, decPassphrase)
+	_, err = Decrypt(res.Output, decPassphrase)
 	if err != nil {
 		t.Fatalf("Decrypt %s: %v", filename, err)
 	}
@@ -63,11 +68,13 @@ func TestDecryptWithGeneratedPassphrase(t *testing.T) {
 	ioutil.WriteFile(filename, []byte(data), 0644)
 
 	// encrypt without given passphrase
-	p, _, _ := Encrypt(filename, []byte(""))
-
-	name := filename[0 : len(filename) - len(ext)]
+	res, err := Encrypt(filename, []byte(""))
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+	defer os.Remove(res.Output)
 
-	_, _, err := Decrypt(name, []byte(p))
+	_, err = Decrypt(res.Output, []byte(res.Passphrase))
 	if err != nil {
 		t.Fatalf("Decrypt %s: %v", filename, err)
 	}
@@ -78,4 +85,205 @@ func TestDecryptWithGeneratedPassphrase(t *testing.T) {
 		t.Fatalf("Decrypt couldn't generate output file")
 	}
 
-}
\ No newline at end of file
+}
+func TestOpenWithoutChecksum(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-decrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "checksum.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, decPassphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+
+	plain, err := open(file, decPassphrase)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if plain.checksum == nil {
+		t.Fatalf("checksum wasn't stored")
+	}
+
+	// files written before checksums were stored only have 3 lines
+	lines := strings.Split(string(file), "\n")
+	legacy := strings.Join(lines[:3], "\n")
+
+	plain, err = open([]byte(legacy), decPassphrase)
+	if err != nil {
+		t.Fatalf("open legacy file: %v", err)
+	}
+	if plain.checksum != nil || string(plain.data) != data {
+		t.Fatalf("unexpected legacy decryption result")
+	}
+}
+
+func TestOpenMalformed(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-decrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "malformed.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, decPassphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+	lines := strings.Split(string(file), "\n")
+
+	// legacy layout so the edited lines aren't caught by the trailer first
+	legacy := func(edit func(l []string)) []byte {
+		l := append([]string(nil), lines[:3]...)
+		edit(l)
+		return []byte(strings.Join(l, "\n"))
+	}
+
+	cases := map[string][]byte{
+		"salt not hex":   legacy(func(l []string) { l[1] = "zz" + l[1][2:] }),
+		"short salt":     legacy(func(l []string) { l[1] = l[1][:32] }),
+		"ciphertext":     legacy(func(l []string) { l[0] = l[0][:len(l[0])-1] }),
+		"short data":     legacy(func(l []string) { l[0] = "00ff" }),
+		"extension hex":  []byte(strings.Join([]string{lines[0], lines[1], "x", lines[3]}, "\n")),
+		"path extension": legacy(func(l []string) { l[2] = hex.EncodeToString([]byte("/../../etc/passwd")) }),
+		"no leading dot": legacy(func(l []string) { l[2] = hex.EncodeToString([]byte("txt")) }),
+		"too many lines": []byte(string(file) + "\n00"),
+	}
+
+	for name, file := range cases {
+		if _, err := open(file, decPassphrase); !errors.Is(err, ErrMalformed) {
+			t.Fatalf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+}
+
+func TestDecryptReturnsErrors(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-decrypt")
+	defer os.RemoveAll(dir)
+
+	if _, err := Decrypt(filepath.Join(dir, "missing"), decPassphrase); err == nil {
+		t.Fatalf("expected an error decrypting a missing file")
+	}
+
+	filename := filepath.Join(dir, "errors.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, decPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	if _, err := Decrypt(res.Output, []byte("wrong")); err == nil {
+		t.Fatalf("expected an error decrypting with a wrong passphrase")
+	}
+
+	if _, err := Encrypt(filepath.Join(dir, "missing.txt"), decPassphrase); err == nil {
+		t.Fatalf("expected an error encrypting a missing file")
+	}
+}
+
+func TestErrorSentinels(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-decrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "sentinels.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+	streamFile := filepath.Join(dir, "sentinels.stream")
+	if err := EncryptResumable(filename, streamFile, filepath.Join(dir, "state"), decPassphrase, Options{}); err != nil {
+		t.Fatalf("EncryptResumable %s: %v", filename, err)
+	}
+	stream, _ := ioutil.ReadFile(streamFile)
+
+	for _, opts := range []Options{{}, {Armor: true}} {
+		res, err := EncryptWithOptions(filename, decPassphrase, Options{Armor: opts.Armor, Overwrite: true})
+		if err != nil {
+			t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+		}
+		file, _ := ioutil.ReadFile(res.Output)
+
+		if _, err := open(file, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("armor %v: expected ErrWrongPassphrase, got %v", opts.Armor, err)
+		}
+		if _, err := open(file[:len(file)-10], decPassphrase); !errors.Is(err, ErrCorruptFile) || !errors.Is(err, ErrTruncated) {
+			t.Fatalf("armor %v: expected a truncated, corrupt file, got %v", opts.Armor, err)
+		}
+	}
+
+	res, _ := EncryptWithOptions(filename, decPassphrase, Options{Overwrite: true})
+	file, _ := ioutil.ReadFile(res.Output)
+	modified := append([]byte(nil), file...)
+	modified[len(modified)-1] ^= 1
+	if _, err := open(modified, decPassphrase); !errors.Is(err, ErrCorruptFile) {
+		t.Fatalf("expected ErrCorruptFile for a modified file, got %v", err)
+	}
+	newer := append([]byte(nil), file...)
+	newer[len(binaryMagic)] = 0xff
+	if _, err := open(newer, decPassphrase); !errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, ErrCorruptFile) {
+		t.Fatalf("expected ErrUnsupportedVersion for a newer file, got %v", err)
+	}
+
+	if _, err := open(stream, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase for a stream, got %v", err)
+	}
+	stream[len(streamMagic)] = 0xff
+	if _, err := open(stream, decPassphrase); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected ErrUnsupportedVersion for a newer stream, got %v", err)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-decrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "report.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	encrypted := filepath.Join(dir, "elsewhere")
+	res, err := EncryptWithOptions(filename, decPassphrase, Options{OutputPath: encrypted})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if res.Output != encrypted {
+		t.Fatalf("output = %s, want %s", res.Output, encrypted)
+	}
+
+	restored := filepath.Join(dir, "restored.txt")
+	res, err = DecryptWithOptions(encrypted, decPassphrase, Options{OutputPath: restored})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions %s: %v", encrypted, err)
+	}
+	if got, _ := ioutil.ReadFile(restored); res.Output != restored || string(got) != data {
+		t.Fatalf("unexpected restored file %s", res.Output)
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-decrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "detect.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, decPassphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	if ok, err := IsEncrypted(res.Output); !ok || err != nil {
+		t.Fatalf("IsEncrypted(%s) = %v, %v", res.Output, ok, err)
+	}
+
+	if ok, err := IsEncrypted(filename); ok || err != nil {
+		t.Fatalf("IsEncrypted(%s) = %v, %v", filename, ok, err)
+	}
+}
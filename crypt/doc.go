@@ -0,0 +1,126 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package crypt implements cloak's passphrase based file encryption.
+//
+// Keys are derived from the passphrase and a random salt with scrypt, or
+// Argon2id when selected through Options.KDF, and file contents are sealed
+// with an authenticated cipher, nacl secretbox by default, or
+// XChaCha20-Poly1305 or AES-256-GCM selected through Options.Cipher and
+// recorded in the header. Options.KeyFile skips the derivation, using a
+// raw 32 byte key read from a file instead.
+//
+// The header is authenticated before any of it is used: binary files seal
+// a hash of it with the metadata and return ErrHeaderModified when it
+// doesn't match, armored files seal a hash of the salt, extension and
+// ciphertext in the trailer. Armored files written before the trailer
+// have no such check and a stripped trailer looks the same, so they are
+// refused with ErrLegacyFormat unless Options.AllowLegacy is set, Migrate
+// rewrites them.
+//
+// Failures can be told apart with errors.Is: ErrWrongPassphrase when the
+// key doesn't open the file, ErrCorruptFile when the file was damaged or
+// modified, matched by ErrMalformed, ErrTruncated and the other corruption
+// errors too, and ErrUnsupportedVersion for formats this release can't
+// read. Every release reads the layouts written before it, Outdated
+// reports files in an old one and Migrate rewrites them in the current one.
+//
+// Derived keys and the plaintext read or restored are zeroed once used,
+// Options.LockMemory also keeps the plaintext out of swap on Linux. This
+// is best effort, copies made by the runtime and the passphrases held by
+// callers are out of reach.
+//
+// Encrypt and Decrypt work on files that fit in memory, EncryptContext and
+// DecryptContext give up once a context is canceled, even while a read is
+// stuck. EncryptStream and DecryptStream seal data in fixed size chunks
+// for inputs of any size, EncryptReader and DecryptReader do the same for
+// callers that want an io.Reader, such as for network streams or stdin.
+// Streams sealed with XChaCha20Poly1305 also authenticate the header and
+// chunk indices as additional data.
+// The path Stdio reads standard input and writes standard output, for
+// pipes.
+// DecryptStreamAt reads a stream from an io.ReaderAt such as a remote
+// object, retrying failed chunks without starting over.
+// EncryptResumable and DecryptResumable record their progress in a state
+// file so an interrupted operation on a huge file continues with Resume
+// from its last checkpoint.
+// EncryptInPlace overwrites a file with its stream instead, journaled so
+// a crash never loses it, when there's no room for a second copy.
+// Options.Progress is called as input is read, by the WithOptions
+// functions and chunk by chunk by EncryptStreamWithOptions and
+// DecryptStreamWithOptions, to show the status of large files.
+//
+// EncryptToRecipients seals a file with a random key wrapped for each
+// X25519 recipient, DecryptWithIdentities opens it with a private key.
+// EncryptMulti also wraps the key for several passphrases, any of which
+// Decrypt accepts. ParseRecipient also reads ssh-ed25519 and ssh-rsa
+// public keys, and ParseSSHIdentity their private keys as written by
+// ssh-keygen.
+// SplitIdentity splits an identity into Shamir shares for trustees and
+// AssembleIdentity puts enough of them back together.
+// EncryptWithKeyProvider has a KeyProvider, such as VaultTransit, wrap the
+// file key instead. TokenKey makes one of a TokenProvider, a hardware token
+// answering challenges such as a YubiKey through CommandToken.
+//
+// EncryptAge and DecryptAge read and write the age v1 format instead, so
+// files can be exchanged with age. identities and recipients are the same
+// X25519 keys, AgeString encodes them the way age does.
+//
+// OpenDecrypted holds the plaintext of a file in an anonymous memory-backed
+// file and encrypts it back on Close, for embedded databases and other
+// libraries that need a file descriptor.
+//
+// EstimateStrength estimates how hard a passphrase is to guess in the
+// manner of zxcvbn, and PassphrasePolicy refuses the ones below a minimum
+// entropy or on a deny list. Encrypt doesn't check passphrases itself.
+// The passphrases it generates when none is given are described by
+// Options.Generator, such as diceware phrases of common words.
+//
+// EncryptToURL uploads a stream to an object store while it's encrypted,
+// such as to s3://bucket/key with S3. RegisterStorage adds other Storage
+// destinations.
+//
+// Options.Sign signs an encrypted file with an Ed25519 SigningKey, and
+// Options.Signers makes decrypting require a signature by a trusted
+// VerifyingKey. Signer checks the signature of a file without the
+// passphrase.
+//
+// Spec describes the file formats, with field offsets and algorithm ids,
+// for other implementations. Conform checks a file against it without the
+// passphrase, and Inspect reports its version, cipher, key derivation
+// parameters, extension and size.
+//
+// Nothing is written to the standard logger, progress messages go to
+// Options.Logger when it is set, along with the decisions behind each file
+// at slog.LevelDebug. NewReport turns a Result, or an error, into a Report
+// for tools that consume json, and ErrorKind classifies errors so they can
+// tell a wrong passphrase from a damaged file.
+//
+// # Concurrency
+//
+// All exported functions are safe for concurrent use by multiple
+// goroutines. The package keeps no mutable state besides the cipher,
+// compressor and entropy check registries, which are guarded by locks, so
+// callers don't need to create or share instances. Every call derives its
+// own key and draws its own salt and nonces. EncryptMany encrypts many
+// files with a bounded number of goroutines, and EncryptStreamWithOptions
+// seals the chunks of one stream on Options.Workers goroutines while
+// writing them in order.
+//
+// Unless Options.OutputPath is set, Decrypt writes the restored file as
+// "out" plus the original extension in the working directory, so
+// concurrent Decrypt calls for files with the same extension write to the
+// same path. Use Plaintext to decrypt concurrently without touching the
+// disk. FileExtension and EncryptedName tell which extension is recorded
+// and which name a file is encrypted to.
+package crypt
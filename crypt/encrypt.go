@@ -16,33 +16,41 @@ package crypt
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
-	"path/filepath"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"time"
 
-	"golang.org/x/crypto/nacl/secretbox"
-	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/blake2b"
 )
 
 // on Linux, Reader uses getrandom(2) if available, /dev/urandom otherwise.
 // on OpenBSD, Reader uses getentropy(2).
 // on other Unix-like systems, Reader reads from /dev/urandom.
 // on Windows systems, Reader uses the CryptGenRandom API.
-func random(size int) []byte {
+func random(size int) ([]byte, error) {
 	r := make([]byte, size)
 	_, err := rand.Read(r)
 	if err != nil {
-		log.Fatal("error: ", err)
-		return nil
+		return nil, err
 	}
 
-	return r
+	return r, nil
 }
 
-// reads the target file
+// reads the target file, standard input when path is Stdio
 func readFile(path string) ([]byte, error) {
+	if path == Stdio {
+		return ioutil.ReadAll(stdin)
+	}
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -50,76 +58,420 @@ func readFile(path string) ([]byte, error) {
 	return data, nil
 }
 
-// creates the output encrypted file without extension
+// checks and maps the file to encrypt, returning the metadata to record
+// with it. it is read instead when opts has a context, so a stuck read can
+// be abandoned, or a progress func, as faults on a mapped file can't be
+// interrupted or counted. a mapped file is recorded in opts so seal checks
+// it didn't change. standard input is read when path is Stdio, it has no
+// metadata and can't be shredded.
+func readInput(path string, opts *Options) ([]byte, *fileMeta, func() error, error) {
+
+	noRelease := func() error { return nil }
+
+	if path == Stdio {
+		if opts.ShredOriginal {
+			return nil, nil, nil, errors.New("standard input can't be shredded")
+		}
+		opts.trace("reading standard input")
+		data, err := readFileContext(opts.context(), path, opts.Progress)
+		return data, nil, noRelease, err
+	}
+
+	if !opts.AllowSpecial {
+		if err := CheckRegular(path); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	meta, err := originalMeta(path, *opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	opts.trace("recording metadata", "recorded", meta != nil)
+
+	if opts.ctx == nil && opts.Progress == nil && !opts.LockMemory {
+		opts.trace("mapping the input", "path", path)
+		data, release, info, err := mapFile(path)
+		if info != nil {
+			opts.mapped = &mappedInput{path: path, info: info}
+		}
+		return data, meta, release, err
+	}
+
+	opts.trace("reading the input instead of mapping it, to cancel, report progress or lock it", "path", path)
+	data, err := readFileContext(opts.context(), path, opts.Progress)
+	return data, meta, noRelease, err
+}
+
+// encodes an armored encrypted file
 // save encrypted data in hex
 // appends hex salt to output file
 // appends hex file ext to output file
-func createEncryptedFile(file string, salt, content []byte) (string, error) {
-
-	extension := filepath.Ext(file)
-	name := file[0 : len(file) - len(extension)]
+// appends hex sealed checksum and rotation metadata to output file
+// appends the hex trailer to output file
+func encodeArmored(extension string, salt, content, checksum []byte, aead cipher.AEAD) ([]byte, error) {
 
 	hexExt := hex.EncodeToString([]byte(extension))
 
-	final := [][]byte{[]byte(hex.EncodeToString(content)), []byte(hex.EncodeToString(salt)), []byte(hexExt)}
+	final := [][]byte{
+		[]byte(hex.EncodeToString(content)),
+		[]byte(hex.EncodeToString(salt)),
+		[]byte(hexExt),
+		[]byte(hex.EncodeToString(checksum)),
+		nil,
+	}
 
-	err := ioutil.WriteFile(name, bytes.Join(final, []byte("\n")), 0644)
+	body := bytes.Join(final, []byte("\n"))
+	trailer, err := sealTrailer(aead, body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return name, nil
+	return append(body, trailer...), nil
+}
+
+// the name an encrypted copy of path is written to, standard input is
+// written to standard output
+func outputName(path string, opts Options) string {
+	if opts.OutputPath != "" {
+		return opts.OutputPath
+	}
+	if path == Stdio {
+		return Stdio
+	}
+	stem, _ := splitExt(path)
+	return stem + Extension
 }
 
-func handleError(e error) (string, string, error) {
-	log.Fatal(e)
-	return "", "", e
+// returns ErrOutputExists if writing body to name, or to the parts it is
+// split into, would replace a file
+func checkClobber(name string, body []byte, aead cipher.AEAD, partSize int64) error {
+
+	names := []string{name}
+	if partSize > 0 {
+		names = nil
+		count := partCount(int64(len(body)), partSize, aead)
+		for i := uint32(1); i <= count; i++ {
+			names = append(names, partName(name, i, count))
+		}
+	}
+	for _, n := range names {
+		if _, err := os.Lstat(n); err == nil {
+			return fmt.Errorf("%w: %s", ErrOutputExists, n)
+		}
+	}
+
+	return nil
+}
+
+// creates the output encrypted file
+//
+// when opts.PartSize is set the file is split into parts instead, which
+// are returned along with the name of the first one
+func createEncryptedFile(name string, body []byte, aead cipher.AEAD, opts Options) (string, []string, error) {
+
+	if name == Stdio {
+		opts.trace("writing standard output")
+		return name, nil, writeStdout(body, opts)
+	}
+
+	if !opts.Overwrite {
+		if err := checkClobber(name, body, aead, opts.PartSize); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if opts.PartSize > 0 {
+		opts.trace("splitting the output into parts", "part_size", opts.PartSize)
+		parts, err := writeParts(name, body, opts.PartSize, aead, opts.Mode)
+		if err != nil {
+			return "", nil, err
+		}
+		return parts[0], parts, nil
+	}
+
+	err := writeFile(name, body, defaultEncryptedMode, opts.Mode)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, nil, nil
 }
 
 // scrypt derives a 64 bytes key based from the passphrase if its provided
 // or randomly generates a passphrase if its not provided.
 // uses nacl box to encrypt the data using derived scrypt key
-func Encrypt(path string, passphrase []byte) (string, string, error) {
+func Encrypt(path string, passphrase []byte) (*Result, error) {
+	return EncryptWithOptions(path, passphrase, Options{})
+}
+
+// EncryptWithOptions is like Encrypt but configured with opts. path, and
+// opts.OutputPath, may be Stdio to read standard input or write standard
+// output.
+func EncryptWithOptions(path string, passphrase []byte, opts Options) (*Result, error) {
+
+	start := time.Now()
+
+	data, meta, release, err := readInput(path, &opts)
+	if err != nil {
+		return nil, err
+	}
+	// a mapped input is the file itself and can't be wiped
+	if opts.mapped == nil {
+		defer opts.hold(data)()
+	}
+
+	extension := FileExtension(path)
+	name := outputName(path, opts)
+
+	res, err := encrypt(data, name, extension, meta, passphrase, opts, start)
+	release()
+
+	return shredAfter(path, res, err, opts)
+}
+
+// EncryptData is like EncryptWithOptions but encrypts data held in memory
+// and writes it to output, opts.OutputPath is ignored. no extension is
+// stored, so Decrypt restores it as "out".
+func EncryptData(data []byte, output string, passphrase []byte, opts Options) (*Result, error) {
+	return encrypt(data, output, "", nil, passphrase, opts, time.Now())
+}
+
+// seals data and writes it to name, along with the original's metadata
+// when meta is set
+func encrypt(data []byte, name, extension string, meta *fileMeta, passphrase []byte, opts Options, start time.Time) (*Result, error) {
+
+	if opts.CheckEntropy {
+		if err := CheckEntropy(); err != nil {
+			return nil, err
+		}
+		opts.trace("random source passed the entropy checks")
+	}
+
+	if opts.Convergent {
+		if err := checkConvergent(passphrase, opts); err != nil {
+			return nil, err
+		}
+		meta = nil
+	}
+
+	if opts.KeyFile != "" {
+		return encryptWithKeyFile(data, name, extension, meta, passphrase, opts, start)
+	}
 
 	if len(passphrase) == 0 {
-		log.Println("generating random passphrase ...")
-		passphrase = []byte(hex.EncodeToString(random(16)))
-		log.Println("file passphrase: ", string(passphrase))
-	} else {
-		log.Println("using user defined passphrase")
+		generated, err := opts.Generator.Generate()
+		if err != nil {
+			return nil, err
+		}
+		passphrase = generated
+		// the only copy left is in the result
+		defer wipe(passphrase)
+		opts.log(slog.LevelInfo, "generated a random passphrase", "bits", int(opts.Generator.Entropy()))
 	}
 
 	// generates a 32 bytes salt
-	salt := random(32)
+	var salt []byte
+	var err error
+	if opts.Convergent {
+		salt = convergentSalt(passphrase, data)
+		opts.trace("derived the salt from the passphrase and contents, convergent mode")
+	} else {
+		salt, err = random(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := LookupCipher(opts.cipher())
+	if err != nil {
+		return nil, err
+	}
+
+	// armored files have no room for the parameters, they always use
+	// the ones every armored file was written with
+	params := opts.KDF.withDefaults()
+	if opts.Armor {
+		if opts.KDF != (KDFParams{}) && params != legacyKDFParams {
+			return nil, errors.New("armored files only support the default scrypt parameters of older versions")
+		}
+		params = legacyKDFParams
+		if opts.Compress != NoCompression {
+			return nil, errors.New("armored files can't be compressed")
+		}
+		if opts.PEM {
+			return nil, errors.New("PEM files wrap the binary format, they can't be armored")
+		}
+		if len(opts.Labels) > 0 {
+			return nil, errors.New("armored files can't hold labels")
+		}
+		if opts.cipher() != SecretBox {
+			return nil, errors.New("armored files only support secretbox")
+		}
+	}
+	if !params.valid() {
+		return nil, fmt.Errorf("invalid %s parameters", params.KDF)
+	}
+	if opts.Armor {
+		opts.trace("armored files use the scrypt parameters of older versions", "kdf", params)
+	}
+
+	derived := time.Now()
+	key, err := deriveKey(passphrase, salt, params, c.KeySize())
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	opts.trace("derived the key from the passphrase", "kdf", params, "took", time.Since(derived))
+	if err := opts.canceled(); err != nil {
+		return nil, err
+	}
+
+	aead, err := c.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Convergent {
+		opts.nonceKey, err = hkdf.Key(sha256.New, key, nil, convergentNonceInfo, sha256.Size)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	var key [32]byte
-	keyBytes, err := scrypt.Key(passphrase, salt, 16384, 8, 1, 32)
+	var h *binaryHeader
+	if !opts.Armor {
+		h = &binaryHeader{version: formatBinary, cipher: opts.cipher(), kdf: params, salt: salt, meta: meta, labels: opts.Labels}
+	}
+
+	res, err := seal(data, name, extension, salt, aead, h, opts, start)
 	if err != nil {
-		return handleError(err)
+		return nil, err
+	}
+
+	res.Secret = newSecret(passphrase)
+	if !opts.Quiet {
+		res.Passphrase = string(passphrase)
+	}
+	res.Salt = salt
+	res.KDF = params
+	res.Cipher = c.Name()
+	return res, nil
+}
+
+// seals data with aead and writes it to name, as an armored file when h is
+// nil and as a binary file with the header h otherwise
+func seal(data []byte, name, extension string, salt []byte, aead cipher.AEAD, h *binaryHeader, opts Options, start time.Time) (res *Result, err error) {
+
+	opts.trace("sealing", "cipher", cipherName(opts.cipher()), "nonce_size", aead.NonceSize())
+
+	if opts.mapped != nil {
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+		defer opts.mapped.recoverFault(&err)
 	}
 
-	// trick to set a fixed slice size for nacl
-	copy(key[:], keyBytes)
+	// a blake2b checksum of the plaintext, sealed under its own nonce,
+	// lets decrypt detect corruption when writing the restored file.
+	// it is taken first, a mapped input changing afterwards is caught
+	// before writing.
+	sum := blake2b.Sum512(data)
+
+	// binary files can hold the plaintext compressed
+	payload := data
+	if h != nil && opts.Compress != NoCompression {
+		payload, h.compressor, err = compress(data, opts.Compress)
+		if err != nil {
+			return nil, err
+		}
+		h.origSize = uint64(len(data))
+		if h.compressor == NoCompression {
+			opts.trace("stored uncompressed, compressing didn't make it smaller")
+		} else {
+			opts.trace("compressed", "compressor", compressorName(h.compressor), "bytes", len(data), "compressed", len(payload))
+		}
+	}
 
 	// must use a different nonce for each message you encrypt with the
 	// same key. Since the nonce here is 192 bits long, a random value
 	// provides a sufficiently small probability of repeats.
-	var nonce [24]byte
-	nonceBytes := random(24)
-	copy(nonce[:], nonceBytes)
-
-	data, err := readFile(path)
+	nonce, err := opts.nonce(aead.NonceSize(), nonceData, payload)
 	if err != nil {
-		return handleError(err)
+		return nil, err
 	}
 
 	// saves the nonce at the first 24 bytes of the encrypted output
-	encrypted := secretbox.Seal(nonce[:], data, &nonce, &key)
+	encrypted := aead.Seal(nonce, nonce, payload, nil)
 
-	outputFilename, err := createEncryptedFile(path, salt, encrypted)
+	// the rotation metadata is sealed along with the checksum
+	rot := rotation{created: start, after: opts.RotateAfter}
+	if opts.Convergent {
+		// the time of encryption would tell copies apart
+		rot.created = time.Unix(0, 0)
+	}
+
+	var body []byte
+	if h == nil {
+		checksumNonce, err := random(aead.NonceSize())
+		if err != nil {
+			return nil, err
+		}
+		checksum := aead.Seal(checksumNonce, checksumNonce, append(sum[:], rot.marshal()...), nil)
+
+		body, err = encodeArmored(extension, salt, encrypted, checksum, aead)
+		if err != nil {
+			return nil, err
+		}
+		opts.trace("writing the armored layout")
+	} else {
+		if len(extension) > maxExtLen {
+			return nil, errors.New("file extension is too long")
+		}
+		if err := checkLabels(h.labels); err != nil {
+			return nil, err
+		}
+		h.plainSize = uint64(len(payload))
+		h.ext = []byte(extension)
+		body, err = encodeBinary(h, aead, encrypted, sum[:], rot, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.trace("writing the binary layout", "version", h.version, "labels", len(h.labels), "pem", opts.PEM)
+		if opts.PEM {
+			body = encodePEM(body, h)
+		}
+	}
+	if opts.Sign != nil {
+		if h == nil || opts.PEM {
+			return nil, errors.New("armored and PEM files can't be signed")
+		}
+		body = signFile(body, opts.Sign)
+		opts.trace("signed", "signer", opts.Sign.Public().String())
+	}
+
+	if err := opts.canceled(); err != nil {
+		return nil, err
+	}
+	if err := opts.mapped.check(); err != nil {
+		return nil, err
+	}
+	outputFilename, parts, err := createEncryptedFile(name, body, aead, opts)
 	if err != nil {
-		return handleError(err)
+		return nil, err
+	}
+	if opts.ShredOriginal {
+		if err := confirmWritten(outputFilename, parts, body); err != nil {
+			return nil, err
+		}
 	}
+	opts.log(slog.LevelInfo, "encrypted", "output", outputFilename, "bytes", len(body), "parts", len(parts))
 
-	return string(passphrase), outputFilename, nil
+	return &Result{
+		Output:        outputFilename,
+		Parts:         parts,
+		BytesIn:       int64(len(data)),
+		BytesOut:      int64(len(body)),
+		Duration:      time.Since(start),
+		PlaintextHash: sum[:],
+		Created:       start,
+		RotateAfter:   opts.RotateAfter,
+	}, nil
 }
@@ -15,9 +15,14 @@
 package crypt
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"golang.org/x/crypto/blake2b"
 )
 
 // https://en.wikiquote.org/wiki/Rick_Cook
@@ -38,12 +43,13 @@ func TestEncryptPassphraseGeneration(t *testing.T) {
 
 	ioutil.WriteFile(filename, []byte(data), 0644)
 
-	pass, _, err := Encrypt(filename, passphrase)
+	res, err := Encrypt(filename, passphrase)
 	if err != nil {
 		t.Fatalf("Encrypt %s: %v", filename, err)
 	}
+	defer os.Remove(res.Output)
 
-	if (pass == "") {
+	if (res.Passphrase == "") {
 		t.Fatalf("Passphrase wasn't generated")
 	}
 }
@@ -58,13 +64,186 @@ func TestEncryptWithPassphrase(t *testing.T) {
 	defer os.Remove(filename)
 
 	// set passphrase
-	pass, _, err := Encrypt(filename, passphrase)
+	res, err := Encrypt(filename, passphrase)
 
 	if err != nil {
 		t.Fatalf("Encrypt %s: %v", filename, err)
 	}
+	defer os.Remove(res.Output)
 
-	if (pass != string(passphrase)) {
+	if (res.Passphrase != string(passphrase)) {
 		t.Fatalf("Invalid passphrase")
 	}
 }
+
+func TestEncryptResult(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-encrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "result.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	info, err := os.Stat(res.Output)
+	if err != nil {
+		t.Fatalf("Stat %s: %v", res.Output, err)
+	}
+
+	if res.BytesIn != int64(len(data)) || res.BytesOut != info.Size() {
+		t.Fatalf("unexpected sizes in %d out %d", res.BytesIn, res.BytesOut)
+	}
+
+	if len(res.Salt) != 32 || res.KDF != DefaultKDFParams || res.Cipher != "secretbox" {
+		t.Fatalf("unexpected parameters %+v", res)
+	}
+
+	sum := blake2b.Sum512([]byte(data))
+	if !bytes.Equal(res.PlaintextHash, sum[:]) {
+		t.Fatalf("unexpected plaintext hash")
+	}
+}
+
+func TestEncryptData(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-encrypt")
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "secret.cloak")
+	res, err := EncryptData([]byte(data), output, passphrase, Options{})
+	if err != nil {
+		t.Fatalf("EncryptData: %v", err)
+	}
+	if res.Output != output {
+		t.Fatalf("output = %s, want %s", res.Output, output)
+	}
+
+	plain, ext, err := PlaintextExt(output, passphrase)
+	if err != nil {
+		t.Fatalf("PlaintextExt: %v", err)
+	}
+	if string(plain) != data || ext != "" {
+		t.Fatalf("unexpected contents or extension %q", ext)
+	}
+}
+
+func TestEncryptKDFParams(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-encrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "kdf.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	params := KDFParams{KDF: Scrypt, N: 1 << 12, R: 4, P: 2}
+	res, err := EncryptWithOptions(filename, passphrase, Options{KDF: params})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if res.KDF != params {
+		t.Fatalf("expected parameters %+v, got %+v", params, res.KDF)
+	}
+
+	// decrypting reads the parameters from the header
+	plain, _, err := openPath(res.Output, passphrase)
+	if err != nil {
+		t.Fatalf("openPath %s: %v", res.Output, err)
+	}
+	if string(plain.data) != data || plain.kdf != params {
+		t.Fatalf("unexpected contents or parameters %+v", plain.kdf)
+	}
+
+	for _, bad := range []KDFParams{{N: 1000, R: 8, P: 1}, {N: 1 << 30, R: 8, P: 1}, {N: 1 << 14, R: 0, P: 1}} {
+		if _, err := EncryptWithOptions(filename, passphrase, Options{KDF: bad}); err == nil {
+			t.Fatalf("expected an error for parameters %+v", bad)
+		}
+	}
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{KDF: params, Armor: true}); err == nil {
+		t.Fatalf("expected an error for custom parameters of an armored file")
+	}
+}
+
+func TestEncryptArgon2id(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-encrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "argon2id.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	params := KDFParams{KDF: Argon2id, Time: 1, Memory: 64, Threads: 2}
+	res, err := EncryptWithOptions(filename, passphrase, Options{KDF: params})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	// the function is picked from the header when decrypting
+	plain, _, err := openPath(res.Output, passphrase)
+	if err != nil {
+		t.Fatalf("openPath %s: %v", res.Output, err)
+	}
+	if string(plain.data) != data || plain.kdf != params {
+		t.Fatalf("unexpected contents or parameters %+v", plain.kdf)
+	}
+
+	if _, _, err := openPath(res.Output, []byte("wrong")); err == nil {
+		t.Fatalf("expected an error for a wrong passphrase")
+	}
+
+	if p := (KDFParams{KDF: Argon2id}).withDefaults(); p != DefaultArgon2idParams {
+		t.Fatalf("unexpected default argon2id parameters %+v", p)
+	}
+
+	for _, bad := range []KDFParams{{KDF: Argon2id, Time: 0, Memory: 64, Threads: 1}, {KDF: Argon2id, Time: 1, Memory: 8, Threads: 4}, {KDF: Argon2id, Time: 17, Memory: 64, Threads: 1}, {KDF: Argon2id, Time: 1, Memory: 2 << 20, Threads: 1}, {KDF: 9, N: 1 << 14, R: 8, P: 1}} {
+		if _, err := EncryptWithOptions(filename, passphrase, Options{KDF: bad}); err == nil {
+			t.Fatalf("expected an error for parameters %+v", bad)
+		}
+	}
+}
+
+func TestEncryptRefusesOverwrite(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-encrypt")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "report.pdf")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+	if want := filepath.Join(dir, "report"+Extension); res.Output != want {
+		t.Fatalf("output = %s, want %s", res.Output, want)
+	}
+	first, _ := ioutil.ReadFile(res.Output)
+
+	if _, err := Encrypt(filename, passphrase); !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("expected ErrOutputExists, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(res.Output); !bytes.Equal(got, first) {
+		t.Fatalf("existing output was modified")
+	}
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Overwrite: true}); err != nil {
+		t.Fatalf("EncryptWithOptions with Overwrite: %v", err)
+	}
+
+	// any part of a split output counts
+	other := filepath.Join(dir, "other")
+	ioutil.WriteFile(other+".002", nil, 0644)
+	opts := Options{OutputPath: other, PartSize: minPartSize(&secretBoxAEAD{})}
+	big := filepath.Join(dir, "big.bin")
+	ioutil.WriteFile(big, bytes.Repeat([]byte(data), 20), 0644)
+	if _, err := EncryptWithOptions(big, passphrase, opts); !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("expected ErrOutputExists for an existing part, got %v", err)
+	}
+	if _, err := os.Stat(other + ".001"); !os.IsNotExist(err) {
+		t.Fatalf("first part was written before the check: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// ErrEntropy is returned when the random source fails a health check, no
+// key, salt or nonce is generated from it.
+var ErrEntropy = errors.New("random source failed a health check")
+
+// EntropyCheck inspects the random source before keys and salts are
+// generated from it, returning an error when it can't be trusted.
+type EntropyCheck func() error
+
+// names of the checks shipped with cloak
+const (
+	// the kernel pool is initialized, so reads don't come from an
+	// unseeded generator early in boot. only checked on Linux
+	EntropyReady = "ready"
+
+	// a sample of the random source passes basic statistical tests
+	EntropyStatistics = "statistics"
+)
+
+var (
+	entropyMu     sync.RWMutex
+	entropyChecks = make(map[string]EntropyCheck)
+)
+
+// RegisterEntropyCheck adds a check run by CheckEntropy. it panics if
+// check is nil or if the name is already taken.
+func RegisterEntropyCheck(name string, check EntropyCheck) {
+	entropyMu.Lock()
+	defer entropyMu.Unlock()
+
+	if check == nil {
+		panic("crypt: RegisterEntropyCheck check is nil")
+	}
+	if _, dup := entropyChecks[name]; dup {
+		panic(fmt.Sprintf("crypt: RegisterEntropyCheck called twice for %s", name))
+	}
+	entropyChecks[name] = check
+}
+
+// EntropyChecks returns the names of all registered checks in order.
+func EntropyChecks() []string {
+	entropyMu.RLock()
+	defer entropyMu.RUnlock()
+
+	names := make([]string, 0, len(entropyChecks))
+	for name := range entropyChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckEntropy runs the registered checks in name order and returns the
+// first failure wrapped in ErrEntropy. encrypting runs it first when
+// Options.CheckEntropy is set.
+func CheckEntropy() error {
+
+	for _, name := range EntropyChecks() {
+		entropyMu.RLock()
+		check := entropyChecks[name]
+		entropyMu.RUnlock()
+
+		if err := check(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrEntropy, name, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterEntropyCheck(EntropyReady, entropyReady)
+	RegisterEntropyCheck(EntropyStatistics, func() error {
+		return sampleLooksRandom(rand.Reader)
+	})
+}
+
+// bits in a statistics sample, as in the FIPS 140-2 power-up tests
+const entropySampleBits = 20000
+
+// tests a sample of r like the FIPS 140-2 monobit and long run tests. the
+// bounds are wider than FIPS so a healthy source fails less than once in
+// ten million runs rather than once in ten thousand, they still catch
+// stuck, biased or repeating output.
+func sampleLooksRandom(r io.Reader) error {
+
+	sample := make([]byte, entropySampleBits/8)
+	if _, err := io.ReadFull(r, sample); err != nil {
+		return err
+	}
+
+	ones := 0
+	for _, b := range sample {
+		ones += bits.OnesCount8(b)
+	}
+	// six standard deviations around half the bits
+	if ones < entropySampleBits/2-425 || ones > entropySampleBits/2+425 {
+		return fmt.Errorf("%d of %d bits set", ones, entropySampleBits)
+	}
+
+	run, longest := 0, 0
+	last := -1
+	for _, b := range sample {
+		for i := 7; i >= 0; i-- {
+			bit := int(b>>uint(i)) & 1
+			if bit == last {
+				run++
+			} else {
+				run, last = 1, bit
+			}
+			if run > longest {
+				longest = run
+			}
+		}
+	}
+	if longest >= 40 {
+		return fmt.Errorf("run of %d identical bits", longest)
+	}
+
+	return nil
+}
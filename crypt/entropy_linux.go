@@ -0,0 +1,65 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// getrandom(2) numbers, syscall only defines them for some ports
+var getrandomTrap = map[string]uintptr{
+	"386":      355,
+	"amd64":    318,
+	"arm":      384,
+	"arm64":    278,
+	"loong64":  278,
+	"mips":     4353,
+	"mipsle":   4353,
+	"mips64":   5313,
+	"mips64le": 5313,
+	"ppc64":    359,
+	"ppc64le":  359,
+	"riscv64":  278,
+	"s390x":    349,
+}
+
+const grndNonblock = 1
+
+// asks getrandom for a byte without blocking, it fails with EAGAIN until
+// the kernel pool was seeded. kernels without getrandom pass the check,
+// crypto/rand falls back to /dev/urandom on them.
+func entropyReady() error {
+
+	trap, ok := getrandomTrap[runtime.GOARCH]
+	if !ok {
+		return nil
+	}
+
+	var b [1]byte
+	_, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(&b[0])), 1, grndNonblock)
+	switch errno {
+	case 0, syscall.ENOSYS:
+		return nil
+	case syscall.EAGAIN:
+		return errors.New("the kernel random pool isn't initialized yet")
+	}
+	return errno
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleLooksRandom(t *testing.T) {
+
+	if err := sampleLooksRandom(rand.Reader); err != nil {
+		t.Fatalf("crypto/rand failed the statistics check: %v", err)
+	}
+
+	alternating := bytes.Repeat([]byte{0x55}, entropySampleBits/8)
+	biased := bytes.Repeat([]byte{0x57}, entropySampleBits/8)
+	run := make([]byte, entropySampleBits/8)
+	rand.Read(run)
+	copy(run[100:], make([]byte, 8))
+
+	for name, sample := range map[string][]byte{"biased": biased, "long run": run, "empty": nil} {
+		if err := sampleLooksRandom(bytes.NewReader(sample)); err == nil {
+			t.Fatalf("%s sample passed", name)
+		}
+	}
+
+	// alternating bits are balanced without runs, the monobit and run
+	// tests alone can't tell them from random data
+	if err := sampleLooksRandom(bytes.NewReader(alternating)); err != nil {
+		t.Fatalf("unexpected failure %v", err)
+	}
+}
+
+func TestCheckEntropy(t *testing.T) {
+
+	if err := CheckEntropy(); err != nil {
+		t.Fatalf("CheckEntropy: %v", err)
+	}
+
+	names := EntropyChecks()
+	if len(names) < 2 || names[0] != EntropyReady || names[len(names)-1] != EntropyStatistics {
+		t.Fatalf("unexpected checks %v", names)
+	}
+
+	RegisterEntropyCheck("test-cold", func() error { return errors.New("cold") })
+	defer func() {
+		entropyMu.Lock()
+		delete(entropyChecks, "test-cold")
+		entropyMu.Unlock()
+	}()
+
+	if err := CheckEntropy(); !errors.Is(err, ErrEntropy) {
+		t.Fatalf("expected ErrEntropy, got %v", err)
+	}
+
+	dir, _ := ioutil.TempDir("", "cloak-entropy")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "entropy.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	_, err := EncryptWithOptions(filename, passphrase, Options{CheckEntropy: true})
+	if !errors.Is(err, ErrEntropy) {
+		t.Fatalf("expected ErrEntropy, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "entropy.cloak")); !os.IsNotExist(err) {
+		t.Fatalf("output written from a failing random source")
+	}
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{}); err != nil {
+		t.Fatalf("EncryptWithOptions without checks: %v", err)
+	}
+}
+
+func TestRegisterEntropyCheckPanics(t *testing.T) {
+
+	for name, check := range map[string]EntropyCheck{"nil": nil, EntropyStatistics: func() error { return nil }} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("RegisterEntropyCheck %s didn't panic", name)
+				}
+			}()
+			RegisterEntropyCheck(name, check)
+		}()
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drish/cloak/internal/shamir"
+)
+
+// an encoded share is the escrow id (8 bytes) + threshold byte + total
+// byte + the recovery public key (32 bytes) + the shamir share of the
+// private key (33 bytes, the last being its index) + the first 4 bytes of
+// the sha256 of everything before, to catch typos when shares are copied
+// by hand.
+//
+// a passphrase share has no public key and holds the share of the
+// padded passphrase instead: its big endian length (2 bytes) + the
+// passphrase + zeros up to a multiple of 32 bytes, so shares don't reveal
+// its exact length.
+const (
+	escrowIDSize   = 8
+	shareValueSize = x25519KeySize + 1
+	shareSize      = escrowIDSize + 2 + x25519KeySize + shareValueSize + 4
+
+	sharePrefix           = "CLOAK-ESCROW-SHARE-"
+	passphraseSharePrefix = "CLOAK-ESCROW-PASSPHRASE-"
+	passphrasePadding     = 32
+	maxEscrowPassphrase   = 1<<16 - 1
+)
+
+// ErrShareMismatch is returned when shares of different escrows, or
+// conflicting copies of one share, are combined.
+var ErrShareMismatch = errors.New("shares don't belong to the same escrow")
+
+// ErrNotEnoughShares is returned when fewer shares than the threshold are
+// assembled.
+var ErrNotEnoughShares = errors.New("not enough shares to assemble the key")
+
+// ErrShareCorrupt is returned when the assembled key doesn't match the
+// recovery public key, or an assembled passphrase isn't padded as it was
+// split, so at least one share was altered.
+var ErrShareCorrupt = errors.New("assembled key doesn't match the recovery public key, a share is corrupt")
+
+// Share is the piece of an escrowed recovery identity, or passphrase,
+// handed to one trustee. any Threshold of the Total shares assemble the
+// identity or passphrase.
+type Share struct {
+	ID        string
+	Index     int
+	Threshold int
+	Total     int
+
+	// public key of the escrowed identity, nil for shares of a passphrase
+	Recipient *Recipient
+
+	value []byte
+}
+
+// ShareStatus describes a set of shares of one escrow.
+type ShareStatus struct {
+	ID        string
+	Threshold int
+	Total     int
+	// nil for shares of a passphrase
+	Recipient *Recipient
+
+	// indexes of the shares present and missing, in order
+	Have    []int
+	Missing []int
+}
+
+// Ready reports whether enough shares are present to assemble the key.
+func (s *ShareStatus) Ready() bool {
+	return len(s.Have) >= s.Threshold
+}
+
+// SplitIdentity splits id into total shares, any threshold of which
+// assemble it again. files encrypted to id.Recipient() can then only be
+// read once enough trustees bring their shares together.
+func SplitIdentity(id *Identity, total, threshold int) ([]*Share, error) {
+	if id.ssh != nil {
+		return nil, errors.New("SSH identities can't be split, escrow a copy of the key file instead")
+	}
+	return splitSecret(id.key.Bytes(), total, threshold, id.Recipient())
+}
+
+// SplitPassphrase splits passphrase into total shares, any threshold of
+// which assemble it again with AssemblePassphrase, so access to files
+// encrypted with it can be escrowed without any single person holding it.
+// unlike identities nothing checks an assembled passphrase but its
+// padding, the files it decrypts are the final check.
+func SplitPassphrase(passphrase []byte, total, threshold int) ([]*Share, error) {
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("a passphrase is required to split it")
+	}
+	if len(passphrase) > maxEscrowPassphrase {
+		return nil, errors.New("passphrase is too long to split")
+	}
+
+	size := (2 + len(passphrase) + passphrasePadding - 1) / passphrasePadding * passphrasePadding
+	padded := make([]byte, 2, size)
+	binary.BigEndian.PutUint16(padded, uint16(len(passphrase)))
+	padded = append(padded, passphrase...)
+	padded = padded[:size]
+	defer wipe(padded)
+
+	return splitSecret(padded, total, threshold, nil)
+}
+
+// splits secret into shares of a new escrow, recipient is nil for
+// passphrases
+func splitSecret(secret []byte, total, threshold int, recipient *Recipient) ([]*Share, error) {
+
+	values, err := shamir.Split(secret, total, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	var escrowID [escrowIDSize]byte
+	if _, err := rand.Read(escrowID[:]); err != nil {
+		return nil, err
+	}
+
+	shares := make([]*Share, len(values))
+	for i, v := range values {
+		shares[i] = &Share{
+			ID:        hex.EncodeToString(escrowID[:]),
+			Index:     i + 1,
+			Threshold: threshold,
+			Total:     total,
+			Recipient: recipient,
+			value:     v,
+		}
+	}
+
+	return shares, nil
+}
+
+// String encodes the share as CLOAK-ESCROW-SHARE- followed by hex, or
+// CLOAK-ESCROW-PASSPHRASE- for shares of a passphrase.
+func (s *Share) String() string {
+
+	id, _ := hex.DecodeString(s.ID)
+
+	prefix := passphraseSharePrefix
+	b := make([]byte, 0, shareSize)
+	b = append(b, id...)
+	b = append(b, byte(s.Threshold), byte(s.Total))
+	if s.Recipient != nil {
+		prefix = sharePrefix
+		b = append(b, s.Recipient.key.Bytes()...)
+	}
+	b = append(b, s.value...)
+	sum := sha256.Sum256(b)
+	b = append(b, sum[:4]...)
+
+	return prefix + strings.ToUpper(hex.EncodeToString(b))
+}
+
+// ParseShare decodes a share encoded by Share.String.
+func ParseShare(s string) (*Share, error) {
+
+	s = strings.TrimSpace(s)
+	passphrase := strings.HasPrefix(s, passphraseSharePrefix)
+	var encoded string
+	switch {
+	case passphrase:
+		encoded = s[len(passphraseSharePrefix):]
+	case strings.HasPrefix(s, sharePrefix):
+		encoded = s[len(sharePrefix):]
+	default:
+		return nil, errors.New("invalid share, expected " + sharePrefix + "... or " + passphraseSharePrefix + "...")
+	}
+
+	b, err := hex.DecodeString(encoded)
+	valid := len(b) == shareSize
+	if passphrase {
+		n := len(b) - escrowIDSize - 2 - 1 - 4
+		valid = n > 0 && n%passphrasePadding == 0
+	}
+	if err != nil || !valid {
+		return nil, errors.New("invalid share encoding")
+	}
+	sum := sha256.Sum256(b[:len(b)-4])
+	if !bytes.Equal(sum[:4], b[len(b)-4:]) {
+		return nil, errors.New("invalid share checksum, it was probably mistyped")
+	}
+
+	threshold, total := int(b[escrowIDSize]), int(b[escrowIDSize+1])
+	start := escrowIDSize + 2
+	if !passphrase {
+		start += x25519KeySize
+	}
+	value := b[start : len(b)-4]
+	index := int(value[len(value)-1])
+	if threshold < 2 || threshold > total || index < 1 || index > total {
+		return nil, errors.New("invalid share parameters")
+	}
+
+	share := &Share{
+		ID:        hex.EncodeToString(b[:escrowIDSize]),
+		Index:     index,
+		Threshold: threshold,
+		Total:     total,
+		value:     append([]byte(nil), value...),
+	}
+	if !passphrase {
+		key, err := ecdh.X25519().NewPublicKey(b[escrowIDSize+2 : escrowIDSize+2+x25519KeySize])
+		if err != nil {
+			return nil, err
+		}
+		share.Recipient = &Recipient{key: key}
+	}
+
+	return share, nil
+}
+
+// ParseShares decodes one share per line of data, skipping blank lines and
+// comments starting with #, as written by the escrow create command.
+func ParseShares(data []byte) ([]*Share, error) {
+
+	var shares []*Share
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		share, err := ParseShare(line)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(shares) == 0 {
+		return nil, errors.New("no shares found")
+	}
+	return shares, nil
+}
+
+// CheckShares returns the status of shares, which must all belong to the
+// same escrow. the same share given twice is only counted once.
+func CheckShares(shares []*Share) (*ShareStatus, error) {
+
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+
+	first := shares[0]
+	status := &ShareStatus{
+		ID:        first.ID,
+		Threshold: first.Threshold,
+		Total:     first.Total,
+		Recipient: first.Recipient,
+	}
+
+	seen := make(map[int][]byte)
+	for _, s := range shares {
+		if s.ID != first.ID || s.Threshold != first.Threshold || s.Total != first.Total ||
+			!sameRecipient(s.Recipient, first.Recipient) || len(s.value) != len(first.value) {
+			return nil, ErrShareMismatch
+		}
+		if v, ok := seen[s.Index]; ok {
+			if !bytes.Equal(v, s.value) {
+				return nil, fmt.Errorf("%w, share %d differs between copies", ErrShareMismatch, s.Index)
+			}
+			continue
+		}
+		seen[s.Index] = s.value
+		status.Have = append(status.Have, s.Index)
+	}
+	sort.Ints(status.Have)
+
+	for i := 1; i <= status.Total; i++ {
+		if _, ok := seen[i]; !ok {
+			status.Missing = append(status.Missing, i)
+		}
+	}
+
+	return status, nil
+}
+
+func sameRecipient(a, b *Recipient) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.key.Equal(b.key)
+}
+
+// AssembleIdentity combines shares made by SplitIdentity back into the
+// recovery identity, checking it against the public key they carry.
+func AssembleIdentity(shares []*Share) (*Identity, error) {
+
+	secret, status, err := combineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(secret)
+	if status.Recipient == nil {
+		return nil, errors.New("shares hold a passphrase, not an identity")
+	}
+
+	key, err := ecdh.X25519().NewPrivateKey(secret)
+	if err != nil {
+		return nil, ErrShareCorrupt
+	}
+	if !key.PublicKey().Equal(status.Recipient.key) {
+		return nil, ErrShareCorrupt
+	}
+
+	return &Identity{key: key}, nil
+}
+
+// AssemblePassphrase combines shares made by SplitPassphrase back into the
+// passphrase.
+func AssemblePassphrase(shares []*Share) ([]byte, error) {
+
+	secret, status, err := combineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(secret)
+	if status.Recipient != nil {
+		return nil, errors.New("shares hold an identity, not a passphrase")
+	}
+
+	n := int(binary.BigEndian.Uint16(secret))
+	if n == 0 || 2+n > len(secret) || len(secret)-(2+n) >= passphrasePadding {
+		return nil, ErrShareCorrupt
+	}
+	for _, b := range secret[2+n:] {
+		if b != 0 {
+			return nil, ErrShareCorrupt
+		}
+	}
+
+	return append([]byte(nil), secret[2:2+n]...), nil
+}
+
+// combines the distinct shares once there are enough of them
+func combineShares(shares []*Share) ([]byte, *ShareStatus, error) {
+
+	status, err := CheckShares(shares)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !status.Ready() {
+		return nil, nil, fmt.Errorf("%w, have %d of the %d needed", ErrNotEnoughShares, len(status.Have), status.Threshold)
+	}
+
+	var values [][]byte
+	used := make(map[int]bool)
+	for _, s := range shares {
+		if !used[s.Index] {
+			used[s.Index] = true
+			values = append(values, s.value)
+		}
+	}
+
+	secret, err := shamir.Combine(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secret, status, nil
+}
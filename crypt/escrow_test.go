@@ -0,0 +1,162 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEscrow(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-escrow")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "will.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	id, _ := GenerateIdentity()
+	shares, err := SplitIdentity(id, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitIdentity: %v", err)
+	}
+
+	res, err := EncryptToRecipients(filename, []*Recipient{id.Recipient()}, Options{})
+	if err != nil {
+		t.Fatalf("EncryptToRecipients: %v", err)
+	}
+
+	// shares survive being written out and read back
+	var text string
+	for _, i := range []int{4, 1} {
+		text += "# share\n" + shares[i].String() + "\n"
+	}
+	parsed, err := ParseShares([]byte(text))
+	if err != nil || len(parsed) != 2 {
+		t.Fatalf("ParseShares: %v", err)
+	}
+
+	status, err := CheckShares(append(parsed, parsed[0]))
+	if err != nil {
+		t.Fatalf("CheckShares: %v", err)
+	}
+	if status.Ready() || len(status.Have) != 2 || status.Have[0] != 2 || len(status.Missing) != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if _, err := AssembleIdentity(parsed); !errors.Is(err, ErrNotEnoughShares) {
+		t.Fatalf("expected ErrNotEnoughShares, got %v", err)
+	}
+
+	assembled, err := AssembleIdentity(append(parsed, shares[2]))
+	if err != nil {
+		t.Fatalf("AssembleIdentity: %v", err)
+	}
+	if assembled.String() != id.String() {
+		t.Fatalf("assembled a different identity")
+	}
+
+	got, err := PlaintextWithIdentities(res.Output, []*Identity{assembled})
+	if err != nil || string(got) != data {
+		t.Fatalf("PlaintextWithIdentities: %v", err)
+	}
+}
+
+func TestEscrowInvalidShares(t *testing.T) {
+
+	id, _ := GenerateIdentity()
+	shares, _ := SplitIdentity(id, 3, 2)
+	other, _ := SplitIdentity(id, 3, 2)
+
+	if _, err := CheckShares([]*Share{shares[0], other[1]}); !errors.Is(err, ErrShareMismatch) {
+		t.Fatalf("expected ErrShareMismatch mixing escrows, got %v", err)
+	}
+
+	// a mistyped character fails the checksum
+	s := []byte(shares[0].String())
+	if s[len(s)-10] == 'A' {
+		s[len(s)-10] = 'B'
+	} else {
+		s[len(s)-10] = 'A'
+	}
+	if _, err := ParseShare(string(s)); err == nil {
+		t.Fatalf("ParseShare accepted a mistyped share")
+	}
+
+	// an altered share with a valid encoding is caught by the public key
+	tampered := *shares[1]
+	tampered.value = append([]byte(nil), shares[1].value...)
+	tampered.value[0] ^= 1
+	if _, err := AssembleIdentity([]*Share{shares[0], &tampered}); !errors.Is(err, ErrShareCorrupt) {
+		t.Fatalf("expected ErrShareCorrupt, got %v", err)
+	}
+}
+
+func TestEscrowPassphrase(t *testing.T) {
+
+	shares, err := SplitPassphrase(passphrase, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitPassphrase: %v", err)
+	}
+
+	var text string
+	for _, i := range []int{0, 2, 4} {
+		text += shares[i].String() + "\n"
+	}
+	parsed, err := ParseShares([]byte(text))
+	if err != nil || len(parsed) != 3 {
+		t.Fatalf("ParseShares: %v", err)
+	}
+	if parsed[0].Recipient != nil {
+		t.Fatalf("expected a passphrase share without a public key")
+	}
+
+	if _, err := AssemblePassphrase(parsed[:2]); !errors.Is(err, ErrNotEnoughShares) {
+		t.Fatalf("expected ErrNotEnoughShares, got %v", err)
+	}
+	assembled, err := AssemblePassphrase(parsed)
+	if err != nil {
+		t.Fatalf("AssemblePassphrase: %v", err)
+	}
+	if string(assembled) != string(passphrase) {
+		t.Fatalf("assembled %q, expected %q", assembled, passphrase)
+	}
+	if _, err := AssembleIdentity(parsed); err == nil {
+		t.Fatalf("expected an error assembling an identity from passphrase shares")
+	}
+
+	// shares are padded, they don't tell a short passphrase from a longer one
+	short, _ := SplitPassphrase([]byte("a"), 3, 2)
+	long, _ := SplitPassphrase([]byte("twenty nine characters long!!"), 3, 2)
+	if len(short[0].String()) != len(long[0].String()) {
+		t.Fatalf("shares reveal the passphrase length")
+	}
+
+	id, _ := GenerateIdentity()
+	identityShares, _ := SplitIdentity(id, 5, 3)
+	identityShares[0].ID = shares[0].ID
+	if _, err := CheckShares([]*Share{shares[0], identityShares[0]}); !errors.Is(err, ErrShareMismatch) {
+		t.Fatalf("expected ErrShareMismatch mixing passphrase and identity shares, got %v", err)
+	}
+
+	tampered := *shares[1]
+	tampered.value = append([]byte(nil), shares[1].value...)
+	tampered.value[0] ^= 1
+	if _, err := AssemblePassphrase([]*Share{shares[0], &tampered, shares[2]}); !errors.Is(err, ErrShareCorrupt) {
+		t.Fatalf("expected ErrShareCorrupt, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrNotEncrypted is returned when a file isn't a cloak encrypted file.
+var ErrNotEncrypted = errors.New("not a cloak encrypted file")
+
+// ErrUnsupportedVersion is returned for files in a format version this
+// release can't read, such as files written by a newer release.
+var ErrUnsupportedVersion = errors.New("unsupported format version")
+
+// FormatInfo describes the layout of an encrypted file.
+type FormatInfo struct {
+	// format version of the file
+	Version int
+
+	// a plaintext checksum is stored, see Decrypt
+	Checksum bool
+
+	// truncation is detected, by a trailer or a length stored up front
+	Trailer bool
+
+	// plaintext bytes per chunk of streamed files, 0 for other formats
+	ChunkSize int
+
+	// cipher and key derivation parameters the file was sealed with
+	Cipher string
+	KDF    KDFParams
+
+	// extension of the original file, empty for streams
+	Ext string
+
+	// number of wrapped keys of files encrypted to recipients
+	Recipients int
+
+	// the binary file is wrapped in a PEM block, see Options.PEM
+	PEM bool
+
+	// key the file is signed with, its signature was verified. nil when
+	// it isn't signed, see Options.Sign
+	Signer *VerifyingKey
+}
+
+// ReadFormat reports the layout of the encrypted file at path, it doesn't
+// need the passphrase. the signature of a signed file is verified.
+func ReadFormat(path string) (FormatInfo, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return FormatInfo{}, err
+	}
+	defer f.Close()
+
+	// binary and streamed files can be large, their header is enough
+	header := make([]byte, binaryFixedSize+maxExtLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FormatInfo{}, err
+	}
+	header = header[:n]
+
+	// a signature covers the whole file, which is read to verify it
+	var signer *VerifyingKey
+	if isSigned(header) {
+		rest, err := ioutil.ReadAll(f)
+		if err != nil {
+			return FormatInfo{}, err
+		}
+		header, signer, err = unwrapSigned(append(header, rest...))
+		if err != nil {
+			return FormatInfo{}, err
+		}
+	}
+
+	info, err := readFormat(f, header, n)
+	if err != nil {
+		return FormatInfo{}, err
+	}
+	info.Signer = signer
+	return info, nil
+}
+
+// reports the layout of the encrypted file starting with the n bytes read
+// into header and continuing in f
+func readFormat(f io.Reader, header []byte, n int) (FormatInfo, error) {
+
+	// the binary file inside a PEM block needs all of it decoded
+	armored := isPEM(header)
+	if armored {
+		rest, err := ioutil.ReadAll(f)
+		if err != nil {
+			return FormatInfo{}, err
+		}
+		header, err = unwrapPEM(append(header, rest...))
+		if err != nil {
+			return FormatInfo{}, err
+		}
+	}
+
+	if n >= streamHeaderSize && string(header[:len(streamMagic)]) == streamMagic {
+		chunkSize, err := parseStreamHeader(header)
+		if err != nil {
+			return FormatInfo{}, err
+		}
+		id, params, err := streamParams(header)
+		if err != nil {
+			return FormatInfo{}, err
+		}
+		// the last chunk flag detects truncation like a trailer
+		return FormatInfo{
+			Version:   formatStream,
+			Trailer:   true,
+			ChunkSize: chunkSize,
+			Cipher:    cipherName(id),
+			KDF:       params,
+		}, nil
+	}
+
+	if isBinary(header) {
+		h, err := parseBinaryHeader(header)
+		if err == ErrTruncated && n == len(header) {
+			// the wrapped keys of many recipients don't fit the prefix
+			rest, readErr := ioutil.ReadAll(f)
+			if readErr != nil {
+				return FormatInfo{}, readErr
+			}
+			h, err = parseBinaryHeader(append(header, rest...))
+		}
+		if err != nil {
+			return FormatInfo{}, err
+		}
+		return FormatInfo{
+			Version:    int(h.version),
+			Checksum:   true,
+			Trailer:    true,
+			Cipher:     cipherName(h.cipher),
+			KDF:        h.kdf,
+			Ext:        string(h.ext),
+			Recipients: len(h.stanzas),
+			PEM:        armored,
+		}, nil
+	}
+
+	rest, err := ioutil.ReadAll(f)
+	if err != nil {
+		return FormatInfo{}, err
+	}
+	file := append(header, rest...)
+
+	if !looksEncrypted(file) {
+		return FormatInfo{}, ErrNotEncrypted
+	}
+
+	lines := strings.Split(string(file), "\n")
+	ext, _ := hex.DecodeString(lines[2])
+
+	return FormatInfo{
+		Version:  formatV0,
+		Checksum: len(lines) > 3,
+		Trailer:  len(lines) > 4,
+		Cipher:   cipherName(SecretBox),
+		KDF:      legacyKDFParams,
+		Ext:      string(ext),
+	}, nil
+}
+
+// FileInfo is what Inspect reports about an encrypted file.
+type FileInfo struct {
+	FormatInfo
+
+	// binary, recipients, stream, armored or pem, as in trace messages
+	Layout string
+
+	// size of the encrypted file in bytes
+	Size int64
+}
+
+// Inspect reports the format version, cipher, key derivation parameters,
+// original extension and size of the encrypted file at path, for tools
+// and inventories. like ReadFormat it doesn't need the passphrase.
+func Inspect(path string) (FileInfo, error) {
+
+	format, err := ReadFormat(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info := FileInfo{FormatInfo: format, Size: fi.Size()}
+	switch {
+	case format.PEM:
+		info.Layout = "pem"
+	case format.Version == formatStream:
+		info.Layout = "stream"
+	case format.Version == formatRecipients:
+		info.Layout = "recipients"
+	case format.Version == formatBinary:
+		info.Layout = "binary"
+	default:
+		info.Layout = "armored"
+	}
+	return info, nil
+}
+
+// the layout of an encrypted file, named in trace messages
+func layoutName(file []byte) string {
+	switch {
+	case isSigned(file):
+		return "signed"
+	case isPEM(file):
+		return "pem"
+	case isStream(file):
+		return "stream"
+	case isBinary(file) && len(file) > len(binaryMagic) && file[len(binaryMagic)] == formatRecipients:
+		return "recipients"
+	case isBinary(file):
+		return "binary"
+	}
+	return "armored"
+}
+
+// name of the cipher registered under id, or its number if it is unknown
+func cipherName(id CipherID) string {
+	c, err := LookupCipher(id)
+	if err != nil {
+		return fmt.Sprintf("cipher %d", id)
+	}
+	return c.Name()
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFormat(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-format")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "format.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	info, err := ReadFormat(res.Output)
+	if err != nil {
+		t.Fatalf("ReadFormat: %v", err)
+	}
+
+	if info.Version != formatV0 || !info.Checksum || !info.Trailer || info.Ext != ".txt" {
+		t.Fatalf("unexpected format %+v", info)
+	}
+
+	res, err = EncryptWithOptions(filename, passphrase, Options{Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	info, err = ReadFormat(res.Output)
+	if err != nil {
+		t.Fatalf("ReadFormat: %v", err)
+	}
+
+	if info.Version != formatBinary || !info.Checksum || !info.Trailer || info.Cipher != "secretbox" || info.KDF != DefaultKDFParams || info.Ext != ".txt" {
+		t.Fatalf("unexpected format %+v", info)
+	}
+
+	file, err := Inspect(res.Output)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	fi, _ := os.Stat(res.Output)
+	if file.FormatInfo != info || file.Layout != "binary" || file.Size != fi.Size() {
+		t.Fatalf("unexpected info %+v", file)
+	}
+
+	if _, err := ReadFormat(filename); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+	if _, err := Inspect(filename); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// characters PassphraseGenerator.Charset can be set to
+const (
+	// lower case hex digits, the default
+	HexCharset = "0123456789abcdef"
+	// letters and digits, easy to select with a double click
+	AlphanumericCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	// printable ASCII without the space
+	PrintableCharset = "!\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+)
+
+// longest passphrase a PassphraseGenerator writes, in characters or words
+const maxGenerated = 1024
+
+var (
+	dicewareOnce  sync.Once
+	dicewareWords []string
+)
+
+// PassphraseGenerator describes the passphrases generated when none is
+// given. the zero value generates 32 hex digits, 128 bits.
+type PassphraseGenerator struct {
+	// number of words of a diceware phrase drawn from a list of common
+	// English words, about 11 bits each, easier to remember and to read
+	// out than characters. when zero Length characters of Charset are
+	// drawn instead.
+	Words int
+
+	// put between the words, "-" when empty
+	Separator string
+
+	// number of characters when Words is zero, 32 when zero
+	Length int
+
+	// characters drawn from, each with the same odds, HexCharset when
+	// empty. repeated characters are counted once.
+	Charset string
+}
+
+// Generate returns a new passphrase drawn from the random source.
+func (g PassphraseGenerator) Generate() ([]byte, error) {
+
+	symbols, sep, err := g.symbols()
+	if err != nil {
+		return nil, err
+	}
+	count := g.count()
+
+	var b []byte
+	for i := 0; i < count; i++ {
+		n, err := randomIndex(len(symbols))
+		if err != nil {
+			wipe(b)
+			return nil, err
+		}
+		if i > 0 {
+			b = append(b, sep...)
+		}
+		b = append(b, symbols[n]...)
+	}
+	return b, nil
+}
+
+// Entropy returns the bits of entropy of the passphrases generated, the
+// log2 of the number of passphrases it can generate.
+func (g PassphraseGenerator) Entropy() float64 {
+	symbols, _, err := g.symbols()
+	if err != nil {
+		return 0
+	}
+	return float64(g.count()) * math.Log2(float64(len(symbols)))
+}
+
+// the number of words or characters generated
+func (g PassphraseGenerator) count() int {
+	switch {
+	case g.Words > 0:
+		return g.Words
+	case g.Length > 0:
+		return g.Length
+	}
+	return 32
+}
+
+// the words or characters drawn from and what separates them
+func (g PassphraseGenerator) symbols() ([]string, string, error) {
+
+	if g.Words < 0 || g.Length < 0 || g.count() > maxGenerated {
+		return nil, "", fmt.Errorf("passphrases are generated with 1 to %d words or characters", maxGenerated)
+	}
+
+	if g.Words > 0 {
+		if g.Length != 0 || g.Charset != "" {
+			return nil, "", errors.New("a passphrase is generated with words or with characters, not both")
+		}
+		dicewareOnce.Do(func() {
+			dicewareWords = strings.Fields(dicewareList)
+		})
+		sep := g.Separator
+		if sep == "" {
+			sep = "-"
+		}
+		return dicewareWords, sep, nil
+	}
+
+	charset := g.Charset
+	if charset == "" {
+		charset = HexCharset
+	}
+	seen := make(map[rune]bool)
+	var symbols []string
+	for _, r := range charset {
+		if !seen[r] {
+			seen[r] = true
+			symbols = append(symbols, string(r))
+		}
+	}
+	if len(symbols) < 2 || len(symbols) > 1<<16 {
+		return nil, "", errors.New("a passphrase is generated from 2 to 65536 different characters")
+	}
+	return symbols, "", nil
+}
+
+// a uniformly random integer in [0, n), n at most 1<<16
+func randomIndex(n int) (int, error) {
+
+	// rejecting the values past the last multiple of n keeps the odds even
+	limit := 1 << 16 / n * n
+	for {
+		b, err := random(2)
+		if err != nil {
+			return 0, err
+		}
+		if v := int(b[0])<<8 | int(b[1]); v < limit {
+			return v % n, nil
+		}
+	}
+}
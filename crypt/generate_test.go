@@ -0,0 +1,78 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPassphraseGenerator(t *testing.T) {
+
+	p, err := PassphraseGenerator{}.Generate()
+	if err != nil || !regexp.MustCompile(`^[0-9a-f]{32}$`).Match(p) {
+		t.Fatalf("expected 32 hex digits by default, got %q, %v", p, err)
+	}
+	if bits := (PassphraseGenerator{}).Entropy(); bits != 128 {
+		t.Fatalf("expected 128 bits by default, got %v", bits)
+	}
+
+	diceware := PassphraseGenerator{Words: 6, Separator: " "}
+	p, err = diceware.Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	words := strings.Split(string(p), " ")
+	if len(words) != 6 {
+		t.Fatalf("expected 6 words, got %q", p)
+	}
+	list := make(map[string]bool)
+	for _, w := range strings.Fields(dicewareList) {
+		list[w] = true
+	}
+	for _, w := range words {
+		if !list[w] {
+			t.Fatalf("%q isn't on the list", w)
+		}
+	}
+	if bits := diceware.Entropy(); bits < 64 {
+		t.Fatalf("expected at least 64 bits from 6 words, got %v", bits)
+	}
+
+	p, _ = PassphraseGenerator{Length: 20, Charset: "ab"}.Generate()
+	if !regexp.MustCompile(`^[ab]{20}$`).Match(p) {
+		t.Fatalf("expected 20 characters of the charset, got %q", p)
+	}
+	if bits := (PassphraseGenerator{Length: 10, Charset: "aabbccdd"}).Entropy(); math.Abs(bits-20) > 1e-9 {
+		t.Fatalf("expected repeated characters counted once, got %v bits", bits)
+	}
+
+	// every character of a charset is drawn
+	seen := make(map[byte]bool)
+	p, _ = PassphraseGenerator{Length: 1000, Charset: AlphanumericCharset}.Generate()
+	for _, c := range p {
+		seen[c] = true
+	}
+	if len(seen) != len(AlphanumericCharset) {
+		t.Fatalf("expected all %d characters drawn, got %d", len(AlphanumericCharset), len(seen))
+	}
+
+	for _, g := range []PassphraseGenerator{{Charset: "a"}, {Words: 2, Length: 3}, {Length: -1}, {Words: maxGenerated + 1}} {
+		if _, err := g.Generate(); err == nil {
+			t.Fatalf("expected an error generating with %+v", g)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// a file encrypted in place becomes a stream, in the format written by
+// EncryptStream. the stream is longer than the plaintext, so the file is
+// first extended by the difference and then sealed from its end back to
+// its start, resumeCheckpoint chunks at a time: the sealed chunks always
+// land at or after the plaintext they replace, so only plaintext already
+// read is overwritten.
+//
+// every block is sealed into a journal next to the file before it is
+// written in place, so a crash at any point is recovered by writing the
+// journaled block again and carrying on below it. the journal holds the
+// header of the stream, the block last written and where it goes, never
+// plaintext:
+// first 8 bytes = magic
+// then a json line describing the operation
+// rest = the sealed block
+const journalMagic = "CLOAKJNL"
+
+// the operation recorded in a journal
+type journal struct {
+	Output string `json:"output"`
+	Size   int64  `json:"size"`
+	Header []byte `json:"header"`
+	// index of the first chunk of the block, the chunks from it to the
+	// end of the file are sealed once the block is written
+	Next uint64 `json:"next"`
+}
+
+// the journal of the file at path
+func journalName(path string) string {
+	dir, base := filepath.Split(path)
+	return filepath.Join(dir, "."+base+".journal")
+}
+
+// number of chunks a stream of size bytes of plaintext is sealed in, the
+// last chunk of an empty stream is empty
+func streamChunks(size int64) uint64 {
+	n := uint64((size + streamChunkSize - 1) / streamChunkSize)
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// EncryptInPlace encrypts the file at path into a stream by overwriting
+// it chunk by chunk, then renames it to opts.OutputPath, or the file with
+// its extension replaced by .cloak. it needs free space for a few bytes
+// per chunk and a journal of 16 MiB rather than for a second copy of the
+// file, for hosts where the plaintext and ciphertext don't fit together.
+//
+// until it completes the file is neither its plaintext nor a valid
+// encrypted file. an interrupted call, even by a crash or power loss, is
+// completed by calling EncryptInPlace again with the same path and
+// passphrase, which finds the journal and carries on where it stopped.
+// chunks are sealed with opts.Cipher, SecretBox or XChaCha20Poly1305, the
+// output is only replaced with opts.Overwrite and its permissions are set
+// to opts.Mode when set. opts.Progress is reported the bytes encrypted.
+// the other options are ignored.
+func EncryptInPlace(path string, passphrase []byte, opts Options) error {
+
+	if len(passphrase) == 0 {
+		return errors.New("a passphrase is required to encrypt a stream")
+	}
+	if path == Stdio || opts.OutputPath == Stdio {
+		return errors.New("standard input and output can't be encrypted in place")
+	}
+
+	j, block, err := readJournal(journalName(path))
+	if os.IsNotExist(err) {
+		return startInPlace(path, passphrase, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	key, err := newStreamKey(j.Header, passphrase)
+	if err != nil {
+		return err
+	}
+	if len(block) > 0 {
+		// another passphrase would seal the rest under another key
+		first := block
+		if j.Next == 0 {
+			first = block[key.size:]
+		}
+		if err := checkChunk(first, j.Next, key); err != nil {
+			return err
+		}
+		if _, err := f.WriteAt(block, chunkOffset(j.Next, key)); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	} else if err := f.Truncate(streamLength(j.Size, key)); err != nil {
+		return err
+	}
+	opts.trace("resuming from the journal", "next", j.Next)
+
+	return sealInPlace(f, path, j, key, opts)
+}
+
+// extends the file at path and seals it from the end
+func startInPlace(path string, passphrase []byte, opts Options) error {
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s isn't a regular file, only files can be encrypted in place", path)
+	}
+	output, err := filepath.Abs(outputName(path, opts))
+	if err != nil {
+		return err
+	}
+	if !opts.Overwrite {
+		if _, err := os.Lstat(output); err == nil {
+			return fmt.Errorf("%w: %s", ErrOutputExists, output)
+		}
+	}
+
+	header, key, err := newStream(passphrase, opts.cipher(), opts.KDF.withDefaults())
+	if err != nil {
+		return err
+	}
+	opts.trace("encrypting in place", "cipher", cipherName(opts.cipher()), "kdf", key.kdf, "chunk_size", streamChunkSize)
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	j := &journal{Output: output, Size: fi.Size(), Header: header, Next: streamChunks(fi.Size())}
+	if err := writeJournal(journalName(path), j, nil); err != nil {
+		return err
+	}
+	if err := f.Truncate(streamLength(j.Size, key)); err != nil {
+		return err
+	}
+
+	return sealInPlace(f, path, j, key, opts)
+}
+
+// offset of chunk i in a stream, where its length is written
+func chunkOffset(i uint64, key *streamKey) int64 {
+	if i == 0 {
+		// the first block starts with the header
+		return 0
+	}
+	return int64(key.size) + int64(i)*int64(4+streamChunkSize+key.aead.Overhead())
+}
+
+// length of the stream of size bytes of plaintext
+func streamLength(size int64, key *streamKey) int64 {
+	return int64(key.size) + size + int64(streamChunks(size))*int64(4+key.aead.Overhead())
+}
+
+// opens chunk i, at the start of a stream body, with key
+func checkChunk(body []byte, i uint64, key *streamKey) error {
+
+	if len(body) < 4 {
+		return ErrTruncated
+	}
+	n := int(binary.BigEndian.Uint32(body))
+	if n < key.aead.Overhead() || 4+n > len(body) {
+		return malformed("invalid chunk length")
+	}
+	plain, _, err := key.open(i, body[4:4+n], nil)
+	wipe(plain)
+	return err
+}
+
+// seals the chunks below j.Next in blocks, from the end of the file back
+// to its start, then renames it to the output
+func sealInPlace(f *os.File, path string, j *journal, key *streamKey, opts Options) error {
+
+	last := streamChunks(j.Size) - 1
+	plain := make([]byte, resumeCheckpoint*streamChunkSize)
+	defer wipe(plain)
+
+	for j.Next > 0 {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+
+		end := j.Next
+		start := uint64(0)
+		if end > resumeCheckpoint {
+			start = end - resumeCheckpoint
+		}
+
+		from := int64(start) * streamChunkSize
+		to := int64(end) * streamChunkSize
+		if to > j.Size {
+			to = j.Size
+		}
+		buf := plain[:to-from]
+		if _, err := f.ReadAt(buf, from); err != nil {
+			return err
+		}
+
+		var block []byte
+		if start == 0 {
+			block = append(block, j.Header...)
+		}
+		for i := start; i < end; i++ {
+			chunk := buf[int64(i-start)*streamChunkSize:]
+			if len(chunk) > streamChunkSize {
+				chunk = chunk[:streamChunkSize]
+			}
+			at := len(block)
+			block = key.seal(append(block, 0, 0, 0, 0), i, i == last, chunk)
+			binary.BigEndian.PutUint32(block[at:], uint32(len(block)-at-4))
+		}
+
+		// the block is journaled before anything is overwritten
+		j.Next = start
+		if err := writeJournal(journalName(path), j, block); err != nil {
+			return err
+		}
+		if _, err := f.WriteAt(block, chunkOffset(start, key)); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(j.Size-from, j.Size)
+		}
+	}
+
+	var err error
+	if opts.Mode != 0 {
+		err = f.Chmod(opts.Mode)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(path, j.Output)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(j.Output))
+	}
+	if err != nil {
+		return err
+	}
+	opts.log(slog.LevelInfo, "encrypted in place", "input", path, "output", j.Output)
+
+	return os.Remove(journalName(path))
+}
+
+func writeJournal(name string, j *journal, block []byte) error {
+
+	meta, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, len(journalMagic)+len(meta)+1+len(block))
+	data = append(data, journalMagic...)
+	data = append(data, meta...)
+	data = append(data, '\n')
+	data = append(data, block...)
+	return writeFile(name, data, 0600, 0)
+}
+
+func readJournal(name string) (*journal, []byte, error) {
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nl := bytes.IndexByte(data, '\n')
+	j := new(journal)
+	if !bytes.HasPrefix(data, []byte(journalMagic)) || nl < 0 || json.Unmarshal(data[len(journalMagic):nl], j) != nil {
+		return nil, nil, fmt.Errorf("%s isn't the journal of a file encrypted in place", name)
+	}
+	if len(j.Header) < streamHeaderSize {
+		return nil, nil, malformed("invalid stream header in the journal")
+	}
+	if _, err := parseStreamHeader(j.Header); err != nil {
+		return nil, nil, err
+	}
+	if len(j.Header) != streamHeaderLen(j.Header[len(streamMagic)]) {
+		return nil, nil, malformed("invalid stream header in the journal")
+	}
+	if _, _, err := streamParams(j.Header); err != nil {
+		return nil, nil, err
+	}
+
+	return j, data[nl+1:], nil
+}
@@ -0,0 +1,120 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptInPlace(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-inplace")
+	defer os.RemoveAll(dir)
+
+	defer func(n uint64) { resumeCheckpoint = n }(resumeCheckpoint)
+	resumeCheckpoint = 2
+
+	for _, size := range []int{0, 100, 3 * streamChunkSize, 7*streamChunkSize + 100} {
+		plain, _ := random(size)
+		filename := filepath.Join(dir, "disk.img")
+		ioutil.WriteFile(filename, plain, 0644)
+		output := filepath.Join(dir, "disk.cloak")
+
+		if err := EncryptInPlace(filename, passphrase, Options{Cipher: XChaCha20Poly1305}); err != nil {
+			t.Fatalf("EncryptInPlace %d bytes: %v", size, err)
+		}
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			t.Fatalf("%s wasn't renamed", filename)
+		}
+		if _, err := os.Stat(journalName(filename)); !os.IsNotExist(err) {
+			t.Fatalf("the journal wasn't removed")
+		}
+
+		var buf bytes.Buffer
+		f, _ := os.Open(output)
+		err := DecryptStream(f, &buf, passphrase)
+		f.Close()
+		if err != nil {
+			t.Fatalf("DecryptStream %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), plain) {
+			t.Fatalf("%d bytes encrypted in place don't decrypt to the original", size)
+		}
+		os.Remove(output)
+	}
+}
+
+func TestEncryptInPlaceCrash(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-inplace")
+	defer os.RemoveAll(dir)
+
+	defer func(n uint64) { resumeCheckpoint = n }(resumeCheckpoint)
+	resumeCheckpoint = 2
+
+	plain, _ := random(9*streamChunkSize + 100)
+	filename := filepath.Join(dir, "disk.img")
+	ioutil.WriteFile(filename, plain, 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := Options{ctx: ctx, Progress: func(done, total int64) {
+		if done > 3*streamChunkSize {
+			cancel()
+		}
+	}}
+	if err := EncryptInPlace(filename, passphrase, opts); err != context.Canceled {
+		t.Fatalf("expected the encryption to be interrupted, got %v", err)
+	}
+
+	j, block, err := readJournal(journalName(filename))
+	if err != nil {
+		t.Fatalf("readJournal: %v", err)
+	}
+	if j.Next == 0 || len(block) == 0 {
+		t.Fatalf("expected a journaled block, next chunk %d", j.Next)
+	}
+
+	// a torn write of the journaled block
+	key, _ := newStreamKey(j.Header, passphrase)
+	f, _ := os.OpenFile(filename, os.O_RDWR, 0)
+	f.WriteAt(make([]byte, len(block)/2), chunkOffset(j.Next, key))
+	f.Close()
+
+	if err := EncryptInPlace(filename, []byte("wrong"), Options{}); err == nil {
+		t.Fatalf("expected an error carrying on with another passphrase")
+	}
+	if err := EncryptInPlace(filename, passphrase, Options{Mode: 0600}); err != nil {
+		t.Fatalf("EncryptInPlace: %v", err)
+	}
+
+	output := filepath.Join(dir, "disk.cloak")
+	if fi, _ := os.Stat(output); fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+	var buf bytes.Buffer
+	f, _ = os.Open(output)
+	err = DecryptStream(f, &buf, passphrase)
+	f.Close()
+	if err != nil {
+		t.Fatalf("DecryptStream: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), plain) {
+		t.Fatalf("the recovered file doesn't decrypt to the original")
+	}
+}
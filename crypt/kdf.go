@@ -0,0 +1,158 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF identifies a key derivation function in the file header.
+type KDF uint8
+
+// key derivation functions supported by cloak
+const (
+	Scrypt   KDF = 1
+	Argon2id KDF = 2
+
+	// no derivation, the key was read from Options.KeyFile
+	RawKey KDF = 3
+)
+
+func (k KDF) String() string {
+	switch k {
+	case Scrypt:
+		return "scrypt"
+	case Argon2id:
+		return "argon2id"
+	case RawKey:
+		return "key file"
+	}
+	return fmt.Sprintf("kdf %d", k)
+}
+
+// KDFParams are the key derivation function and its cost parameters used
+// to derive a file key.
+type KDFParams struct {
+	// Scrypt when zero
+	KDF KDF
+
+	// scrypt cost parameters
+	N int
+	R int
+	P int
+
+	// argon2id passes, memory in KiB and lanes
+	Time    int
+	Memory  int
+	Threads int
+}
+
+// DefaultKDFParams are used by Encrypt when Options.KDF is not set.
+var DefaultKDFParams = KDFParams{KDF: Scrypt, N: 1 << 15, R: 8, P: 1}
+
+// DefaultArgon2idParams are used when Options.KDF selects Argon2id without
+// setting its costs, the second recommendation of RFC 9106.
+var DefaultArgon2idParams = KDFParams{KDF: Argon2id, Time: 3, Memory: 64 << 10, Threads: 4}
+
+// fixed parameters of armored and streamed files, which don't record them
+var legacyKDFParams = KDFParams{KDF: Scrypt, N: 16384, R: 8, P: 1}
+
+// bounds on the stored parameters, so a crafted header can't make
+// decryption use unbounded memory or time
+const (
+	maxScryptN      = 1 << 22
+	maxScryptRP     = 1 << 10
+	maxScryptMemory = 1 << 30 // bytes, scrypt uses 128·N·r
+	maxArgon2Time   = 16
+	maxArgon2KiB    = 1 << 20
+	maxArgon2Lanes  = 255
+)
+
+// fills in the defaults for unset parameters
+func (p KDFParams) withDefaults() KDFParams {
+	if p == (KDFParams{}) {
+		return DefaultKDFParams
+	}
+	if p == (KDFParams{KDF: Argon2id}) {
+		return DefaultArgon2idParams
+	}
+	if p.KDF == 0 {
+		p.KDF = Scrypt
+	}
+	return p
+}
+
+// reports whether the parameters are accepted by their function and cheap
+// enough to be derived when decrypting
+func (p KDFParams) valid() bool {
+	switch p.KDF {
+	case Scrypt:
+		return p.N > 1 && p.N <= maxScryptN && p.N&(p.N-1) == 0 &&
+			p.R > 0 && p.P > 0 && p.R*p.P <= maxScryptRP &&
+			128*uint64(p.N)*uint64(p.R) <= maxScryptMemory
+	case Argon2id:
+		return p.Time > 0 && p.Time <= maxArgon2Time &&
+			p.Threads > 0 && p.Threads <= maxArgon2Lanes &&
+			p.Memory >= 8*p.Threads && p.Memory <= maxArgon2KiB
+	case RawKey:
+		return p == KDFParams{KDF: RawKey}
+	}
+	return false
+}
+
+// LogValue describes the parameters in Options.Logger messages, naming
+// the costs of the function.
+func (p KDFParams) LogValue() slog.Value {
+	switch p.KDF {
+	case Scrypt:
+		return slog.GroupValue(slog.String("name", "scrypt"), slog.Int("N", p.N), slog.Int("r", p.R), slog.Int("p", p.P))
+	case Argon2id:
+		return slog.GroupValue(slog.String("name", "argon2id"), slog.Int("time", p.Time), slog.Int("memory", p.Memory), slog.Int("threads", p.Threads))
+	}
+	return slog.GroupValue(slog.String("name", p.KDF.String()))
+}
+
+// the three costs stored in the binary header
+func (p KDFParams) costs() [3]int {
+	if p.KDF == Argon2id {
+		return [3]int{p.Time, p.Memory, p.Threads}
+	}
+	return [3]int{p.N, p.R, p.P}
+}
+
+func kdfFromCosts(kdf KDF, c [3]int) KDFParams {
+	if kdf == Argon2id {
+		return KDFParams{KDF: kdf, Time: c[0], Memory: c[1], Threads: c[2]}
+	}
+	return KDFParams{KDF: kdf, N: c[0], R: c[1], P: c[2]}
+}
+
+// derives a key of size bytes from the passphrase and salt
+func deriveKey(passphrase, salt []byte, params KDFParams, size int) ([]byte, error) {
+
+	switch params.KDF {
+	case Scrypt:
+		return scrypt.Key(passphrase, salt, params.N, params.R, params.P, size)
+	case Argon2id:
+		if !params.valid() {
+			return nil, fmt.Errorf("invalid %s parameters", params.KDF)
+		}
+		return argon2.IDKey(passphrase, salt, uint32(params.Time), uint32(params.Memory), uint8(params.Threads), uint32(size)), nil
+	}
+	return nil, fmt.Errorf("unknown key derivation function %s", params.KDF)
+}
@@ -0,0 +1,124 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// KeySize is the size in bytes of the raw key held by Options.KeyFile.
+const KeySize = 32
+
+// ErrKeyFileRequired is returned when a file encrypted with a key file is
+// decrypted with a passphrase.
+var ErrKeyFileRequired = errors.New("file was encrypted with a key file")
+
+// ErrNotKeyFile is returned when a key file is given to decrypt a file
+// that was encrypted with a passphrase or to recipients.
+var ErrNotKeyFile = errors.New("file wasn't encrypted with a key file")
+
+var errKeyFilePassphrase = errors.New("a key file can't be combined with a passphrase")
+
+// reads the raw key held by path, which must be exactly KeySize bytes
+func readKeyFile(path string) ([]byte, error) {
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		wipe(key)
+		return nil, fmt.Errorf("key file %s must hold exactly %d bytes", path, KeySize)
+	}
+	return key, nil
+}
+
+// like encrypt but seals data with the key of opts.KeyFile, recording
+// RawKey as the key derivation function
+func encryptWithKeyFile(data []byte, name, extension string, meta *fileMeta, passphrase []byte, opts Options, start time.Time) (*Result, error) {
+
+	if len(passphrase) > 0 {
+		return nil, errKeyFilePassphrase
+	}
+	if opts.Armor {
+		return nil, errors.New("armored files can't be encrypted with a key file")
+	}
+	if opts.KDF != (KDFParams{}) {
+		return nil, errors.New("key files skip the key derivation, KDF can't be set")
+	}
+
+	key, err := readKeyFile(opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	opts.trace("using the raw key of a key file, skipping the key derivation", "key_file", opts.KeyFile)
+
+	c, err := LookupCipher(opts.cipher())
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the salt isn't used but keeps the header layout of other files
+	salt, err := random(32)
+	if err != nil {
+		return nil, err
+	}
+
+	params := KDFParams{KDF: RawKey}
+	h := &binaryHeader{version: formatBinary, cipher: opts.cipher(), kdf: params, salt: salt, meta: meta, labels: opts.Labels}
+	res, err := seal(data, name, extension, salt, aead, h, opts, start)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Salt = salt
+	res.KDF = params
+	res.Cipher = c.Name()
+	return res, nil
+}
+
+// decrypts a binary file encrypted with the raw key
+func openKeyFile(file, key []byte) (*plainFile, error) {
+
+	if !isBinary(file) {
+		if looksEncrypted(file) {
+			return nil, ErrNotKeyFile
+		}
+		return nil, ErrNotEncrypted
+	}
+	h, err := parseBinaryHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if h.version != formatBinary || h.kdf.KDF != RawKey {
+		return nil, ErrNotKeyFile
+	}
+
+	return openBinaryKey(file, h, func(c Cipher) ([]byte, error) {
+		if c.KeySize() != len(key) {
+			return nil, fmt.Errorf("%s needs a %d byte key", c.Name(), c.KeySize())
+		}
+		// openBinaryKey wipes the key it's given
+		return append([]byte(nil), key...), nil
+	})
+}
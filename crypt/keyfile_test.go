@@ -0,0 +1,88 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyFile(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-keyfile")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "keyed.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	keyFile := filepath.Join(dir, "key")
+	key, _ := random(KeySize)
+	ioutil.WriteFile(keyFile, key, 0600)
+
+	opts := Options{KeyFile: keyFile, OutputPath: filepath.Join(dir, "out")}
+	res, err := EncryptWithOptions(filename, nil, opts)
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if res.Passphrase != "" || res.Secret != nil || res.KDF.KDF != RawKey {
+		t.Fatalf("unexpected result for a key file: %+v", res)
+	}
+
+	if _, err := Plaintext(res.Output, passphrase); !errors.Is(err, ErrKeyFileRequired) {
+		t.Fatalf("expected ErrKeyFileRequired decrypting with a passphrase, got %v", err)
+	}
+
+	dec, err := DecryptWithOptions(res.Output, nil, Options{KeyFile: keyFile, OutputPath: filepath.Join(dir, "restored")})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if got, _ := ioutil.ReadFile(dec.Output); string(got) != data {
+		t.Fatalf("decrypted content doesn't match")
+	}
+
+	other, _ := random(KeySize)
+	ioutil.WriteFile(keyFile, other, 0600)
+	if _, err := DecryptWithOptions(res.Output, nil, Options{KeyFile: keyFile, OutputPath: filepath.Join(dir, "wrong")}); err == nil {
+		t.Fatalf("decrypted with the wrong key")
+	}
+
+	// a passphrase file doesn't open with a key file
+	plain, err := EncryptWithOptions(filename, passphrase, Options{OutputPath: filepath.Join(dir, "pass.cloak")})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if _, err := DecryptWithOptions(plain.Output, nil, Options{KeyFile: keyFile}); !errors.Is(err, ErrNotKeyFile) {
+		t.Fatalf("expected ErrNotKeyFile, got %v", err)
+	}
+
+	ioutil.WriteFile(keyFile, other[:16], 0600)
+	for _, o := range []Options{{KeyFile: keyFile}, {KeyFile: filepath.Join(dir, "missing")}} {
+		if _, err := EncryptWithOptions(filename, nil, o); err == nil {
+			t.Fatalf("encrypted with an invalid key file %s", o.KeyFile)
+		}
+	}
+	ioutil.WriteFile(keyFile, other, 0600)
+	for _, o := range []Options{{KeyFile: keyFile, Armor: true}, {KeyFile: keyFile, KDF: DefaultKDFParams}} {
+		if _, err := EncryptWithOptions(filename, nil, o); err == nil {
+			t.Fatalf("expected an error for %+v", o)
+		}
+	}
+	if _, err := EncryptWithOptions(filename, passphrase, Options{KeyFile: keyFile}); err == nil {
+		t.Fatalf("expected an error combining a key file and a passphrase")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrLabels is returned when labels are invalid or too long to be sealed
+// with the file's metadata.
+var ErrLabels = errors.New("invalid labels")
+
+// room left for labels in the sealed records next to the file metadata
+// and compression records
+const maxLabelsSize = maxRecordsSize - (2 + fileMetaSize) - (2 + 9) - 2
+
+// ParseLabel splits a key=value label, such as team=infra.
+func ParseLabel(s string) (string, string, error) {
+
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return "", "", fmt.Errorf("%w: %q, expected key=value", ErrLabels, s)
+	}
+	key, value := s[:i], s[i+1:]
+	if err := checkLabel(key, value); err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// MatchLabels reports whether labels holds every key of selector with the
+// same value. an empty selector matches any labels.
+func MatchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Labels decrypts the file at path in memory and returns the labels it
+// was encrypted with, see Options.Labels. the plaintext is discarded.
+func Labels(path string, passphrase []byte) (map[string]string, error) {
+
+	plain, _, err := openPath(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	wipe(plain.data)
+
+	return plain.labels, nil
+}
+
+// keys are short words, values any printable text
+func checkLabel(key, value string) error {
+
+	if key == "" || len(key) > 64 {
+		return fmt.Errorf("%w: key %q must be 1 to 64 bytes", ErrLabels, key)
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("._-/", r) {
+			return fmt.Errorf("%w: key %q may only hold letters, digits and . _ - /", ErrLabels, key)
+		}
+	}
+	for _, r := range value {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("%w: value of %q isn't printable", ErrLabels, key)
+		}
+	}
+	return nil
+}
+
+// checks every label and that they fit the sealed records
+func checkLabels(labels map[string]string) error {
+
+	size := 0
+	for k, v := range labels {
+		if err := checkLabel(k, v); err != nil {
+			return err
+		}
+		size += 2 + len(k) + len(v)
+	}
+	if size > maxLabelsSize {
+		return fmt.Errorf("%w: %d bytes, at most %d fit", ErrLabels, size, maxLabelsSize)
+	}
+	return nil
+}
+
+// encodes the labels sorted by key, each a key length byte + key + value
+// length byte + value
+func marshalLabels(labels map[string]string) []byte {
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b []byte
+	for _, k := range keys {
+		b = append(b, byte(len(k)))
+		b = append(b, k...)
+		b = append(b, byte(len(labels[k])))
+		b = append(b, labels[k]...)
+	}
+	return b
+}
+
+func parseLabels(b []byte) (map[string]string, error) {
+
+	labels := make(map[string]string)
+	for len(b) > 0 {
+		if len(b) < 1+int(b[0])+1 {
+			return nil, malformed("truncated labels")
+		}
+		key := string(b[1 : 1+b[0]])
+		b = b[1+len(key):]
+		if len(b) < 1+int(b[0]) {
+			return nil, malformed("truncated labels")
+		}
+		labels[key] = string(b[1 : 1+b[0]])
+		b = b[1+int(b[0]):]
+	}
+	return labels, nil
+}
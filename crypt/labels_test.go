@@ -0,0 +1,97 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-labels")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "labels.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	labels := map[string]string{"backup": "deep", "team": "infra"}
+	res, err := EncryptWithOptions(filename, passphrase, Options{Labels: labels, Compress: Gzip, OutputPath: filepath.Join(dir, "out")})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+
+	got, err := Labels(res.Output, passphrase)
+	if err != nil {
+		t.Fatalf("Labels: %v", err)
+	}
+	if len(got) != 2 || got["backup"] != "deep" || got["team"] != "infra" {
+		t.Fatalf("unexpected labels %v", got)
+	}
+
+	dec, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: filepath.Join(dir, "restored")})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if !MatchLabels(dec.Labels, map[string]string{"team": "infra"}) || MatchLabels(dec.Labels, map[string]string{"team": "web"}) {
+		t.Fatalf("unexpected matches for %v", dec.Labels)
+	}
+
+	id, _ := GenerateIdentity()
+	multi, err := EncryptToRecipients(filename, []*Recipient{id.Recipient()}, Options{Labels: labels, OutputPath: filepath.Join(dir, "multi")})
+	if err != nil {
+		t.Fatalf("EncryptToRecipients: %v", err)
+	}
+	dec, err = DecryptWithIdentities(multi.Output, []*Identity{id}, Options{OutputPath: filepath.Join(dir, "multi-restored")})
+	if err != nil || dec.Labels["backup"] != "deep" {
+		t.Fatalf("labels of a file encrypted to recipients: %v, %v", dec, err)
+	}
+}
+
+func TestInvalidLabels(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-labels")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "labels.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	for _, labels := range []map[string]string{
+		{"": "empty"},
+		{"a b": "space"},
+		{"key": "new\nline"},
+		{"long": strings.Repeat("x", 250)},
+	} {
+		_, err := EncryptWithOptions(filename, passphrase, Options{Labels: labels, Overwrite: true})
+		if !errors.Is(err, ErrLabels) {
+			t.Fatalf("expected ErrLabels for %q, got %v", labels, err)
+		}
+	}
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Labels: map[string]string{"a": "b"}, Armor: true, Overwrite: true}); err == nil {
+		t.Fatalf("expected an error for labels in an armored file")
+	}
+
+	if k, v, err := ParseLabel("team=infra=1"); err != nil || k != "team" || v != "infra=1" {
+		t.Fatalf("ParseLabel = %q, %q, %v", k, v, err)
+	}
+	if _, _, err := ParseLabel("team"); !errors.Is(err, ErrLabels) {
+		t.Fatalf("expected ErrLabels without a value, got %v", err)
+	}
+}
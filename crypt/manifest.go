@@ -0,0 +1,255 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// a manifest is a text file listing the files of an archive with their
+// size and BLAKE2b-256 hash, signed with an HMAC-SHA256 keyed by the
+// passphrase through scrypt:
+//
+//	cloak-manifest v1
+//	kdf scrypt <N> <r> <p> <salt hex>
+//	file <hash hex> <size> <quoted path>
+//	...
+//	hmac <hex of the hmac of every line above>
+//
+// it isn't encrypted, whoever reads it learns the names and sizes of the
+// files and can check a guess of their contents against the hashes.
+
+const manifestMagic = "cloak-manifest v1"
+
+// ErrManifestSignature is returned when the HMAC of a manifest doesn't
+// match, it was altered or the passphrase is wrong.
+var ErrManifestSignature = errors.New("manifest signature doesn't match, wrong passphrase or altered manifest")
+
+// ManifestEntry is a regular file listed by a Manifest.
+type ManifestEntry struct {
+	// slash separated path under the archived directory
+	Path string
+	Size int64
+	// BLAKE2b-256 of the contents
+	Hash []byte
+}
+
+// Manifest lists the regular files of an archive, in the order they were
+// archived, so Audit can tell later whether the archive still holds all
+// of them unchanged. EncryptArchiveWithOptions writes one to
+// Options.Manifest.
+type Manifest struct {
+	Entries []ManifestEntry
+}
+
+// AuditReport is the outcome of Audit. the archive matches its manifest
+// when OK reports true.
+type AuditReport struct {
+	// number of files of the archive compared with the manifest
+	Checked int
+
+	// listed by the manifest but not in the archive
+	Missing []string
+	// in the archive with another size or hash than listed
+	Altered []string
+	// in the archive but not listed
+	Extra []string
+}
+
+// OK reports whether no file is missing, altered or extra.
+func (r *AuditReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Altered) == 0 && len(r.Extra) == 0
+}
+
+// Audit decrypts the archive at path, hashes every regular file in it and
+// compares them with the manifest at manifestPath, signed with the same
+// passphrase, to find files that went missing, were altered or were
+// added since the manifest was written. nothing is written to disk.
+func Audit(path, manifestPath string, passphrase []byte) (*AuditReport, error) {
+	return AuditWithOptions(path, manifestPath, passphrase, Options{})
+}
+
+// AuditWithOptions is like Audit but reports the encrypted bytes read to
+// opts.Progress. path may be Stdio to read standard input. the other
+// options are ignored.
+func AuditWithOptions(path, manifestPath string, passphrase []byte, opts Options) (*AuditReport, error) {
+
+	m, err := ReadManifest(manifestPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]ManifestEntry, len(m.Entries))
+	for _, e := range m.Entries {
+		listed[e.Path] = e
+	}
+
+	report := &AuditReport{}
+	seen := make(map[string]bool)
+	err = readArchive(path, passphrase, opts, func() error { return nil }, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		h, _ := blake2b.New256(nil)
+		size, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(hdr.Name, "./")
+		report.Checked++
+		seen[name] = true
+		want, ok := listed[name]
+		switch {
+		case !ok:
+			report.Extra = append(report.Extra, name)
+		case want.Size != size || !hmac.Equal(want.Hash, h.Sum(nil)):
+			report.Altered = append(report.Altered, name)
+		default:
+			opts.trace("matches the manifest", "path", name, "bytes", size)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range m.Entries {
+		if !seen[e.Path] {
+			report.Missing = append(report.Missing, e.Path)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Altered)
+	sort.Strings(report.Extra)
+
+	return report, nil
+}
+
+// WriteManifest signs m with passphrase and writes it to path, replacing
+// it atomically.
+func WriteManifest(path string, m *Manifest, passphrase []byte) error {
+
+	if len(passphrase) == 0 {
+		return errors.New("a passphrase is required to sign a manifest")
+	}
+	salt, err := random(32)
+	if err != nil {
+		return err
+	}
+	params := DefaultKDFParams
+	key, err := deriveKey(passphrase, salt, params, sha256.Size)
+	if err != nil {
+		return err
+	}
+	defer wipe(key)
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, manifestMagic)
+	fmt.Fprintf(&b, "kdf scrypt %d %d %d %x\n", params.N, params.R, params.P, salt)
+	for _, e := range m.Entries {
+		fmt.Fprintf(&b, "file %x %d %s\n", e.Hash, e.Size, strconv.Quote(e.Path))
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b.Bytes())
+	fmt.Fprintf(&b, "hmac %x\n", mac.Sum(nil))
+
+	return writeFile(path, b.Bytes(), defaultEncryptedMode, 0)
+}
+
+// ReadManifest reads the manifest at path and checks its signature with
+// passphrase, returning ErrManifestSignature when it doesn't match.
+func ReadManifest(path string, passphrase []byte) (*Manifest, error) {
+
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	i := bytes.LastIndex(file, []byte("\nhmac "))
+	if !bytes.HasPrefix(file, []byte(manifestMagic+"\n")) || i < 0 {
+		return nil, fmt.Errorf("%s is not a manifest", path)
+	}
+	signed := file[:i+1]
+	sum, err := hex.DecodeString(strings.TrimSpace(string(file[i+len("\nhmac "):])))
+	if err != nil {
+		return nil, fmt.Errorf("malformed manifest signature: %v", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(signed))
+	scanner.Buffer(nil, 1<<20)
+	scanner.Scan()
+
+	var params KDFParams
+	var saltHex string
+	scanner.Scan()
+	if n, _ := fmt.Sscanf(scanner.Text(), "kdf scrypt %d %d %d %s", &params.N, &params.R, &params.P, &saltHex); n != 4 {
+		return nil, errors.New("malformed manifest key derivation line")
+	}
+	params.KDF = Scrypt
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil || !params.valid() {
+		return nil, errors.New("malformed manifest key derivation line")
+	}
+
+	key, err := deriveKey(passphrase, salt, params, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, ErrManifestSignature
+	}
+
+	m := &Manifest{}
+	for line := 3; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 || fields[0] != "file" {
+			return nil, fmt.Errorf("malformed manifest line %d", line)
+		}
+		hash, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed hash on manifest line %d", line)
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed size on manifest line %d", line)
+		}
+		name, err := strconv.Unquote(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("malformed path on manifest line %d", line)
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Path: name, Size: size, Hash: hash})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
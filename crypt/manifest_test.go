@@ -0,0 +1,87 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-manifest")
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "project")
+	os.MkdirAll(filepath.Join(src, "docs"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "main.go"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(src, "docs", "notes with spaces.txt"), []byte("notes"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "docs", "todo.txt"), []byte("todo"), 0644)
+
+	out := filepath.Join(dir, "project.cloak")
+	manifest := filepath.Join(dir, "project.manifest")
+	if err := EncryptArchiveWithOptions(src, out, passphrase, Options{Manifest: manifest}); err != nil {
+		t.Fatalf("EncryptArchiveWithOptions: %v", err)
+	}
+
+	m, err := ReadManifest(manifest, passphrase)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if len(m.Entries) != 3 || m.Entries[0].Path != "docs/notes with spaces.txt" || m.Entries[2].Size != int64(len(data)) {
+		t.Fatalf("unexpected entries %+v", m.Entries)
+	}
+
+	report, err := Audit(out, manifest, passphrase)
+	if err != nil {
+		t.Fatalf("Audit: %v", err)
+	}
+	if !report.OK() || report.Checked != 3 {
+		t.Fatalf("expected the archive to match, got %+v", report)
+	}
+
+	// an archive of the changed tree encrypted with the same passphrase
+	ioutil.WriteFile(filepath.Join(src, "main.go"), []byte(data+"!"), 0644)
+	os.Remove(filepath.Join(src, "docs", "todo.txt"))
+	ioutil.WriteFile(filepath.Join(src, "new.txt"), []byte("new"), 0644)
+	if err := EncryptArchiveWithOptions(src, out, passphrase, Options{Overwrite: true}); err != nil {
+		t.Fatalf("EncryptArchiveWithOptions: %v", err)
+	}
+	report, err = Audit(out, manifest, passphrase)
+	if err != nil {
+		t.Fatalf("Audit: %v", err)
+	}
+	want := &AuditReport{Checked: 3, Missing: []string{"docs/todo.txt"}, Altered: []string{"main.go"}, Extra: []string{"new.txt"}}
+	if !reflect.DeepEqual(report, want) || report.OK() {
+		t.Fatalf("expected %+v, got %+v", want, report)
+	}
+
+	if _, err := Audit(out, manifest, []byte("wrong")); !errors.Is(err, ErrManifestSignature) {
+		t.Fatalf("expected ErrManifestSignature, got %v", err)
+	}
+	file, _ := ioutil.ReadFile(manifest)
+	ioutil.WriteFile(manifest, bytes.Replace(file, []byte("todo.txt"), []byte("todo.md"), 1), 0644)
+	if _, err := ReadManifest(manifest, passphrase); !errors.Is(err, ErrManifestSignature) {
+		t.Fatalf("expected ErrManifestSignature for an altered manifest, got %v", err)
+	}
+
+	if err := EncryptArchiveWithOptions(src, filepath.Join(dir, "other.cloak"), passphrase, Options{Manifest: manifest}); !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("expected ErrOutputExists for an existing manifest, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNoMemFile is returned by OpenDecrypted when the platform offers no
+// memory-backed file to hold the plaintext. the plaintext is never written
+// to disk instead.
+var ErrNoMemFile = errors.New("no memory-backed files on this platform")
+
+// DecryptedFile is the plaintext of an encrypted file held in an anonymous
+// memory-backed file, for programs such as embedded databases that need a
+// real file descriptor. changes are encrypted back to the original path
+// by Sync and Close.
+type DecryptedFile struct {
+	mu         sync.Mutex
+	file       *os.File
+	path       string
+	ext        string
+	meta       *fileMeta
+	passphrase []byte
+	opts       Options
+}
+
+// OpenDecrypted decrypts the file at path into an anonymous memory-backed
+// file. opts configure writing it back, the KDF parameters, rotation
+// window and labels of the original are kept unless opts sets them.
+func OpenDecrypted(path string, passphrase []byte, opts Options) (*DecryptedFile, error) {
+
+	plain, _, err := openPath(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := anonymousFile()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(plain.data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if opts.KDF == (KDFParams{}) && plain.kdf != (KDFParams{}) {
+		opts.KDF = plain.kdf
+	}
+	if opts.RotateAfter == 0 {
+		opts.RotateAfter = plain.rotation.after
+	}
+	if opts.Labels == nil {
+		opts.Labels = plain.labels
+	}
+	opts.Overwrite = true
+	opts.OutputPath = ""
+	opts.PartSize = 0
+
+	return &DecryptedFile{
+		file:       f,
+		path:       path,
+		ext:        string(plain.ext),
+		meta:       plain.meta,
+		passphrase: append([]byte(nil), passphrase...),
+		opts:       opts,
+	}, nil
+}
+
+// File returns the memory-backed file holding the plaintext.
+func (d *DecryptedFile) File() *os.File {
+	return d.file
+}
+
+// Path returns a path that opens the memory-backed file, for libraries
+// that take a file name rather than a descriptor.
+func (d *DecryptedFile) Path() string {
+	return fmt.Sprintf("/proc/self/fd/%d", d.file.Fd())
+}
+
+// Sync encrypts the current contents back to the original path.
+func (d *DecryptedFile) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.sync()
+}
+
+func (d *DecryptedFile) sync() error {
+
+	if d.passphrase == nil {
+		return os.ErrClosed
+	}
+
+	data, err := ioutil.ReadFile(d.Path())
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+
+	_, err = encrypt(data, d.path, d.ext, d.meta, d.passphrase, d.opts, time.Now())
+	return err
+}
+
+// Close encrypts the current contents back to the original path and
+// releases the memory-backed file. the file is released even when writing
+// it back fails.
+func (d *DecryptedFile) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.sync()
+	if cerr := d.discard(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// Discard releases the memory-backed file without writing changes back.
+func (d *DecryptedFile) Discard() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.discard()
+}
+
+func (d *DecryptedFile) discard() error {
+
+	if d.passphrase == nil {
+		return os.ErrClosed
+	}
+	wipe(d.passphrase)
+	d.passphrase = nil
+
+	return d.file.Close()
+}
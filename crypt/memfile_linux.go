@@ -0,0 +1,52 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// filesystem type of tmpfs, whose files only live in memory
+const tmpfsMagic = 0x01021994
+
+// directory of the shared memory tmpfs present on most systems
+var memDir = "/dev/shm"
+
+// creates a file in memDir and unlinks it right away, so only the
+// returned descriptor refers to it. memDir must be a tmpfs, the plaintext
+// would otherwise end up on disk.
+func anonymousFile() (*os.File, error) {
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(memDir, &st); err != nil || int64(st.Type) != tmpfsMagic {
+		return nil, ErrNoMemFile
+	}
+
+	f, err := ioutil.TempFile(memDir, "cloak-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenDecrypted(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-memfile")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.db")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	d, err := OpenDecrypted(res.Output, passphrase, Options{})
+	if errors.Is(err, ErrNoMemFile) {
+		t.Skip("no memory-backed files available")
+	}
+	if err != nil {
+		t.Fatalf("OpenDecrypted: %v", err)
+	}
+
+	// the plaintext has no name on any filesystem, only the descriptor
+	entries, _ := ioutil.ReadDir(memDir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "cloak-") {
+			t.Fatalf("plaintext left at %s", e.Name())
+		}
+	}
+
+	got, err := ioutil.ReadFile(d.Path())
+	if err != nil || string(got) != data {
+		t.Fatalf("read %q through %s: %v", got, d.Path(), err)
+	}
+
+	if _, err := d.File().WriteAt([]byte("changed"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := d.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("second Close returned %v", err)
+	}
+
+	plain, ext, err := PlaintextExt(res.Output, passphrase)
+	if err != nil {
+		t.Fatalf("PlaintextExt: %v", err)
+	}
+	if want := "changed" + data[len("changed"):]; string(plain) != want || ext != ".db" {
+		t.Fatalf("re-encrypted %q%s, want %q.db", plain, ext, want)
+	}
+
+	// discarding leaves the encrypted file as it was
+	d, err = OpenDecrypted(res.Output, passphrase, Options{})
+	if err != nil {
+		t.Fatalf("OpenDecrypted: %v", err)
+	}
+	d.File().WriteAt([]byte("discarded"), 0)
+	if err := d.Discard(); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if again, _ := Plaintext(res.Output, passphrase); string(again) != string(plain) {
+		t.Fatalf("Discard wrote changes back")
+	}
+}
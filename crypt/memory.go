@@ -0,0 +1,47 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+// keys derived from passphrases and the plaintext read or restored are
+// zeroed once they're no longer needed, so they don't linger in memory
+// until the garbage collector reuses it. this is best effort: copies made
+// by the runtime when growing slices or moving stacks, the key schedules
+// kept by the ciphers and the passphrases held by callers are out of
+// reach, and a mapped input is the file itself and is never wiped.
+
+// overwrites b with zeros
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// keeps b out of swap when o.LockMemory is set. the returned func wipes
+// b and unlocks it, it must be called once b is no longer used.
+func (o Options) hold(b []byte) func() {
+
+	if !o.LockMemory || len(b) == 0 {
+		return func() { wipe(b) }
+	}
+	if err := lockMemory(b); err != nil {
+		o.trace("unable to lock memory, it may be swapped", "bytes", len(b), "error", err)
+		return func() { wipe(b) }
+	}
+	o.trace("locked memory", "bytes", len(b))
+
+	return func() {
+		wipe(b)
+		unlockMemory(b)
+	}
+}
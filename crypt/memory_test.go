@@ -0,0 +1,61 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHold(t *testing.T) {
+
+	for _, lock := range []bool{false, true} {
+		b := []byte("plaintext")
+		release := Options{LockMemory: lock}.hold(b)
+		if string(b) != "plaintext" {
+			t.Fatalf("hold changed the buffer")
+		}
+		release()
+		if !bytes.Equal(b, make([]byte, len(b))) {
+			t.Fatalf("expected the buffer zeroed, got %q", b)
+		}
+	}
+}
+
+func TestLockMemory(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-lock")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "locked.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	opts := Options{LockMemory: true}
+	res, err := EncryptWithOptions(filename, passphrase, opts)
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	os.Remove(filename)
+
+	dec, err := DecryptWithOptions(res.Output, passphrase, opts)
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if restored, _ := ioutil.ReadFile(dec.Output); string(restored) != data {
+		t.Fatalf("unexpected contents %q", restored)
+	}
+}
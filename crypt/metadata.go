@@ -0,0 +1,119 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// size of the original's metadata optionally sealed after the rotation
+// metadata: mode (4 bytes) + modification time in unix nanoseconds
+// (8 bytes) + uid and gid (4 bytes each) + flags byte, all big endian
+const fileMetaSize = 21
+
+// set in the flags byte when uid and gid were recorded
+const metaHasOwner = 1 << 0
+
+// set in the flags byte when the original had the Windows hidden attribute
+const metaHidden = 1 << 1
+
+// permissions, modification time, owner and attributes of an encrypted
+// original. read-only files are recorded with a mode without write
+// permission on every platform.
+type fileMeta struct {
+	mode     os.FileMode
+	modTime  time.Time
+	uid, gid uint32
+	hasOwner bool
+	hidden   bool
+}
+
+// the metadata of path to record when encrypting it with opts, nil when
+// none should be recorded
+func originalMeta(path string, opts Options) (*fileMeta, error) {
+
+	if opts.NoMetadata || opts.Armor {
+		return nil, nil
+	}
+
+	return statMeta(path)
+}
+
+func statMeta(path string) (*fileMeta, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &fileMeta{mode: info.Mode().Perm(), modTime: info.ModTime(), hidden: fileHidden(info)}
+	m.uid, m.gid, m.hasOwner = fileOwner(info)
+
+	return m, nil
+}
+
+func (m *fileMeta) marshal() []byte {
+	b := make([]byte, 0, fileMetaSize)
+	b = binary.BigEndian.AppendUint32(b, uint32(m.mode))
+	b = binary.BigEndian.AppendUint64(b, uint64(m.modTime.UnixNano()))
+	b = binary.BigEndian.AppendUint32(b, m.uid)
+	b = binary.BigEndian.AppendUint32(b, m.gid)
+	var flags byte
+	if m.hasOwner {
+		flags |= metaHasOwner
+	}
+	if m.hidden {
+		flags |= metaHidden
+	}
+	return append(b, flags)
+}
+
+func parseFileMeta(b []byte) *fileMeta {
+	return &fileMeta{
+		mode:     os.FileMode(binary.BigEndian.Uint32(b)).Perm(),
+		modTime:  time.Unix(0, int64(binary.BigEndian.Uint64(b[4:]))),
+		uid:      binary.BigEndian.Uint32(b[12:]),
+		gid:      binary.BigEndian.Uint32(b[16:]),
+		hasOwner: b[20]&metaHasOwner != 0,
+		hidden:   b[20]&metaHidden != 0,
+	}
+}
+
+// applies the recorded metadata to the restored file name. opts.Mode
+// takes precedence over the recorded mode, and the owner is only changed
+// where the process is allowed to. the hidden attribute is only restored
+// on Windows.
+func (m *fileMeta) restore(name string, opts Options) error {
+
+	if m.hidden {
+		if err := setHidden(name); err != nil {
+			return err
+		}
+	}
+	if opts.Mode == 0 {
+		if err := os.Chmod(name, m.mode); err != nil {
+			return err
+		}
+	}
+	if m.hasOwner {
+		if err := os.Chown(name, int(m.uid), int(m.gid)); err != nil {
+			opts.log(slog.LevelDebug, "owner not restored", "output", name, "error", err)
+		}
+	}
+
+	return os.Chtimes(name, m.modTime, m.modTime)
+}
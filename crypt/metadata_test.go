@@ -0,0 +1,87 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreMetadata(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-metadata")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "script.sh")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+	os.Chmod(filename, 0750)
+	modTime := time.Date(2020, 2, 3, 4, 5, 6, 7000, time.UTC)
+	os.Chtimes(filename, modTime, modTime)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	out := filepath.Join(dir, "restored.sh")
+	if _, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: out}); err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0750 || !info.ModTime().Equal(modTime) {
+		t.Fatalf("restored mode %o mtime %v, want 750 %v", info.Mode().Perm(), info.ModTime(), modTime)
+	}
+
+	// the opt-out keeps the default mode of decrypted files
+	os.Remove(out)
+	if _, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: out, NoMetadata: true}); err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if info, _ := os.Stat(out); info.ModTime().Equal(modTime) {
+		t.Fatalf("metadata was restored with NoMetadata")
+	}
+
+	// nothing is recorded with the opt-out, and such files still open
+	res, err = EncryptWithOptions(filename, passphrase, Options{NoMetadata: true, Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	file, _ := ioutil.ReadFile(res.Output)
+	plain, err := open(file, passphrase)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if plain.meta != nil {
+		t.Fatalf("metadata recorded with NoMetadata")
+	}
+}
+
+func TestFileMetaMarshal(t *testing.T) {
+
+	m := &fileMeta{mode: 0640, modTime: time.Unix(1700000000, 123), uid: 1000, gid: 100, hasOwner: true, hidden: true}
+	b := m.marshal()
+	if len(b) != fileMetaSize {
+		t.Fatalf("marshal produced %d bytes, want %d", len(b), fileMetaSize)
+	}
+	got := parseFileMeta(b)
+	if got.mode != m.mode || !got.modTime.Equal(m.modTime) || got.uid != m.uid || got.gid != m.gid || !got.hasOwner || !got.hidden {
+		t.Fatalf("parsed %+v, want %+v", got, m)
+	}
+}
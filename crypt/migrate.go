@@ -0,0 +1,114 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io"
+	"os"
+)
+
+// Outdated reports why the encrypted file at path should be migrated to
+// the format Encrypt writes today, or an empty string when it needn't be.
+// armored files written before the binary format and streams sealed with
+// secretbox are outdated, they can't hold the current parameters or don't
+// bind their chunks to the stream. it doesn't need the passphrase.
+func Outdated(path string) (string, error) {
+
+	info, err := ReadFormat(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case info.Version == formatV0 && !info.Checksum:
+		return "armored layout without a checksum or trailer", nil
+	case info.Version == formatV0 && !info.Trailer:
+		return "armored layout without a trailer", nil
+	case info.Version == formatV0:
+		return "armored layout", nil
+	case info.Version == formatStream && info.Cipher == cipherName(SecretBox):
+		return "stream sealed with secretbox", nil
+	}
+	return "", nil
+}
+
+// Migrate rewrites the encrypted file at path in the current format with
+// the same passphrase when Outdated reports it should be, and reports
+// whether it did. armored files become binary files with a new salt and
+// the default key derivation parameters, or opts.KDF, and streams are
+// sealed again with XChaCha20Poly1305 chunk by chunk and the default key
+// derivation parameters, or opts.KDF, so they never have to fit in memory.
+// the new file replaces the old one atomically and keeps its permissions
+// unless opts.Mode is set. the other options are used like
+// RekeyWithOptions for armored files and ignored for streams, armored
+// files without a trailer are migrated as if opts.AllowLegacy was set.
+func Migrate(path string, passphrase []byte, opts Options) (bool, error) {
+
+	why, err := Outdated(path)
+	if err != nil || why == "" {
+		return false, err
+	}
+	opts.trace("migrating", "path", path, "from", why)
+
+	info, err := ReadFormat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.Version == formatStream {
+		return true, migrateStream(path, passphrase, opts)
+	}
+
+	opts.Armor = false
+	opts.PEM = false
+	opts.AllowLegacy = true
+	res, err := RekeyWithOptions(path, passphrase, passphrase, opts)
+	if err != nil {
+		return false, err
+	}
+	res.Secret.Destroy()
+
+	return true, nil
+}
+
+// seals the stream at path again with the current stream version
+func migrateStream(path string, passphrase []byte, opts Options) error {
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dr, err := DecryptReader(withProgress(f, opts.Progress), passphrase)
+	if err != nil {
+		return err
+	}
+
+	mode := opts.Mode
+	if mode == 0 {
+		mode = fi.Mode().Perm()
+	}
+	return writeFileWith(path, defaultEncryptedMode, mode, func(w io.Writer) error {
+		er, err := encryptReader(dr, passphrase, XChaCha20Poly1305, opts.KDF.withDefaults())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, er)
+		return err
+	})
+}
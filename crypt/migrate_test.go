@@ -0,0 +1,91 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-migrate")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "migrate.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	armored := filepath.Join(dir, "armored.cloak")
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Armor: true, OutputPath: armored, Mode: 0600}); err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	binary := filepath.Join(dir, "binary.cloak")
+	if _, err := EncryptWithOptions(filename, passphrase, Options{OutputPath: binary}); err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	stream := filepath.Join(dir, "stream.cloak")
+	var buf bytes.Buffer
+	if err := EncryptStream(bytes.NewReader([]byte(data)), &buf, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	ioutil.WriteFile(stream, buf.Bytes(), 0640)
+
+	for path, outdated := range map[string]bool{armored: true, binary: false, stream: true} {
+		why, err := Outdated(path)
+		if err != nil {
+			t.Fatalf("Outdated %s: %v", path, err)
+		}
+		if (why != "") != outdated {
+			t.Fatalf("%s: expected outdated %v, got %q", path, outdated, why)
+		}
+	}
+
+	before, _ := ioutil.ReadFile(armored)
+	if _, err := Migrate(armored, []byte("wrong"), Options{}); err == nil {
+		t.Fatalf("expected an error with a wrong passphrase")
+	}
+	if after, _ := ioutil.ReadFile(armored); !bytes.Equal(after, before) {
+		t.Fatalf("a failed migration changed the file")
+	}
+
+	for _, path := range []string{armored, stream, binary} {
+		migrated, err := Migrate(path, passphrase, Options{})
+		if err != nil {
+			t.Fatalf("Migrate %s: %v", path, err)
+		}
+		if migrated != (path != binary) {
+			t.Fatalf("%s: unexpected migrated %v", path, migrated)
+		}
+		if why, _ := Outdated(path); why != "" {
+			t.Fatalf("%s is still outdated: %s", path, why)
+		}
+		plain, err := Plaintext(path, passphrase)
+		if err != nil || string(plain) != data {
+			t.Fatalf("%s doesn't decrypt to the original after migrating: %v", path, err)
+		}
+	}
+
+	if info, _ := ReadFormat(armored); info.Version != formatBinary || info.Ext != ".txt" {
+		t.Fatalf("expected a binary file keeping its extension, got %+v", info)
+	}
+	if fi, _ := os.Stat(armored); fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600 kept, got %v", fi.Mode().Perm())
+	}
+	if fi, _ := os.Stat(stream); fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode 0640 kept, got %v", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"fmt"
+	"os"
+)
+
+// files smaller than this are read into memory instead of being mapped,
+// mapping only pays off once copying the file becomes expensive
+const mmapThreshold = 4 << 20
+
+// reads the whole file, the returned release func is a no-op
+func readFileNoRelease(path string) ([]byte, func() error, os.FileInfo, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return data, func() error { return nil }, nil, nil
+}
+
+// an input being encrypted from its mapping, which shows the file as it
+// is written to. the checksum and the ciphertext would hold different
+// contents if it changed in between, and reading past a truncation
+// faults.
+type mappedInput struct {
+	path string
+	info os.FileInfo
+}
+
+// returns an error when the file changed since it was mapped. a nil m
+// was read and can't have changed.
+func (m *mappedInput) check() error {
+	if m == nil {
+		return nil
+	}
+	fi, err := os.Stat(m.path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != m.info.Size() || !fi.ModTime().Equal(m.info.ModTime()) {
+		return fmt.Errorf("%s changed while it was encrypted, encrypt it again once it's no longer written to", m.path)
+	}
+	return nil
+}
+
+// deferred by the functions reading m with debug.SetPanicOnFault, turns
+// the fault of reading it after a truncation into *err. other panics
+// are passed on.
+func (m *mappedInput) recoverFault(err *error) {
+	if m == nil {
+		return
+	}
+	r := recover()
+	if r == nil {
+		return
+	}
+	if _, ok := r.(interface{ Addr() uintptr }); !ok {
+		panic(r)
+	}
+	*err = fmt.Errorf("%s was truncated while it was encrypted", m.path)
+}
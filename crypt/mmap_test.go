@@ -0,0 +1,99 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMapFile(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-mmap")
+	defer os.RemoveAll(dir)
+
+	for _, size := range []int{0, 10, mmapThreshold + 10} {
+		content := bytes.Repeat([]byte{'x'}, size)
+		filename := filepath.Join(dir, "mmap.txt")
+		ioutil.WriteFile(filename, content, 0644)
+
+		mapped, release, _, err := mapFile(filename)
+		if err != nil {
+			t.Fatalf("mapFile %d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(mapped, content) {
+			t.Fatalf("mapFile %d bytes returned different content", size)
+		}
+
+		if err := release(); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+	}
+
+	if _, _, _, err := mapFile(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("mapFile didn't fail on a missing file")
+	}
+}
+
+func TestEncryptChangedMappedInput(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-mmap")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "mmap.txt")
+	output := filepath.Join(dir, "mmap"+Extension)
+	for _, change := range []func() error{
+		func() error {
+			f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteAt([]byte("changed"), 10)
+			// the same second would go unnoticed on coarse filesystems
+			os.Chtimes(filename, time.Now(), time.Now().Add(time.Hour))
+			return err
+		},
+		// reading the truncated pages faults
+		func() error { return os.Truncate(filename, 0) },
+	} {
+		ioutil.WriteFile(filename, bytes.Repeat([]byte{'x'}, mmapThreshold+10), 0644)
+
+		data, release, info, err := mapFile(filename)
+		if err != nil {
+			t.Fatalf("mapFile: %v", err)
+		}
+		if info == nil {
+			release()
+			t.Skip("files aren't mapped on this platform")
+		}
+		if err := change(); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := Options{mapped: &mappedInput{path: filename, info: info}}
+		if _, err := encrypt(data, output, ".txt", nil, passphrase, opts, time.Now()); err == nil {
+			t.Fatalf("expected an error encrypting a file changed while it was mapped")
+		}
+		release()
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Fatalf("the output of a changed file was written")
+		}
+	}
+}
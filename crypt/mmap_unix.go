@@ -0,0 +1,64 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// memory maps the file read only, falling back to reading it into
+// memory for small or non regular files or when mmap fails.
+// the returned release func must be called once data is no longer used.
+// the file's info is returned when it was mapped, nil when it was read.
+func mapFile(path string) ([]byte, func() error, os.FileInfo, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// pipes and devices are read through the same handle, opening a pipe
+	// a second time would wait for another writer
+	if !info.Mode().IsRegular() {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return data, func() error { return nil }, nil, nil
+	}
+
+	size := info.Size()
+	if size < mmapThreshold || int64(int(size)) != size {
+		return readFileNoRelease(path)
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return readFileNoRelease(path)
+	}
+
+	return data, func() error { return syscall.Munmap(data) }, info, nil
+}
@@ -0,0 +1,349 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ErrCrossDevice is returned when the output can't be renamed into place
+// because it is a mount point of its own. the output is never copied
+// over, which could leave it partly written.
+var ErrCrossDevice = errors.New("output is on a different device than its directory")
+
+// ErrOutputExists is returned when the encrypted output would replace an
+// existing file and Options.Overwrite isn't set.
+var ErrOutputExists = errors.New("output file already exists")
+
+// Extension is added to the name of encrypted files unless
+// Options.OutputPath is set.
+const Extension = ".cloak"
+
+// default permissions of written files before the umask is applied,
+// decrypted files hold plaintext and are only readable by the owner
+const (
+	defaultEncryptedMode os.FileMode = 0666
+	defaultDecryptedMode os.FileMode = 0600
+)
+
+// Options configure EncryptWithOptions and DecryptWithOptions.
+type Options struct {
+	// permissions of the written file. when zero new files are created
+	// with 0666 for encrypted and 0600 for decrypted output, minus the
+	// umask, and decrypted files then get the mode recorded with the
+	// original. when set the output gets exactly this mode.
+	Mode os.FileMode
+
+	// how long the passphrase of an encrypted file should be used, stored
+	// in the file so decrypting it later can warn when it is overdue.
+	// ignored when decrypting.
+	RotateAfter time.Duration
+
+	// when set the encrypted file is split into parts named name.001,
+	// name.002, ... of at most this many bytes each, such as for mail
+	// size limits. decrypting any part reassembles the file.
+	// ignored when decrypting.
+	PartSize int64
+
+	// write the hex, line based layout instead of the smaller binary
+	// one, for channels that only carry text. ignored when decrypting.
+	Armor bool
+
+	// scrypt parameters used to derive the key, DefaultKDFParams when
+	// zero. they are recorded in the file header. ignored when decrypting.
+	KDF KDFParams
+
+	// cipher sealing binary files and streams, SecretBox when zero. it
+	// is recorded in the header, so files decrypt whichever cipher they
+	// use. armored files always use SecretBox and streams can't use
+	// AES256GCM. ignored when decrypting.
+	Cipher CipherID
+
+	// path of a file holding a raw KeySize byte key used instead of a
+	// passphrase, skipping the key derivation. files encrypted with a
+	// key file can only be decrypted with it. can't be combined with a
+	// passphrase, KDF or Armor.
+	KeyFile string
+
+	// path of the written file. by default Encrypt writes next to the
+	// original, replacing its extension with Extension, and Decrypt
+	// writes "out" plus the original extension in the working directory.
+	OutputPath string
+
+	// replace an existing encrypted output instead of returning
+	// ErrOutputExists. ignored when decrypting.
+	Overwrite bool
+
+	// read named pipes, devices and files under /proc, /sys and /dev
+	// instead of returning ErrSpecialFile. ignored when decrypting.
+	AllowSpecial bool
+
+	// refuse to decrypt files sealed with parameters weaker than the
+	// recommended minimums, returning ErrWeakParams. ignored when
+	// encrypting.
+	Strict bool
+
+	// decrypt armored files written before the trailer, whose salt and
+	// extension aren't authenticated, instead of returning
+	// ErrLegacyFormat. they are still reported among the warnings, and
+	// Strict still refuses them. Migrate sets it. ignored when encrypting.
+	AllowLegacy bool
+
+	// compress the plaintext with this registered compressor before
+	// sealing it, unless that doesn't make it smaller. armored files
+	// can't be compressed. ignored when decrypting.
+	Compress CompressorID
+
+	// don't record the permissions, modification time and owner of the
+	// original when encrypting, or don't restore them when decrypting.
+	// armored files and EncryptData never record them.
+	NoMetadata bool
+
+	// once the output is written, flushed and read back intact, overwrite
+	// the original file with random data and remove it. ignored by
+	// EncryptData and when decrypting.
+	ShredOriginal bool
+
+	// run CheckEntropy before generating the passphrase, salt and nonces
+	// and fail with ErrEntropy instead of using a random source that
+	// isn't ready or looks broken
+	CheckEntropy bool
+
+	// wrap the binary file in a PEM block that can be pasted into email,
+	// tickets or YAML. can't be combined with Armor
+	PEM bool
+
+	// receives progress messages, such as the written output. every
+	// decision behind the file, such as the cipher, key derivation
+	// parameters, layout, compression and fallbacks taken, is traced at
+	// slog.LevelDebug. nothing is logged when it is nil, and passphrases
+	// and keys are never logged
+	Logger *slog.Logger
+
+	// called as the input is read, by EncryptWithOptions and
+	// DecryptWithOptions from the file and chunk by chunk by the
+	// WithOptions stream functions, so long operations can show their
+	// status. parts of split files other than the one opened aren't
+	// reported.
+	Progress ProgressFunc
+
+	// key=value pairs sealed with the metadata of binary files, such as
+	// backup=deep or team=infra, so bulk operations can select files by
+	// them. keys are letters, digits and . _ - /, values printable text.
+	// armored files can't hold labels. ignored when decrypting.
+	Labels map[string]string
+
+	// how the passphrase is generated when none is given, 32 hex digits
+	// when zero. ignored when decrypting.
+	Generator PassphraseGenerator
+
+	// only return the passphrase as Result.Secret, leaving
+	// Result.Passphrase empty so no copy of it outlives Secret.Destroy
+	Quiet bool
+
+	// derive the salt from the passphrase and the contents, and every
+	// nonce from the key and what it seals, so the same file encrypted
+	// twice with the same passphrase gives the same bytes and backup
+	// systems can deduplicate encrypted blobs. this gives up a property
+	// of normal encryption: anyone holding the passphrase can tell
+	// whether a file holds a guessed content, and anyone without it can
+	// tell that two files are equal. the original's metadata isn't
+	// recorded. a passphrase is required and armored, split, rotated and
+	// key file encryption are refused. only used by Encrypt and the
+	// functions built on it.
+	Convergent bool
+
+	// locks the plaintext read or restored in memory with mlock, so it
+	// isn't written to swap, until it's wiped once the file is written.
+	// the input is read instead of mapped. only supported on Linux, and
+	// limited by RLIMIT_MEMLOCK: when locking fails the file is still
+	// processed and the failure traced. derived keys and plaintext held
+	// in buffers are zeroed after use whether or not this is set, a
+	// mapped input is the file itself and left alone.
+	LockMemory bool
+
+	// glob patterns selecting the files of a directory tree, used by
+	// EncryptArchiveWithOptions and Watcher. a pattern without a slash
+	// matches names at any depth, such as *.log, one with a slash the
+	// path under the tree, such as build/*. when Include is set only the
+	// files it matches are taken. Exclude leaves out the files it matches
+	// and the directories it matches with everything under them, and
+	// wins over Include.
+	Include []string
+	Exclude []string
+
+	// leave out the files and directories of a tree whose name starts
+	// with a dot, such as .git or .cache. Watcher always does.
+	NoDotfiles bool
+
+	// how EncryptArchiveWithOptions handles symbolic links in the tree,
+	// PreserveSymlinks when zero. Watcher always skips them.
+	Symlinks SymlinkPolicy
+
+	// path where EncryptArchiveWithOptions writes a Manifest of the
+	// archived files, signed with the passphrase, for Audit to check the
+	// archive against later. it is replaced with Overwrite only.
+	Manifest string
+
+	// goroutines sealing the chunks of a stream concurrently, while it is
+	// read and written in order on others, one per CPU when zero. one
+	// seals them on the calling goroutine. the output is the same either
+	// way, only EncryptStreamWithOptions and the functions built on it
+	// use it.
+	Workers int
+
+	// signs the encrypted file with this key, so recipients can tell who
+	// wrote it. only files written by Encrypt and the functions built on
+	// it are signed, armored and PEM files can't be.
+	Sign *SigningKey
+
+	// only decrypt files signed by one of these keys, failing with
+	// ErrUntrustedSigner otherwise. the signature of a signed file is
+	// checked whether or not this is set. ignored when encrypting.
+	Signers []*VerifyingKey
+
+	// set by EncryptContext and DecryptContext
+	ctx context.Context
+
+	// set by readInput when the input is mapped
+	mapped *mappedInput
+
+	// set in Convergent mode, derives nonces instead of drawing them
+	nonceKey []byte
+}
+
+// a nonce of size bytes for sealing message, random unless nonces are
+// derived in Convergent mode. a derived nonce only repeats for the same
+// message under the same key, which reveals nothing but that equality.
+func (o Options) nonce(size int, purpose byte, message []byte) ([]byte, error) {
+
+	if o.nonceKey == nil {
+		return random(size)
+	}
+	if size > sha256.Size {
+		return nil, fmt.Errorf("can't derive a nonce of %d bytes", size)
+	}
+	mac := hmac.New(sha256.New, o.nonceKey)
+	mac.Write([]byte{purpose})
+	mac.Write(message)
+	return mac.Sum(nil)[:size], nil
+}
+
+// the cipher sealing binary files
+func (o Options) cipher() CipherID {
+	if o.Cipher == 0 {
+		return SecretBox
+	}
+	return o.Cipher
+}
+
+// the context of the operation, never nil
+func (o Options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// returns the error of the context once it is canceled or past its
+// deadline, checked before each step that can't be interrupted
+func (o Options) canceled() error {
+	return o.context().Err()
+}
+
+// logs a progress message to opts.Logger
+func (o Options) log(level slog.Level, msg string, args ...interface{}) {
+	if o.Logger != nil {
+		o.Logger.Log(context.Background(), level, msg, args...)
+	}
+}
+
+// logs a decision at slog.LevelDebug, see Options.Logger
+func (o Options) trace(msg string, args ...interface{}) {
+	o.log(slog.LevelDebug, msg, args...)
+}
+
+// writes data to name, creating it with perm minus the umask, or forcing
+// mode when it is set
+//
+// the data goes to a temporary file next to name which is flushed and
+// renamed over it, so a crash never leaves a partly written name behind.
+// when name is a symlink the file it points to is replaced instead.
+func writeFile(name string, data []byte, perm, mode os.FileMode) error {
+	return writeFileWith(name, perm, mode, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// like writeFile but the contents are written by write, for outputs that
+// don't fit in memory
+func writeFileWith(name string, perm, mode os.FileMode, write func(io.Writer) error) error {
+
+	if mode != 0 {
+		perm = mode
+	}
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+
+	suffix, err := random(6)
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(name)
+	tmp := filepath.Join(dir, "."+base+"."+hex.EncodeToString(suffix)+".tmp")
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if err == nil && mode != 0 {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = makeReplaceable(name)
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+		if errors.Is(err, syscall.EXDEV) {
+			err = fmt.Errorf("%w: %s", ErrCrossDevice, name)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(name))
+}
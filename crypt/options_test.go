@@ -0,0 +1,173 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-write")
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "out")
+	ioutil.WriteFile(name, []byte("old"), 0644)
+
+	// the old file is replaced rather than truncated, so another link to
+	// it keeps the complete previous contents
+	link := filepath.Join(dir, "link")
+	os.Link(name, link)
+
+	if err := writeFile(name, []byte("new"), 0644, 0); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if got, _ := ioutil.ReadFile(name); string(got) != "new" {
+		t.Fatalf("%s holds %q, want new", name, got)
+	}
+	if got, _ := ioutil.ReadFile(link); string(got) != "old" {
+		t.Fatalf("old file was modified in place: %q", got)
+	}
+
+	// a rename that fails must not leave the temporary file behind
+	sub := filepath.Join(dir, "sub")
+	os.Mkdir(sub, 0755)
+	ioutil.WriteFile(filepath.Join(sub, "file"), nil, 0644)
+	if err := writeFile(sub, []byte("data"), 0644, 0); err == nil {
+		t.Fatalf("expected an error replacing a directory")
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 3 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("unexpected files left behind: %v", names)
+	}
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-write")
+	defer os.RemoveAll(dir)
+
+	// the link may point to another filesystem, the temporary file must be
+	// staged next to the target so the rename stays on one device
+	other := filepath.Join(dir, "other")
+	os.Mkdir(other, 0755)
+	target := filepath.Join(other, "target")
+	ioutil.WriteFile(target, []byte("old"), 0644)
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	if err := writeFile(link, []byte("new"), 0644, 0); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("link was replaced by a regular file")
+	}
+	if got, _ := ioutil.ReadFile(target); string(got) != "new" {
+		t.Fatalf("%s holds %q, want new", target, got)
+	}
+	if entries, _ := ioutil.ReadDir(other); len(entries) != 1 {
+		t.Fatalf("temporary file left next to the target")
+	}
+}
+
+func TestLogger(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-logger")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "logger.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	// without a logger nothing reaches the standard logger
+	var std bytes.Buffer
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+
+	res, err := EncryptWithOptions(filename, nil, Options{})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if std.Len() != 0 {
+		t.Fatalf("library logged %q", std.String())
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	res, err = EncryptWithOptions(filename, nil, Options{Logger: logger, Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	_, err = DecryptWithOptions(res.Output, []byte(res.Passphrase), Options{Logger: logger, OutputPath: filepath.Join(dir, "out.txt")})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+
+	logged := buf.String()
+	for _, want := range []string{"generated a random passphrase", "msg=encrypted", "msg=decrypted", res.Output} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("expected %q in %s", want, logged)
+		}
+	}
+	if strings.Contains(logged, res.Passphrase) {
+		t.Fatalf("passphrase logged: %s", logged)
+	}
+}
+
+func TestTrace(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-trace")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "trace.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	params := KDFParams{KDF: Argon2id, Time: 1, Memory: 64, Threads: 1}
+	res, err := EncryptWithOptions(filename, passphrase, Options{Logger: logger, KDF: params, Cipher: AES256GCM, Compress: Gzip})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	_, err = DecryptWithOptions(res.Output, passphrase, Options{Logger: logger, OutputPath: filepath.Join(dir, "out.txt")})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+
+	logged := buf.String()
+	for _, want := range []string{"level=DEBUG", "mapping the input", "kdf.name=argon2id kdf.time=1 kdf.memory=64 kdf.threads=1", "cipher=aes-256-gcm", "compressor=gzip", "layout=binary", "matches the checksum"} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("expected %q in %s", want, logged)
+		}
+	}
+	if strings.Contains(logged, string(passphrase)) {
+		t.Fatalf("passphrase logged: %s", logged)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOutputModes(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "cloak-mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	old := syscall.Umask(022)
+	defer syscall.Umask(old)
+
+	filename := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(filename, []byte(data), 0600)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+	if mode := perm(t, res.Output); mode != 0644 {
+		t.Fatalf("encrypted file mode = %o, want 644 with umask 022", mode)
+	}
+
+	dec, err := Decrypt(res.Output, passphrase)
+	if err != nil {
+		t.Fatalf("Decrypt %s: %v", res.Output, err)
+	}
+	if mode := perm(t, dec.Output); mode != 0600 {
+		t.Fatalf("decrypted file mode = %o, want 600", mode)
+	}
+
+	res, err = EncryptWithOptions(filename, passphrase, Options{Mode: 0640, Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if mode := perm(t, res.Output); mode != 0640 {
+		t.Fatalf("encrypted file mode = %o, want 640", mode)
+	}
+
+	// an explicit mode is not reduced by the umask
+	syscall.Umask(077)
+	dec, err = DecryptWithOptions(res.Output, passphrase, Options{Mode: 0644})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions %s: %v", res.Output, err)
+	}
+	if mode := perm(t, dec.Output); mode != 0644 {
+		t.Fatalf("decrypted file mode = %o, want 644", mode)
+	}
+}
+
+func perm(t *testing.T, name string) os.FileMode {
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("stat %s: %v", name, err)
+	}
+	return fi.Mode().Perm()
+}
@@ -0,0 +1,243 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPartMissing is returned when a part of a split encrypted file can't
+// be found next to the part being decrypted.
+var ErrPartMissing = errors.New("part of split encrypted file is missing")
+
+// a split encrypted file is written as name.001, name.002, ... each part
+// starts with a hex header line followed by the next piece of the
+// encrypted file:
+// first 8 bytes = magic
+// next 16 bytes = random id shared by all parts of the file
+// next 4 + 4 bytes = big endian part index, starting at 1, and part count
+// rest = nonce + sealed sha256 of the piece, the id, index and count
+//
+// the sealed hash authenticates the sequence once the key was derived
+// from the reassembled file.
+const partMagic = "CLOAKPRT"
+
+// size of the unsealed part of the header
+const partInfoSize = len(partMagic) + 16 + 4 + 4
+
+type part struct {
+	path   string
+	id     []byte
+	index  uint32
+	count  uint32
+	sealed []byte
+	data   []byte
+}
+
+// length of a part's header line, including the new line
+func partHeaderLen(aead cipher.AEAD) int64 {
+	return int64(hex.EncodedLen(partInfoSize+aead.NonceSize()+sha256.Size+24+aead.Overhead()) + 1)
+}
+
+// minimum part size that leaves room for the header and some data
+func minPartSize(aead cipher.AEAD) int64 {
+	return partHeaderLen(aead) + 1024
+}
+
+// contents the part's sealed hash is computed over
+func (p *part) digest() []byte {
+	sum := sha256.Sum256(p.data)
+	info := make([]byte, 0, sha256.Size+24)
+	info = append(info, sum[:]...)
+	info = append(info, p.id...)
+	info = binary.BigEndian.AppendUint32(info, p.index)
+	return binary.BigEndian.AppendUint32(info, p.count)
+}
+
+func partName(name string, index, count uint32) string {
+	width := len(fmt.Sprint(count))
+	if width < 3 {
+		width = 3
+	}
+	return fmt.Sprintf("%s.%0*d", name, width, index)
+}
+
+// number of parts of at most size bytes a body of n bytes is split into,
+// zero if size is too small to hold any data
+func partCount(n, size int64, aead cipher.AEAD) uint32 {
+
+	if size < minPartSize(aead) {
+		return 0
+	}
+
+	piece := size - partHeaderLen(aead)
+	count := uint32((n + piece - 1) / piece)
+	if count == 0 {
+		count = 1
+	}
+
+	return count
+}
+
+// splits body into parts of at most size bytes and writes them next to name
+func writeParts(name string, body []byte, size int64, aead cipher.AEAD, mode os.FileMode) ([]string, error) {
+
+	if min := minPartSize(aead); size < min {
+		return nil, fmt.Errorf("part size must be at least %d bytes", min)
+	}
+
+	piece := size - partHeaderLen(aead)
+	count := partCount(int64(len(body)), size, aead)
+
+	id, err := random(16)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i := uint32(0); i < count; i++ {
+		start := int64(i) * piece
+		end := start + piece
+		if end > int64(len(body)) {
+			end = int64(len(body))
+		}
+
+		p := &part{id: id, index: i + 1, count: count, data: body[start:end]}
+		nonce, err := random(aead.NonceSize())
+		if err != nil {
+			return nil, err
+		}
+		p.sealed = aead.Seal(nonce, nonce, p.digest(), nil)
+
+		header := make([]byte, 0, partInfoSize+len(p.sealed))
+		header = append(header, partMagic...)
+		header = append(header, id...)
+		header = binary.BigEndian.AppendUint32(header, p.index)
+		header = binary.BigEndian.AppendUint32(header, p.count)
+		header = append(header, p.sealed...)
+
+		out := make([]byte, 0, hex.EncodedLen(len(header))+1+len(p.data))
+		out = append(out, hex.EncodeToString(header)...)
+		out = append(out, '\n')
+		out = append(out, p.data...)
+
+		n := partName(name, p.index, p.count)
+		err = writeFile(n, out, defaultEncryptedMode, mode)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+
+	return names, nil
+}
+
+// reports whether file is a part of a split encrypted file
+func isPart(file []byte) bool {
+	prefix := hex.EncodeToString([]byte(partMagic))
+	return bytes.HasPrefix(file, []byte(prefix))
+}
+
+func parsePart(path string, file []byte) (*part, error) {
+
+	nl := bytes.IndexByte(file, '\n')
+	if nl < 0 {
+		return nil, ErrTruncated
+	}
+
+	header, err := hex.DecodeString(string(file[:nl]))
+	if err != nil || len(header) <= partInfoSize || string(header[:len(partMagic)]) != partMagic {
+		return nil, malformed("invalid part header")
+	}
+
+	info := header[len(partMagic):]
+	p := &part{
+		path:   path,
+		id:     info[:16],
+		index:  binary.BigEndian.Uint32(info[16:]),
+		count:  binary.BigEndian.Uint32(info[20:]),
+		sealed: header[partInfoSize:],
+		data:   file[nl+1:],
+	}
+	if p.index == 0 || p.index > p.count {
+		return nil, malformed("invalid part index")
+	}
+
+	return p, nil
+}
+
+// reads all parts of the split encrypted file path belongs to and
+// returns the reassembled file
+func readParts(path string, file []byte) ([]byte, []*part, error) {
+
+	first, err := parsePart(path, file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	parts := make([]*part, first.count)
+	var joined []byte
+	for i := uint32(1); i <= first.count; i++ {
+		p := first
+		if i != first.index {
+			name := partName(base, i, first.count)
+			data, err := readFile(name)
+			if os.IsNotExist(err) {
+				return nil, nil, fmt.Errorf("%w: %s", ErrPartMissing, name)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			p, err = parsePart(name, data)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if p.index != i || p.count != first.count || !bytes.Equal(p.id, first.id) {
+			return nil, nil, fmt.Errorf("%s doesn't belong to %s", p.path, path)
+		}
+		parts[i-1] = p
+		joined = append(joined, p.data...)
+	}
+
+	return joined, parts, nil
+}
+
+// checks the sealed hash of every part
+func verifyParts(aead cipher.AEAD, parts []*part) error {
+
+	nonceSize := aead.NonceSize()
+	for _, p := range parts {
+		if len(p.sealed) < nonceSize+aead.Overhead() {
+			return malformed("invalid part header")
+		}
+		digest, err := aead.Open(nil, p.sealed[:nonceSize], p.sealed[nonceSize:], nil)
+		if err != nil || subtle.ConstantTimeCompare(digest, p.digest()) != 1 {
+			return fmt.Errorf("part %s was modified", p.path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitParts(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-parts")
+	defer os.RemoveAll(dir)
+
+	original := bytes.Repeat([]byte(data), 40)
+	filename := filepath.Join(dir, "mail.txt")
+	ioutil.WriteFile(filename, original, 0644)
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{PartSize: 100}); err == nil {
+		t.Fatalf("expected an error for a part size without room for data")
+	}
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{PartSize: 4096})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if len(res.Parts) < 3 || res.Output != res.Parts[0] {
+		t.Fatalf("unexpected parts %v, output %s", res.Parts, res.Output)
+	}
+
+	for _, p := range res.Parts {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("stat %s: %v", p, err)
+		}
+		if fi.Size() > 4096 {
+			t.Fatalf("part %s is %d bytes, want at most 4096", p, fi.Size())
+		}
+	}
+
+	// any part reassembles the whole file
+	for _, p := range res.Parts {
+		plain, err := Plaintext(p, passphrase)
+		if err != nil {
+			t.Fatalf("Plaintext %s: %v", p, err)
+		}
+		if !bytes.Equal(plain, original) {
+			t.Fatalf("Plaintext %s returned different contents", p)
+		}
+	}
+
+	if ok, _ := IsEncrypted(res.Parts[1]); ok {
+		t.Fatalf("a single part shouldn't look like an encrypted file")
+	}
+}
+
+func TestSplitPartsTampering(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-parts")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "mail.txt")
+	ioutil.WriteFile(filename, bytes.Repeat([]byte(data), 40), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{PartSize: 4096})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	first, _ := ioutil.ReadFile(res.Parts[0])
+	second, _ := ioutil.ReadFile(res.Parts[1])
+
+	// swapped parts
+	ioutil.WriteFile(res.Parts[0], second, 0644)
+	ioutil.WriteFile(res.Parts[1], first, 0644)
+	if _, err := Plaintext(res.Parts[0], passphrase); err == nil {
+		t.Fatalf("expected an error for swapped parts")
+	}
+	ioutil.WriteFile(res.Parts[0], first, 0644)
+	ioutil.WriteFile(res.Parts[1], second, 0644)
+
+	// a modified piece
+	modified := append([]byte(nil), second...)
+	modified[len(modified)-10] ^= 1
+	ioutil.WriteFile(res.Parts[1], modified, 0644)
+	if _, err := Plaintext(res.Parts[0], passphrase); err == nil {
+		t.Fatalf("expected an error for a modified part")
+	}
+	ioutil.WriteFile(res.Parts[1], second, 0644)
+
+	// a missing part
+	os.Remove(res.Parts[len(res.Parts)-1])
+	if _, err := Plaintext(res.Parts[0], passphrase); !errors.Is(err, ErrPartMissing) {
+		t.Fatalf("expected ErrPartMissing, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileExtension returns the extension recorded for the file at path and
+// restored when it is decrypted. leading dots belong to the name, so
+// .bashrc has no extension, and a trailing dot is no extension either.
+// the extension of a tar archive is kept whole, archive.tar.gz is recorded
+// as .tar.gz rather than .gz. on Windows the alternate data stream of a
+// path such as notes.txt:summary isn't part of its extension.
+func FileExtension(path string) string {
+	_, ext := splitExt(path)
+	return ext
+}
+
+// EncryptedName returns the name a file is encrypted to unless
+// Options.OutputPath is set, path with its extension replaced by
+// Extension. the stream of an alternate data stream is added to the name,
+// notes.txt:summary is encrypted to notes_summary.cloak.
+func EncryptedName(path string) string {
+	return outputName(path, Options{})
+}
+
+// splits path into the name its output is derived from and the extension
+// to record
+func splitExt(path string) (string, string) {
+
+	if path == Stdio {
+		return path, ""
+	}
+
+	file, stream := splitStream(path)
+	i := len(file)
+	for i > 0 && !os.IsPathSeparator(file[i-1]) {
+		i--
+	}
+	name := strings.TrimLeft(file[i:], ".")
+
+	ext := filepath.Ext(name)
+	if ext == "." {
+		ext = ""
+	}
+	if rest := strings.TrimSuffix(name, ext); ext != "" && strings.EqualFold(filepath.Ext(rest), ".tar") {
+		ext = name[len(rest)-len(".tar"):]
+	}
+
+	stem := file[:len(file)-len(ext)]
+	if stream != "" {
+		stem += "_" + stream
+	}
+	return stem, ext
+}
@@ -0,0 +1,42 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build !windows
+// +build !windows
+
+package crypt
+
+import "os"
+
+// files have no alternate data streams on this platform
+func splitStream(path string) (string, string) {
+	return path, ""
+}
+
+func safeExt(ext string) string {
+	return ext
+}
+
+// hidden files are dotfiles on this platform, which is part of their name
+func fileHidden(info os.FileInfo) bool {
+	return false
+}
+
+func setHidden(path string) error {
+	return nil
+}
+
+// renames replace read-only files on this platform
+func makeReplaceable(path string) error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileExtension(t *testing.T) {
+
+	for _, tc := range []struct{ path, ext, output string }{
+		{"notes.txt", ".txt", "notes.cloak"},
+		{"archive.tar.gz", ".tar.gz", "archive.cloak"},
+		{"backup.TAR.XZ", ".TAR.XZ", "backup.cloak"},
+		{"report.v2.final.pdf", ".pdf", "report.v2.final.cloak"},
+		{"Makefile", "", "Makefile.cloak"},
+		{".bashrc", "", ".bashrc.cloak"},
+		{".config.json", ".json", ".config.cloak"},
+		{".tar.gz", ".gz", ".tar.cloak"},
+		{"trailing.", "", "trailing..cloak"},
+		{filepath.Join("v1.2", "LICENSE"), "", filepath.Join("v1.2", "LICENSE.cloak")},
+		{Stdio, "", Stdio},
+	} {
+		if ext := FileExtension(tc.path); ext != tc.ext {
+			t.Errorf("FileExtension(%q) = %q, want %q", tc.path, ext, tc.ext)
+		}
+		if output := EncryptedName(tc.path); output != tc.output {
+			t.Errorf("EncryptedName(%q) = %q, want %q", tc.path, output, tc.output)
+		}
+	}
+}
+
+func TestMultipleDots(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-dots")
+	defer os.RemoveAll(dir)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	for _, name := range []string{"archive.tar.gz", "Makefile", ".env"} {
+		ioutil.WriteFile(name, []byte(data), 0400)
+
+		res, err := EncryptWithOptions(name, passphrase, Options{ShredOriginal: true})
+		if err != nil {
+			t.Fatalf("EncryptWithOptions %s: %v", name, err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("the read-only original %s wasn't shredded: %v", name, err)
+		}
+
+		dec, err := DecryptWithOptions(res.Output, passphrase, Options{})
+		if err != nil {
+			t.Fatalf("DecryptWithOptions %s: %v", res.Output, err)
+		}
+		if want := "out" + FileExtension(name); dec.Output != want {
+			t.Fatalf("%s decrypted to %s, want %s", name, dec.Output, want)
+		}
+		if fi, _ := os.Stat(dec.Output); fi.Mode().Perm() != 0400 {
+			t.Fatalf("expected the read-only mode restored, got %v", fi.Mode().Perm())
+		}
+		os.Remove(dec.Output)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build windows
+// +build windows
+
+package crypt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// paths this long are only opened by the Windows API with the \\?\ prefix
+const maxPath = 260
+
+// splits the alternate data stream off a path such as notes.txt:summary or
+// notes.txt:summary:$DATA, the stream is empty for the file itself
+func splitStream(path string) (string, string) {
+
+	vol := filepath.VolumeName(path)
+	rest := path[len(vol):]
+	i := strings.LastIndexAny(rest, `\/`)
+	colon := strings.IndexByte(rest[i+1:], ':')
+	if colon < 0 {
+		return path, ""
+	}
+
+	file := path[:len(vol)+i+1+colon]
+	stream := rest[i+1+colon+1:]
+	if j := strings.IndexByte(stream, ':'); j >= 0 {
+		stream = stream[:j]
+	}
+	return file, stream
+}
+
+// an extension written by another platform could name a stream of the
+// decrypted file
+func safeExt(ext string) string {
+	return strings.ReplaceAll(ext, ":", "_")
+}
+
+// prefixes an absolute path too long for the Windows API with \\?\, the
+// os package does the same for the files it opens
+func longPath(path string) string {
+
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) || !filepath.IsAbs(path) {
+		return path
+	}
+	path = filepath.Clean(path)
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
+
+// reports whether the file described by info has the hidden attribute
+func fileHidden(info os.FileInfo) bool {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
+
+// sets the hidden attribute of the file at path
+func setHidden(path string) error {
+
+	p, err := syscall.UTF16PtrFromString(longPath(path))
+	if err != nil {
+		return err
+	}
+	attrs, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return err
+	}
+	return syscall.SetFileAttributes(p, attrs|syscall.FILE_ATTRIBUTE_HIDDEN)
+}
+
+// read-only files can't be replaced by a rename on Windows, the attribute
+// of an existing target is cleared first
+func makeReplaceable(path string) error {
+
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode().Perm()&0200 != 0 {
+		return nil
+	}
+	return os.Chmod(path, fi.Mode().Perm()|0200)
+}
@@ -0,0 +1,103 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build windows
+// +build windows
+
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestWindowsPaths(t *testing.T) {
+
+	for _, tc := range []struct{ path, ext, output string }{
+		{`C:\Users\me\notes.txt`, ".txt", `C:\Users\me\notes.cloak`},
+		{`C:notes.txt`, ".txt", `C:notes.cloak`},
+		{`\\server\share\dir.v2\LICENSE`, "", `\\server\share\dir.v2\LICENSE.cloak`},
+		{`\\?\C:\data\archive.tar.gz`, ".tar.gz", `\\?\C:\data\archive.cloak`},
+		{`notes.txt:summary`, ".txt", `notes_summary.cloak`},
+		{`C:\data\notes.txt:summary:$DATA`, ".txt", `C:\data\notes_summary.cloak`},
+		{`notes.txt::$DATA`, ".txt", `notes.cloak`},
+	} {
+		if ext := FileExtension(tc.path); ext != tc.ext {
+			t.Errorf("FileExtension(%q) = %q, want %q", tc.path, ext, tc.ext)
+		}
+		if output := EncryptedName(tc.path); output != tc.output {
+			t.Errorf("EncryptedName(%q) = %q, want %q", tc.path, output, tc.output)
+		}
+	}
+
+	long := `C:\` + strings.Repeat(`directory\`, 30) + "file.txt"
+	if got := longPath(long); got != `\\?\`+long {
+		t.Errorf("longPath(%q) = %q", long, got)
+	}
+	unc := `\\server\share\` + strings.Repeat(`directory\`, 30) + "file.txt"
+	if got := longPath(unc); got != `\\?\UNC\`+unc[2:] {
+		t.Errorf("longPath(%q) = %q", unc, got)
+	}
+	for _, short := range []string{`C:\file.txt`, `\\?\` + long, strings.Repeat(`directory\`, 30)} {
+		if got := longPath(short); got != short {
+			t.Errorf("longPath(%q) = %q, want it unchanged", short, got)
+		}
+	}
+	if got := safeExt(".txt:summary"); got != ".txt_summary" {
+		t.Errorf("safeExt kept a stream name, got %q", got)
+	}
+}
+
+func TestWindowsAttributes(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-attributes")
+	defer os.RemoveAll(dir)
+
+	// deep enough to need the \\?\ prefix
+	deep := filepath.Join(dir, strings.Repeat("directory", 8), strings.Repeat("directory", 8), strings.Repeat("directory", 8), strings.Repeat("directory", 8))
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(deep, "hidden.tar.gz")
+	ioutil.WriteFile(filename, []byte(data), 0444)
+	if err := setHidden(filename); err != nil {
+		t.Fatalf("setHidden: %v", err)
+	}
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	out := filepath.Join(deep, "restored.tar.gz")
+	if _, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: out}); err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileHidden(fi) || fi.Mode().Perm()&0200 != 0 {
+		t.Fatalf("expected a hidden read-only file, got %v", fi.Mode())
+	}
+
+	// a read-only output is replaced with Overwrite
+	if _, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: out, Overwrite: true}); err != nil {
+		t.Fatalf("DecryptWithOptions over a read-only file: %v", err)
+	}
+	p, _ := syscall.UTF16PtrFromString(longPath(out))
+	syscall.SetFileAttributes(p, syscall.FILE_ATTRIBUTE_NORMAL)
+}
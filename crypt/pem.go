@@ -0,0 +1,82 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"encoding/pem"
+	"strconv"
+)
+
+// files encrypted with Options.PEM are a binary file in a PEM block:
+//
+//	-----BEGIN CLOAK FILE-----
+//	Version: 2
+//	Cipher: secretbox
+//
+//	base64 of the binary file, 64 characters per line
+//	-----END CLOAK FILE-----
+//
+// the header fields are informational, decrypting reads the parameters
+// from the authenticated binary header.
+const pemType = "CLOAK FILE"
+
+var pemBegin = []byte("-----BEGIN " + pemType + "-----")
+
+// wraps a binary encrypted file with the header h in a PEM block
+func encodePEM(body []byte, h *binaryHeader) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type: pemType,
+		Headers: map[string]string{
+			"Version": strconv.Itoa(int(h.version)),
+			"Cipher":  cipherName(h.cipher),
+		},
+		Bytes: body,
+	})
+}
+
+// reports whether file starts with a PEM block, leading blank lines and
+// indentation are allowed so pasted blocks are recognised
+func isPEM(file []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(file, " \t\r\n"), pemBegin)
+}
+
+// returns the binary file inside a PEM block, and file itself if it isn't
+// one
+func unwrapPEM(file []byte) ([]byte, error) {
+
+	if !isPEM(file) {
+		return file, nil
+	}
+
+	if !bytes.Contains(file, []byte("-----END "+pemType+"-----")) {
+		return nil, ErrTruncated
+	}
+	block, rest := pem.Decode(file)
+	if block == nil {
+		return nil, malformed("invalid PEM block")
+	}
+	if block.Type != pemType {
+		return nil, malformed("PEM block isn't a cloak file")
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, malformed("data after the PEM block")
+	}
+	if !isBinary(block.Bytes) {
+		return nil, malformed("PEM block doesn't hold a binary file")
+	}
+
+	return block.Bytes, nil
+}
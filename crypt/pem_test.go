@@ -0,0 +1,90 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptPEM(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-pem")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "pem.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{PEM: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	armored, _ := ioutil.ReadFile(res.Output)
+	if !bytes.HasPrefix(armored, []byte("-----BEGIN CLOAK FILE-----\nCipher: secretbox\nVersion: 2\n\n")) {
+		t.Fatalf("unexpected armor:\n%s", armored)
+	}
+	for _, line := range strings.Split(string(armored), "\n") {
+		if len(line) > 64 {
+			t.Fatalf("line longer than 64 characters: %s", line)
+		}
+	}
+
+	info, err := ReadFormat(res.Output)
+	if err != nil || !info.PEM || info.Version != formatBinary || info.Ext != ".txt" {
+		t.Fatalf("ReadFormat: %+v, %v", info, err)
+	}
+	if ok, err := IsEncrypted(res.Output); !ok || err != nil {
+		t.Fatalf("IsEncrypted: %v, %v", ok, err)
+	}
+	if _, err := ReadRandomness(res.Output); err != nil {
+		t.Fatalf("ReadRandomness: %v", err)
+	}
+
+	// pasted blocks are often indented by a blank line and end with one
+	pasted := filepath.Join(dir, "pasted.cloak")
+	ioutil.WriteFile(pasted, append(append([]byte("\n\n"), armored...), "\n"...), 0600)
+
+	plain, err := Plaintext(pasted, passphrase)
+	if err != nil || string(plain) != data {
+		t.Fatalf("Plaintext: %v", err)
+	}
+
+	cases := map[string][]byte{
+		"truncated":  armored[:len(armored)/2],
+		"trailing":   append(append([]byte(nil), armored...), "more"...),
+		"wrong type": bytes.Replace(armored, []byte("CLOAK FILE"), []byte("CLOAK DATA"), 2),
+	}
+	for name, file := range cases {
+		bad := filepath.Join(dir, "bad.cloak")
+		ioutil.WriteFile(bad, file, 0600)
+		_, err := Plaintext(bad, passphrase)
+		if name == "truncated" && err != ErrTruncated {
+			t.Fatalf("%s: expected ErrTruncated, got %v", name, err)
+		}
+		if name != "truncated" && !errors.Is(err, ErrMalformed) {
+			t.Fatalf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+
+	if _, err := EncryptWithOptions(filename, passphrase, Options{PEM: true, Armor: true, Overwrite: true}); err == nil {
+		t.Fatalf("expected PEM and Armor to be refused together")
+	}
+}
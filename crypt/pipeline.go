@@ -0,0 +1,164 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/binary"
+	"io"
+	"runtime"
+)
+
+// chunks buffered per worker, so reading and writing can run ahead of
+// sealing
+const chunksPerWorker = 2
+
+// a chunk of a stream passed from the reader to a worker sealing it and
+// on to the writer
+type streamChunk struct {
+	index uint64
+	last  bool
+	plain []byte
+	n     int
+
+	sealed []byte
+	err    error
+	// signaled once sealed or err is set
+	done chan struct{}
+}
+
+// the number of goroutines sealing chunks with opts
+func (o Options) workers() int {
+	if o.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.Workers
+}
+
+// writes header and the chunks read from r sealed with key to w, the same
+// bytes a streamEncrypter produces. one goroutine reads the chunks, up to
+// workers seal them concurrently and the calling goroutine writes them in
+// order, so reading, sealing and writing overlap and throughput scales
+// with the cores instead of being capped by one. at most chunksPerWorker
+// chunks per worker are held in memory.
+func sealChunks(r io.Reader, w io.Writer, header []byte, key *streamKey, workers int, opts Options) error {
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	free := make(chan *streamChunk, chunksPerWorker*workers)
+	for i := 0; i < cap(free); i++ {
+		free <- &streamChunk{
+			plain:  make([]byte, streamChunkSize),
+			sealed: make([]byte, 0, 4+streamChunkSize+key.aead.Overhead()),
+			done:   make(chan struct{}, 1),
+		}
+	}
+	jobs := make(chan *streamChunk)
+	order := make(chan *streamChunk, cap(free))
+
+	// stops the reader once the writer returned, the workers stop when
+	// the reader closes jobs
+	quit := make(chan struct{})
+	defer close(quit)
+
+	go readChunks(r, free, jobs, order, quit)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for c := range jobs {
+				c.sealed = key.seal(append(c.sealed[:0], 0, 0, 0, 0), c.index, c.last, c.plain[:c.n])
+				binary.BigEndian.PutUint32(c.sealed, uint32(len(c.sealed)-4))
+				c.done <- struct{}{}
+			}
+		}()
+	}
+
+	for c := range order {
+		<-c.done
+		if c.err != nil {
+			return c.err
+		}
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		if _, err := w.Write(c.sealed); err != nil {
+			return err
+		}
+		free <- c
+	}
+	return nil
+}
+
+// reads r chunk by chunk into the chunks taken from free, sending each to
+// order and then to jobs, until the last chunk, a read error sent as a
+// failed chunk, or quit. like a streamEncrypter it reads one chunk ahead
+// to tell whether a full chunk is the last one.
+func readChunks(r io.Reader, free <-chan *streamChunk, jobs, order chan<- *streamChunk, quit <-chan struct{}) {
+
+	defer close(jobs)
+	defer close(order)
+
+	take := func() *streamChunk {
+		select {
+		case c := <-free:
+			return c
+		case <-quit:
+			return nil
+		}
+	}
+	send := func(ch chan<- *streamChunk, c *streamChunk) bool {
+		select {
+		case ch <- c:
+			return true
+		case <-quit:
+			return false
+		}
+	}
+	read := func(c *streamChunk) error {
+		n, err := io.ReadFull(r, c.plain)
+		c.n = n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+
+	cur := take()
+	if cur == nil {
+		return
+	}
+	err := read(cur)
+	for index := uint64(0); ; index++ {
+		var next *streamChunk
+		if err == nil && cur.n == streamChunkSize {
+			if next = take(); next == nil {
+				return
+			}
+			err = read(next)
+		}
+		if err != nil {
+			cur.err = err
+			cur.done <- struct{}{}
+			send(order, cur)
+			return
+		}
+
+		cur.index = index
+		cur.last = next == nil || next.n == 0
+		if !send(order, cur) || !send(jobs, cur) || cur.last {
+			return
+		}
+		cur = next
+	}
+}
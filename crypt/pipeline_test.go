@@ -0,0 +1,86 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// fails once more than n bytes were written
+type limitedWriter struct {
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		return 0, errors.New("disk full")
+	}
+	l.n -= len(p)
+	return len(p), nil
+}
+
+func TestSealChunks(t *testing.T) {
+
+	header, key, err := newStream(passphrase, XChaCha20Poly1305, DefaultKDFParams)
+	if err != nil {
+		t.Fatalf("newStream: %v", err)
+	}
+
+	// the same bytes as sealing on one goroutine, whatever the chunk
+	// boundaries and the reads
+	for _, size := range []int{0, 100, streamChunkSize, 2 * streamChunkSize, 7*streamChunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		e := newStreamEncrypter(bytes.NewReader(plain), key, 0)
+		e.out = header
+		want, err := ioutil.ReadAll(e)
+		if err != nil {
+			t.Fatalf("streamEncrypter %d bytes: %v", size, err)
+		}
+
+		for _, workers := range []int{2, 3, 8} {
+			var got bytes.Buffer
+			if err := sealChunks(iotest.HalfReader(bytes.NewReader(plain)), &got, header, key, workers, Options{}); err != nil {
+				t.Fatalf("sealChunks %d bytes on %d workers: %v", size, workers, err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Fatalf("sealChunks %d bytes on %d workers differs from one goroutine", size, workers)
+			}
+		}
+	}
+
+	plain := make([]byte, 5*streamChunkSize)
+	err = sealChunks(failingReader{bytes.NewReader(plain)}, ioutil.Discard, header, key, 4, Options{})
+	if err == nil || err.Error() != "disk on fire" {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	err = sealChunks(bytes.NewReader(plain), &limitedWriter{n: 2 * streamChunkSize}, header, key, 4, Options{})
+	if err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+
+	var encrypted, decrypted bytes.Buffer
+	if err := EncryptStreamWithOptions(bytes.NewReader(plain), &encrypted, passphrase, Options{Workers: 4}); err != nil {
+		t.Fatalf("EncryptStreamWithOptions: %v", err)
+	}
+	if err := DecryptStream(&encrypted, &decrypted, passphrase); err != nil || !bytes.Equal(decrypted.Bytes(), plain) {
+		t.Fatalf("round trip on 4 workers: %v", err)
+	}
+}
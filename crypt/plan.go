@@ -0,0 +1,143 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlanAction is what encrypting a file would do with it.
+type PlanAction string
+
+const (
+	// the file would be encrypted to a new output
+	PlanEncrypt PlanAction = "encrypt"
+	// the file would be encrypted, replacing an existing output
+	PlanOverwrite PlanAction = "overwrite"
+	// the file would be left alone, Reason says why
+	PlanSkip PlanAction = "skip"
+)
+
+// PlanEntry describes what encrypting one file would do, as returned by
+// Plan and Watcher.Plan before anything is touched.
+type PlanEntry struct {
+	Path   string     `json:"path"`
+	Action PlanAction `json:"action"`
+	// the encrypted file that would be written, empty when skipped
+	Output string `json:"output,omitempty"`
+	// the original would be shredded once encrypted
+	Shred bool `json:"shred,omitempty"`
+	// why the file would be skipped
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plan reports what EncryptManyWithOptions would do with paths and opts,
+// one PlanEntry per path in the order of paths, without reading or
+// writing any of them. files that aren't regular, unless opts.AllowSpecial
+// is set, and files whose output exists, unless opts.Overwrite is set,
+// would be skipped. with opts.PartSize any existing part of the output
+// counts as the output existing.
+func Plan(paths []string, opts Options) []PlanEntry {
+
+	opts.OutputPath = ""
+
+	plan := make([]PlanEntry, len(paths))
+	for i, path := range paths {
+		plan[i] = planFile(path, opts)
+	}
+	return plan
+}
+
+// what encrypting path next to itself with opts would do
+func planFile(path string, opts Options) PlanEntry {
+
+	entry := PlanEntry{Path: path, Action: PlanSkip}
+
+	if opts.AllowSpecial {
+		if _, err := os.Stat(path); err != nil {
+			entry.Reason = err.Error()
+			return entry
+		}
+	} else if err := CheckRegular(path); err != nil {
+		entry.Reason = planReason(path, err)
+		return entry
+	}
+
+	output := outputName(path, opts)
+	exists, err := outputExists(output, opts.PartSize)
+	if err != nil {
+		entry.Reason = err.Error()
+		return entry
+	}
+	if exists && !opts.Overwrite {
+		entry.Reason = fmt.Sprintf("%s exists", output)
+		return entry
+	}
+
+	entry.Action = PlanEncrypt
+	if exists {
+		entry.Action = PlanOverwrite
+	}
+	entry.Output = output
+	entry.Shred = opts.ShredOriginal
+	return entry
+}
+
+// the error of checking path as a reason, without the path it starts with
+func planReason(path string, err error) string {
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return strings.TrimPrefix(err.Error(), path+": ")
+}
+
+// reports whether name, or any part it would be split into with partSize,
+// exists
+func outputExists(name string, partSize int64) (bool, error) {
+
+	if _, err := os.Lstat(name); err == nil {
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	if partSize <= 0 {
+		return false, nil
+	}
+
+	parts, err := filepath.Glob(globEscape(name) + ".[0-9][0-9][0-9]*")
+	return len(parts) > 0, err
+}
+
+// escapes the characters of name that filepath.Glob treats specially,
+// except on Windows where backslashes are separators and can't escape
+func globEscape(name string) string {
+
+	if filepath.Separator == '\\' {
+		return name
+	}
+	var b strings.Builder
+	for _, c := range name {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
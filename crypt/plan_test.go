@@ -0,0 +1,81 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-plan")
+	defer os.RemoveAll(dir)
+
+	fresh := filepath.Join(dir, "fresh.txt")
+	done := filepath.Join(dir, "done.txt")
+	missing := filepath.Join(dir, "missing.txt")
+	ioutil.WriteFile(fresh, []byte(data), 0644)
+	ioutil.WriteFile(done, []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "done.cloak"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte(data), 0644)
+
+	paths := []string{fresh, done, dir, missing}
+	plan := Plan(paths, Options{ShredOriginal: true})
+	want := []PlanAction{PlanEncrypt, PlanSkip, PlanSkip, PlanSkip}
+	for i, e := range plan {
+		if e.Path != paths[i] || e.Action != want[i] {
+			t.Fatalf("expected %s to %s, got %+v", paths[i], want[i], e)
+		}
+	}
+	if plan[0].Output != filepath.Join(dir, "fresh.cloak") || !plan[0].Shred {
+		t.Fatalf("unexpected output or shred %+v", plan[0])
+	}
+	if plan[1].Reason == "" || plan[1].Output != "" || plan[1].Shred {
+		t.Fatalf("expected a reason and no output, got %+v", plan[1])
+	}
+	if plan = Plan(paths[1:2], Options{Overwrite: true}); plan[0].Action != PlanOverwrite {
+		t.Fatalf("expected the output overwritten, got %+v", plan[0])
+	}
+
+	// nothing is touched
+	if _, err := os.Stat(filepath.Join(dir, "fresh.cloak")); !os.IsNotExist(err) {
+		t.Fatalf("planning wrote an output")
+	}
+
+	w := &Watcher{Dir: dir, Passphrase: passphrase, Options: Options{Exclude: []string{"fresh.*"}}}
+	plan, err := w.Plan()
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	reasons := map[string]string{
+		".hidden":    "hidden",
+		"done.cloak": "already encrypted",
+		"done.txt":   filepath.Join(dir, "done.cloak") + " exists",
+		"fresh.txt":  "filtered out",
+	}
+	if len(plan) != len(reasons) {
+		t.Fatalf("expected %d entries, got %+v", len(reasons), plan)
+	}
+	for _, e := range plan {
+		if e.Action != PlanSkip || e.Reason != reasons[filepath.Base(e.Path)] {
+			t.Fatalf("unexpected entry %+v", e)
+		}
+	}
+	if results, _ := w.Scan(); len(results) != 0 {
+		t.Fatalf("expected nothing encrypted on the first scan, got %v", results)
+	}
+}
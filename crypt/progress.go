@@ -0,0 +1,117 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// input is read in chunks of this size when progress is reported
+const progressChunkSize = 1 << 20
+
+// ProgressFunc is called with the number of input bytes processed so far
+// and the size of the input, or -1 when it isn't known. it is called from
+// the goroutine doing the work and should return quickly.
+type ProgressFunc func(bytesDone, bytesTotal int64)
+
+// reports every read of r to fn
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.fn(p.done, p.total)
+	}
+	return n, err
+}
+
+// wraps r so its reads are reported to fn, r is returned as is when fn is
+// nil
+func withProgress(r io.Reader, fn ProgressFunc) io.Reader {
+	if fn == nil {
+		return r
+	}
+	return &progressReader{r: r, total: readerSize(r), fn: fn}
+}
+
+// the number of bytes left in r when it can tell, otherwise -1
+func readerSize(r io.Reader) int64 {
+
+	switch r := r.(type) {
+	case *bytes.Reader:
+		return int64(r.Len())
+	case *bytes.Buffer:
+		return int64(r.Len())
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	}
+	return -1
+}
+
+// reads the file at path, or standard input for Stdio, in chunks,
+// reporting them to fn
+func readFileProgress(path string, fn ProgressFunc) ([]byte, error) {
+
+	if fn == nil {
+		return readFile(path)
+	}
+
+	in := stdin
+	if path != Stdio {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	size := readerSize(in)
+	var buf bytes.Buffer
+	if size > 0 {
+		buf.Grow(int(size))
+	}
+
+	r := &progressReader{r: in, total: size, fn: fn}
+	chunk := make([]byte, progressChunkSize)
+	for {
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// records progress calls and checks they only move forward
+type progressLog struct {
+	t     *testing.T
+	calls int
+	done  int64
+	total int64
+}
+
+func (l *progressLog) report(done, total int64) {
+	if done < l.done {
+		l.t.Fatalf("progress went back from %d to %d", l.done, done)
+	}
+	l.calls++
+	l.done, l.total = done, total
+}
+
+func TestProgressFile(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-progress")
+	defer os.RemoveAll(dir)
+
+	// a few chunks plus a partial one
+	plain := bytes.Repeat([]byte("0123456789abcdef"), 3*progressChunkSize/16+100)
+	filename := filepath.Join(dir, "big.bin")
+	ioutil.WriteFile(filename, plain, 0644)
+
+	enc := &progressLog{t: t}
+	res, err := EncryptWithOptions(filename, []byte("pass"), Options{Progress: enc.report})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if enc.calls < 4 || enc.done != int64(len(plain)) || enc.total != int64(len(plain)) {
+		t.Fatalf("encrypting reported %d calls ending at %d of %d", enc.calls, enc.done, enc.total)
+	}
+
+	info, _ := os.Stat(res.Output)
+	dec := &progressLog{t: t}
+	_, err = DecryptWithOptions(res.Output, []byte("pass"), Options{OutputPath: filepath.Join(dir, "out.bin"), Progress: dec.report})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if dec.done != info.Size() || dec.total != info.Size() {
+		t.Fatalf("decrypting reported %d of %d, the file has %d bytes", dec.done, dec.total, info.Size())
+	}
+}
+
+func TestProgressStream(t *testing.T) {
+
+	plain := bytes.Repeat([]byte("stream"), 3*streamChunkSize/6)
+
+	enc := &progressLog{t: t}
+	var sealed bytes.Buffer
+	err := EncryptStreamWithOptions(bytes.NewReader(plain), &sealed, []byte("pass"), Options{Progress: enc.report})
+	if err != nil {
+		t.Fatalf("EncryptStreamWithOptions: %v", err)
+	}
+	if enc.calls < 3 || enc.done != int64(len(plain)) || enc.total != int64(len(plain)) {
+		t.Fatalf("encrypting reported %d calls ending at %d of %d", enc.calls, enc.done, enc.total)
+	}
+
+	// the size of a plain reader isn't known
+	size := int64(sealed.Len())
+	dec := &progressLog{t: t}
+	var out bytes.Buffer
+	err = DecryptStreamWithOptions(struct{ io.Reader }{&sealed}, &out, []byte("pass"), Options{Progress: dec.report})
+	if err != nil {
+		t.Fatalf("DecryptStreamWithOptions: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Fatalf("decrypted stream differs")
+	}
+	if dec.done != size || dec.total != -1 {
+		t.Fatalf("decrypting reported %d of %d, want %d of -1", dec.done, dec.total, size)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoProviderStanza is returned when a file has no file key wrapped by
+// the key provider it is decrypted with.
+var ErrNoProviderStanza = errors.New("file key isn't wrapped by this key provider")
+
+// KeyProvider wraps file keys with a key it manages, such as a key of
+// HashiCorp Vault or a cloud key management service, so access to files
+// is granted and revoked centrally instead of by sharing passphrases. the
+// file format stays the same, the wrapped key is one more stanza of a
+// recipients file.
+type KeyProvider interface {
+	// Name identifies the provider and its key in the file header,
+	// decrypting unwraps the stanza with the same name. at most 255
+	// bytes.
+	Name() string
+
+	// WrapKey encrypts a file key with the managed key.
+	WrapKey(ctx context.Context, fileKey []byte) ([]byte, error)
+
+	// UnwrapKey decrypts a file key wrapped by WrapKey. the returned
+	// slice is zeroed once the file key is used.
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// EncryptWithKeyProvider is like EncryptToRecipients but wraps the random
+// file key with p, DecryptWithKeyProvider decrypts it.
+func EncryptWithKeyProvider(path string, p KeyProvider, opts Options) (*Result, error) {
+
+	start := time.Now()
+
+	data, meta, release, err := readInput(path, &opts)
+	if err != nil {
+		return nil, err
+	}
+	// a mapped input is the file itself and can't be wiped
+	if opts.mapped == nil {
+		defer opts.hold(data)()
+	}
+
+	extension := FileExtension(path)
+	name := outputName(path, opts)
+
+	res, err := encryptMulti(data, name, extension, meta, nil, nil, []KeyProvider{p}, opts, start)
+	release()
+
+	return shredAfter(path, res, err, opts)
+}
+
+// DecryptWithKeyProvider is like DecryptWithOptions for files written by
+// EncryptWithKeyProvider, opts.Context bounds the calls to p.
+func DecryptWithKeyProvider(path string, p KeyProvider, opts Options) (*Result, error) {
+	return decryptWith(path, nil, opts, func(file []byte) (*plainFile, error) {
+		return openProvider(opts.context(), file, p)
+	})
+}
+
+// PlaintextWithKeyProvider is like Plaintext for files written by
+// EncryptWithKeyProvider.
+func PlaintextWithKeyProvider(path string, p KeyProvider) ([]byte, error) {
+
+	plain, _, err := openPathWith(path, func(file []byte) (*plainFile, error) {
+		return openProvider(context.Background(), file, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plain.data, nil
+}
+
+// decrypts a formatRecipients file with the key p unwraps from its stanza
+func openProvider(ctx context.Context, file []byte, p KeyProvider) (*plainFile, error) {
+
+	h, err := parseBinaryHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if h.version != formatRecipients {
+		return nil, ErrNoProviderStanza
+	}
+
+	return openBinaryKey(file, h, func(c Cipher) ([]byte, error) {
+		for _, s := range h.stanzas {
+			name, wrapped, ok := parseProviderStanza(s)
+			if !ok || name != p.Name() {
+				continue
+			}
+			key, err := p.UnwrapKey(ctx, wrapped)
+			if err != nil {
+				return nil, fmt.Errorf("unwrapping the file key with %s: %w", name, err)
+			}
+			if len(key) != c.KeySize() {
+				return nil, fmt.Errorf("%s unwrapped a key of %d bytes", name, len(key))
+			}
+			return key, nil
+		}
+		return nil, ErrNoProviderStanza
+	})
+}
+
+func wrapProvider(ctx context.Context, fileKey []byte, p KeyProvider) (stanza, error) {
+
+	name := p.Name()
+	if name == "" || len(name) > 255 {
+		return stanza{}, fmt.Errorf("invalid key provider name %q", name)
+	}
+	wrapped, err := p.WrapKey(ctx, fileKey)
+	if err != nil {
+		return stanza{}, fmt.Errorf("wrapping the file key with %s: %w", name, err)
+	}
+	if len(wrapped) == 0 || 1+len(name)+len(wrapped) > 1<<16-1 {
+		return stanza{}, fmt.Errorf("%s wrapped the file key in %d bytes", name, len(wrapped))
+	}
+
+	body := append([]byte{byte(len(name))}, name...)
+	return stanza{kind: stanzaProvider, body: append(body, wrapped...)}, nil
+}
+
+// splits a key provider stanza into the provider name and wrapped key
+func parseProviderStanza(s stanza) (string, []byte, bool) {
+	if s.kind != stanzaProvider || len(s.body) < 1 {
+		return "", nil, false
+	}
+	n := int(s.body[0])
+	if n == 0 || len(s.body) <= 1+n {
+		return "", nil, false
+	}
+	return string(s.body[1 : 1+n]), s.body[1+n:], true
+}
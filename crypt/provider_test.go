@@ -0,0 +1,110 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// a transit engine that "encrypts" by prefixing, enough to check what
+// cloak sends and stores
+func fakeVault(t *testing.T, token string) *httptest.Server {
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/files":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"ciphertext": "vault:v1:" + req["plaintext"]},
+			})
+		case "/v1/transit/decrypt/files":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"plaintext": strings.TrimPrefix(req["ciphertext"], "vault:v1:")},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"no handler for route"}})
+		}
+	}))
+}
+
+func TestKeyProvider(t *testing.T) {
+
+	srv := fakeVault(t, "s.token")
+	defer srv.Close()
+
+	dir, _ := ioutil.TempDir("", "cloak-provider")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "provider.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	vault := &VaultTransit{Address: srv.URL, Token: "s.token", Key: "files"}
+	res, err := EncryptWithKeyProvider(filename, vault, Options{})
+	if err != nil {
+		t.Fatalf("EncryptWithKeyProvider: %v", err)
+	}
+	if res.Secret != nil {
+		t.Fatalf("expected no passphrase in the result")
+	}
+	if err := Conform(res.Output); err != nil {
+		t.Fatalf("Conform: %v", err)
+	}
+
+	plain, err := PlaintextWithKeyProvider(res.Output, vault)
+	if err != nil {
+		t.Fatalf("PlaintextWithKeyProvider: %v", err)
+	}
+	if string(plain) != data {
+		t.Fatalf("unexpected contents %q", plain)
+	}
+
+	other := &VaultTransit{Address: srv.URL, Token: "s.token", Key: "other"}
+	if _, err := PlaintextWithKeyProvider(res.Output, other); err != ErrNoProviderStanza {
+		t.Fatalf("expected ErrNoProviderStanza with another key, got %v", err)
+	}
+	revoked := &VaultTransit{Address: srv.URL, Token: "s.revoked", Key: "files"}
+	if _, err := PlaintextWithKeyProvider(res.Output, revoked); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected vault's error with a revoked token, got %v", err)
+	}
+	if _, err := Plaintext(res.Output, passphrase); err == nil {
+		t.Fatalf("expected an error decrypting with a passphrase")
+	}
+
+	// the file key is only as safe as the provider keeps it
+	file, _ := ioutil.ReadFile(res.Output)
+	h, _ := parseBinaryHeader(file)
+	_, wrapped, ok := parseProviderStanza(h.stanzas[0])
+	if !ok || !strings.HasPrefix(string(wrapped), "vault:v1:") {
+		t.Fatalf("expected the ciphertext returned by vault in the header")
+	}
+	if _, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(wrapped), "vault:v1:")); err != nil {
+		t.Fatalf("expected the file key sent base64 encoded: %v", err)
+	}
+}
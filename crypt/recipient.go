@@ -0,0 +1,653 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drish/cloak/internal/bech32"
+)
+
+// the header of formatRecipients files:
+// magic (8 bytes) + version byte + cipher id byte + stanza count byte
+// then for each stanza a kind byte + big endian body length (2 bytes) +
+// body, then big endian plaintext size (8 bytes) + extension length byte
+// + extension. metadata and data follow as in formatBinary files.
+//
+// an x25519 stanza body is the ephemeral public key (32 bytes) + nonce +
+// the file key sealed with a key derived from the shared secret.
+// a passphrase stanza body is the kdf id byte + its three big endian costs
+// (4 bytes each) + salt (32 bytes) + nonce + the file key sealed with the
+// key derived from the passphrase.
+// a key provider stanza body is the provider name length byte + name + the
+// file key as wrapped by the provider.
+// an ssh-ed25519 stanza body is the tag of the SSH key (4 bytes) + the
+// ephemeral public key (32 bytes) + nonce + the sealed file key, an
+// ssh-rsa stanza body the tag + the file key wrapped with RSA-OAEP.
+const (
+	stanzaX25519     = 1
+	stanzaPassphrase = 2
+	stanzaProvider   = 3
+	stanzaSSHEd25519 = 4
+	stanzaSSHRSA     = 5
+
+	x25519KeySize = 32
+	wrapInfo      = "cloak x25519 file key"
+
+	// kdf id and costs, then the salt
+	passphraseSaltOffset = 1 + 12
+	passphraseStanzaSize = passphraseSaltOffset + 32
+
+	recipientPrefix = "cloak-pub-"
+	identityPrefix  = "CLOAK-SECRET-KEY-"
+)
+
+// ErrRecipients is returned when a file encrypted to recipients is opened
+// with a passphrase.
+var ErrRecipients = errors.New("file is encrypted to recipients, decrypt it with an identity")
+
+// ErrNoIdentity is returned when none of the identities is a recipient of
+// the file.
+var ErrNoIdentity = errors.New("no identity matches a recipient of the file")
+
+// a wrapped file key in the header of a formatRecipients file
+type stanza struct {
+	kind byte
+	body []byte
+}
+
+// Identity is an X25519 private key files can be decrypted with, or an
+// SSH private key read by ParseSSHIdentity.
+type Identity struct {
+	key *ecdh.PrivateKey
+	ssh *sshIdentity
+}
+
+// Recipient is an X25519 public key files can be encrypted to, or an SSH
+// public key.
+type Recipient struct {
+	key *ecdh.PublicKey
+	ssh *sshPublicKey
+}
+
+// GenerateIdentity returns a new random identity.
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// Recipient returns the public key files are encrypted to for i.
+func (i *Identity) Recipient() *Recipient {
+	if i.ssh != nil {
+		return &Recipient{ssh: i.ssh.pub}
+	}
+	return &Recipient{key: i.key.PublicKey()}
+}
+
+// String encodes the identity as CLOAK-SECRET-KEY- followed by the hex
+// private key. SSH identities stay in their key files, their String is
+// empty.
+func (i *Identity) String() string {
+	if i.ssh != nil {
+		return ""
+	}
+	return identityPrefix + strings.ToUpper(hex.EncodeToString(i.key.Bytes()))
+}
+
+// String encodes the recipient as cloak-pub- followed by the hex public
+// key, or an SSH recipient as its authorized_keys line.
+func (r *Recipient) String() string {
+	if r.ssh != nil {
+		return r.ssh.String()
+	}
+	return recipientPrefix + hex.EncodeToString(r.key.Bytes())
+}
+
+// AgeString encodes the identity like age-keygen, as AGE-SECRET-KEY-1
+// followed by the bech32 private key. it's empty for SSH identities.
+func (i *Identity) AgeString() string {
+	if i.ssh != nil {
+		return ""
+	}
+	s, _ := bech32.Encode(ageIdentityHRP, i.key.Bytes())
+	return s
+}
+
+// AgeString encodes the recipient like age, as age1 followed by the
+// bech32 public key. age takes SSH recipients as they are.
+func (r *Recipient) AgeString() string {
+	if r.ssh != nil {
+		return r.ssh.String()
+	}
+	s, _ := bech32.Encode(ageRecipientHRP, r.key.Bytes())
+	return s
+}
+
+// ParseIdentity decodes an identity encoded by Identity.String or
+// Identity.AgeString, so identities written by age-keygen can be used.
+func ParseIdentity(s string) (*Identity, error) {
+
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, ageIdentityHRP+"1") {
+		b, err := decodeAgeKey(s, ageIdentityHRP)
+		if err != nil {
+			return nil, errors.New("invalid age identity")
+		}
+		key, err := ecdh.X25519().NewPrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{key: key}, nil
+	}
+	if !strings.HasPrefix(s, identityPrefix) {
+		return nil, errors.New("invalid identity, expected " + identityPrefix + "...")
+	}
+	b, err := hex.DecodeString(s[len(identityPrefix):])
+	if err != nil || len(b) != x25519KeySize {
+		return nil, errors.New("invalid identity key")
+	}
+	key, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseRecipient decodes a recipient encoded by Recipient.String or
+// Recipient.AgeString, or an ssh-ed25519 or ssh-rsa public key line such
+// as the contents of ~/.ssh/id_ed25519.pub.
+func ParseRecipient(s string) (*Recipient, error) {
+
+	s = strings.TrimSpace(s)
+	if isSSHKey(s) {
+		k, err := parseSSHPublicKey(s)
+		if err != nil {
+			return nil, err
+		}
+		return &Recipient{ssh: k}, nil
+	}
+	if strings.HasPrefix(s, ageRecipientHRP+"1") {
+		b, err := decodeAgeKey(s, ageRecipientHRP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q", s)
+		}
+		key, err := ecdh.X25519().NewPublicKey(b)
+		if err != nil {
+			return nil, err
+		}
+		return &Recipient{key: key}, nil
+	}
+	if !strings.HasPrefix(s, recipientPrefix) {
+		return nil, fmt.Errorf("invalid recipient %q, expected %s...", s, recipientPrefix)
+	}
+	b, err := hex.DecodeString(s[len(recipientPrefix):])
+	if err != nil || len(b) != x25519KeySize {
+		return nil, fmt.Errorf("invalid recipient key %q", s)
+	}
+	key, err := ecdh.X25519().NewPublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Recipient{key: key}, nil
+}
+
+// decodes the bech32 key s, whose human readable part must be hrp
+func decodeAgeKey(s, hrp string) ([]byte, error) {
+	got, b, err := bech32.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(got, hrp) || len(b) != x25519KeySize {
+		return nil, errors.New("invalid age key")
+	}
+	return b, nil
+}
+
+// ParseIdentities decodes one identity per line of data, skipping blank
+// lines and comments starting with #, as written by the keygen command.
+// data may also be an unencrypted SSH private key, see ParseSSHIdentity.
+func ParseIdentities(data []byte) ([]*Identity, error) {
+
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		id, err := ParseSSHIdentity(data, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []*Identity{id}, nil
+	}
+
+	var ids []*Identity
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := ParseIdentity(line)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no identities found")
+	}
+	return ids, nil
+}
+
+// EncryptToRecipients is like EncryptWithOptions but seals the file with a
+// random key wrapped for each recipient, any of their identities can
+// decrypt it. opts.Armor is not supported.
+func EncryptToRecipients(path string, recipients []*Recipient, opts Options) (*Result, error) {
+	return EncryptMulti(path, nil, recipients, opts)
+}
+
+// EncryptMulti is like EncryptToRecipients but also wraps the file key for
+// each passphrase, so any of the passphrases or identities can decrypt
+// the file without encrypting it once per recipient. opts.KDF sets the
+// parameters the passphrase keys are derived with.
+func EncryptMulti(path string, passphrases [][]byte, recipients []*Recipient, opts Options) (*Result, error) {
+
+	start := time.Now()
+
+	data, meta, release, err := readInput(path, &opts)
+	if err != nil {
+		return nil, err
+	}
+	// a mapped input is the file itself and can't be wiped
+	if opts.mapped == nil {
+		defer opts.hold(data)()
+	}
+
+	extension := FileExtension(path)
+	name := outputName(path, opts)
+
+	res, err := encryptMulti(data, name, extension, meta, passphrases, recipients, nil, opts, start)
+	release()
+
+	return shredAfter(path, res, err, opts)
+}
+
+func encryptMulti(data []byte, name, extension string, meta *fileMeta, passphrases [][]byte, recipients []*Recipient, providers []KeyProvider, opts Options, start time.Time) (*Result, error) {
+
+	if n := len(passphrases) + len(recipients) + len(providers); n == 0 || n > 255 {
+		return nil, errors.New("between 1 and 255 passphrases, recipients and key providers are required")
+	}
+	if opts.Armor {
+		return nil, errors.New("armored files can't be used with recipients")
+	}
+	if opts.KeyFile != "" {
+		return nil, errors.New("key files can't be combined with passphrases and recipients")
+	}
+	if opts.CheckEntropy {
+		if err := CheckEntropy(); err != nil {
+			return nil, err
+		}
+	}
+	params := opts.KDF.withDefaults()
+	if !params.valid() {
+		return nil, fmt.Errorf("invalid %s parameters", params.KDF)
+	}
+	for _, p := range passphrases {
+		if len(p) == 0 {
+			return nil, errors.New("empty passphrase")
+		}
+	}
+
+	c, err := LookupCipher(opts.cipher())
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey, err := random(c.KeySize())
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(fileKey)
+	opts.trace("wrapping a random file key", "passphrases", len(passphrases), "recipients", len(recipients), "providers", len(providers), "kdf", params)
+
+	h := &binaryHeader{version: formatRecipients, cipher: opts.cipher(), meta: meta, labels: opts.Labels}
+	for _, p := range passphrases {
+		s, err := wrapPassphrase(c, fileKey, p, params)
+		if err != nil {
+			return nil, err
+		}
+		h.stanzas = append(h.stanzas, s)
+	}
+	for _, r := range recipients {
+		wrap := wrapX25519
+		if r.ssh != nil {
+			wrap = wrapSSH
+		}
+		s, err := wrap(c, fileKey, r)
+		if err != nil {
+			return nil, err
+		}
+		h.stanzas = append(h.stanzas, s)
+	}
+	for _, p := range providers {
+		s, err := wrapProvider(opts.context(), fileKey, p)
+		if err != nil {
+			return nil, err
+		}
+		h.stanzas = append(h.stanzas, s)
+	}
+
+	aead, err := c.New(fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := seal(data, name, extension, nil, aead, h, opts, start)
+	if err != nil {
+		return nil, err
+	}
+	res.Cipher = c.Name()
+	if len(passphrases) > 0 {
+		res.Secret = newSecret(passphrases[0])
+		if !opts.Quiet {
+			res.Passphrase = string(passphrases[0])
+		}
+		res.KDF = params
+	}
+	return res, nil
+}
+
+// DecryptWithIdentities is like DecryptWithOptions for files written by
+// EncryptToRecipients, trying each identity in turn.
+func DecryptWithIdentities(path string, identities []*Identity, opts Options) (*Result, error) {
+	return decryptWith(path, nil, opts, func(file []byte) (*plainFile, error) {
+		return openRecipients(file, identities)
+	})
+}
+
+// PlaintextWithIdentities is like Plaintext for files written by
+// EncryptToRecipients.
+func PlaintextWithIdentities(path string, identities []*Identity) ([]byte, error) {
+
+	plain, _, err := openPathWith(path, func(file []byte) (*plainFile, error) {
+		return openRecipients(file, identities)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plain.data, nil
+}
+
+// decrypts a formatRecipients file with the first identity that unwraps
+// one of its keys
+func openRecipients(file []byte, identities []*Identity) (*plainFile, error) {
+
+	h, err := parseBinaryHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if h.version != formatRecipients {
+		return nil, errors.New("file is not encrypted to recipients, decrypt it with a passphrase")
+	}
+
+	return openBinaryKey(file, h, func(c Cipher) ([]byte, error) {
+		for _, s := range h.stanzas {
+			for _, id := range identities {
+				unwrap := unwrapX25519
+				switch {
+				case s.kind == stanzaX25519 && id.ssh == nil:
+				case (s.kind == stanzaSSHEd25519 || s.kind == stanzaSSHRSA) && id.ssh != nil:
+					unwrap = unwrapSSH
+				default:
+					continue
+				}
+				if key, err := unwrap(c, s, id); err == nil {
+					return key, nil
+				}
+			}
+		}
+		return nil, ErrNoIdentity
+	})
+}
+
+// decrypts a formatRecipients file with the first passphrase stanza the
+// passphrase unwraps
+func openPassphraseStanzas(file []byte, h *binaryHeader, passphrase []byte) (*plainFile, error) {
+
+	var params KDFParams
+	var salt []byte
+	plain, err := openBinaryKey(file, h, func(c Cipher) ([]byte, error) {
+		wrapped := false
+		for _, s := range h.stanzas {
+			if s.kind != stanzaPassphrase {
+				continue
+			}
+			wrapped = true
+			key, p, err := unwrapPassphrase(c, s, passphrase)
+			if err == nil {
+				params, salt = p, s.body[passphraseSaltOffset:passphraseStanzaSize]
+				return key, nil
+			}
+		}
+		if !wrapped {
+			return nil, ErrRecipients
+		}
+		return nil, ErrWrongPassphrase
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plain.kdf = params
+	plain.salt = salt
+	return plain, nil
+}
+
+func wrapPassphrase(c Cipher, fileKey, passphrase []byte, params KDFParams) (stanza, error) {
+
+	salt, err := random(32)
+	if err != nil {
+		return stanza{}, err
+	}
+	key, err := deriveKey(passphrase, salt, params, c.KeySize())
+	if err != nil {
+		return stanza{}, err
+	}
+	defer wipe(key)
+	aead, err := c.New(key)
+	if err != nil {
+		return stanza{}, err
+	}
+	nonce, err := random(aead.NonceSize())
+	if err != nil {
+		return stanza{}, err
+	}
+
+	body := []byte{byte(params.KDF)}
+	for _, v := range params.costs() {
+		body = binary.BigEndian.AppendUint32(body, uint32(v))
+	}
+	body = append(append(body, salt...), nonce...)
+	return stanza{kind: stanzaPassphrase, body: aead.Seal(body, nonce, fileKey, nil)}, nil
+}
+
+func unwrapPassphrase(c Cipher, s stanza, passphrase []byte) ([]byte, KDFParams, error) {
+
+	if len(s.body) < passphraseStanzaSize {
+		return nil, KDFParams{}, malformed("passphrase stanza")
+	}
+	params := kdfFromCosts(KDF(s.body[0]), [3]int{
+		int(binary.BigEndian.Uint32(s.body[1:])),
+		int(binary.BigEndian.Uint32(s.body[5:])),
+		int(binary.BigEndian.Uint32(s.body[9:])),
+	})
+	// checked before deriving, the header isn't authenticated yet
+	if !params.valid() {
+		return nil, KDFParams{}, malformed("invalid passphrase stanza parameters")
+	}
+
+	key, err := deriveKey(passphrase, s.body[passphraseSaltOffset:passphraseStanzaSize], params, c.KeySize())
+	if err != nil {
+		return nil, KDFParams{}, err
+	}
+	defer wipe(key)
+	aead, err := c.New(key)
+	if err != nil {
+		return nil, KDFParams{}, err
+	}
+
+	sealed := s.body[passphraseStanzaSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, KDFParams{}, malformed("passphrase stanza")
+	}
+	fileKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	return fileKey, params, err
+}
+
+// the key wrapping a file key for an x25519 shared secret, bound to both
+// public keys
+func wrapKey(c Cipher, shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	return hkdf.Key(sha256.New, shared, salt, wrapInfo, c.KeySize())
+}
+
+func wrapX25519(c Cipher, fileKey []byte, r *Recipient) (stanza, error) {
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return stanza{}, err
+	}
+	shared, err := ephemeral.ECDH(r.key)
+	if err != nil {
+		return stanza{}, err
+	}
+
+	pub := ephemeral.PublicKey().Bytes()
+	key, err := wrapKey(c, shared, pub, r.key.Bytes())
+	if err != nil {
+		return stanza{}, err
+	}
+	aead, err := c.New(key)
+	if err != nil {
+		return stanza{}, err
+	}
+
+	nonce, err := random(aead.NonceSize())
+	if err != nil {
+		return stanza{}, err
+	}
+	body := append(pub, nonce...)
+	return stanza{kind: stanzaX25519, body: aead.Seal(body, nonce, fileKey, nil)}, nil
+}
+
+func unwrapX25519(c Cipher, s stanza, id *Identity) ([]byte, error) {
+
+	if len(s.body) < x25519KeySize {
+		return nil, malformed("x25519 stanza")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(s.body[:x25519KeySize])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := id.key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := wrapKey(c, shared, s.body[:x25519KeySize], id.key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := s.body[x25519KeySize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, malformed("x25519 stanza")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func (h *binaryHeader) marshalRecipients() []byte {
+
+	b := append([]byte(binaryMagic), formatRecipients, byte(h.cipher), byte(len(h.stanzas)))
+	for _, s := range h.stanzas {
+		b = append(b, s.kind)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s.body)))
+		b = append(b, s.body...)
+	}
+	b = binary.BigEndian.AppendUint64(b, h.plainSize)
+	b = append(b, byte(len(h.ext)))
+	return append(b, h.ext...)
+}
+
+// parses the header of a formatRecipients file, returning ErrTruncated
+// when file is too short to hold it
+func parseRecipientHeader(file []byte) (*binaryHeader, error) {
+
+	b := file[len(binaryMagic):]
+	if len(b) < 3 {
+		return nil, ErrTruncated
+	}
+	h := &binaryHeader{version: formatRecipients, cipher: CipherID(b[1])}
+	count := int(b[2])
+	if count == 0 {
+		return nil, malformed("no recipients")
+	}
+
+	b = b[3:]
+	for i := 0; i < count; i++ {
+		if len(b) < 3 {
+			return nil, ErrTruncated
+		}
+		n := int(binary.BigEndian.Uint16(b[1:]))
+		if len(b) < 3+n {
+			return nil, ErrTruncated
+		}
+		h.stanzas = append(h.stanzas, stanza{kind: b[0], body: b[3 : 3+n]})
+		b = b[3+n:]
+	}
+
+	if len(b) < 9 {
+		return nil, ErrTruncated
+	}
+	h.plainSize = binary.BigEndian.Uint64(b)
+	extLen := int(b[8])
+	if len(b) < 9+extLen {
+		return nil, ErrTruncated
+	}
+	h.ext = b[9 : 9+extLen]
+	if !validExt(h.ext) {
+		return nil, malformed("invalid extension")
+	}
+	h.raw = file[:len(file)-len(b)+9+extLen]
+
+	return h, nil
+}
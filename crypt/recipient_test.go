@@ -0,0 +1,191 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentityEncoding(t *testing.T) {
+
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity: %v", err)
+	}
+
+	parsed, err := ParseIdentity(id.String())
+	if err != nil || parsed.String() != id.String() {
+		t.Fatalf("ParseIdentity: %v", err)
+	}
+
+	r, err := ParseRecipient(id.Recipient().String())
+	if err != nil || r.String() != id.Recipient().String() {
+		t.Fatalf("ParseRecipient: %v", err)
+	}
+
+	ids, err := ParseIdentities([]byte("# public key: " + r.String() + "\n\n" + id.String() + "\n"))
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("ParseIdentities: %v", err)
+	}
+
+	for _, bad := range []string{"", "cloak-pub-00", recipientPrefix + "zz", id.String()} {
+		if _, err := ParseRecipient(bad); err == nil {
+			t.Fatalf("expected an error parsing recipient %q", bad)
+		}
+	}
+}
+
+func TestEncryptToRecipients(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-recipient")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	var ids []*Identity
+	var recipients []*Recipient
+	for i := 0; i < 4; i++ {
+		id, _ := GenerateIdentity()
+		ids = append(ids, id)
+		recipients = append(recipients, id.Recipient())
+	}
+
+	res, err := EncryptToRecipients(filename, recipients, Options{})
+	if err != nil {
+		t.Fatalf("EncryptToRecipients: %v", err)
+	}
+
+	// every recipient can decrypt on its own
+	for i, id := range ids {
+		got, err := PlaintextWithIdentities(res.Output, []*Identity{id})
+		if err != nil || string(got) != data {
+			t.Fatalf("identity %d: %v", i, err)
+		}
+	}
+
+	other, _ := GenerateIdentity()
+	if _, err := PlaintextWithIdentities(res.Output, []*Identity{other}); err != ErrNoIdentity {
+		t.Fatalf("expected ErrNoIdentity, got %v", err)
+	}
+
+	if _, err := Plaintext(res.Output, passphrase); err != ErrRecipients {
+		t.Fatalf("expected ErrRecipients, got %v", err)
+	}
+
+	// the header doesn't fit the prefix ReadFormat reads first
+	info, err := ReadFormat(res.Output)
+	if err != nil || info.Version != formatRecipients || info.Recipients != len(ids) || info.Ext != ".txt" {
+		t.Fatalf("ReadFormat: %+v %v", info, err)
+	}
+
+	out := filepath.Join(dir, "out.txt")
+	dec, err := DecryptWithIdentities(res.Output, ids[2:], Options{OutputPath: out, Strict: true})
+	if err != nil {
+		t.Fatalf("DecryptWithIdentities: %v", err)
+	}
+	if len(dec.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", dec.Warnings)
+	}
+	if got, _ := ioutil.ReadFile(out); string(got) != data {
+		t.Fatalf("decrypted file has different contents")
+	}
+}
+
+func TestRecipientsTampering(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-recipient")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	id, _ := GenerateIdentity()
+	res, err := EncryptToRecipients(filename, []*Recipient{id.Recipient()}, Options{})
+	if err != nil {
+		t.Fatalf("EncryptToRecipients: %v", err)
+	}
+	file, _ := ioutil.ReadFile(res.Output)
+
+	for _, cut := range []int{len(binaryMagic) + 2, len(binaryMagic) + 40, len(file) - 1} {
+		if _, err := openRecipients(file[:cut], []*Identity{id}); err != ErrTruncated {
+			t.Fatalf("open truncated at %d: expected ErrTruncated, got %v", cut, err)
+		}
+	}
+
+	// the stanzas are outside of the ciphertext but authenticated
+	h, _ := parseBinaryHeader(file)
+	modified := append([]byte(nil), file...)
+	modified[len(h.raw)-1] = 'x'
+	if _, err := openRecipients(modified, []*Identity{id}); err == nil {
+		t.Fatalf("expected an error for a modified header")
+	}
+
+	if _, err := EncryptToRecipients(filename, nil, Options{}); err == nil {
+		t.Fatalf("expected an error without recipients")
+	}
+	if _, err := EncryptToRecipients(filename, []*Recipient{id.Recipient()}, Options{Armor: true}); err == nil {
+		t.Fatalf("expected an error for armored output")
+	}
+}
+
+func TestEncryptMulti(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-recipient")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "shared.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	id, _ := GenerateIdentity()
+	passphrases := [][]byte{[]byte("first"), []byte("second")}
+	params := KDFParams{KDF: Argon2id, Time: 2, Memory: 64, Threads: 1}
+
+	res, err := EncryptMulti(filename, passphrases, []*Recipient{id.Recipient()}, Options{KDF: params})
+	if err != nil {
+		t.Fatalf("EncryptMulti: %v", err)
+	}
+
+	// the content key is wrapped per passphrase, the data sealed once
+	for _, p := range passphrases {
+		plain, _, err := openPath(res.Output, p)
+		if err != nil || string(plain.data) != data {
+			t.Fatalf("passphrase %s: %v", p, err)
+		}
+		if plain.kdf != params {
+			t.Fatalf("unexpected parameters %+v", plain.kdf)
+		}
+	}
+
+	if got, err := PlaintextWithIdentities(res.Output, []*Identity{id}); err != nil || string(got) != data {
+		t.Fatalf("identity: %v", err)
+	}
+
+	if _, err := Plaintext(res.Output, []byte("third")); err == nil {
+		t.Fatalf("expected an error for a wrong passphrase")
+	}
+
+	// Decrypt picks the stanzas up without options
+	out := filepath.Join(dir, "out.txt")
+	if _, err := DecryptWithOptions(res.Output, passphrases[1], Options{OutputPath: out}); err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+
+	if _, err := EncryptMulti(filename, [][]byte{nil}, nil, Options{}); err == nil {
+		t.Fatalf("expected an error for an empty passphrase")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// Rekey decrypts the encrypted file at path in memory with oldPass and
+// encrypts it again with newPass, a new salt and the default key
+// derivation parameters, for rotation policies or after a passphrase was
+// compromised. the new file replaces the old one atomically, a crash
+// leaves one or the other behind but never a mix of both. the extension,
+// labels, rotation period and recorded metadata of the original are kept.
+func Rekey(path string, oldPass, newPass []byte) (*Result, error) {
+	return RekeyWithOptions(path, oldPass, newPass, Options{})
+}
+
+// RekeyWithOptions is like Rekey but encrypts the file again with opts,
+// such as another KDF or Cipher. armored files are rewritten in the binary
+// format unless opts.Armor is set, as they can't hold the current
+// parameters, and PEM files stay PEM files. the signature of a signed
+// file is verified and dropped, it is signed again with opts.Sign only.
+// opts.OutputPath and opts.PartSize are ignored, split files and files
+// encrypted to recipients can't be rekeyed, and armored files without a
+// trailer return ErrLegacyFormat unless opts.AllowLegacy is set.
+func RekeyWithOptions(path string, oldPass, newPass []byte, opts Options) (*Result, error) {
+
+	start := time.Now()
+
+	if path == Stdio {
+		return nil, errors.New("standard input can't be rekeyed in place")
+	}
+	if len(newPass) == 0 && opts.KeyFile == "" {
+		return nil, errors.New("a new passphrase is required to rekey a file")
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := readFileContext(opts.context(), path, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	if isPart(file) {
+		return nil, errors.New("split files can't be rekeyed in place, decrypt and encrypt them again")
+	}
+	unwrapped, _, err := unwrapSigned(file)
+	if err != nil {
+		return nil, err
+	}
+	unwrapped, err = unwrapPEM(unwrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := open(unwrapped, oldPass)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plain.data)
+	opts.trace("opened", "layout", layoutName(unwrapped), "cipher", plain.cipher, "kdf", plain.kdf, "labels", len(plain.labels))
+	if !plain.trailer && !opts.AllowLegacy {
+		return nil, ErrLegacyFormat
+	}
+
+	if opts.Labels == nil {
+		opts.Labels = plain.labels
+	}
+	if opts.RotateAfter == 0 {
+		opts.RotateAfter = plain.rotation.after
+	}
+	if opts.Mode == 0 {
+		opts.Mode = fi.Mode().Perm()
+	}
+	if !opts.Armor && isPEM(file) {
+		opts.PEM = true
+	}
+	opts.OutputPath = path
+	opts.PartSize = 0
+	opts.Overwrite = true
+	opts.ShredOriginal = false
+
+	return encrypt(plain.data, path, string(plain.ext), plain.meta, newPass, opts, start)
+}
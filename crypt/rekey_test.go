@@ -0,0 +1,91 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRekey(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-rekey")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "rekey.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	newPass := []byte("new passphrase")
+	labels := map[string]string{"team": "ops"}
+	res, err := EncryptWithOptions(filename, passphrase, Options{Labels: labels, Mode: 0600})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	before, _ := ioutil.ReadFile(res.Output)
+
+	if _, err := Rekey(res.Output, []byte("wrong"), newPass); err == nil {
+		t.Fatalf("expected an error with a wrong passphrase")
+	}
+	if after, _ := ioutil.ReadFile(res.Output); !bytes.Equal(after, before) {
+		t.Fatalf("a failed rekey changed the file")
+	}
+
+	rekeyed, err := Rekey(res.Output, passphrase, newPass)
+	if err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+	if rekeyed.Output != res.Output || bytes.Equal(rekeyed.Salt, res.Salt) {
+		t.Fatalf("expected %s rewritten with a new salt", res.Output)
+	}
+	if rekeyed.KDF != DefaultKDFParams {
+		t.Fatalf("expected the default parameters, got %v", rekeyed.KDF)
+	}
+
+	if _, err := Plaintext(res.Output, passphrase); err == nil {
+		t.Fatalf("the old passphrase still decrypts")
+	}
+	plain, ext, err := PlaintextExt(res.Output, newPass)
+	if err != nil {
+		t.Fatalf("PlaintextExt: %v", err)
+	}
+	if string(plain) != data || ext != ".txt" {
+		t.Fatalf("unexpected contents or extension %q", ext)
+	}
+	if got, _ := Labels(res.Output, newPass); got["team"] != "ops" {
+		t.Fatalf("labels weren't kept, got %v", got)
+	}
+	if fi, _ := os.Stat(res.Output); fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	// armored files can't hold the current parameters
+	armored := filepath.Join(dir, "armored.cloak")
+	if _, err := EncryptWithOptions(filename, passphrase, Options{Armor: true, OutputPath: armored}); err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if _, err := Rekey(armored, passphrase, newPass); err != nil {
+		t.Fatalf("Rekey %s: %v", armored, err)
+	}
+	file, _ := ioutil.ReadFile(armored)
+	if !isBinary(file) {
+		t.Fatalf("expected %s rewritten in the binary format", armored)
+	}
+
+	if _, err := Rekey(res.Output, newPass, nil); err == nil {
+		t.Fatalf("expected an error without a new passphrase")
+	}
+}
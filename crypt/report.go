@@ -0,0 +1,172 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+)
+
+// kinds of errors reported by ErrorKind. they are part of the json form
+// of a Report and don't change.
+const (
+	ErrorKindWrongKey        = "wrong_key"
+	ErrorKindCorrupt         = "corrupt"
+	ErrorKindUntrustedSigner = "untrusted_signer"
+	ErrorKindOutputExists    = "output_exists"
+	ErrorKindNotFound        = "not_found"
+	ErrorKindPermission      = "permission"
+	ErrorKindWeak            = "weak"
+	ErrorKindCanceled        = "canceled"
+	ErrorKindOther           = "other"
+)
+
+// ErrorKind classifies an error returned by this package, so tools can
+// tell a wrong passphrase from a damaged file without matching messages.
+// it is empty for a nil error and ErrorKindOther for errors of no other
+// kind.
+func ErrorKind(err error) string {
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrWrongPassphrase), errors.Is(err, ErrNoIdentity), errors.Is(err, ErrNoProviderStanza),
+		errors.Is(err, ErrTokenMismatch), errors.Is(err, ErrKeyFileRequired), errors.Is(err, ErrNotKeyFile),
+		errors.Is(err, ErrRecipients):
+		return ErrorKindWrongKey
+	case errors.Is(err, ErrCorruptFile), errors.Is(err, ErrSignature), errors.Is(err, ErrPartMissing),
+		errors.Is(err, ErrNotEncrypted), errors.Is(err, ErrUnsupportedVersion):
+		return ErrorKindCorrupt
+	case errors.Is(err, ErrUntrustedSigner):
+		return ErrorKindUntrustedSigner
+	case errors.Is(err, ErrOutputExists):
+		return ErrorKindOutputExists
+	case errors.Is(err, os.ErrNotExist):
+		return ErrorKindNotFound
+	case errors.Is(err, os.ErrPermission):
+		return ErrorKindPermission
+	case errors.Is(err, ErrWeakPassphrase), errors.Is(err, ErrWeakParams):
+		return ErrorKindWeak
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindCanceled
+	}
+	return ErrorKindOther
+}
+
+// Report describes a finished operation, or the error it failed with, in
+// a form meant to be encoded as json for tools driving cloak rather than
+// parsing its logs. fields are only ever added, never renamed or removed.
+type Report struct {
+	// what was done, such as encrypt or decrypt, and to which file
+	Operation string `json:"operation"`
+	Input     string `json:"input"`
+
+	OK bool `json:"ok"`
+
+	Output   string   `json:"output,omitempty"`
+	Parts    []string `json:"parts,omitempty"`
+	BytesIn  int64    `json:"bytes_in,omitempty"`
+	BytesOut int64    `json:"bytes_out,omitempty"`
+
+	// hex encoded salt, empty for files without one
+	Salt   string     `json:"salt,omitempty"`
+	KDF    *KDFReport `json:"kdf,omitempty"`
+	Cipher string     `json:"cipher,omitempty"`
+
+	Duration float64 `json:"duration_seconds"`
+
+	// hex encoded blake2b-512 of the plaintext
+	PlaintextHash string `json:"plaintext_blake2b,omitempty"`
+
+	Created     *time.Time        `json:"created,omitempty"`
+	RotateAfter string            `json:"rotate_after,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Signer      string            `json:"signer,omitempty"`
+	Warnings    []string          `json:"warnings,omitempty"`
+
+	// message and kind of the error the operation failed with
+	Error     string `json:"error,omitempty"`
+	ErrorKind string `json:"error_kind,omitempty"`
+}
+
+// KDFReport holds the key derivation function of a Report and its costs,
+// only those of the function are set.
+type KDFReport struct {
+	Name    string `json:"name"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	Time    int    `json:"time,omitempty"`
+	Memory  int    `json:"memory_kib,omitempty"`
+	Threads int    `json:"threads,omitempty"`
+}
+
+// NewReport describes the operation on input that returned res and err.
+// res may be nil, or partly filled, when the operation failed or doesn't
+// return a Result. the passphrase of res is never reported.
+func NewReport(operation, input string, res *Result, err error) Report {
+
+	r := Report{Operation: operation, Input: input, OK: err == nil}
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorKind = ErrorKind(err)
+	}
+	if res == nil {
+		return r
+	}
+
+	r.Output = res.Output
+	r.Parts = res.Parts
+	r.BytesIn, r.BytesOut = res.BytesIn, res.BytesOut
+	if len(res.Salt) > 0 {
+		r.Salt = hex.EncodeToString(res.Salt)
+	}
+	if res.KDF != (KDFParams{}) {
+		r.KDF = newKDFReport(res.KDF)
+	}
+	r.Cipher = res.Cipher
+	r.Duration = res.Duration.Seconds()
+	if len(res.PlaintextHash) > 0 {
+		r.PlaintextHash = hex.EncodeToString(res.PlaintextHash)
+	}
+	if !res.Created.IsZero() {
+		created := res.Created.UTC()
+		r.Created = &created
+	}
+	if res.RotateAfter > 0 {
+		r.RotateAfter = res.RotateAfter.String()
+	}
+	r.Labels = res.Labels
+	if res.Signer != nil {
+		r.Signer = res.Signer.String()
+	}
+	r.Warnings = res.Warnings
+
+	return r
+}
+
+func newKDFReport(p KDFParams) *KDFReport {
+
+	k := &KDFReport{Name: p.KDF.String()}
+	switch p.KDF {
+	case Scrypt:
+		k.N, k.R, k.P = p.N, p.R, p.P
+	case Argon2id:
+		k.Time, k.Memory, k.Threads = p.Time, p.Memory, p.Threads
+	}
+	return k
+}
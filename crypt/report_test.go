@@ -0,0 +1,90 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-report")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "report.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Labels: map[string]string{"team": "ops"}})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	r := NewReport("encrypt", filename, res, nil)
+	if !r.OK || r.Output != res.Output || r.Salt == "" || r.KDF == nil || r.KDF.N != DefaultKDFParams.N || r.Cipher == "" || r.Error != "" {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(b, &fields)
+	for _, name := range []string{"operation", "input", "ok", "output", "salt", "kdf", "cipher", "duration_seconds", "plaintext_blake2b", "created"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("report has no %s: %s", name, b)
+		}
+	}
+	if _, ok := fields["error"]; ok {
+		t.Fatalf("successful report has an error: %s", b)
+	}
+
+	_, err = DecryptWithOptions(res.Output, []byte("wrong"), Options{OutputPath: filepath.Join(dir, "out.txt")})
+	r = NewReport("decrypt", res.Output, nil, err)
+	if r.OK || r.Error == "" || r.ErrorKind != ErrorKindWrongKey {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if _, err := EncryptWithOptions(filename, passphrase, Options{}); ErrorKind(err) != ErrorKindOutputExists {
+		t.Fatalf("expected %s, got %v", ErrorKindOutputExists, err)
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+
+	for _, tc := range []struct {
+		err  error
+		kind string
+	}{
+		{nil, ""},
+		{fmt.Errorf("opening: %w", ErrWrongPassphrase), ErrorKindWrongKey},
+		{ErrNoIdentity, ErrorKindWrongKey},
+		{ErrTruncated, ErrorKindCorrupt},
+		{malformed("bad header"), ErrorKindCorrupt},
+		{ErrSignature, ErrorKindCorrupt},
+		{ErrUntrustedSigner, ErrorKindUntrustedSigner},
+		{fmt.Errorf("%w: out.txt", ErrOutputExists), ErrorKindOutputExists},
+		{&os.PathError{Op: "open", Path: "missing", Err: os.ErrNotExist}, ErrorKindNotFound},
+		{&os.PathError{Op: "open", Path: "secret", Err: os.ErrPermission}, ErrorKindPermission},
+		{ErrWeakPassphrase, ErrorKindWeak},
+		{errors.New("disk full"), ErrorKindOther},
+	} {
+		if kind := ErrorKind(tc.err); kind != tc.kind {
+			t.Errorf("ErrorKind(%v) = %q, want %q", tc.err, kind, tc.kind)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import "time"
+
+// Result describes a finished Encrypt or Decrypt operation.
+type Result struct {
+	// passphrase the file was encrypted with, generated by Encrypt
+	// when none was provided. it is never logged, showing it is up to
+	// the caller. empty with Options.Quiet
+	Passphrase string
+
+	// the same passphrase, which can be destroyed once it was shown or
+	// stored. nil when decrypting or encrypting to recipients only
+	Secret *Secret
+
+	// path of the written file, the first part when it was split
+	Output string
+
+	// paths of all parts when the encrypted file was split
+	Parts []string
+
+	// size of the input and the written file
+	BytesIn  int64
+	BytesOut int64
+
+	// scrypt salt and parameters the key was derived with
+	Salt []byte
+	KDF  KDFParams
+
+	// name of the cipher used to seal the file
+	Cipher string
+
+	// time the operation took
+	Duration time.Duration
+
+	// blake2b-512 of the plaintext
+	PlaintextHash []byte
+
+	// when the file was encrypted and how long its passphrase should be
+	// used before rotating it, zero when unknown or unset
+	Created     time.Time
+	RotateAfter time.Duration
+
+	// weaknesses of the decrypted file's parameters, see MinKDFParams
+	Warnings []string
+
+	// labels the decrypted file was encrypted with, see Options.Labels
+	Labels map[string]string
+
+	// key the decrypted file was signed with, nil when it isn't signed
+	Signer *VerifyingKey
+}
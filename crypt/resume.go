@@ -0,0 +1,552 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DecryptStreamAt decrypts a stream written by EncryptStream of size bytes
+// from r, such as an object in remote storage read with ranged requests,
+// and writes the plaintext to w.
+//
+// each chunk is fetched with a single ReadAt call and authenticated before
+// it is written. a failed fetch is retried up to retries times from the
+// start of the chunk, so a dropped connection resumes at the last
+// verified chunk rather than at the start of the stream. like
+// DecryptStream, data written before an error must be discarded.
+func DecryptStreamAt(r io.ReaderAt, size int64, w io.Writer, passphrase []byte, retries int) error {
+
+	fetch := func(buf []byte, off int64) error {
+		for attempt := 0; ; attempt++ {
+			n, err := r.ReadAt(buf, off)
+			if n == len(buf) {
+				return nil
+			}
+			if attempt >= retries {
+				if err == nil || err == io.EOF {
+					err = ErrTruncated
+				}
+				return err
+			}
+		}
+	}
+
+	if size < int64(streamHeaderSize) {
+		return ErrTruncated
+	}
+	header := make([]byte, streamHeaderSize)
+	if err := fetch(header, 0); err != nil {
+		return err
+	}
+
+	chunkSize, err := parseStreamHeader(header)
+	if err != nil {
+		return err
+	}
+	if n := streamHeaderLen(header[len(streamMagic)]); n > len(header) {
+		if size < int64(n) {
+			return ErrTruncated
+		}
+		header = append(header, make([]byte, n-len(header))...)
+		if err := fetch(header[streamHeaderSize:], int64(streamHeaderSize)); err != nil {
+			return err
+		}
+	}
+
+	key, err := newStreamKey(header, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// a chunk and its length are fetched together
+	buf := make([]byte, 4+chunkSize+key.aead.Overhead())
+	var plain []byte
+
+	off := int64(len(header))
+	for i := uint64(0); ; i++ {
+		want := int64(len(buf))
+		if size-off < want {
+			want = size - off
+		}
+		if want < 4 {
+			return ErrTruncated
+		}
+		if err := fetch(buf[:want], off); err != nil {
+			return err
+		}
+
+		n := int64(binary.BigEndian.Uint32(buf))
+		if n < int64(key.aead.Overhead()) || 4+n > int64(len(buf)) {
+			return malformed("invalid chunk length")
+		}
+		if 4+n > want {
+			return ErrTruncated
+		}
+
+		var last bool
+		plain, last, err = key.open(i, buf[4:4+n], plain[:0])
+		if err != nil {
+			return err
+		}
+		off += 4 + n
+
+		if last && off != size {
+			return malformed("data after the last chunk")
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// a resumable operation encrypts a file to a stream, or decrypts a stream
+// to a file, and records its progress in a json state file every
+// resumeCheckpoint chunks. the output is written to a hidden .partial file
+// next to it and renamed once it is complete, the state file is removed
+// then. an interrupted operation starts again from its last checkpoint:
+// the partial output is cut back to the length recorded and the input read
+// from the offset recorded.
+const (
+	resumeEncrypt = "encrypt"
+	resumeDecrypt = "decrypt"
+
+	resumeStateVersion = 1
+)
+
+// chunks between two checkpoints, 16 MiB of plaintext, replaced by tests
+var resumeCheckpoint uint64 = 256
+
+// the json state file of a resumable operation
+type resumeState struct {
+	Version int    `json:"version"`
+	Op      string `json:"op"`
+
+	// the input is only resumed while it keeps the size and modification
+	// time it was started with
+	Input   string    `json:"input"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	Output  string      `json:"output"`
+	Partial string      `json:"partial"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+
+	// chunks done and the bytes of the input and partial output they
+	// account for
+	Chunks  uint64 `json:"chunks"`
+	Read    int64  `json:"read"`
+	Written int64  `json:"written"`
+}
+
+// EncryptResumable encrypts the file at path to out in the format written
+// by EncryptStream and records its progress in the state file at
+// statePath, so encrypting a huge file that was interrupted continues from
+// its last checkpoint rather than from the start. when statePath already
+// records the encryption of path to out it is continued, as with Resume.
+//
+// the chunks sealed again after an interruption are sealed with the same
+// key and nonces as before, which is only safe while the input is
+// unchanged, a file whose size or modification time changed isn't
+// resumed. chunks are sealed with opts.Cipher, SecretBox or
+// XChaCha20Poly1305, under a key derived with opts.KDF. out is only
+// replaced with opts.Overwrite and is created with opts.Mode when set.
+// opts.Progress is reported the bytes of path read. the other options are
+// ignored.
+func EncryptResumable(path, out, statePath string, passphrase []byte, opts Options) error {
+
+	if len(passphrase) == 0 {
+		return errors.New("a passphrase is required to encrypt a stream")
+	}
+	if err := checkStreamCipher(opts.cipher()); err != nil {
+		return err
+	}
+	return startResumable(resumeEncrypt, path, out, statePath, passphrase, opts)
+}
+
+// DecryptResumable decrypts the stream at path to out like DecryptStream,
+// recording its progress in the state file at statePath like
+// EncryptResumable. the plaintext is only moved to out once every chunk
+// was authenticated. out is only replaced with opts.Overwrite and is
+// created with opts.Mode when set, 0600 otherwise. opts.Progress is
+// reported the bytes of path read. the other options are ignored.
+func DecryptResumable(path, out, statePath string, passphrase []byte, opts Options) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, streamHeaderSize)
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrNotEncrypted
+	}
+	if err == nil {
+		_, err = parseStreamHeader(header)
+	}
+	if errors.Is(err, ErrNotEncrypted) {
+		return fmt.Errorf("%s isn't a stream, only streams can be decrypted resumably", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return startResumable(resumeDecrypt, path, out, statePath, passphrase, opts)
+}
+
+// Resume continues the operation recorded in the state file at statePath
+// by EncryptResumable or DecryptResumable from its last checkpoint, with
+// the passphrase it was started with. opts is used like the function that
+// started it, except the output mode and whether it is replaced, which
+// were recorded.
+func Resume(statePath string, passphrase []byte, opts Options) error {
+
+	st, err := readResumeState(statePath)
+	if err != nil {
+		return err
+	}
+	return runResumable(st, statePath, passphrase, opts)
+}
+
+// starts the operation op of path to out, or continues it when statePath
+// records it already
+func startResumable(op, path, out, statePath string, passphrase []byte, opts Options) error {
+
+	if path == Stdio || out == Stdio {
+		return errors.New("standard input and output can't be resumed")
+	}
+	// recorded absolute, so the operation can be resumed from anywhere
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	out, err = filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(statePath); err == nil {
+		st, err := readResumeState(statePath)
+		if err != nil {
+			return err
+		}
+		if st.Op != op || st.Input != path || st.Output != out {
+			return fmt.Errorf("%s records the %s of %s to %s, resume or remove it first", statePath, st.Op, st.Input, st.Output)
+		}
+		return runResumable(st, statePath, passphrase, opts)
+	}
+
+	if !opts.Overwrite {
+		if _, err := os.Lstat(out); err == nil {
+			return fmt.Errorf("%w: %s", ErrOutputExists, out)
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s isn't a regular file, only files can be resumed", path)
+	}
+
+	dir, base := filepath.Split(out)
+	st := &resumeState{
+		Version: resumeStateVersion,
+		Op:      op,
+		Input:   path,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		Output:  out,
+		Partial: filepath.Join(dir, "."+base+".partial"),
+		Mode:    opts.Mode,
+	}
+	// a partial output left by an earlier state file that was removed
+	// can't be trusted
+	if err := os.Remove(st.Partial); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := writeResumeState(statePath, st); err != nil {
+		return err
+	}
+
+	return runResumable(st, statePath, passphrase, opts)
+}
+
+func readResumeState(statePath string) (*resumeState, error) {
+
+	data, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	st := new(resumeState)
+	if err := json.Unmarshal(data, st); err != nil || (st.Op != resumeEncrypt && st.Op != resumeDecrypt) {
+		return nil, fmt.Errorf("%s isn't a state file of a resumable operation", statePath)
+	}
+	if st.Version != resumeStateVersion {
+		return nil, fmt.Errorf("unsupported state file version %d", st.Version)
+	}
+
+	return st, nil
+}
+
+func writeResumeState(statePath string, st *resumeState) error {
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(statePath, append(data, '\n'), 0600, 0)
+}
+
+// runs the operation st from its last checkpoint until it completes
+func runResumable(st *resumeState, statePath string, passphrase []byte, opts Options) error {
+
+	in, err := os.Open(st.Input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != st.Size || !fi.ModTime().Equal(st.ModTime) {
+		return fmt.Errorf("%s changed since it was started, it can't be resumed", st.Input)
+	}
+
+	perm := defaultEncryptedMode
+	if st.Op == resumeDecrypt {
+		perm = defaultDecryptedMode
+	}
+	if st.Mode != 0 {
+		perm = st.Mode
+	}
+	out, err := os.OpenFile(st.Partial, os.O_RDWR|os.O_CREATE, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// anything after the last checkpoint is sealed or opened again
+	if err := out.Truncate(st.Written); err != nil {
+		return err
+	}
+	if _, err := out.Seek(st.Written, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := in.Seek(st.Read, io.SeekStart); err != nil {
+		return err
+	}
+	if st.Chunks > 0 {
+		opts.trace("resuming", "op", st.Op, "chunks", st.Chunks, "read", st.Read, "written", st.Written)
+	}
+
+	var r io.Reader = in
+	if opts.Progress != nil {
+		r = &progressReader{r: in, done: st.Read, total: st.Size, fn: opts.Progress}
+	}
+
+	checkpoint := func() error {
+		if err := out.Sync(); err != nil {
+			return err
+		}
+		return writeResumeState(statePath, st)
+	}
+
+	if st.Op == resumeEncrypt {
+		err = resumeEncryption(r, out, st, passphrase, opts, checkpoint)
+	} else {
+		err = resumeDecryption(r, in, out, st, passphrase, opts, checkpoint)
+	}
+	if err != nil {
+		return err
+	}
+
+	if st.Mode != 0 {
+		err = out.Chmod(st.Mode)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(st.Partial, st.Output)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(st.Output))
+	}
+	if err != nil {
+		return err
+	}
+	opts.log(slog.LevelInfo, "finished", "op", st.Op, "input", st.Input, "output", st.Output)
+
+	return os.Remove(statePath)
+}
+
+// seals the chunks of r after the last checkpoint to out
+func resumeEncryption(r io.Reader, out *os.File, st *resumeState, passphrase []byte, opts Options, checkpoint func() error) error {
+
+	var header []byte
+	var key *streamKey
+	if st.Chunks == 0 {
+		// nothing was sealed yet, the stream starts over with a new
+		// header
+		h, k, err := newStream(passphrase, opts.cipher(), opts.KDF.withDefaults())
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(h); err != nil {
+			return err
+		}
+		header, key = h, k
+		st.Written = int64(len(header))
+	} else {
+		h, _, err := readStreamHeader(io.NewSectionReader(out, 0, st.Written))
+		if err != nil {
+			return err
+		}
+		header = h
+		k, err := newStreamKey(header, passphrase)
+		if err != nil {
+			return err
+		}
+		// another passphrase would seal the rest under another key
+		if err := checkFirstChunk(out, k); err != nil {
+			return err
+		}
+		key = k
+	}
+	opts.trace("streaming", "cipher", cipherName(key.cipher), "kdf", key.kdf, "chunk_size", streamChunkSize)
+
+	e := newStreamEncrypter(r, key, st.Chunks)
+	for !e.done {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		if err := e.seal(); err != nil {
+			return err
+		}
+		if _, err := out.Write(e.out); err != nil {
+			return err
+		}
+		st.Chunks = e.index
+		st.Read = int64(e.index) * streamChunkSize
+		st.Written += int64(len(e.out))
+
+		if !e.done && st.Chunks%resumeCheckpoint == 0 {
+			if err := checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// opens the first chunk of the stream in out with key
+func checkFirstChunk(out *os.File, key *streamKey) error {
+
+	var length [4]byte
+	if _, err := out.ReadAt(length[:], int64(key.size)); err != nil {
+		return ErrTruncated
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n < uint32(key.aead.Overhead()) || n > uint32(streamChunkSize+key.aead.Overhead()) {
+		return malformed("invalid chunk length")
+	}
+	sealed := make([]byte, n)
+	if _, err := out.ReadAt(sealed, int64(key.size)+4); err != nil {
+		return ErrTruncated
+	}
+
+	plain, _, err := key.open(0, sealed, nil)
+	wipe(plain)
+	return err
+}
+
+// opens the chunks of the stream in after the last checkpoint, read
+// through r, to out
+func resumeDecryption(r io.Reader, in, out *os.File, st *resumeState, passphrase []byte, opts Options, checkpoint func() error) error {
+
+	header, chunkSize, err := readStreamHeader(io.NewSectionReader(in, 0, math.MaxInt64))
+	if err != nil {
+		return err
+	}
+	key, err := newStreamKey(header, passphrase)
+	if err != nil {
+		return err
+	}
+	opts.trace("streaming", "cipher", cipherName(key.cipher), "kdf", key.kdf, "chunk_size", chunkSize)
+
+	if st.Chunks == 0 {
+		st.Read = int64(len(header))
+		if _, err := in.Seek(st.Read, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	d := &streamDecrypter{
+		r:      r,
+		key:    key,
+		cipher: key.cipher,
+		index:  st.Chunks,
+		buf:    make([]byte, chunkSize+key.aead.Overhead()),
+	}
+	defer func() { wipe(d.plain) }()
+	for !d.done {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		if err := d.open(); err != nil {
+			return err
+		}
+		if _, err := out.Write(d.out); err != nil {
+			return err
+		}
+		read, err := in.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		st.Chunks = d.index
+		st.Read = read
+		st.Written += int64(len(d.out))
+
+		if !d.done && st.Chunks%resumeCheckpoint == 0 {
+			if err := checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
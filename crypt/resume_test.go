@@ -0,0 +1,192 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fails every other read, like a flaky connection
+type flakyReaderAt struct {
+	r     io.ReaderAt
+	reads int
+	fail  int
+}
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	f.reads++
+	if f.reads%2 == 0 {
+		f.fail++
+		n, _ := f.r.ReadAt(p[:len(p)/2], off)
+		return n, errors.New("connection reset")
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestDecryptStreamAt(t *testing.T) {
+
+	plain := bytes.Repeat([]byte(data), 3*streamChunkSize/len(data)+1)
+
+	var stream bytes.Buffer
+	if err := EncryptStream(bytes.NewReader(plain), &stream, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	sealed := stream.Bytes()
+	head := streamHeaderLen(streamVersionKDF)
+
+	flaky := &flakyReaderAt{r: bytes.NewReader(sealed)}
+	var out bytes.Buffer
+	if err := DecryptStreamAt(flaky, int64(len(sealed)), &out, passphrase, 1); err != nil {
+		t.Fatalf("DecryptStreamAt: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Fatalf("decrypted stream differs")
+	}
+	if flaky.fail == 0 {
+		t.Fatalf("no read failed, retries weren't exercised")
+	}
+
+	// without retries the first failure is returned
+	flaky = &flakyReaderAt{r: bytes.NewReader(sealed)}
+	if err := DecryptStreamAt(flaky, int64(len(sealed)), io.Discard, passphrase, 0); err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+
+	cases := map[string]struct {
+		file []byte
+		size int64
+		want error
+	}{
+		"truncated": {sealed[:len(sealed)-10], int64(len(sealed) - 10), ErrTruncated},
+		"no last":   {sealed[:head+4+streamChunkSize+16], int64(head + 4 + streamChunkSize + 16), ErrTruncated},
+		"trailing":  {append(append([]byte(nil), sealed...), 0), int64(len(sealed) + 1), ErrMalformed},
+		"short":     {sealed[:10], 10, ErrTruncated},
+	}
+	for name, c := range cases {
+		err := DecryptStreamAt(bytes.NewReader(c.file), c.size, io.Discard, passphrase, 0)
+		if !errors.Is(err, c.want) {
+			t.Fatalf("%s: expected %v, got %v", name, c.want, err)
+		}
+	}
+
+	if err := DecryptStreamAt(bytes.NewReader(sealed), int64(len(sealed)), io.Discard, []byte("wrong"), 0); err == nil {
+		t.Fatalf("expected a wrong passphrase to fail")
+	}
+}
+
+// options interrupting an operation once it read more than n bytes
+func interruptAfter(n int64) Options {
+	ctx, cancel := context.WithCancel(context.Background())
+	return Options{ctx: ctx, Progress: func(done, total int64) {
+		if done > n {
+			cancel()
+		}
+	}}
+}
+
+func TestResumable(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-resumable")
+	defer os.RemoveAll(dir)
+
+	defer func(n uint64) { resumeCheckpoint = n }(resumeCheckpoint)
+	resumeCheckpoint = 2
+
+	plain, _ := random(10*streamChunkSize + 100)
+	filename := filepath.Join(dir, "huge.img")
+	ioutil.WriteFile(filename, plain, 0644)
+	encrypted := filepath.Join(dir, "huge.cloak")
+	state := filepath.Join(dir, "huge.state")
+
+	err := EncryptResumable(filename, encrypted, state, passphrase, interruptAfter(5*streamChunkSize))
+	if err != context.Canceled {
+		t.Fatalf("expected the encryption to be interrupted, got %v", err)
+	}
+	if _, err := os.Stat(encrypted); !os.IsNotExist(err) {
+		t.Fatalf("an interrupted encryption wrote %s", encrypted)
+	}
+	st, err := readResumeState(state)
+	if err != nil {
+		t.Fatalf("readResumeState: %v", err)
+	}
+	if st.Chunks == 0 || st.Chunks%2 != 0 {
+		t.Fatalf("expected a checkpoint after a few chunks, got %d", st.Chunks)
+	}
+
+	if err := Resume(state, []byte("wrong"), Options{}); err == nil {
+		t.Fatalf("expected an error resuming with another passphrase")
+	}
+	if err := EncryptResumable(filename, filepath.Join(dir, "other.cloak"), state, passphrase, Options{}); err == nil {
+		t.Fatalf("expected an error starting another operation with the same state file")
+	}
+	if err := Resume(state, passphrase, Options{}); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Fatalf("the state file wasn't removed")
+	}
+
+	var buf bytes.Buffer
+	f, _ := os.Open(encrypted)
+	err = DecryptStream(f, &buf, passphrase)
+	f.Close()
+	if err != nil {
+		t.Fatalf("DecryptStream: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), plain) {
+		t.Fatalf("the resumed stream doesn't decrypt to the original")
+	}
+
+	// running the same call again continues it
+	restored := filepath.Join(dir, "restored.img")
+	err = DecryptResumable(encrypted, restored, state, passphrase, interruptAfter(5*streamChunkSize))
+	if err != context.Canceled {
+		t.Fatalf("expected the decryption to be interrupted, got %v", err)
+	}
+	if err := DecryptResumable(encrypted, restored, state, passphrase, Options{Mode: 0640}); err != nil {
+		t.Fatalf("DecryptResumable: %v", err)
+	}
+	got, _ := ioutil.ReadFile(restored)
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("the resumed decryption doesn't match the original")
+	}
+	if fi, _ := os.Stat(restored); fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected the mode recorded when it started, got %v", fi.Mode().Perm())
+	}
+
+	if err := DecryptResumable(filename, restored, state, passphrase, Options{Overwrite: true}); err == nil {
+		t.Fatalf("expected an error decrypting a file that isn't a stream")
+	}
+
+	// a changed input would be sealed again with the same nonces
+	opts := interruptAfter(3 * streamChunkSize)
+	opts.Overwrite = true
+	if err := EncryptResumable(filename, encrypted, state, passphrase, opts); err == nil {
+		t.Fatalf("expected the encryption to be interrupted")
+	}
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filename, later, later)
+	if err := Resume(state, passphrase, Options{}); err == nil {
+		t.Fatalf("expected an error resuming a file that changed")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// size of the rotation metadata sealed after the plaintext checksum
+const rotationSize = 16
+
+// when a file was encrypted and how long its passphrase should be used,
+// zero values mean unknown and no rotation window
+type rotation struct {
+	created time.Time
+	after   time.Duration
+}
+
+// encodes the creation time in unix seconds followed by the rotation
+// window in seconds, both big endian
+func (r rotation) marshal() []byte {
+	b := make([]byte, rotationSize)
+	binary.BigEndian.PutUint64(b, uint64(r.created.Unix()))
+	binary.BigEndian.PutUint64(b[8:], uint64(r.after/time.Second))
+	return b
+}
+
+func parseRotation(b []byte) rotation {
+	return rotation{
+		created: time.Unix(int64(binary.BigEndian.Uint64(b)), 0),
+		after:   time.Duration(binary.BigEndian.Uint64(b[8:])) * time.Second,
+	}
+}
+
+// RotationDue reports whether the passphrase of the file described by r
+// has outlived its rotate-after window at now. files without a window, or
+// written before creation times were stored, are never due.
+func (r *Result) RotationDue(now time.Time) bool {
+	if r.RotateAfter <= 0 || r.Created.IsZero() {
+		return false
+	}
+	return now.After(r.Created.Add(r.RotateAfter))
+}
@@ -0,0 +1,101 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestRotationMetadata(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-rotation")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "rotate.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{RotateAfter: 90 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+	plain, err := open(file, passphrase)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	if plain.rotation.after != 90*24*time.Hour {
+		t.Fatalf("rotate after = %v, want 2160h", plain.rotation.after)
+	}
+	if plain.rotation.created.Unix() != res.Created.Unix() {
+		t.Fatalf("created = %v, want %v", plain.rotation.created, res.Created)
+	}
+
+	dec := &Result{Created: plain.rotation.created, RotateAfter: plain.rotation.after}
+	if dec.RotationDue(res.Created.Add(89 * 24 * time.Hour)) {
+		t.Fatalf("rotation due before the window passed")
+	}
+	if !dec.RotationDue(res.Created.Add(91 * 24 * time.Hour)) {
+		t.Fatalf("rotation not due after the window passed")
+	}
+}
+
+func TestRotationLegacyChecksum(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-rotation")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "legacy.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+	lines := strings.Split(string(file), "\n")
+
+	// reseal the checksum line without rotation metadata, the way older
+	// versions wrote it
+	plain, err := open(file, passphrase)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	c, _ := LookupCipher(SecretBox)
+	key, _ := scrypt.Key(passphrase, plain.salt, plain.kdf.N, plain.kdf.R, plain.kdf.P, c.KeySize())
+	aead, _ := c.New(key)
+	nonce, _ := random(aead.NonceSize())
+	lines[3] = hex.EncodeToString(aead.Seal(nonce, nonce, plain.checksum, nil))
+
+	plain, err = open([]byte(strings.Join(lines[:4], "\n")), passphrase)
+	if err != nil {
+		t.Fatalf("open legacy checksum: %v", err)
+	}
+	if !plain.rotation.created.IsZero() || plain.rotation.after != 0 {
+		t.Fatalf("unexpected rotation metadata %+v", plain.rotation)
+	}
+	if (&Result{}).RotationDue(time.Now()) {
+		t.Fatalf("rotation due without metadata")
+	}
+}
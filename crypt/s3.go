@@ -0,0 +1,377 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parts of multipart uploads, S3 requires 5 MiB but for the last one and
+// allows 10000 of them
+const (
+	defaultS3PartSize = 8 << 20
+	maxS3Parts        = 10000
+)
+
+// S3 is a Storage uploading to a bucket of Amazon S3, or of a compatible
+// object store such as MinIO, or Google Cloud Storage with HMAC keys.
+// objects larger than a part are sent in parts with a multipart upload,
+// so at most one part is held in memory, and the upload is aborted when
+// it fails.
+type S3 struct {
+	Bucket string
+	// us-east-1 when empty
+	Region string
+	// base URL of a compatible object store, such as
+	// https://storage.googleapis.com, requests are then path-style.
+	// https://s3.<region>.amazonaws.com when empty.
+	Endpoint string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// of temporary credentials, optional
+	SessionToken string
+
+	// size of the parts, 8 MiB when zero. the part size grows by as much
+	// every thousand parts, so objects of up to 440 GiB fit in 10000.
+	PartSize int
+	// http.DefaultClient when nil
+	Client *http.Client
+}
+
+// NewS3 returns an S3 for bucket configured by the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION or
+// AWS_DEFAULT_REGION, and AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL
+// environment variables, like the aws command line.
+func NewS3(bucket string) (*S3, error) {
+
+	s := &S3{
+		Bucket:          bucket,
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to use s3")
+	}
+	return s, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Put uploads everything read from r as the object name. data smaller
+// than a part is sent with a single request.
+func (s *S3) Put(ctx context.Context, name string, r io.Reader) error {
+
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = defaultS3PartSize
+	}
+
+	part, last, err := readPart(r, partSize)
+	if err != nil {
+		return err
+	}
+	if last {
+		_, err := s.do(ctx, http.MethodPut, name, nil, part)
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, name, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp, &created); err != nil || created.UploadID == "" {
+		return fmt.Errorf("s3: no upload id in %q", resp)
+	}
+
+	err = s.putParts(ctx, name, created.UploadID, part, r, partSize)
+	if err != nil {
+		// drops the parts uploaded, ctx may be the reason it failed
+		abort, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		s.do(abort, http.MethodDelete, name, url.Values{"uploadId": {created.UploadID}}, nil)
+	}
+	return err
+}
+
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+// uploads first and the rest of r as the parts of the upload, and
+// completes it
+func (s *S3) putParts(ctx context.Context, name, uploadID string, first []byte, r io.Reader, partSize int) error {
+
+	var parts []s3Part
+	part, last := first, false
+	for n := 1; ; n++ {
+		if n > maxS3Parts {
+			return fmt.Errorf("s3: %s needs more than %d parts, raise the part size", name, maxS3Parts)
+		}
+		q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		etag, err := s.doETag(ctx, http.MethodPut, name, q, part)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, s3Part{Number: n, ETag: etag})
+		if last {
+			break
+		}
+
+		part, last, err = readPart(r, partSize*(1+n/1000))
+		if err != nil {
+			return err
+		}
+		// the previous part was the last one
+		if len(part) == 0 {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPost, name, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return err
+	}
+	// completing can fail after the response started
+	if bytes.Contains(resp, []byte("<Error>")) {
+		return s3Error("completing the upload", resp)
+	}
+	return nil
+}
+
+// reads up to size bytes of r, last reports that r ended
+func readPart(r io.Reader, size int) ([]byte, bool, error) {
+	part := make([]byte, size)
+	n, err := io.ReadFull(r, part)
+	switch err {
+	case nil:
+		return part, false, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return part[:n], true, nil
+	}
+	return nil, false, err
+}
+
+func (s *S3) doETag(ctx context.Context, method, name string, query url.Values, body []byte) (string, error) {
+	req, err := s.request(ctx, method, name, query, body)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.send(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", errors.New("s3: no ETag for the uploaded part")
+	}
+	return etag, nil
+}
+
+// sends a signed request for the object name and returns the body of the
+// response
+func (s *S3) do(ctx context.Context, method, name string, query url.Values, body []byte) ([]byte, error) {
+	req, err := s.request(ctx, method, name, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func (s *S3) send(req *http.Request) (*http.Response, error) {
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return nil, s3Error(req.Method+" "+resp.Status, b)
+	}
+	return resp, nil
+}
+
+// the code and message of an S3 error response
+func s3Error(what string, body []byte) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &e) != nil || e.Code == "" {
+		return fmt.Errorf("s3: %s", what)
+	}
+	return fmt.Errorf("s3: %s: %s: %s", what, e.Code, e.Message)
+}
+
+// a request for the object name signed with AWS signature version 4
+func (s *S3) request(ctx context.Context, method, name string, query url.Values, body []byte) (*http.Request, error) {
+
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	u := &url.URL{Scheme: "https", Host: s.Bucket + ".s3." + region + ".amazonaws.com", Path: "/" + name}
+	if s.Endpoint != "" {
+		base, err := url.Parse(s.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		u = &url.URL{Scheme: base.Scheme, Host: base.Host, Path: strings.TrimRight(base.Path, "/") + "/" + s.Bucket + "/" + name}
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	sum := sha256.Sum256(body)
+	signS3(req, hex.EncodeToString(sum[:]), s.AccessKeyID, s.SecretAccessKey, region, time.Now())
+	return req, nil
+}
+
+// signs req, whose body hashes to payloadHash, with AWS signature version
+// 4. the host and every header set are signed.
+func signS3(req *http.Request, payloadHash, keyID, secret, region string, now time.Time) {
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + secret)
+	for _, s := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+keyID+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+// escapes every byte of p but unreserved characters and slashes, as
+// signatures expect
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// the query sorted by key with every value escaped, empty values keep
+// their =
+func s3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			pairs = append(pairs, strings.ReplaceAll(url.QueryEscape(k), "+", "%20")+"="+strings.ReplaceAll(url.QueryEscape(v), "+", "%20"))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,54 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+// Secret holds a passphrase without exposing it by accident, printing it
+// with fmt or the log package shows a placeholder instead.
+type Secret struct {
+	b []byte
+}
+
+// copies b into a new secret
+func newSecret(b []byte) *Secret {
+	return &Secret{b: append([]byte(nil), b...)}
+}
+
+// Reveal returns the secret, nil once it was destroyed. the returned
+// slice is the secret itself and is zeroed by Destroy.
+func (s *Secret) Reveal() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.b
+}
+
+// Destroy zeroes the secret and forgets it.
+func (s *Secret) Destroy() {
+	if s == nil {
+		return
+	}
+	for i := range s.b {
+		s.b[i] = 0
+	}
+	s.b = nil
+}
+
+func (s *Secret) String() string {
+	return "[secret]"
+}
+
+func (s *Secret) GoString() string {
+	return s.String()
+}
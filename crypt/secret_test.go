@@ -0,0 +1,77 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+
+	b := []byte("hunter2")
+	s := newSecret(b)
+	if string(s.Reveal()) != "hunter2" {
+		t.Fatalf("Reveal returned %q", s.Reveal())
+	}
+
+	for _, printed := range []string{fmt.Sprint(s), fmt.Sprintf("%v %+v %#v %s", s, s, s, s), fmt.Sprint(Result{Secret: s})} {
+		if strings.Contains(printed, "hunter2") {
+			t.Fatalf("secret printed as %s", printed)
+		}
+	}
+
+	revealed := s.Reveal()
+	s.Destroy()
+	if s.Reveal() != nil || string(revealed) != strings.Repeat("\x00", 7) {
+		t.Fatalf("Destroy didn't zero the secret")
+	}
+	if string(b) != "hunter2" {
+		t.Fatalf("Destroy zeroed the caller's passphrase")
+	}
+
+	var unset *Secret
+	unset.Destroy()
+	if unset.Reveal() != nil {
+		t.Fatalf("nil secret revealed something")
+	}
+}
+
+func TestEncryptQuiet(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-secret")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, nil, Options{Quiet: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	if res.Passphrase != "" || len(res.Secret.Reveal()) == 0 {
+		t.Fatalf("expected the generated passphrase only in Secret")
+	}
+
+	plain, err := Plaintext(res.Output, res.Secret.Reveal())
+	if err != nil || string(plain) != data {
+		t.Fatalf("Plaintext with the secret: %v", err)
+	}
+	res.Secret.Destroy()
+}
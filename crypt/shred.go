@@ -0,0 +1,201 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ErrOutputMismatch is returned when shredding the original is requested
+// but the encrypted output read back from disk isn't what was written.
+var ErrOutputMismatch = errors.New("encrypted output doesn't match what was written")
+
+// reads the written output back, so the original is only shredded once
+// the encrypted copy is known to be stored
+func confirmWritten(output string, parts []string, body []byte) error {
+
+	stored, err := readFile(output)
+	if err != nil {
+		return err
+	}
+	if len(parts) > 0 {
+		stored, _, err = readParts(output, stored)
+		if err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(stored, body) {
+		return ErrOutputMismatch
+	}
+
+	return nil
+}
+
+// shreds the original at path when opts asks for it and encrypting it
+// succeeded. the file must no longer be mapped.
+func shredAfter(path string, res *Result, err error, opts Options) (*Result, error) {
+
+	if err != nil || !opts.ShredOriginal {
+		return res, err
+	}
+	if err := shred(path); err != nil {
+		return res, fmt.Errorf("encrypted %s but couldn't shred the original: %w", res.Output, err)
+	}
+	opts.log(slog.LevelInfo, "shredded the original", "path", path)
+
+	return res, nil
+}
+
+// WipeReport describes a finished Wipe.
+type WipeReport struct {
+	// regular files that were overwritten and removed
+	Files []string
+
+	// why overwritten data may survive, such as solid state storage or a
+	// copy on write filesystem under path
+	Warnings []string
+}
+
+// Wipe overwrites the file at path with random data passes times, once if
+// passes is below 1, flushing it after each pass. it then renames the file
+// to random names so its name doesn't linger in the directory and removes
+// it. a directory is wiped with everything below it, symlinks and special
+// files in it are removed without touching what they point to.
+//
+// overwriting in place doesn't reach blocks an SSD remapped, copies kept
+// by copy on write filesystems or snapshots, the report's warnings say
+// when path is on such storage.
+func Wipe(path string, passes int) (*WipeReport, error) {
+
+	if passes < 1 {
+		passes = 1
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &WipeReport{Warnings: storageWarnings(path)}
+	if !info.IsDir() {
+		if err := wipeFile(path, passes); err != nil {
+			return report, err
+		}
+		report.Files = append(report.Files, path)
+		return report, nil
+	}
+
+	// directories go after what they contain
+	var dirs []string
+	err = filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, name)
+		case info.Mode().IsRegular():
+			if err := wipeFile(name, passes); err != nil {
+				return err
+			}
+			report.Files = append(report.Files, name)
+		default:
+			return os.Remove(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(dirs[i]); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// overwrites path with random data, flushes it and removes it. on copy on
+// write filesystems, SSDs and journaled data the old blocks may survive.
+func shred(path string) error {
+	return wipeFile(path, 1)
+}
+
+// overwrites the regular file at path passes times, then scrambles its
+// name and removes it
+func wipeFile(path string, passes int) error {
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s", ErrSpecialFile, path)
+	}
+	// a read-only original is removed all the same
+	if info.Mode().Perm()&0200 == 0 {
+		if err := os.Chmod(path, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < passes && err == nil; i++ {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			break
+		}
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+		if err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	dir, name := filepath.Dir(path), path
+	for i := 0; i < 3; i++ {
+		b, err := random(8)
+		if err != nil {
+			return err
+		}
+		next := filepath.Join(dir, hex.EncodeToString(b))
+		if err := os.Rename(name, next); err != nil {
+			return err
+		}
+		name = next
+	}
+
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
@@ -0,0 +1,136 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShredOriginal(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-shred")
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte(data), 500)
+	for _, opts := range []Options{{ShredOriginal: true}, {ShredOriginal: true, PartSize: 4096}} {
+		filename := filepath.Join(dir, "secret.txt")
+		ioutil.WriteFile(filename, content, 0644)
+
+		// a second link sees the blocks the original held
+		link := filepath.Join(dir, "link")
+		os.Remove(link)
+		if err := os.Link(filename, link); err != nil {
+			t.Fatalf("Link: %v", err)
+		}
+
+		res, err := EncryptWithOptions(filename, passphrase, opts)
+		if err != nil {
+			t.Fatalf("EncryptWithOptions %+v: %v", opts, err)
+		}
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			t.Fatalf("original still exists after shredding: %v", err)
+		}
+
+		left, _ := ioutil.ReadFile(link)
+		if len(left) != len(content) || bytes.Equal(left, content) {
+			t.Fatalf("original content wasn't overwritten")
+		}
+
+		plain, err := Plaintext(res.Output, passphrase)
+		if err != nil {
+			t.Fatalf("Plaintext: %v", err)
+		}
+		if !bytes.Equal(plain, content) {
+			t.Fatalf("decrypted content doesn't match the shredded original")
+		}
+	}
+}
+
+func TestShredKeepsOriginalOnFailure(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-shred")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	opts := Options{ShredOriginal: true, OutputPath: filepath.Join(dir, "missing", "out")}
+	if _, err := EncryptWithOptions(filename, passphrase, opts); err == nil {
+		t.Fatalf("expected an error writing to a missing directory")
+	}
+
+	got, err := ioutil.ReadFile(filename)
+	if err != nil || string(got) != data {
+		t.Fatalf("original was touched after a failed encryption: %v", err)
+	}
+}
+
+func TestWipe(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-wipe")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "secret.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	report, err := Wipe(filename, 3)
+	if err != nil {
+		t.Fatalf("Wipe: %v", err)
+	}
+	if len(report.Files) != 1 || report.Files[0] != filename {
+		t.Fatalf("report lists %v, want %s", report.Files, filename)
+	}
+
+	left, _ := ioutil.ReadDir(dir)
+	if len(left) != 0 {
+		t.Fatalf("%d entries left after wiping, the renamed file wasn't removed", len(left))
+	}
+}
+
+func TestWipeDirectory(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-wipe")
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside.txt")
+	ioutil.WriteFile(outside, []byte(data), 0644)
+
+	tree := filepath.Join(dir, "tree")
+	os.MkdirAll(filepath.Join(tree, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(tree, "a.txt"), []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(tree, "sub", "b.txt"), []byte(data), 0644)
+	os.Symlink(outside, filepath.Join(tree, "link"))
+
+	report, err := Wipe(tree, 1)
+	if err != nil {
+		t.Fatalf("Wipe: %v", err)
+	}
+	if len(report.Files) != 2 {
+		t.Fatalf("report lists %v, want both files", report.Files)
+	}
+	if _, err := os.Lstat(tree); !os.IsNotExist(err) {
+		t.Fatalf("directory still exists after wiping: %v", err)
+	}
+
+	// the target of a symlink isn't touched
+	got, err := ioutil.ReadFile(outside)
+	if err != nil || string(got) != data {
+		t.Fatalf("symlink target was touched: %v", err)
+	}
+}
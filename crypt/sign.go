@@ -0,0 +1,222 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// files encrypted with Options.Sign are wrapped in a signature:
+// magic (8 bytes) + version byte + ed25519 public key of the signer (32
+// bytes) + signature (64 bytes) + the encrypted file
+//
+// the signature is Ed25519ph over the sha512 of the magic, version and
+// public key followed by the whole encrypted file, headers and ciphertext
+// alike, so it tells who wrote the file and not only that it wasn't
+// modified. it is checked before the key is derived, by anyone, without
+// the passphrase.
+const (
+	signedMagic   = "CLOAKSIG"
+	signedVersion = 1
+	signedPrefix  = len(signedMagic) + 1 + ed25519.PublicKeySize
+	signedSize    = signedPrefix + ed25519.SignatureSize
+
+	signingKeyPrefix   = "CLOAK-SIGNING-KEY-"
+	verifyingKeyPrefix = "cloak-sig-"
+
+	// separates cloak signatures from other uses of the same key
+	signedContext = "cloak signed file v1"
+)
+
+// ErrSignature is returned when the signature of a signed file doesn't
+// match its contents.
+var ErrSignature = errors.New("signature doesn't match the file")
+
+// ErrUntrustedSigner is returned when Options.Signers is set and a file
+// isn't signed by any of them, or isn't signed at all.
+var ErrUntrustedSigner = errors.New("file isn't signed by a trusted key")
+
+// SigningKey is an Ed25519 private key encrypted files are signed with,
+// see Options.Sign.
+type SigningKey struct {
+	key ed25519.PrivateKey
+}
+
+// VerifyingKey is the public half of a SigningKey, which recipients of
+// signed files trust, see Options.Signers.
+type VerifyingKey struct {
+	key ed25519.PublicKey
+}
+
+// GenerateSigningKey returns a new random signing key.
+func GenerateSigningKey() (*SigningKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{key: key}, nil
+}
+
+// Public returns the key the files signed with k are verified with.
+func (k *SigningKey) Public() *VerifyingKey {
+	return &VerifyingKey{key: k.key.Public().(ed25519.PublicKey)}
+}
+
+// String encodes the key as CLOAK-SIGNING-KEY- followed by the hex seed.
+func (k *SigningKey) String() string {
+	return signingKeyPrefix + strings.ToUpper(hex.EncodeToString(k.key.Seed()))
+}
+
+// String encodes the key as cloak-sig- followed by the hex public key.
+func (v *VerifyingKey) String() string {
+	return verifyingKeyPrefix + hex.EncodeToString(v.key)
+}
+
+// Equal reports whether v and o are the same key.
+func (v *VerifyingKey) Equal(o *VerifyingKey) bool {
+	return o != nil && v.key.Equal(o.key)
+}
+
+// ParseSigningKey decodes a key encoded by SigningKey.String, the rest of
+// a key file, blank lines and comments starting with #, is skipped.
+func ParseSigningKey(s string) (*SigningKey, error) {
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, signingKeyPrefix) {
+			return nil, errors.New("invalid signing key, expected " + signingKeyPrefix + "...")
+		}
+		seed, err := hex.DecodeString(line[len(signingKeyPrefix):])
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid signing key")
+		}
+		return &SigningKey{key: ed25519.NewKeyFromSeed(seed)}, nil
+	}
+	return nil, errors.New("no signing key found")
+}
+
+// ParseVerifyingKey decodes a key encoded by VerifyingKey.String.
+func ParseVerifyingKey(s string) (*VerifyingKey, error) {
+
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, verifyingKeyPrefix) {
+		return nil, fmt.Errorf("invalid verifying key %q, expected %s...", s, verifyingKeyPrefix)
+	}
+	b, err := hex.DecodeString(s[len(verifyingKeyPrefix):])
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid verifying key %q", s)
+	}
+	return &VerifyingKey{key: ed25519.PublicKey(b)}, nil
+}
+
+// Signer verifies the signature of the encrypted file at path and returns
+// the key it was signed with, or nil when it isn't signed. it doesn't need
+// the passphrase. split files are reassembled first.
+func Signer(path string) (*VerifyingKey, error) {
+
+	file, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isPart(file) {
+		file, _, err = readParts(path, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, signer, err := unwrapSigned(file)
+	return signer, err
+}
+
+// reports whether file starts with a signature
+func isSigned(file []byte) bool {
+	return bytes.HasPrefix(file, []byte(signedMagic))
+}
+
+// wraps the encrypted file in a signature made with k
+func signFile(file []byte, k *SigningKey) []byte {
+
+	signed := make([]byte, 0, signedSize+len(file))
+	signed = append(signed, signedMagic...)
+	signed = append(signed, signedVersion)
+	signed = append(signed, k.key.Public().(ed25519.PublicKey)...)
+
+	// can't fail, ed25519ph with a context is supported
+	sig, _ := k.key.Sign(nil, signedDigest(signed, file), signedOptions())
+	signed = append(signed, sig...)
+	return append(signed, file...)
+}
+
+// the digest signed for file under the magic, version and key of prefix
+func signedDigest(prefix, file []byte) []byte {
+	h := sha512.New()
+	h.Write(prefix)
+	h.Write(file)
+	return h.Sum(nil)
+}
+
+func signedOptions() *ed25519.Options {
+	return &ed25519.Options{Hash: crypto.SHA512, Context: signedContext}
+}
+
+// verifies the signature of a signed file and returns the encrypted file
+// inside and its signer, and file itself with a nil signer if it isn't
+// signed
+func unwrapSigned(file []byte) ([]byte, *VerifyingKey, error) {
+
+	if !isSigned(file) {
+		return file, nil, nil
+	}
+	if len(file) < signedSize {
+		return nil, nil, ErrTruncated
+	}
+	if v := file[len(signedMagic)]; v != signedVersion {
+		return nil, nil, fmt.Errorf("%w %d of signature", ErrUnsupportedVersion, v)
+	}
+
+	key := ed25519.PublicKey(file[len(signedMagic)+1 : signedPrefix])
+	inner := file[signedSize:]
+	err := ed25519.VerifyWithOptions(key, signedDigest(file[:signedPrefix], inner), file[signedPrefix:signedSize], signedOptions())
+	if err != nil {
+		return nil, nil, ErrSignature
+	}
+
+	return inner, &VerifyingKey{key: append(ed25519.PublicKey(nil), key...)}, nil
+}
+
+// reports whether signer is one of trusted
+func trustedSigner(signer *VerifyingKey, trusted []*VerifyingKey) bool {
+
+	if signer == nil {
+		return false
+	}
+	for _, t := range trusted {
+		if signer.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
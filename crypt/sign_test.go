@@ -0,0 +1,114 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-sign")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "signed.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	parsed, err := ParseSigningKey("# comment\n" + key.String() + "\n")
+	if err != nil || !parsed.Public().Equal(key.Public()) {
+		t.Fatalf("ParseSigningKey: %v", err)
+	}
+	public, err := ParseVerifyingKey(key.Public().String())
+	if err != nil || !public.Equal(key.Public()) {
+		t.Fatalf("ParseVerifyingKey: %v", err)
+	}
+	other, _ := GenerateSigningKey()
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Sign: key})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if signer, err := Signer(res.Output); err != nil || !signer.Equal(key.Public()) {
+		t.Fatalf("expected the file signed by %s, got %v, %v", key.Public(), signer, err)
+	}
+	if info, err := ReadFormat(res.Output); err != nil || !info.Signer.Equal(key.Public()) || info.Ext != ".txt" {
+		t.Fatalf("unexpected format %+v, %v", info, err)
+	}
+	if err := Conform(res.Output); err != nil {
+		t.Fatalf("Conform: %v", err)
+	}
+
+	out := filepath.Join(dir, "out.txt")
+	dec, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: out, Signers: []*VerifyingKey{other.Public(), key.Public()}})
+	if err != nil || !dec.Signer.Equal(key.Public()) {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if plain, _ := ioutil.ReadFile(out); string(plain) != data {
+		t.Fatalf("unexpected contents %q", plain)
+	}
+	if _, err := DecryptWithOptions(res.Output, passphrase, Options{OutputPath: out, Overwrite: true, Signers: []*VerifyingKey{other.Public()}}); err != ErrUntrustedSigner {
+		t.Fatalf("expected ErrUntrustedSigner, got %v", err)
+	}
+
+	// an unsigned file isn't trusted either
+	unsigned := filepath.Join(dir, "unsigned.cloak")
+	if _, err := EncryptWithOptions(filename, passphrase, Options{OutputPath: unsigned}); err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if _, err := DecryptWithOptions(unsigned, passphrase, Options{OutputPath: out, Overwrite: true, Signers: []*VerifyingKey{key.Public()}}); err != ErrUntrustedSigner {
+		t.Fatalf("expected ErrUntrustedSigner, got %v", err)
+	}
+
+	// the signature covers the ciphertext, and the key it claims
+	file, _ := ioutil.ReadFile(res.Output)
+	for _, offset := range []int{len(signedMagic) + 1, signedSize + 20, len(file) - 1} {
+		tampered := append([]byte(nil), file...)
+		tampered[offset] ^= 1
+		ioutil.WriteFile(res.Output, tampered, 0644)
+		if _, err := Plaintext(res.Output, passphrase); err != ErrSignature {
+			t.Fatalf("expected ErrSignature flipping byte %d, got %v", offset, err)
+		}
+	}
+
+	// split files are signed before they are split
+	large := filepath.Join(dir, "large.txt")
+	ioutil.WriteFile(large, bytes.Repeat([]byte(data), 40), 0644)
+	res, err = EncryptWithOptions(large, passphrase, Options{PartSize: 4096, Sign: key})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if signer, err := Signer(res.Parts[1]); err != nil || !signer.Equal(key.Public()) {
+		t.Fatalf("expected the parts signed by %s, got %v, %v", key.Public(), signer, err)
+	}
+	if plain, err := Plaintext(res.Parts[0], passphrase); err != nil || !bytes.Equal(plain, bytes.Repeat([]byte(data), 40)) {
+		t.Fatalf("Plaintext of a signed split file: %v", err)
+	}
+
+	for _, opts := range []Options{{Armor: true}, {PEM: true}} {
+		opts.Sign = key
+		opts.OutputPath = filepath.Join(dir, "refused.cloak")
+		if _, err := EncryptWithOptions(filename, passphrase, opts); err == nil || errors.Is(err, ErrOutputExists) {
+			t.Fatalf("expected armored and PEM files refused, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// FormatSpec describes the file formats cloak writes and reads, for other
+// implementations and for checking archives long after they were written.
+type FormatSpec struct {
+	Formats     []Layout    `json:"formats"`
+	Ciphers     []Algorithm `json:"ciphers"`
+	KDFs        []Algorithm `json:"kdfs"`
+	Compressors []Algorithm `json:"compressors"`
+	Stanzas     []Algorithm `json:"stanzas"`
+	Records     []Algorithm `json:"records"`
+
+	// wrappers around a whole file, such as PEM blocks and split parts
+	Wrappers []string `json:"wrappers"`
+}
+
+// Layout is the sequence of fields of one format version.
+type Layout struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+
+	// "binary", or "hex lines" for newline separated hex fields
+	Encoding string  `json:"encoding"`
+	Fields   []Field `json:"fields"`
+}
+
+// Field is one field of a layout. multi byte integers are big endian.
+type Field struct {
+	Name string `json:"name"`
+
+	// byte offset from the start of the file, or the line index of hex
+	// lines layouts. -1 when it follows a variable length field.
+	Offset int `json:"offset"`
+
+	// size in bytes, decoded for hex lines, -1 when it varies
+	Size int `json:"size"`
+
+	Description string `json:"description"`
+}
+
+// Algorithm is an id stored in file headers and what it stands for.
+type Algorithm struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+
+	// key, nonce and authentication tag sizes of ciphers
+	KeySize   int `json:"key_size,omitempty"`
+	NonceSize int `json:"nonce_size,omitempty"`
+	Overhead  int `json:"overhead,omitempty"`
+}
+
+// fills in the offsets of fields laid out one after the other
+func sequence(fields ...Field) []Field {
+
+	offset := 0
+	for i := range fields {
+		fields[i].Offset = offset
+		if offset >= 0 && fields[i].Size >= 0 {
+			offset += fields[i].Size
+		} else {
+			offset = -1
+		}
+	}
+	return fields
+}
+
+// the sealed metadata and data ending both binary layouts
+var binaryTail = []Field{
+	{Name: "metadata length", Size: 4, Description: "length of the sealed metadata"},
+	{Name: "metadata", Size: -1, Description: fmt.Sprintf("nonce + sealed sha256 of the header, blake2b-512 of the plaintext, rotation metadata (%d bytes: creation and rotation window in unix nanoseconds) and records, each a tag byte, a length byte and the value", rotationSize)},
+	{Name: "data", Size: -1, Description: "nonce + sealed plaintext, to the end of the file"},
+}
+
+// Spec returns the description of the formats this build supports, with
+// the ids of the registered ciphers and compressors.
+func Spec() FormatSpec {
+
+	binaryFields := sequence(append([]Field{
+		{Name: "magic", Size: len(binaryMagic), Description: fmt.Sprintf("%q", binaryMagic)},
+		{Name: "version", Size: 1, Description: fmt.Sprintf("%d", formatBinary)},
+		{Name: "cipher", Size: 1, Description: "cipher id"},
+		{Name: "kdf", Size: 1, Description: "key derivation function id"},
+		{Name: "cost 1", Size: 4, Description: "scrypt N or argon2id time, zero for key files"},
+		{Name: "cost 2", Size: 4, Description: "scrypt r or argon2id memory in KiB, zero for key files"},
+		{Name: "cost 3", Size: 4, Description: "scrypt p or argon2id threads, zero for key files"},
+		{Name: "plaintext size", Size: 8, Description: "size of the sealed plaintext, after compression"},
+		{Name: "salt", Size: 32, Description: "key derivation salt"},
+		{Name: "extension length", Size: 1, Description: fmt.Sprintf("at most %d", maxExtLen)},
+		{Name: "extension", Size: -1, Description: "extension of the original file including the dot, may be empty"},
+	}, binaryTail...)...)
+
+	recipientFields := sequence(append([]Field{
+		{Name: "magic", Size: len(binaryMagic), Description: fmt.Sprintf("%q", binaryMagic)},
+		{Name: "version", Size: 1, Description: fmt.Sprintf("%d", formatRecipients)},
+		{Name: "cipher", Size: 1, Description: "cipher id"},
+		{Name: "stanza count", Size: 1, Description: "number of wrapped file keys, at least 1"},
+		{Name: "stanzas", Size: -1, Description: fmt.Sprintf("each a kind byte + length (2 bytes) + body. x25519 body = ephemeral public key (%d bytes) + nonce + sealed file key. passphrase body = kdf id byte + three costs (4 bytes each) + salt (32 bytes) + nonce + sealed file key. key provider body = name length byte + name + file key wrapped by the provider", x25519KeySize)},
+		{Name: "plaintext size", Size: 8, Description: "size of the sealed plaintext, after compression"},
+		{Name: "extension length", Size: 1, Description: fmt.Sprintf("at most %d", maxExtLen)},
+		{Name: "extension", Size: -1, Description: "extension of the original file including the dot, may be empty"},
+	}, binaryTail...)...)
+
+	streamFields := sequence(
+		Field{Name: "magic", Size: len(streamMagic), Description: fmt.Sprintf("%q", streamMagic)},
+		Field{Name: "version", Size: 1, Description: fmt.Sprintf("%d. older streams, %d sealed with secretbox and %d with xchacha20-poly1305, end after the nonce prefix and derive their key with scrypt N=%d r=%d p=%d", streamVersionKDF, streamVersion, streamVersionX, legacyKDFParams.N, legacyKDFParams.R, legacyKDFParams.P)},
+		Field{Name: "salt", Size: 32, Description: "key derivation salt"},
+		Field{Name: "chunk size", Size: 4, Description: fmt.Sprintf("plaintext bytes per chunk, at most %d", maxStreamChunkSize)},
+		Field{Name: "nonce prefix", Size: streamNoncePrefix, Description: "random prefix of the chunk nonces"},
+		Field{Name: "cipher", Size: 1, Description: "cipher id, secretbox or xchacha20-poly1305"},
+		Field{Name: "kdf", Size: 1, Description: "key derivation function id, scrypt or argon2id"},
+		Field{Name: "cost 1", Size: 4, Description: "scrypt N or argon2id time"},
+		Field{Name: "cost 2", Size: 4, Description: "scrypt r or argon2id memory in KiB"},
+		Field{Name: "cost 3", Size: 4, Description: "scrypt p or argon2id threads"},
+		Field{Name: "chunks", Size: -1, Description: "each a sealed length (4 bytes) + chunk sealed with the nonce prefix + its index (8 bytes), the top bit of the index set on the last chunk. xchacha20-poly1305 also authenticates the header + the index as additional data. every chunk but the last holds chunk size bytes, the last may be empty"},
+	)
+
+	armoredFields := []Field{
+		{Name: "ciphertext", Offset: 0, Size: -1, Description: "nonce + sealed plaintext"},
+		{Name: "salt", Offset: 1, Size: 32, Description: fmt.Sprintf("scrypt salt, N=%d r=%d p=%d", legacyKDFParams.N, legacyKDFParams.R, legacyKDFParams.P)},
+		{Name: "extension", Offset: 2, Size: -1, Description: "extension of the original file, may be empty"},
+		{Name: "checksum", Offset: 3, Size: -1, Description: fmt.Sprintf("optional, nonce + sealed blake2b-512 of the plaintext and rotation metadata (%d bytes)", rotationSize)},
+		{Name: "trailer", Offset: 4, Size: -1, Description: "optional, length of everything before this line (8 bytes) + nonce + sealed sha256 of it"},
+	}
+
+	spec := FormatSpec{
+		Formats: []Layout{
+			{Version: formatV0, Name: "armored", Encoding: "hex lines", Fields: armoredFields},
+			{Version: formatStream, Name: "stream", Encoding: "binary", Fields: streamFields},
+			{Version: formatBinary, Name: "binary", Encoding: "binary", Fields: binaryFields},
+			{Version: formatRecipients, Name: "recipients", Encoding: "binary", Fields: recipientFields},
+		},
+		KDFs: []Algorithm{
+			{ID: int(Scrypt), Name: Scrypt.String()},
+			{ID: int(Argon2id), Name: Argon2id.String()},
+			{ID: int(RawKey), Name: RawKey.String()},
+		},
+		Compressors: []Algorithm{{ID: int(NoCompression), Name: "none"}},
+		Stanzas: []Algorithm{
+			{ID: stanzaX25519, Name: "x25519"},
+			{ID: stanzaPassphrase, Name: "passphrase"},
+			{ID: stanzaProvider, Name: "key provider"},
+			{ID: stanzaSSHEd25519, Name: "ssh-ed25519"},
+			{ID: stanzaSSHRSA, Name: "ssh-rsa"},
+		},
+		Records: []Algorithm{
+			{ID: recordFileMeta, Name: "mode, modification time, owner and attributes of the original"},
+			{ID: recordCompression, Name: "compressor id byte + plaintext size before compression (8 bytes)"},
+			{ID: recordLabels, Name: "labels sorted by key, each a key length byte + key + value length byte + value"},
+		},
+		Wrappers: []string{
+			fmt.Sprintf("PEM: a binary file base64 encoded in a %q block with Version and Cipher headers", pemType),
+			fmt.Sprintf("parts: a file split into name.001, name.002, ... each starting with a hex encoded %q header", partMagic),
+			fmt.Sprintf("signed: %q + version byte %d + ed25519 public key (32 bytes) + ed25519ph signature with context %q of the sha512 of everything before the signature and the file after it (64 bytes) + a binary file", signedMagic, signedVersion, signedContext),
+		},
+	}
+
+	for _, id := range Ciphers() {
+		c, aead, err := cipherSizes(id)
+		if err != nil {
+			continue
+		}
+		spec.Ciphers = append(spec.Ciphers, Algorithm{
+			ID:        int(id),
+			Name:      c.Name(),
+			KeySize:   c.KeySize(),
+			NonceSize: aead.NonceSize(),
+			Overhead:  aead.Overhead(),
+		})
+	}
+	for _, id := range Compressors() {
+		c, err := LookupCompressor(id)
+		if err == nil {
+			spec.Compressors = append(spec.Compressors, Algorithm{ID: int(id), Name: c.Name()})
+		}
+	}
+
+	return spec
+}
+
+// Conform checks that the file at path follows the layout of its format
+// version as described by Spec, without the passphrase. split files and
+// PEM blocks are checked after reassembling and decoding them, signed
+// files once their signature is verified. it returns
+// ErrNotEncrypted, ErrTruncated or an error wrapping ErrMalformed for the
+// first violation found. the sealed parts can only be checked by Verify.
+func Conform(path string) error {
+
+	file, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if isPart(file) {
+		file, _, err = readParts(path, file)
+		if err != nil {
+			return err
+		}
+	}
+	file, _, err = unwrapSigned(file)
+	if err != nil {
+		return err
+	}
+	file, err = unwrapPEM(file)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case isStream(file):
+		return conformStream(file)
+	case isBinary(file):
+		return conformBinary(file)
+	}
+	return conformArmored(file)
+}
+
+func conformBinary(file []byte) error {
+
+	h, err := parseBinaryHeader(file)
+	if err != nil {
+		return err
+	}
+	c, aead, err := cipherSizes(h.cipher)
+	if err != nil {
+		return err
+	}
+	sealedKey := aead.NonceSize() + c.KeySize() + aead.Overhead()
+
+	for i, s := range h.stanzas {
+		switch s.kind {
+		case stanzaX25519:
+			if len(s.body) != x25519KeySize+sealedKey {
+				return malformed(fmt.Sprintf("x25519 stanza %d has %d bytes", i, len(s.body)))
+			}
+		case stanzaPassphrase:
+			if len(s.body) != passphraseStanzaSize+sealedKey {
+				return malformed(fmt.Sprintf("passphrase stanza %d has %d bytes", i, len(s.body)))
+			}
+			params := kdfFromCosts(KDF(s.body[0]), [3]int{
+				int(binary.BigEndian.Uint32(s.body[1:])),
+				int(binary.BigEndian.Uint32(s.body[5:])),
+				int(binary.BigEndian.Uint32(s.body[9:])),
+			})
+			if params.KDF == RawKey || !params.valid() {
+				return malformed(fmt.Sprintf("invalid parameters in passphrase stanza %d", i))
+			}
+		case stanzaProvider:
+			// the wrapped key is opaque, only the provider knows its size
+			if _, _, ok := parseProviderStanza(s); !ok {
+				return malformed(fmt.Sprintf("key provider stanza %d has no name or key", i))
+			}
+		case stanzaSSHEd25519:
+			if len(s.body) != sshTagSize+x25519KeySize+sealedKey {
+				return malformed(fmt.Sprintf("ssh-ed25519 stanza %d has %d bytes", i, len(s.body)))
+			}
+		case stanzaSSHRSA:
+			// as long as the modulus of the key
+			if len(s.body) < sshTagSize+sshMinRSABits/8 {
+				return malformed(fmt.Sprintf("ssh-rsa stanza %d has %d bytes", i, len(s.body)))
+			}
+		default:
+			return malformed(fmt.Sprintf("unknown kind %d of stanza %d", s.kind, i))
+		}
+	}
+
+	_, _, _, err = splitBinary(file, h, c)
+	return err
+}
+
+func conformStream(file []byte) error {
+
+	if len(file) < streamHeaderSize {
+		return ErrTruncated
+	}
+	chunkSize, err := parseStreamHeader(file[:streamHeaderSize])
+	if err != nil {
+		return err
+	}
+	size := streamHeaderLen(file[len(streamMagic)])
+	if len(file) < size {
+		return ErrTruncated
+	}
+	id, _, err := streamParams(file[:size])
+	if err != nil {
+		return err
+	}
+	_, aead, err := cipherSizes(id)
+	if err != nil {
+		return err
+	}
+	full := chunkSize + aead.Overhead()
+
+	rest := file[size:]
+	if len(rest) == 0 {
+		return ErrTruncated
+	}
+	for i := 0; len(rest) > 0; i++ {
+		if len(rest) < 4 {
+			return ErrTruncated
+		}
+		n := int(binary.BigEndian.Uint32(rest))
+		if n < aead.Overhead() || n > full {
+			return malformed(fmt.Sprintf("invalid length of chunk %d", i))
+		}
+		if len(rest) < 4+n {
+			return ErrTruncated
+		}
+		rest = rest[4+n:]
+		if n < full && len(rest) > 0 {
+			return malformed(fmt.Sprintf("chunk %d is short but not the last", i))
+		}
+	}
+
+	return nil
+}
+
+// the registered cipher id and an instance under a zero key, for its
+// nonce and overhead sizes
+func cipherSizes(id CipherID) (Cipher, cipher.AEAD, error) {
+
+	c, err := LookupCipher(id)
+	if err != nil {
+		return nil, nil, malformed(err.Error())
+	}
+	aead, err := c.New(make([]byte, c.KeySize()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, aead, nil
+}
+
+func conformArmored(file []byte) error {
+
+	if !looksEncrypted(file) {
+		return ErrNotEncrypted
+	}
+	lines := strings.Split(string(file), "\n")
+
+	_, aead, err := cipherSizes(SecretBox)
+	if err != nil {
+		return err
+	}
+	sealedSize := aead.NonceSize() + aead.Overhead()
+
+	if len(lines[0]) < hex.EncodedLen(sealedSize) {
+		return malformed("ciphertext is too short")
+	}
+	ext, _ := hex.DecodeString(lines[2])
+	if !validExt(ext) {
+		return malformed("invalid extension")
+	}
+	if len(lines) > 3 && len(lines[3]) != hex.EncodedLen(sealedSize+blake2b.Size) && len(lines[3]) != hex.EncodedLen(sealedSize+blake2b.Size+rotationSize) {
+		return malformed("invalid checksum line")
+	}
+	if len(lines) > 4 {
+		trailer := lines[4]
+		if err := checkTrailerLength(file[:len(file)-len(trailer)], trailer); err != nil {
+			return err
+		}
+		if len(trailer) != hex.EncodedLen(8+sealedSize+32) {
+			return malformed("invalid trailer")
+		}
+	}
+
+	return nil
+}
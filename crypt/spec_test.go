@@ -0,0 +1,120 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSpecOffsets(t *testing.T) {
+
+	spec := Spec()
+
+	// the first variable length field of each layout starts where the
+	// fixed header ends
+	starts := map[int]int{formatBinary: binaryFixedSize, formatStream: streamHeaderLen(streamVersionKDF)}
+	for _, l := range spec.Formats {
+		want, ok := starts[l.Version]
+		if !ok {
+			continue
+		}
+		for _, f := range l.Fields {
+			if f.Size < 0 {
+				if f.Offset != want {
+					t.Fatalf("%s %s at offset %d, want %d", l.Name, f.Name, f.Offset, want)
+				}
+				break
+			}
+		}
+	}
+
+	if len(spec.Ciphers) == 0 || spec.Ciphers[0].Name != "secretbox" || spec.Ciphers[0].NonceSize != 24 {
+		t.Fatalf("unexpected ciphers %+v", spec.Ciphers)
+	}
+}
+
+func TestConform(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-conform")
+	defer os.RemoveAll(dir)
+
+	// long enough to be split into parts
+	filename := filepath.Join(dir, "conform.txt")
+	ioutil.WriteFile(filename, bytes.Repeat([]byte(data), 20), 0644)
+
+	var files []string
+	for i, opts := range []Options{{}, {Armor: true}, {PEM: true}, {Compress: Gzip}, {PartSize: 1281}} {
+		opts.OutputPath = filepath.Join(dir, "out"+string(rune('a'+i)))
+		res, err := EncryptWithOptions(filename, passphrase, opts)
+		if err != nil {
+			t.Fatalf("EncryptWithOptions %+v: %v", opts, err)
+		}
+		if opts.PartSize > 0 && len(res.Parts) < 2 {
+			t.Fatalf("file wasn't split")
+		}
+		files = append(files, res.Output)
+	}
+
+	id, _ := GenerateIdentity()
+	res, err := EncryptMulti(filename, [][]byte{passphrase}, []*Recipient{id.Recipient()}, Options{OutputPath: filepath.Join(dir, "multi")})
+	if err != nil {
+		t.Fatalf("EncryptMulti: %v", err)
+	}
+	files = append(files, res.Output)
+
+	var stream bytes.Buffer
+	if err := EncryptStream(bytes.NewReader(make([]byte, 3*streamChunkSize+10)), &stream, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	streamFile := filepath.Join(dir, "stream")
+	ioutil.WriteFile(streamFile, stream.Bytes(), 0644)
+	files = append(files, streamFile)
+
+	for _, f := range files {
+		if err := Conform(f); err != nil {
+			t.Fatalf("Conform %s: %v", f, err)
+		}
+	}
+
+	if err := Conform(filename); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted for a plain file, got %v", err)
+	}
+
+	binary, _ := ioutil.ReadFile(files[0])
+	ioutil.WriteFile(files[0], binary[:len(binary)-1], 0644)
+	if err := Conform(files[0]); err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	ioutil.WriteFile(files[0], append(binary, 0), 0644)
+	if err := Conform(files[0]); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed for trailing data, got %v", err)
+	}
+
+	// a short chunk is only allowed at the end
+	s := stream.Bytes()
+	second := streamHeaderLen(streamVersionKDF) + 4 + streamChunkSize + 16
+	short := append(append([]byte{}, s[:second]...), 0, 0, 0, 20)
+	short = append(short, make([]byte, 20)...)
+	short = append(short, s[second:]...)
+	ioutil.WriteFile(streamFile, short, 0644)
+	if err := Conform(streamFile); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed for a short chunk, got %v", err)
+	}
+}
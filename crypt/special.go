@@ -0,0 +1,72 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSpecialFile is returned when encrypting a named pipe, device, socket
+// or a file of a virtual filesystem such as /proc, which can block forever
+// or change while being read.
+var ErrSpecialFile = errors.New("not a regular file")
+
+// trees of virtual filesystems, whose files don't hold stable contents
+var virtualRoots = []string{"/proc", "/sys", "/dev"}
+
+// IsVirtualPath reports whether path, once symlinks are resolved, is
+// under /proc, /sys or /dev.
+func IsVirtualPath(path string) bool {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	for _, root := range virtualRoots {
+		if abs == root || strings.HasPrefix(abs, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSpecial reports whether info describes a named pipe, device or socket.
+func IsSpecial(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice|os.ModeSocket|os.ModeIrregular) != 0
+}
+
+// CheckRegular returns an error wrapping ErrSpecialFile unless path is a
+// regular file outside of virtual filesystems.
+func CheckRegular(path string) error {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: %w (%s)", path, ErrSpecialFile, info.Mode().Type())
+	}
+	if IsVirtualPath(path) {
+		return fmt.Errorf("%s: %w, it is on a virtual filesystem", path, ErrSpecialFile)
+	}
+	return nil
+}
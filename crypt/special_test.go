@@ -0,0 +1,49 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRegular(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-special")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "regular.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	if err := CheckRegular(filename); err != nil {
+		t.Fatalf("CheckRegular %s: %v", filename, err)
+	}
+
+	if err := CheckRegular(dir); !errors.Is(err, ErrSpecialFile) {
+		t.Fatalf("expected ErrSpecialFile for a directory, got %v", err)
+	}
+
+	if _, err := Encrypt(dir, passphrase); !errors.Is(err, ErrSpecialFile) {
+		t.Fatalf("expected ErrSpecialFile encrypting a directory, got %v", err)
+	}
+
+	for path, want := range map[string]bool{"/proc": true, "/proc/self/status": true, "/sys/kernel": true, "/devices": false, filename: false} {
+		if got := IsVirtualPath(path); got != want {
+			t.Fatalf("IsVirtualPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestEncryptFIFO(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-special")
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "pipe")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+
+	// returns before opening the pipe, which would block without a writer
+	_, err := Encrypt(fifo, passphrase)
+	if !errors.Is(err, ErrSpecialFile) {
+		t.Fatalf("expected ErrSpecialFile, got %v", err)
+	}
+
+	info, _ := os.Lstat(fifo)
+	if !IsSpecial(info) {
+		t.Fatalf("expected a named pipe to be special")
+	}
+
+	// with AllowSpecial the pipe is read until the writer closes it
+	go func() {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err == nil {
+			f.Write([]byte(data))
+			f.Close()
+		}
+	}()
+	res, err := EncryptWithOptions(fifo, passphrase, Options{AllowSpecial: true, OutputPath: filepath.Join(dir, "out")})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if got, _ := Plaintext(res.Output, passphrase); string(got) != data {
+		t.Fatalf("unexpected contents %q", got)
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH public keys can be recipients and their private keys identities, so
+// the keys a team already distributes in authorized_keys files encrypt
+// files too. ssh-ed25519 keys are converted to X25519 like age does, with
+// the shared secret tweaked by the SSH key so a stanza is bound to the key
+// rather than to its conversion. ssh-rsa keys wrap the file key with
+// RSA-OAEP-SHA256. both stanzas start with a tag, the first 4 bytes of the
+// SHA-256 of the key in the SSH wire format, so identities skip the
+// stanzas of other keys without trying them.
+//
+// ssh-agent can't decrypt files: agents only sign, and neither a
+// signature nor the public key recovers a file key wrapped for the key.
+const (
+	sshEd25519    = "ssh-ed25519"
+	sshRSA        = "ssh-rsa"
+	sshTagSize    = 4
+	sshMinRSABits = 2048
+
+	sshEd25519Info = "cloak ssh-ed25519 file key"
+	sshRSALabel    = "cloak ssh-rsa file key"
+)
+
+// ErrSSHKeyEncrypted is returned by ParseSSHIdentity when the private key
+// is encrypted and no passphrase was given.
+var ErrSSHKeyEncrypted = errors.New("the SSH private key is encrypted, its passphrase is required")
+
+var errInvalidSSHKey = errors.New("invalid SSH key")
+
+// an ssh-ed25519 or ssh-rsa public key
+type sshPublicKey struct {
+	typ  string
+	wire []byte
+
+	// the Montgomery form of an ssh-ed25519 key
+	x25519 *ecdh.PublicKey
+	rsa    *rsa.PublicKey
+}
+
+// the private half of an sshPublicKey
+type sshIdentity struct {
+	pub    *sshPublicKey
+	x25519 *ecdh.PrivateKey
+	rsa    *rsa.PrivateKey
+}
+
+// the tag starting the stanzas wrapped for k
+func (k *sshPublicKey) tag() []byte {
+	sum := sha256.Sum256(k.wire)
+	return sum[:sshTagSize]
+}
+
+// the key as a line of an authorized_keys file, without a comment
+func (k *sshPublicKey) String() string {
+	return k.typ + " " + base64.StdEncoding.EncodeToString(k.wire)
+}
+
+// reports whether s starts like an SSH public key line
+func isSSHKey(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
+
+// parses an SSH public key line, as found in id_ed25519.pub or
+// authorized_keys files: the key type, the base64 key and an optional
+// comment
+func parseSSHPublicKey(line string) (*sshPublicKey, error) {
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errInvalidSSHKey
+	}
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errInvalidSSHKey
+	}
+	k, err := parseSSHWireKey(wire)
+	if err != nil {
+		return nil, err
+	}
+	if k.typ != fields[0] {
+		return nil, fmt.Errorf("SSH key of type %s is labeled %s", k.typ, fields[0])
+	}
+	return k, nil
+}
+
+// parses a public key in the SSH wire format
+func parseSSHWireKey(wire []byte) (*sshPublicKey, error) {
+
+	r := &sshReader{b: wire}
+	k := &sshPublicKey{typ: string(r.string()), wire: wire}
+
+	switch k.typ {
+	case sshEd25519:
+		pub := r.string()
+		if r.err != nil || len(r.b) != 0 || len(pub) != ed25519.PublicKeySize {
+			return nil, errInvalidSSHKey
+		}
+		u, err := edwardsToMontgomery(pub)
+		if err != nil {
+			return nil, err
+		}
+		if k.x25519, err = ecdh.X25519().NewPublicKey(u); err != nil {
+			return nil, err
+		}
+
+	case sshRSA:
+		e, n := r.mpint(), r.mpint()
+		if r.err != nil || len(r.b) != 0 {
+			return nil, errInvalidSSHKey
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || e.Bit(0) == 0 {
+			return nil, errors.New("invalid SSH RSA public exponent")
+		}
+		if n.BitLen() < sshMinRSABits {
+			return nil, fmt.Errorf("SSH RSA keys need at least %d bits, this one has %d", sshMinRSABits, n.BitLen())
+		}
+		k.rsa = &rsa.PublicKey{N: n, E: int(e.Int64())}
+
+	default:
+		if r.err != nil {
+			return nil, errInvalidSSHKey
+		}
+		return nil, fmt.Errorf("SSH keys of type %q aren't supported, only %s and %s", k.typ, sshEd25519, sshRSA)
+	}
+
+	return k, nil
+}
+
+var (
+	curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	// d of the twisted Edwards curve, -121665/121666
+	edwardsD = new(big.Int).Mod(new(big.Int).Mul(big.NewInt(-121665), new(big.Int).ModInverse(big.NewInt(121666), curve25519P)), curve25519P)
+)
+
+// converts an Ed25519 public key to the X25519 key of the same point,
+// u = (1 + y) / (1 - y), after checking the point is on the curve
+func edwardsToMontgomery(pub []byte) ([]byte, error) {
+
+	p := curve25519P
+	be := make([]byte, len(pub))
+	for i, b := range pub {
+		be[len(pub)-1-i] = b
+	}
+	// the top bit is the sign of x, which u doesn't depend on
+	be[0] &= 0x7f
+	y := new(big.Int).SetBytes(be)
+	if y.Cmp(p) >= 0 {
+		return nil, errInvalidSSHKey
+	}
+
+	// a point has an x with x^2 = (y^2 - 1) / (d y^2 + 1)
+	y2 := new(big.Int).Mul(y, y)
+	num := new(big.Int).Mod(new(big.Int).Sub(y2, big.NewInt(1)), p)
+	den := new(big.Int).Mod(new(big.Int).Add(new(big.Int).Mul(edwardsD, y2), big.NewInt(1)), p)
+	inv := new(big.Int).ModInverse(den, p)
+	if inv == nil {
+		return nil, errInvalidSSHKey
+	}
+	x2 := new(big.Int).Mod(new(big.Int).Mul(num, inv), p)
+	if new(big.Int).ModSqrt(x2, p) == nil {
+		return nil, errors.New("invalid SSH key, not a point on the curve")
+	}
+
+	inv = new(big.Int).ModInverse(new(big.Int).Mod(new(big.Int).Sub(big.NewInt(1), y), p), p)
+	if inv == nil {
+		return nil, errInvalidSSHKey
+	}
+	u := new(big.Int).Mod(new(big.Int).Mul(new(big.Int).Add(big.NewInt(1), y), inv), p)
+
+	out := u.FillBytes(make([]byte, x25519KeySize))
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// tweaks an X25519 shared secret with the SSH key it was computed for,
+// as age does
+func sshTweak(shared, wire []byte, info string) ([]byte, error) {
+
+	tweak, err := hkdf.Key(sha256.New, nil, wire, info, x25519KeySize)
+	if err != nil {
+		return nil, err
+	}
+	scalar, err := ecdh.X25519().NewPrivateKey(tweak)
+	if err != nil {
+		return nil, err
+	}
+	point, err := ecdh.X25519().NewPublicKey(shared)
+	if err != nil {
+		return nil, err
+	}
+	return scalar.ECDH(point)
+}
+
+// the shared secret with an ssh-ed25519 key, from the sender's side when
+// priv is ephemeral or the recipient's when pub is
+func sshEd25519Shared(priv *ecdh.PrivateKey, pub *ecdh.PublicKey, k *sshPublicKey, info string) ([]byte, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	return sshTweak(shared, k.wire, info)
+}
+
+func wrapSSH(c Cipher, fileKey []byte, r *Recipient) (stanza, error) {
+
+	k := r.ssh
+	if k.rsa != nil {
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, k.rsa, fileKey, []byte(sshRSALabel))
+		if err != nil {
+			return stanza{}, err
+		}
+		return stanza{kind: stanzaSSHRSA, body: append(k.tag(), wrapped...)}, nil
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return stanza{}, err
+	}
+	shared, err := sshEd25519Shared(ephemeral, k.x25519, k, sshEd25519Info)
+	if err != nil {
+		return stanza{}, err
+	}
+
+	pub := ephemeral.PublicKey().Bytes()
+	salt := append(append([]byte(nil), pub...), k.x25519.Bytes()...)
+	key, err := hkdf.Key(sha256.New, shared, salt, sshEd25519Info, c.KeySize())
+	if err != nil {
+		return stanza{}, err
+	}
+	defer wipe(key)
+	aead, err := c.New(key)
+	if err != nil {
+		return stanza{}, err
+	}
+
+	nonce, err := random(aead.NonceSize())
+	if err != nil {
+		return stanza{}, err
+	}
+	body := append(append(k.tag(), pub...), nonce...)
+	return stanza{kind: stanzaSSHEd25519, body: aead.Seal(body, nonce, fileKey, nil)}, nil
+}
+
+// unwraps the file key of an SSH stanza with the SSH identity id, failing
+// without trying when the stanza was wrapped for another key
+func unwrapSSH(c Cipher, s stanza, id *Identity) ([]byte, error) {
+
+	k := id.ssh
+	if len(s.body) < sshTagSize || !bytes.Equal(s.body[:sshTagSize], k.pub.tag()) {
+		return nil, ErrNoIdentity
+	}
+	body := s.body[sshTagSize:]
+
+	switch {
+	case s.kind == stanzaSSHRSA && k.rsa != nil:
+		fileKey, err := rsa.DecryptOAEP(sha256.New(), nil, k.rsa, body, []byte(sshRSALabel))
+		if err != nil {
+			return nil, ErrNoIdentity
+		}
+		return fileKey, nil
+
+	case s.kind == stanzaSSHEd25519 && k.x25519 != nil:
+		if len(body) < x25519KeySize {
+			return nil, malformed("ssh-ed25519 stanza")
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(body[:x25519KeySize])
+		if err != nil {
+			return nil, err
+		}
+		shared, err := sshEd25519Shared(k.x25519, ephemeral, k.pub, sshEd25519Info)
+		if err != nil {
+			return nil, err
+		}
+		salt := append(append([]byte(nil), body[:x25519KeySize]...), k.pub.x25519.Bytes()...)
+		key, err := hkdf.Key(sha256.New, shared, salt, sshEd25519Info, c.KeySize())
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(key)
+		aead, err := c.New(key)
+		if err != nil {
+			return nil, err
+		}
+		sealed := body[x25519KeySize:]
+		if len(sealed) < aead.NonceSize() {
+			return nil, malformed("ssh-ed25519 stanza")
+		}
+		return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	}
+
+	return nil, ErrNoIdentity
+}
+
+// ParseSSHIdentity decodes an SSH private key, such as ~/.ssh/id_ed25519,
+// so files encrypted to its public key can be decrypted. keys written by
+// ssh-keygen in the OpenSSH format are supported, encrypted or not, as are
+// PKCS #1 and PKCS #8 keys. ErrSSHKeyEncrypted is returned when the key is
+// encrypted and passphrase is empty, ErrWrongPassphrase when it doesn't
+// decrypt the key.
+func ParseSSHIdentity(pemBytes, passphrase []byte) (*Identity, error) {
+
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if len(passphrase) == 0 {
+			return nil, ErrSSHKeyEncrypted
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrWrongPassphrase
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return rsaSSHIdentity(key)
+	case *ed25519.PrivateKey:
+		return ed25519SSHIdentity(*key)
+	case ed25519.PrivateKey:
+		return ed25519SSHIdentity(key)
+	}
+	return nil, fmt.Errorf("%T keys aren't supported, only %s and %s", key, sshEd25519, sshRSA)
+}
+
+func ed25519SSHIdentity(key ed25519.PrivateKey) (*Identity, error) {
+
+	pub := appendSSHString(appendSSHString(nil, []byte(sshEd25519)), key.Public().(ed25519.PublicKey))
+	k, err := parseSSHWireKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	// the X25519 scalar is the one Ed25519 signs with
+	h := sha512.Sum512(key.Seed())
+	defer wipe(h[:])
+	x, err := ecdh.X25519().NewPrivateKey(h[:x25519KeySize])
+	if err != nil {
+		return nil, err
+	}
+	if !x.PublicKey().Equal(k.x25519) {
+		return nil, errors.New("the SSH private key doesn't match its public key")
+	}
+
+	return &Identity{ssh: &sshIdentity{pub: k, x25519: x}}, nil
+}
+
+func rsaSSHIdentity(key *rsa.PrivateKey) (*Identity, error) {
+
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	key.Precompute()
+
+	pub := appendSSHString(nil, []byte(sshRSA))
+	pub = appendSSHMpint(pub, big.NewInt(int64(key.E)))
+	pub = appendSSHMpint(pub, key.N)
+	k, err := parseSSHWireKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{ssh: &sshIdentity{pub: k, rsa: key}}, nil
+}
+
+// reads the fields of the SSH wire format, the first error sticks
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) < 4 {
+		r.err = errInvalidSSHKey
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.b)) < uint64(n) {
+		r.err = errInvalidSSHKey
+		return nil
+	}
+	s := r.b[:n]
+	r.b = r.b[n:]
+	return s
+}
+
+// a non negative mpint, never nil
+func (r *sshReader) mpint() *big.Int {
+	b := r.string()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		r.err = errInvalidSSHKey
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func appendSSHString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func appendSSHMpint(b []byte, n *big.Int) []byte {
+	v := n.Bytes()
+	if len(v) > 0 && v[0]&0x80 != 0 {
+		v = append([]byte{0}, v...)
+	}
+	return appendSSHString(b, v)
+}
@@ -0,0 +1,48 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// Stdio is the path that stands for standard input when it is read and
+// standard output when it is written, for pipes such as
+// tar cz dir | cloak encrypt - > dir.tar.cloak. input read from Stdio
+// has no extension or metadata to record, and output written to it
+// defaults to Stdio as well unless Options.OutputPath is set.
+const Stdio = "-"
+
+// read and written in place of Stdio, replaced by tests
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+)
+
+// writes body to standard output, which can't be split into parts or
+// read back to confirm it before shredding the original
+func writeStdout(body []byte, opts Options) error {
+
+	if opts.PartSize > 0 {
+		return errors.New("split files can't be written to standard output")
+	}
+	if opts.ShredOriginal {
+		return errors.New("the original can't be shredded when the output is written to standard output")
+	}
+
+	_, err := stdout.Write(body)
+	return err
+}
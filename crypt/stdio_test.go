@@ -0,0 +1,109 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// replaces standard input and returns what is written to standard output
+func setStdio(in io.Reader) *bytes.Buffer {
+	out := &bytes.Buffer{}
+	stdin, stdout = in, out
+	return out
+}
+
+func restoreStdio(in io.Reader, out io.Writer) {
+	stdin, stdout = in, out
+}
+
+func TestStdioRoundTrip(t *testing.T) {
+
+	defer restoreStdio(stdin, stdout)
+
+	plain := bytes.Repeat([]byte("piped tarball "), 1000)
+
+	out := setStdio(bytes.NewReader(plain))
+	res, err := EncryptWithOptions(Stdio, []byte("pass"), Options{})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if res.Output != Stdio {
+		t.Fatalf("output is %q, expected standard output", res.Output)
+	}
+	sealed := append([]byte(nil), out.Bytes()...)
+	if !looksEncrypted(sealed) {
+		t.Fatal("standard output isn't an encrypted file")
+	}
+
+	out = setStdio(bytes.NewReader(sealed))
+	res, err = DecryptWithOptions(Stdio, []byte("pass"), Options{})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	if res.Output != Stdio || !bytes.Equal(out.Bytes(), plain) {
+		t.Fatalf("decrypted %d bytes to %q, expected the original on standard output", out.Len(), res.Output)
+	}
+}
+
+func TestStdioToFile(t *testing.T) {
+
+	defer restoreStdio(stdin, stdout)
+
+	dir, _ := ioutil.TempDir("", "cloak-stdio")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "notes.txt")
+	ioutil.WriteFile(filename, []byte("some notes"), 0644)
+
+	// a file encrypted to standard output decrypts from standard input
+	out := setStdio(nil)
+	if _, err := EncryptWithOptions(filename, []byte("pass"), Options{OutputPath: Stdio}); err != nil {
+		t.Fatalf("EncryptWithOptions: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.cloak")); !os.IsNotExist(err) {
+		t.Fatal("encrypting to standard output wrote a file")
+	}
+
+	setStdio(bytes.NewReader(out.Bytes()))
+	output := filepath.Join(dir, "restored.txt")
+	res, err := DecryptWithOptions(Stdio, []byte("pass"), Options{OutputPath: output})
+	if err != nil {
+		t.Fatalf("DecryptWithOptions: %v", err)
+	}
+	restored, _ := ioutil.ReadFile(output)
+	if res.Output != output || string(restored) != "some notes" {
+		t.Fatalf("restored %q to %s", restored, res.Output)
+	}
+}
+
+func TestStdioRefusesPartsAndShred(t *testing.T) {
+
+	defer restoreStdio(stdin, stdout)
+
+	setStdio(bytes.NewReader([]byte("data")))
+	if _, err := EncryptWithOptions(Stdio, []byte("pass"), Options{PartSize: 1 << 10}); err == nil {
+		t.Fatal("split a file on standard output")
+	}
+
+	setStdio(bytes.NewReader([]byte("data")))
+	if _, err := EncryptWithOptions(Stdio, []byte("pass"), Options{ShredOriginal: true}); err == nil {
+		t.Fatal("shredded standard input")
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Storage is a remote destination encrypted streams are uploaded to, such
+// as a bucket of an object store, so they needn't be staged in a local
+// file first. S3 is built in, RegisterStorage adds others.
+type Storage interface {
+	// Put stores everything read from r as the object name, replacing
+	// it. when reading r fails nothing is stored and Put returns the
+	// error.
+	Put(ctx context.Context, name string, r io.Reader) error
+}
+
+var (
+	storagesMu sync.RWMutex
+	storages   = make(map[string]func(bucket string) (Storage, error))
+)
+
+func init() {
+	RegisterStorage("s3", func(bucket string) (Storage, error) {
+		return NewS3(bucket)
+	})
+}
+
+// RegisterStorage makes URLs such as scheme://bucket/name open the
+// Storage open returns for the bucket, the host part of the URL. it
+// panics if open is nil or if the scheme is already taken.
+func RegisterStorage(scheme string, open func(bucket string) (Storage, error)) {
+	storagesMu.Lock()
+	defer storagesMu.Unlock()
+
+	if open == nil {
+		panic("crypt: RegisterStorage open is nil")
+	}
+	if _, dup := storages[scheme]; dup {
+		panic(fmt.Sprintf("crypt: RegisterStorage called twice for scheme %s", scheme))
+	}
+	storages[scheme] = open
+}
+
+// StorageSchemes returns the URL schemes of the registered storages in
+// alphabetical order.
+func StorageSchemes() []string {
+	storagesMu.RLock()
+	defer storagesMu.RUnlock()
+
+	schemes := make([]string, 0, len(storages))
+	for s := range storages {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsStorageURL reports whether s is a URL with the scheme of a registered
+// storage rather than a path.
+func IsStorageURL(s string) bool {
+	i := strings.Index(s, "://")
+	if i <= 0 {
+		return false
+	}
+	storagesMu.RLock()
+	defer storagesMu.RUnlock()
+	_, ok := storages[s[:i]]
+	return ok
+}
+
+// OpenStorage returns the Storage of a URL such as s3://bucket/name and
+// the name of the object in it.
+func OpenStorage(rawURL string) (Storage, string, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	storagesMu.RLock()
+	open, ok := storages[u.Scheme]
+	storagesMu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported storage %q, supported: %s", u.Scheme, strings.Join(StorageSchemes(), ", "))
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || name == "" {
+		return nil, "", fmt.Errorf("%s needs a bucket and an object name, such as %s://bucket/backup.cloak", rawURL, u.Scheme)
+	}
+
+	s, err := open(u.Host)
+	if err != nil {
+		return nil, "", err
+	}
+	return s, name, nil
+}
+
+// EncryptToURL encrypts the file at path, or standard input when path is
+// Stdio, as a stream like EncryptStreamWithOptions and uploads it to the
+// object of a storage URL, such as s3://bucket/backups/db.cloak. the
+// ciphertext is never written to a local file.
+func EncryptToURL(path, rawURL string, passphrase []byte, opts Options) error {
+
+	s, name, err := OpenStorage(rawURL)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = stdin
+	if path != Stdio {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if err := EncryptToStorage(r, s, name, passphrase, opts); err != nil {
+		return err
+	}
+	opts.log(slog.LevelInfo, "uploaded", "input", path, "output", rawURL)
+	return nil
+}
+
+// EncryptToStorage encrypts everything read from r as a stream like
+// EncryptStreamWithOptions and stores it as the object name of s while
+// it's being encrypted. nothing is stored when encrypting fails.
+func EncryptToStorage(r io.Reader, s Storage, name string, passphrase []byte, opts Options) error {
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(EncryptStreamWithOptions(r, pw, passphrase, opts))
+	}()
+
+	err := s.Put(opts.context(), name, pr)
+	// unblocks the encryption when the upload failed
+	pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,84 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// filesystems that write changes to new blocks, keeping the old ones
+var copyOnWrite = map[int64]string{
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0xca451a4e: "bcachefs",
+	0xf2f52010: "f2fs",
+	0x3434:     "nilfs2",
+	0x794c7630: "overlayfs",
+}
+
+// reasons data overwritten under path may survive
+func storageWarnings(path string) []string {
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return []string{fmt.Sprintf("couldn't check the filesystem of %s: %v", path, err)}
+	}
+	if int64(fs.Type) == tmpfsMagic {
+		return []string{fmt.Sprintf("%s is on tmpfs, overwritten pages may remain in swap", path)}
+	}
+
+	var warnings []string
+	if name, ok := copyOnWrite[int64(fs.Type)]; ok {
+		warnings = append(warnings, fmt.Sprintf("%s is on %s, which writes changes to new blocks so the old data may survive", path, name))
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return warnings
+	}
+	switch rotational(uint64(st.Dev)) {
+	case "0":
+		warnings = append(warnings, fmt.Sprintf("%s is on solid state storage, which remaps writes so overwritten blocks may survive until they are trimmed", path))
+	case "1":
+	default:
+		warnings = append(warnings, fmt.Sprintf("couldn't tell whether the storage of %s keeps overwritten blocks", path))
+	}
+
+	return warnings
+}
+
+// the queue/rotational flag of the block device dev, or of the disk when
+// dev is a partition. empty when it isn't known.
+func rotational(dev uint64) string {
+
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	base := fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)
+
+	for _, p := range []string{"queue/rotational", "../queue/rotational"} {
+		b, err := ioutil.ReadFile(filepath.Join(base, p))
+		if err == nil {
+			return strings.TrimSpace(string(b))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package crypt
+
+import "fmt"
+
+// the filesystem and device can't be inspected on this platform
+func storageWarnings(path string) []string {
+	return []string{fmt.Sprintf("couldn't tell whether the storage of %s keeps overwritten blocks, SSDs and copy on write filesystems do", path)}
+}
@@ -0,0 +1,594 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// a streamed file is binary, unlike the hex layout written by Encrypt:
+// header = magic + version byte + salt (32 bytes) + big endian chunk size
+// (4 bytes) + nonce prefix (16 bytes)
+// then chunks = big endian sealed length (4 bytes) + sealed chunk
+//
+// each chunk is sealed with the nonce prefix followed by its big endian
+// index, the top bit of the index marks the last chunk so reordered,
+// dropped or truncated chunks fail to open. the last chunk may be empty.
+//
+// version 1 streams are sealed with secretbox. version 2 streams are
+// sealed with xchacha20-poly1305 and also authenticate the header and the
+// index of each chunk as additional data, so a chunk can't be moved to
+// another stream or position even under the same key. both derive their
+// key with the fixed legacyKDFParams.
+//
+// version 3 streams record how they are sealed after the nonce prefix:
+// cipher id byte + kdf id byte + big endian scrypt N, r and p or argon2id
+// time, memory and threads (4 bytes each). the header is authenticated
+// like version 2 when sealed with xchacha20-poly1305, secretbox takes no
+// additional data but a changed header derives another key.
+const (
+	streamMagic   = "CLOAKSTR"
+	streamVersion = 1
+	// xchacha20-poly1305 with the header and index as additional data
+	streamVersionX = 2
+	// the cipher and key derivation recorded in the header
+	streamVersionKDF = 3
+
+	// size of the header of versions 1 and 2, and of the fields every
+	// version starts with
+	streamHeaderSize  = len(streamMagic) + 1 + 32 + 4 + 16
+	streamNoncePrefix = 16
+	// the cipher and key derivation fields of version 3
+	streamKDFSize = 2 + 12
+
+	// plaintext bytes sealed per chunk
+	streamChunkSize = 64 << 10
+	// largest chunk size accepted when decrypting
+	maxStreamChunkSize = 16 << 20
+
+	lastChunk = 1 << 63
+)
+
+// the nonce of chunk i
+func chunkNonce(prefix []byte, i uint64, last bool) []byte {
+	if last {
+		i |= lastChunk
+	}
+	nonce := make([]byte, 0, streamNoncePrefix+8)
+	nonce = append(nonce, prefix...)
+	return binary.BigEndian.AppendUint64(nonce, i)
+}
+
+// the cipher sealing the chunks of stream version 1 or 2
+func streamCipher(version byte) CipherID {
+	if version == streamVersionX {
+		return XChaCha20Poly1305
+	}
+	return SecretBox
+}
+
+// checks that cipher id can seal streams
+func checkStreamCipher(id CipherID) error {
+
+	switch id {
+	case SecretBox, XChaCha20Poly1305:
+		return nil
+	}
+	return fmt.Errorf("cipher %s can't seal streams, use %s or %s", cipherName(id), cipherName(SecretBox), cipherName(XChaCha20Poly1305))
+}
+
+// the size of the header of a stream version
+func streamHeaderLen(version byte) int {
+	if version == streamVersionKDF {
+		return streamHeaderSize + streamKDFSize
+	}
+	return streamHeaderSize
+}
+
+// the cipher and key derivation parameters of a whole stream header
+func streamParams(header []byte) (CipherID, KDFParams, error) {
+
+	version := header[len(streamMagic)]
+	if version != streamVersionKDF {
+		return streamCipher(version), legacyKDFParams, nil
+	}
+	if len(header) < streamHeaderLen(version) {
+		return 0, KDFParams{}, ErrTruncated
+	}
+
+	b := header[streamHeaderSize:]
+	id := CipherID(b[0])
+	if checkStreamCipher(id) != nil {
+		return 0, KDFParams{}, malformed("invalid stream cipher")
+	}
+	kdf := KDF(b[1])
+	if kdf != Scrypt && kdf != Argon2id {
+		return 0, KDFParams{}, malformed("unknown key derivation function")
+	}
+	params := kdfFromCosts(kdf, [3]int{
+		int(binary.BigEndian.Uint32(b[2:])),
+		int(binary.BigEndian.Uint32(b[6:])),
+		int(binary.BigEndian.Uint32(b[10:])),
+	})
+	if !params.valid() {
+		return 0, KDFParams{}, malformed("invalid " + kdf.String() + " parameters")
+	}
+	return id, params, nil
+}
+
+// the key and nonce prefix of a stream
+type streamKey struct {
+	aead   cipher.AEAD
+	prefix []byte
+	// authenticated with the index of every chunk, nil for secretbox
+	header []byte
+
+	// how the stream is sealed, as recorded in its header or implied by
+	// its version
+	cipher CipherID
+	kdf    KDFParams
+	// of the header the stream starts with
+	size int
+}
+
+// derives the key of the stream with a parsed header from the passphrase
+func newStreamKey(header, passphrase []byte) (*streamKey, error) {
+
+	id, params, err := streamParams(header)
+	if err != nil {
+		return nil, err
+	}
+	c, err := LookupCipher(id)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := header[len(streamMagic)+1 : len(streamMagic)+33]
+	key, err := deriveKey(passphrase, salt, params, c.KeySize())
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	aead, err := c.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &streamKey{aead: aead, prefix: header[streamHeaderSize-streamNoncePrefix : streamHeaderSize], cipher: id, kdf: params}
+	if id == XChaCha20Poly1305 {
+		k.header = header
+	}
+	k.size = len(header)
+	return k, nil
+}
+
+// the additional data of the chunk sealed with nonce
+func (k *streamKey) additionalData(nonce []byte) []byte {
+
+	if k.header == nil {
+		return nil
+	}
+	ad := make([]byte, 0, len(k.header)+8)
+	ad = append(ad, k.header...)
+	return append(ad, nonce[streamNoncePrefix:]...)
+}
+
+// appends chunk i sealed to dst
+func (k *streamKey) seal(dst []byte, i uint64, last bool, plain []byte) []byte {
+
+	nonce := chunkNonce(k.prefix, i, last)
+	return k.aead.Seal(dst, nonce, plain, k.additionalData(nonce))
+}
+
+// opens chunk i into dst, a chunk is the last one if it opens with the
+// last chunk nonce
+func (k *streamKey) open(i uint64, sealed, dst []byte) ([]byte, bool, error) {
+
+	for _, last := range []bool{false, true} {
+		nonce := chunkNonce(k.prefix, i, last)
+		plain, err := k.aead.Open(dst, nonce, sealed, k.additionalData(nonce))
+		if err == nil {
+			return plain, last, nil
+		}
+	}
+	if i == 0 {
+		// nothing checked the key before the first chunk
+		return nil, false, ErrWrongPassphrase
+	}
+	return nil, false, corrupt(fmt.Sprintf("unable to decrypt chunk %d", i))
+}
+
+// EncryptStream encrypts everything read from r and writes it to w in
+// fixed size chunks, so the data never has to fit in memory. unlike
+// Encrypt it requires a passphrase.
+func EncryptStream(r io.Reader, w io.Writer, passphrase []byte) error {
+
+	return EncryptStreamWithOptions(r, w, passphrase, Options{})
+}
+
+// EncryptStreamWithOptions is like EncryptStream but reports each chunk
+// read from r to opts.Progress and seals the chunks with opts.Cipher,
+// SecretBox or XChaCha20Poly1305, on opts.Workers goroutines. the key is
+// derived with opts.KDF, which the header records. the other options are
+// ignored.
+func EncryptStreamWithOptions(r io.Reader, w io.Writer, passphrase []byte, opts Options) error {
+
+	header, key, err := newStream(passphrase, opts.cipher(), opts.KDF.withDefaults())
+	if err != nil {
+		return err
+	}
+	workers := opts.workers()
+	opts.trace("streaming", "cipher", cipherName(opts.cipher()), "kdf", key.kdf, "chunk_size", streamChunkSize, "workers", workers)
+
+	r = withProgress(r, opts.Progress)
+	if workers > 1 {
+		return sealChunks(r, w, header, key, workers, opts)
+	}
+
+	e := newStreamEncrypter(r, key, 0)
+	e.out = header
+	_, err = io.Copy(w, e)
+	return err
+}
+
+// DecryptStream decrypts a stream written by EncryptStream from r and
+// writes the plaintext to w. chunks are authenticated before they are
+// written, but data written before an error must be discarded as the
+// stream may have been truncated.
+func DecryptStream(r io.Reader, w io.Writer, passphrase []byte) error {
+
+	return DecryptStreamWithOptions(r, w, passphrase, Options{})
+}
+
+// DecryptStreamWithOptions is like DecryptStream but reports the encrypted
+// bytes read from r to opts.Progress as each chunk is opened. the other
+// options are ignored.
+func DecryptStreamWithOptions(r io.Reader, w io.Writer, passphrase []byte, opts Options) error {
+
+	dr, err := DecryptReader(withProgress(r, opts.Progress), passphrase)
+	if err != nil {
+		return err
+	}
+	d := dr.(*streamDecrypter)
+	opts.trace("streaming", "cipher", cipherName(d.cipher), "kdf", d.key.kdf, "chunk_size", len(d.buf)-d.key.aead.Overhead())
+
+	_, err = io.Copy(w, dr)
+	return err
+}
+
+// EncryptReader returns a reader producing the encrypted stream of
+// everything read from r, in the format written by EncryptStream. the key
+// is derived before it returns, data is read from r as the result is read.
+// chunks are sealed with SecretBox and the key derived with
+// DefaultKDFParams.
+func EncryptReader(r io.Reader, passphrase []byte) (io.Reader, error) {
+
+	return encryptReader(r, passphrase, SecretBox, DefaultKDFParams)
+}
+
+func encryptReader(r io.Reader, passphrase []byte, id CipherID, params KDFParams) (io.Reader, error) {
+
+	header, key, err := newStream(passphrase, id, params)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newStreamEncrypter(r, key, 0)
+	e.out = header
+	return e, nil
+}
+
+// returns the header of a new stream sealed with cipher id under a key
+// derived with params, with a random salt and nonce prefix, and its key
+func newStream(passphrase []byte, id CipherID, params KDFParams) ([]byte, *streamKey, error) {
+
+	if len(passphrase) == 0 {
+		return nil, nil, errors.New("a passphrase is required to encrypt a stream")
+	}
+	if err := checkStreamCipher(id); err != nil {
+		return nil, nil, err
+	}
+	if params.KDF == RawKey || !params.valid() {
+		return nil, nil, fmt.Errorf("invalid key derivation parameters %+v", params)
+	}
+
+	salt, err := random(32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefix, err := random(streamNoncePrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := make([]byte, 0, streamHeaderLen(streamVersionKDF))
+	header = append(header, streamMagic...)
+	header = append(header, streamVersionKDF)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, streamChunkSize)
+	header = append(header, prefix...)
+	header = append(header, byte(id), byte(params.KDF))
+	for _, v := range params.costs() {
+		header = binary.BigEndian.AppendUint32(header, uint32(v))
+	}
+
+	key, err := newStreamKey(header, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, key, nil
+}
+
+// seals the chunks read from r starting at chunk index
+func newStreamEncrypter(r io.Reader, key *streamKey, index uint64) *streamEncrypter {
+	return &streamEncrypter{
+		r:      r,
+		key:    key,
+		index:  index,
+		buf:    make([]byte, streamChunkSize),
+		next:   make([]byte, streamChunkSize),
+		sealed: make([]byte, 0, 4+streamChunkSize+key.aead.Overhead()),
+	}
+}
+
+type streamEncrypter struct {
+	r     io.Reader
+	key   *streamKey
+	index uint64
+
+	// buf holds the next chunk to seal, next is read ahead to tell
+	// whether buf is the last one
+	buf, next []byte
+	n         int
+	started   bool
+
+	sealed []byte
+	out    []byte
+	done   bool
+	err    error
+}
+
+func (e *streamEncrypter) Read(p []byte) (int, error) {
+
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.done {
+			return 0, io.EOF
+		}
+		e.err = e.seal()
+	}
+
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// seals the next chunk into out
+func (e *streamEncrypter) seal() error {
+
+	if !e.started {
+		n, err := io.ReadFull(e.r, e.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		e.n, e.started = n, true
+	}
+
+	last := e.n < streamChunkSize
+	var m int
+	if !last {
+		var err error
+		m, err = io.ReadFull(e.r, e.next)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last = m == 0
+	}
+
+	e.sealed = e.key.seal(append(e.sealed[:0], 0, 0, 0, 0), e.index, last, e.buf[:e.n])
+	binary.BigEndian.PutUint32(e.sealed, uint32(len(e.sealed)-4))
+	e.out = e.sealed
+
+	e.index++
+	e.done = last
+	e.buf, e.next, e.n = e.next, e.buf, m
+	return nil
+}
+
+// DecryptReader returns a reader producing the plaintext of the stream
+// read from r, written by EncryptStream or EncryptReader. the header is
+// read and the key derived before it returns. like DecryptStream, data read
+// before an error must be discarded.
+func DecryptReader(r io.Reader, passphrase []byte) (io.Reader, error) {
+
+	header, chunkSize, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newStreamKey(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamDecrypter{
+		r:      r,
+		key:    key,
+		cipher: key.cipher,
+		buf:    make([]byte, chunkSize+key.aead.Overhead()),
+	}, nil
+}
+
+// reads and checks the whole header of a stream from r, returning it and
+// the chunk size
+func readStreamHeader(r io.Reader) ([]byte, int, error) {
+
+	header := make([]byte, streamHeaderSize, streamHeaderLen(streamVersionKDF))
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, ErrTruncated
+		}
+		return nil, 0, err
+	}
+
+	chunkSize, err := parseStreamHeader(header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header = header[:streamHeaderLen(header[len(streamMagic)])]
+	if _, err := io.ReadFull(r, header[streamHeaderSize:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, ErrTruncated
+		}
+		return nil, 0, err
+	}
+	if _, _, err := streamParams(header); err != nil {
+		return nil, 0, err
+	}
+
+	return header, chunkSize, nil
+}
+
+type streamDecrypter struct {
+	r      io.Reader
+	key    *streamKey
+	cipher CipherID
+	index  uint64
+
+	buf   []byte
+	plain []byte
+	out   []byte
+	done  bool
+	err   error
+}
+
+func (d *streamDecrypter) Read(p []byte) (int, error) {
+
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.open()
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// reads and opens the next chunk into out
+func (d *streamDecrypter) open() error {
+
+	var length [4]byte
+	if _, err := io.ReadFull(d.r, length[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+
+	n := binary.BigEndian.Uint32(length[:])
+	if n < uint32(d.key.aead.Overhead()) || n > uint32(len(d.buf)) {
+		return malformed("invalid chunk length")
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+
+	var last bool
+	var err error
+	d.plain, last, err = d.key.open(d.index, d.buf[:n], d.plain[:0])
+	if err != nil {
+		return err
+	}
+	if last {
+		// nothing may follow the last chunk
+		var extra [1]byte
+		if m, _ := io.ReadFull(d.r, extra[:]); m > 0 {
+			return malformed("data after the last chunk")
+		}
+		d.done = true
+	}
+
+	d.index++
+	d.out = d.plain
+	return nil
+}
+
+// reports whether file starts like an encrypted stream
+func isStream(file []byte) bool {
+	return bytes.HasPrefix(file, []byte(streamMagic))
+}
+
+// decrypts a whole stream held in memory, streams store no extension
+func openStream(file, passphrase []byte) (*plainFile, error) {
+
+	dr, err := DecryptReader(bytes.NewReader(file), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(dr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := dr.(*streamDecrypter)
+	return &plainFile{
+		data:    data,
+		salt:    file[len(streamMagic)+1 : len(streamMagic)+33],
+		kdf:     d.key.kdf,
+		cipher:  cipherName(d.cipher),
+		aead:    d.key.aead,
+		trailer: true,
+	}, nil
+}
+
+// checks the magic and version of the fields every stream header starts
+// with and returns its chunk size. version 3 headers continue with
+// streamParams.
+func parseStreamHeader(header []byte) (int, error) {
+
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return 0, ErrNotEncrypted
+	}
+	if v := header[len(streamMagic)]; v != streamVersion && v != streamVersionX && v != streamVersionKDF {
+		return 0, fmt.Errorf("%w %d of stream", ErrUnsupportedVersion, v)
+	}
+
+	chunkSize := binary.BigEndian.Uint32(header[len(streamMagic)+33:])
+	if chunkSize == 0 || chunkSize > maxStreamChunkSize {
+		return 0, malformed("invalid chunk size")
+	}
+
+	return int(chunkSize), nil
+}
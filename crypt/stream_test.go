@@ -0,0 +1,331 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+
+	// empty, shorter than a chunk, exactly one chunk and several chunks
+	for _, size := range []int{0, 100, streamChunkSize, 3*streamChunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		var encrypted bytes.Buffer
+		if err := EncryptStream(bytes.NewReader(plain), &encrypted, passphrase); err != nil {
+			t.Fatalf("EncryptStream %d bytes: %v", size, err)
+		}
+
+		var decrypted bytes.Buffer
+		if err := DecryptStream(&encrypted, &decrypted, passphrase); err != nil {
+			t.Fatalf("DecryptStream %d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(decrypted.Bytes(), plain) {
+			t.Fatalf("round trip of %d bytes returned different contents", size)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+
+	plain := make([]byte, 2*streamChunkSize+5)
+	rand.Read(plain)
+
+	var encrypted bytes.Buffer
+	if err := EncryptStream(bytes.NewReader(plain), &encrypted, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	stream := encrypted.Bytes()
+	head := streamHeaderLen(streamVersionKDF)
+	chunk := 4 + streamChunkSize + 16
+
+	if err := DecryptStream(bytes.NewReader(stream), ioutil.Discard, []byte("wrong")); err == nil {
+		t.Fatalf("expected an error with a wrong passphrase")
+	}
+
+	// dropping the last chunk, or cutting inside of it
+	for _, cut := range []int{head + 2*chunk, len(stream) - 1, head - 1} {
+		if err := DecryptStream(bytes.NewReader(stream[:cut]), ioutil.Discard, passphrase); err != ErrTruncated {
+			t.Fatalf("cut at %d: expected ErrTruncated, got %v", cut, err)
+		}
+	}
+
+	// swapping the first two chunks
+	swapped := append([]byte(nil), stream...)
+	first := stream[head : head+chunk]
+	second := stream[head+chunk : head+2*chunk]
+	copy(swapped[head:], second)
+	copy(swapped[head+chunk:], first)
+	if err := DecryptStream(bytes.NewReader(swapped), ioutil.Discard, passphrase); err == nil {
+		t.Fatalf("expected an error for reordered chunks")
+	}
+
+	// trailing data after the last chunk
+	extra := append(append([]byte(nil), stream...), 0)
+	if err := DecryptStream(bytes.NewReader(extra), ioutil.Discard, passphrase); err == nil {
+		t.Fatalf("expected an error for data after the last chunk")
+	}
+
+	if err := EncryptStream(bytes.NewReader(plain), ioutil.Discard, nil); err == nil {
+		t.Fatalf("expected an error without a passphrase")
+	}
+}
+
+func TestStreamXChaCha20Poly1305(t *testing.T) {
+
+	plain := make([]byte, 2*streamChunkSize+5)
+	rand.Read(plain)
+
+	var encrypted bytes.Buffer
+	opts := Options{Cipher: XChaCha20Poly1305}
+	if err := EncryptStreamWithOptions(bytes.NewReader(plain), &encrypted, passphrase, opts); err != nil {
+		t.Fatalf("EncryptStreamWithOptions: %v", err)
+	}
+	stream := encrypted.Bytes()
+	if v := stream[len(streamMagic)]; v != streamVersionKDF {
+		t.Fatalf("expected stream version %d, got %d", streamVersionKDF, v)
+	}
+	if id := CipherID(stream[streamHeaderSize]); id != XChaCha20Poly1305 {
+		t.Fatalf("expected the xchacha20-poly1305 cipher in the header, got %d", id)
+	}
+	head := streamHeaderLen(streamVersionKDF)
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(bytes.NewReader(stream), &decrypted, passphrase); err != nil {
+		t.Fatalf("DecryptStream: %v", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plain) {
+		t.Fatalf("round trip returned different contents")
+	}
+
+	decrypted.Reset()
+	if err := DecryptStreamAt(bytes.NewReader(stream), int64(len(stream)), &decrypted, passphrase, 0); err != nil {
+		t.Fatalf("DecryptStreamAt: %v", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plain) {
+		t.Fatalf("DecryptStreamAt returned different contents")
+	}
+
+	// the version is authenticated with every chunk
+	downgraded := append([]byte(nil), stream...)
+	downgraded[len(streamMagic)] = streamVersion
+	if err := DecryptStream(bytes.NewReader(downgraded), ioutil.Discard, passphrase); err == nil {
+		t.Fatalf("expected an error for a changed version")
+	}
+
+	chunk := 4 + streamChunkSize + 16
+	swapped := append([]byte(nil), stream...)
+	copy(swapped[head:], stream[head+chunk:head+2*chunk])
+	copy(swapped[head+chunk:], stream[head:head+chunk])
+	if err := DecryptStream(bytes.NewReader(swapped), ioutil.Discard, passphrase); err == nil {
+		t.Fatalf("expected an error for reordered chunks")
+	}
+	if err := DecryptStream(bytes.NewReader(stream[:head+2*chunk]), ioutil.Discard, passphrase); err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated for a dropped last chunk, got %v", err)
+	}
+
+	if err := conformStream(stream); err != nil {
+		t.Fatalf("conformStream: %v", err)
+	}
+
+	if err := EncryptStreamWithOptions(bytes.NewReader(plain), ioutil.Discard, passphrase, Options{Cipher: AES256GCM}); err == nil {
+		t.Fatalf("expected an error for streams sealed with aes-256-gcm")
+	}
+}
+
+func TestStreamKDF(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-stream")
+	defer os.RemoveAll(dir)
+
+	plain := make([]byte, streamChunkSize+5)
+	rand.Read(plain)
+
+	params := KDFParams{KDF: Argon2id, Time: 1, Memory: 64, Threads: 1}
+	for _, id := range []CipherID{SecretBox, XChaCha20Poly1305} {
+		var encrypted bytes.Buffer
+		opts := Options{Cipher: id, KDF: params}
+		if err := EncryptStreamWithOptions(bytes.NewReader(plain), &encrypted, passphrase, opts); err != nil {
+			t.Fatalf("EncryptStreamWithOptions: %v", err)
+		}
+		stream := encrypted.Bytes()
+
+		filename := filepath.Join(dir, "stream")
+		ioutil.WriteFile(filename, stream, 0644)
+		info, err := ReadFormat(filename)
+		if err != nil {
+			t.Fatalf("ReadFormat: %v", err)
+		}
+		if info.KDF != params || info.Cipher != cipherName(id) {
+			t.Fatalf("expected %s with %+v in the header, got %+v", cipherName(id), params, info)
+		}
+
+		var decrypted bytes.Buffer
+		if err := DecryptStream(bytes.NewReader(stream), &decrypted, passphrase); err != nil {
+			t.Fatalf("DecryptStream: %v", err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), plain) {
+			t.Fatalf("round trip returned different contents")
+		}
+
+		// the recorded costs are part of the key
+		changed := append([]byte(nil), stream...)
+		changed[streamHeaderSize+5] ^= 2
+		if err := DecryptStream(bytes.NewReader(changed), ioutil.Discard, passphrase); err == nil {
+			t.Fatalf("expected an error for changed costs")
+		}
+
+		// forged costs are refused before deriving anything
+		changed = append([]byte(nil), stream...)
+		changed[streamHeaderSize+6] = 0xff
+		if err := DecryptStream(bytes.NewReader(changed), ioutil.Discard, passphrase); !errors.Is(err, ErrMalformed) {
+			t.Fatalf("expected ErrMalformed for a forged memory cost, got %v", err)
+		}
+	}
+
+	if err := EncryptStreamWithOptions(bytes.NewReader(plain), ioutil.Discard, passphrase, Options{KDF: KDFParams{KDF: RawKey}}); err == nil {
+		t.Fatalf("expected an error for a stream without a key derivation")
+	}
+
+	// version 2 streams still derive their key with the legacy parameters
+	header := append([]byte(streamMagic), streamVersionX)
+	header = append(header, make([]byte, 32)...)
+	header = append(header, 0, 1, 0, 0)
+	header = append(header, make([]byte, streamNoncePrefix)...)
+	key, err := newStreamKey(header, passphrase)
+	if err != nil {
+		t.Fatalf("newStreamKey: %v", err)
+	}
+	if key.kdf != legacyKDFParams || key.cipher != XChaCha20Poly1305 {
+		t.Fatalf("unexpected version 2 key %s %+v", cipherName(key.cipher), key.kdf)
+	}
+	e := newStreamEncrypter(bytes.NewReader(plain), key, 0)
+	e.out = header
+	legacy, _ := ioutil.ReadAll(e)
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(bytes.NewReader(legacy), &decrypted, passphrase); err != nil {
+		t.Fatalf("DecryptStream of a version 2 stream: %v", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plain) {
+		t.Fatalf("version 2 round trip returned different contents")
+	}
+}
+
+func TestReadFormatStream(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-stream")
+	defer os.RemoveAll(dir)
+
+	var encrypted bytes.Buffer
+	if err := EncryptStream(bytes.NewReader([]byte(data)), &encrypted, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+
+	filename := filepath.Join(dir, "stream")
+	ioutil.WriteFile(filename, encrypted.Bytes(), 0644)
+
+	info, err := ReadFormat(filename)
+	if err != nil {
+		t.Fatalf("ReadFormat: %v", err)
+	}
+	if info.Version != formatStream || info.ChunkSize != streamChunkSize {
+		t.Fatalf("unexpected format %+v", info)
+	}
+}
+
+func TestStreamReaders(t *testing.T) {
+
+	plain := make([]byte, 2*streamChunkSize+333)
+	rand.Read(plain)
+
+	er, err := EncryptReader(bytes.NewReader(plain), passphrase)
+	if err != nil {
+		t.Fatalf("EncryptReader: %v", err)
+	}
+
+	// tiny reads on both ends must not change the result
+	encrypted, err := ioutil.ReadAll(iotest.OneByteReader(er))
+	if err != nil {
+		t.Fatalf("reading EncryptReader: %v", err)
+	}
+
+	var streamed bytes.Buffer
+	if err := DecryptStream(bytes.NewReader(encrypted), &streamed, passphrase); err != nil {
+		t.Fatalf("DecryptStream: %v", err)
+	}
+	if !bytes.Equal(streamed.Bytes(), plain) {
+		t.Fatalf("DecryptStream of EncryptReader output returned different contents")
+	}
+
+	dr, err := DecryptReader(iotest.HalfReader(bytes.NewReader(encrypted)), passphrase)
+	if err != nil {
+		t.Fatalf("DecryptReader: %v", err)
+	}
+	decrypted, err := ioutil.ReadAll(iotest.OneByteReader(dr))
+	if err != nil {
+		t.Fatalf("reading DecryptReader: %v", err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatalf("DecryptReader returned different contents")
+	}
+
+	// errors of the source are returned to the reader
+	failing := io.MultiReader(bytes.NewReader(plain[:100]), iotest.ErrReader(errors.New("connection reset")))
+	er, _ = EncryptReader(failing, passphrase)
+	if _, err := ioutil.ReadAll(er); err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected the source error, got %v", err)
+	}
+
+	if _, err := DecryptReader(bytes.NewReader(encrypted[:10]), passphrase); err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated for a short header, got %v", err)
+	}
+}
+
+func TestPlaintextStream(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-stream")
+	defer os.RemoveAll(dir)
+
+	var encrypted bytes.Buffer
+	if err := EncryptStream(bytes.NewReader([]byte(data)), &encrypted, passphrase); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+
+	filename := filepath.Join(dir, "stream")
+	ioutil.WriteFile(filename, encrypted.Bytes(), 0644)
+
+	if ok, _ := IsEncrypted(filename); !ok {
+		t.Fatalf("IsEncrypted didn't recognise a stream")
+	}
+
+	plain, err := Plaintext(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Plaintext: %v", err)
+	}
+	if string(plain) != data {
+		t.Fatalf("Plaintext of a stream returned different contents")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrWeakPassphrase is returned by PassphrasePolicy.Check for passphrases
+// the policy refuses, errors wrapping it say why.
+var ErrWeakPassphrase = errors.New("passphrase is too weak")
+
+// Strength is how hard a passphrase is estimated to guess.
+type Strength struct {
+	// log2 of the guesses an attacker trying common passwords, words,
+	// keyboard patterns, sequences, repeats and years before brute force
+	// would need
+	Entropy float64
+
+	// 0 to 4 like zxcvbn: fewer than 10^3, 10^6, 10^8 and 10^10 guesses
+	// score 0 to 3, more score 4
+	Score int
+
+	// why the passphrase is easier to guess than its length suggests,
+	// such as "a common password"
+	Warnings []string
+}
+
+// a pattern found in a passphrase, covering runes i to j included
+type strengthMatch struct {
+	i, j    int
+	guesses float64
+	warning string
+}
+
+// EstimateStrength estimates how many guesses finding passphrase takes,
+// in the manner of zxcvbn: the passphrase is split into the common
+// passwords, words, keyboard rows, sequences, repeats and years it holds
+// and the characters left over are brute forced, picking the split that
+// is cheapest for the attacker. userWords, such as the name of the
+// project or company, are tried first.
+func EstimateStrength(passphrase []byte, userWords ...string) Strength {
+
+	runes := []rune(string(passphrase))
+	if len(runes) == 0 {
+		return Strength{Warnings: []string{"empty"}}
+	}
+
+	var matches []strengthMatch
+	matches = append(matches, dictionaryMatches(runes, userWords)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	// the cheapest guesses of the first k runes and the match ending the
+	// split reaching it, nil for a brute forced rune
+	bruteforce := math.Log2(cardinality(runes))
+	cost := make([]float64, len(runes)+1)
+	last := make([]*strengthMatch, len(runes)+1)
+	for k := 1; k <= len(runes); k++ {
+		cost[k] = cost[k-1] + bruteforce
+		last[k] = nil
+		for m := range matches {
+			if matches[m].j != k-1 {
+				continue
+			}
+			if c := cost[matches[m].i] + math.Log2(matches[m].guesses); c < cost[k] {
+				cost[k] = c
+				last[k] = &matches[m]
+			}
+		}
+	}
+
+	s := Strength{Entropy: cost[len(runes)]}
+	seen := make(map[string]bool)
+	for k := len(runes); k > 0; {
+		m := last[k]
+		if m == nil {
+			k--
+			continue
+		}
+		if !seen[m.warning] {
+			seen[m.warning] = true
+			s.Warnings = append([]string{m.warning}, s.Warnings...)
+		}
+		k = m.i
+	}
+	if len(runes) < 8 {
+		s.Warnings = append(s.Warnings, "fewer than 8 characters")
+	}
+
+	for _, bits := range []float64{3, 6, 8, 10} {
+		if s.Entropy < bits*math.Log2(10) {
+			break
+		}
+		s.Score++
+	}
+	return s
+}
+
+// the number of characters a brute force attack tries per rune, from the
+// character classes in runes
+func cardinality(runes []rune) float64 {
+
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0.0
+	for _, class := range []struct {
+		present bool
+		size    float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			n += class.size
+		}
+	}
+	return n
+}
+
+// common substitutions of letters by digits and symbols
+var leet = map[rune]rune{'4': 'a', '@': 'a', '8': 'b', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '0': 'o', '5': 's', '$': 's', '7': 't', '+': 't', '2': 'z'}
+
+// rank of each word of the lists, and whether it is a password, built on
+// first use
+var (
+	dictionaryOnce sync.Once
+	dictionary     map[string]dictionaryWord
+)
+
+type dictionaryWord struct {
+	rank    int
+	warning string
+}
+
+func loadDictionary() {
+	dictionary = make(map[string]dictionaryWord)
+	for _, list := range []struct{ words, warning string }{
+		{commonPasswords, "a common password"},
+		{commonWords, "a common word"},
+	} {
+		for _, w := range strings.Fields(list.words) {
+			if _, ok := dictionary[w]; !ok {
+				dictionary[w] = dictionaryWord{len(dictionary) + 1, list.warning}
+			}
+		}
+	}
+}
+
+// words and passwords of the lists, and userWords ranked ahead of them,
+// found in runes, reversed, capitalized or with leet substitutions
+func dictionaryMatches(runes []rune, userWords []string) []strengthMatch {
+
+	dictionaryOnce.Do(loadDictionary)
+	lookup := func(word string) (dictionaryWord, bool) {
+		for i, w := range userWords {
+			if strings.ToLower(w) == word {
+				return dictionaryWord{i + 1, "a word specific to you or the project"}, true
+			}
+		}
+		w, ok := dictionary[word]
+		w.rank += len(userWords)
+		return w, ok
+	}
+
+	var matches []strengthMatch
+	for i := range runes {
+		for j := i + 2; j < len(runes) && j < i+32; j++ {
+			word := runes[i : j+1]
+			lower := strings.ToLower(string(word))
+
+			// capitalized or all upper case, or upper case letters
+			// anywhere
+			variations := 1.0
+			if lower != string(word) {
+				variations = 2
+				if strings.ToUpper(string(word)) != string(word) && !unicode.IsUpper(word[0]) {
+					variations = float64(len(word))
+				}
+			}
+
+			subs := 0
+			unleeted := []rune(lower)
+			for k, r := range unleeted {
+				if l, ok := leet[r]; ok {
+					unleeted[k] = l
+					subs++
+				}
+			}
+
+			candidates := []string{lower, reverse(lower), string(unleeted)}
+			factors := []float64{1, 2, 2 * float64(subs)}
+			for k, c := range candidates {
+				if w, ok := lookup(c); ok && factors[k] > 0 {
+					matches = append(matches, strengthMatch{i, j, float64(w.rank) * variations * factors[k], w.warning})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// runs of one character, or of a few characters, repeated at least twice
+func repeatMatches(runes []rune) []strengthMatch {
+
+	var matches []strengthMatch
+	for i := range runes {
+		for size := 1; size <= 8 && i+2*size <= len(runes); size++ {
+			unit := string(runes[i : i+size])
+			j := i + size
+			for j+size <= len(runes) && string(runes[j:j+size]) == unit {
+				j += size
+			}
+			if count := (j - i) / size; count >= 2 && j-i >= 3 {
+				base := math.Pow(cardinality(runes[i:i+size]), float64(size))
+				matches = append(matches, strengthMatch{i, j - 1, base * float64(count), "repeated characters"})
+			}
+		}
+	}
+	return matches
+}
+
+// rows of the keyboard and the alphabet, walked one way or the other
+var sequences = []string{"abcdefghijklmnopqrstuvwxyz", "0123456789", "qwertyuiop", "asdfghjkl", "zxcvbnm", "1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p", "qazwsxedcrfvtgbyhnujmikolp"}
+
+// runs of at least three characters following one of the sequences
+func sequenceMatches(runes []rune) []strengthMatch {
+
+	lower := []rune(strings.ToLower(string(runes)))
+	var matches []strengthMatch
+	for _, seq := range sequences {
+		warning := "a sequence"
+		if seq != sequences[0] && seq != sequences[1] {
+			warning = "a keyboard pattern"
+		}
+		for _, s := range []string{seq, reverse(seq)} {
+			for i := range lower {
+				j := i
+				for j+1 < len(lower) {
+					a := strings.IndexRune(s, lower[j])
+					if a < 0 || a+1 >= len(s) || rune(s[a+1]) != lower[j+1] {
+						break
+					}
+					j++
+				}
+				if j-i >= 2 {
+					// the sequence, its start and direction
+					guesses := float64(len(sequences)) * float64(len(seq)) * 2 * float64(j-i+1)
+					matches = append(matches, strengthMatch{i, j, guesses, warning})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// years from 1900 to 2099
+func yearMatches(runes []rune) []strengthMatch {
+
+	var matches []strengthMatch
+	for i := 0; i+4 <= len(runes); i++ {
+		y := string(runes[i : i+4])
+		if (strings.HasPrefix(y, "19") || strings.HasPrefix(y, "20")) && strings.Trim(y, "0123456789") == "" {
+			matches = append(matches, strengthMatch{i, i + 3, 200, "a year"})
+		}
+	}
+	return matches
+}
+
+// PassphrasePolicy is what makes a passphrase chosen by a user strong
+// enough to encrypt with.
+type PassphrasePolicy struct {
+	// least Strength.Entropy accepted, in bits
+	MinEntropy float64
+
+	// passphrases refused whatever their strength, compared without
+	// case, such as leaked or formerly used ones. they also count as
+	// words when estimating the strength of others.
+	Deny []string
+}
+
+// DefaultPassphrasePolicy asks for about 40 bits, such as four common
+// words or ten random letters and digits.
+var DefaultPassphrasePolicy = PassphrasePolicy{MinEntropy: 40}
+
+// Check returns an error wrapping ErrWeakPassphrase when the policy
+// refuses passphrase, saying why.
+func (p PassphrasePolicy) Check(passphrase []byte) error {
+
+	for _, denied := range p.Deny {
+		if strings.EqualFold(denied, string(passphrase)) {
+			return fmt.Errorf("%w: it is on the deny list", ErrWeakPassphrase)
+		}
+	}
+
+	s := EstimateStrength(passphrase, p.Deny...)
+	if s.Entropy >= p.MinEntropy {
+		return nil
+	}
+	reason := fmt.Sprintf("about %.0f bits of entropy, at least %.0f are required", s.Entropy, p.MinEntropy)
+	if len(s.Warnings) > 0 {
+		reason += ", it has " + strings.Join(s.Warnings, ", ")
+	}
+	return fmt.Errorf("%w: %s", ErrWeakPassphrase, reason)
+}
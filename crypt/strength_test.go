@@ -0,0 +1,61 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEstimateStrength(t *testing.T) {
+
+	weak := []string{"a", "password", "P@ssw0rd", "qwertyuiop", "aaaaaaaaaaaa", "abcdef123456", "drowssap", "iloveyou2019", "monkey", "Dragon1"}
+	for _, p := range weak {
+		if s := EstimateStrength([]byte(p)); s.Score > 1 || len(s.Warnings) == 0 {
+			t.Errorf("%q: expected a weak passphrase with warnings, got %+v", p, s)
+		}
+	}
+
+	strong := []string{"correct horse battery staple", "xK9#mQ2$vL7pR4nZ", "tqmbvzrkhpwdxnlg"}
+	for _, p := range strong {
+		if s := EstimateStrength([]byte(p)); s.Score < 4 || s.Entropy < DefaultPassphrasePolicy.MinEntropy {
+			t.Errorf("%q: expected a strong passphrase, got %+v", p, s)
+		}
+	}
+
+	if s := EstimateStrength([]byte("acmecorp2024"), "acmecorp"); s.Entropy > 20 {
+		t.Errorf("expected user words to weaken a passphrase, got %+v", s)
+	}
+	if s := EstimateStrength(nil); s.Entropy != 0 || s.Score != 0 {
+		t.Errorf("expected an empty passphrase to score 0, got %+v", s)
+	}
+}
+
+func TestPassphrasePolicy(t *testing.T) {
+
+	if err := DefaultPassphrasePolicy.Check([]byte("x")); !errors.Is(err, ErrWeakPassphrase) {
+		t.Fatalf("expected ErrWeakPassphrase, got %v", err)
+	}
+	if err := DefaultPassphrasePolicy.Check([]byte("correct horse battery staple")); err != nil {
+		t.Fatalf("expected a strong passphrase accepted, got %v", err)
+	}
+
+	policy := PassphrasePolicy{Deny: []string{"Correct Horse Battery Staple"}}
+	if err := policy.Check([]byte("correct horse battery staple")); !errors.Is(err, ErrWeakPassphrase) {
+		t.Fatalf("expected a denied passphrase refused, got %v", err)
+	}
+	if err := (PassphrasePolicy{}).Check([]byte("x")); err != nil {
+		t.Fatalf("expected an empty policy to accept anything, got %v", err)
+	}
+}
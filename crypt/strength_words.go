@@ -0,0 +1,77 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+// the most common passwords of public leak corpora, most common first
+const commonPasswords = `
+123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon
+123123 baseball abc123 football monkey letmein 696969 shadow master 666666
+qwertyuiop 123321 mustang 1234567890 michael 654321 superman 1qaz2wsx 7777777
+121212 000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm asdfgh
+hunter buster soccer harley batman andrew tigger sunshine iloveyou 2000
+charlie robert thomas hockey ranger daniel starwars klaster 112233 george
+computer michelle jessica pepper 1111 zxcvbn 555555 11111111 131313 freedom
+777777 pass maggie 159753 aaaaaa ginger princess joshua cheese amanda summer
+love ashley nicole chelsea biteme matthew access yankees 987654321 dallas
+austin thunder taylor matrix welcome admin secret passw0rd login hello
+whatever qwerty123 password1 password123 welcome1 admin123 root toor letmein1
+changeme default guest test test123 temp temp123 p@ssw0rd p@ssword qwe123
+1q2w3e4r 1q2w3e 1q2w3e4r5t zaq12wsx q1w2e3r4 abcd1234 abcdef abc 123abc
+monkey123 dragon123 football1 baseball1 iloveyou1 princess1 sunshine1 shadow1
+master1 michael1 superman1 batman1 charlie1 secret1 hello123 loveme lovely
+flower hottie angel angels babygirl butterfly purple forever family friends
+friend jesus christ blessed god money mother father samsung apple google
+facebook linkedin twitter yahoo microsoft windows linux ubuntu oracle cisco
+internet server database backup security cloak encrypt encrypted crypto bitcoin
+spring autumn winter january february march april june july august september
+october november december monday tuesday wednesday thursday friday saturday sunday
+`
+
+// common English words, most common first
+const commonWords = `
+the and for that with you this but his from they say her she will one all
+would there their what out about who get which when make can like time just
+him know take people into year your good some could them see other than then
+now look only come its over think also back after use two how our work first
+well way even new want because any these give day most us man find here thing
+many tell very through long little down great old call world high school
+house still hand life place home point keep small large number under never
+same another while last might next name word life light night water fire
+earth wind air stone tree wood river lake ocean sea sky sun moon star cloud
+rain snow storm ice green blue red black white yellow orange brown gray gold
+silver iron steel glass paper book page letter door window wall floor room
+table chair bed kitchen garden street road bridge city town country state
+horse battery staple correct dog cat bird fish bear wolf lion tiger eagle
+mouse rabbit snake dragon horse cow pig sheep goat duck chicken apple banana
+orange lemon cherry grape berry bread butter cheese milk coffee tea sugar salt
+pepper rice pasta pizza music song dance game play team ball goal score king
+queen prince princess knight castle tower magic power energy force space
+planet rocket ship boat train plane car truck bike wheel engine machine robot
+computer phone code data key lock secret hidden shadow ghost spirit soul heart
+mind body head face eye ear nose mouth hair hand finger foot leg arm blood
+bone skin love hate hope fear peace war battle fight friend enemy hero
+legend story dream sleep wake open close start stop begin end left right up
+down north south east west happy sad angry calm quiet loud fast slow hot
+cold warm cool dark bright strong weak hard soft big small tall short young
+old rich poor free safe true false real simple easy clean dirty sweet sour
+bitter fresh early late summer winter spring autumn morning evening today
+tomorrow yesterday always sometimes never maybe please thank sorry yes no
+super mega ultra alpha beta gamma delta omega zero one two three four five
+six seven eight nine ten hundred thousand million first second third
+purple silver golden crystal diamond ruby pearl jade coral amber copper
+admin user root master guest test demo sample example password pass word
+letme login logon access enter system network server cloud backup office
+company project team work job money bank cash card credit account email
+mail phone mobile home family mother father brother sister baby child
+`
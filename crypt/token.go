@@ -0,0 +1,188 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// a token wrapped key is the challenge (32 bytes) + nonce (24 bytes) +
+// the file key sealed with xchacha20-poly1305, keyed by the secret the
+// token derives from the challenge
+const (
+	tokenChallengeSize = 32
+	tokenInfo          = "cloak token file key"
+
+	// an HMAC-SHA1 challenge-response gives the shortest secret
+	tokenMinSecretSize = 20
+)
+
+// ErrTokenMismatch is returned when a token derives another key than the
+// one the file key was wrapped with, such as when another token is used.
+var ErrTokenMismatch = errors.New("the token doesn't unwrap the file key, was it encrypted with another token?")
+
+// TokenProvider is a hardware token deriving secrets from challenges with
+// a key that never leaves it, such as a FIDO2 key with the hmac-secret
+// extension or the HMAC-SHA1 challenge-response slot of a YubiKey. tokens
+// set up to require a touch make every encryption and decryption need one.
+// TokenKey turns it into a KeyProvider.
+type TokenProvider interface {
+	// Name identifies the token and its credential or slot, it's
+	// recorded in the file header to find the stanza when decrypting.
+	Name() string
+
+	// Derive returns the secret of the token for challenge, which must
+	// be the same every time for the same challenge. it may wait for the
+	// token to be touched, ctx bounds the wait.
+	Derive(ctx context.Context, challenge []byte) ([]byte, error)
+}
+
+// TokenKey returns a KeyProvider wrapping file keys with a key t derives
+// from a random challenge, stored next to the wrapped key, so a file
+// encrypted with EncryptWithKeyProvider can only be decrypted with the
+// token at hand. its name is token: followed by the name of t.
+func TokenKey(t TokenProvider) KeyProvider {
+	return &tokenKey{token: t}
+}
+
+type tokenKey struct {
+	token TokenProvider
+}
+
+func (k *tokenKey) Name() string {
+	return "token:" + k.token.Name()
+}
+
+func (k *tokenKey) WrapKey(ctx context.Context, fileKey []byte) ([]byte, error) {
+
+	challenge, err := random(tokenChallengeSize)
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.derive(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := random(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(append(challenge, nonce...), nonce, fileKey, []byte(k.Name())), nil
+}
+
+func (k *tokenKey) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+
+	if len(wrapped) < tokenChallengeSize+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, malformed("token wrapped key")
+	}
+	challenge := wrapped[:tokenChallengeSize]
+	key, err := k.derive(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := wrapped[tokenChallengeSize:]
+	fileKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(k.Name()))
+	if err != nil {
+		return nil, ErrTokenMismatch
+	}
+	return fileKey, nil
+}
+
+// the wrapping key for challenge, derived from the token's secret
+func (k *tokenKey) derive(ctx context.Context, challenge []byte) ([]byte, error) {
+
+	secret, err := k.token.Derive(ctx, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("token %s: %w", k.token.Name(), err)
+	}
+	defer wipe(secret)
+	if len(secret) < tokenMinSecretSize {
+		return nil, fmt.Errorf("token %s returned a secret of %d bytes, at least %d are required", k.token.Name(), len(secret), tokenMinSecretSize)
+	}
+	return hkdf.Key(sha256.New, secret, challenge, tokenInfo, chacha20poly1305.KeySize)
+}
+
+// CommandToken is a TokenProvider running a program for each challenge,
+// passing the challenge hex encoded as its last argument and reading the
+// hex secret it prints. this is how ykchalresp -2 -x answers with the
+// HMAC-SHA1 challenge-response slot 2 of a YubiKey. a FIDO2 key is used
+// through a small script around fido2-assert -G -h, printing the hmac
+// secret of a credential for the challenge used as its salt.
+type CommandToken struct {
+	// the program and its arguments, such as ykchalresp, -2, -x
+	Command []string
+}
+
+// NewCommandToken returns a CommandToken running command, split into the
+// program and its arguments at spaces.
+func NewCommandToken(command string) (*CommandToken, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("a command answering the token challenges is required")
+	}
+	return &CommandToken{Command: fields}, nil
+}
+
+// Name is the base name of the program followed by its arguments, so
+// tokens answered from other paths on other machines still match.
+func (c *CommandToken) Name() string {
+	return strings.Join(append([]string{filepath.Base(c.Command[0])}, c.Command[1:]...), " ")
+}
+
+// Derive runs the command with challenge, a touch prompt of the token is
+// up to the program.
+func (c *CommandToken) Derive(ctx context.Context, challenge []byte) ([]byte, error) {
+
+	args := append(append([]string(nil), c.Command[1:]...), hex.EncodeToString(challenge))
+	cmd := exec.CommandContext(ctx, c.Command[0], args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	defer wipe(out)
+
+	secret, err := hex.DecodeString(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, errors.New("the token command didn't print a hex secret")
+	}
+	return secret, nil
+}
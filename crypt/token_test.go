@@ -0,0 +1,102 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// a token answering challenges with HMAC-SHA256 of a key it holds
+type fakeToken struct {
+	name    string
+	key     []byte
+	touches int
+}
+
+func (t *fakeToken) Name() string { return t.name }
+
+func (t *fakeToken) Derive(ctx context.Context, challenge []byte) ([]byte, error) {
+	t.touches++
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write(challenge)
+	return mac.Sum(nil), nil
+}
+
+func TestTokenKey(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-token")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "token.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	token := &fakeToken{name: "yubikey", key: []byte("slot 2")}
+	res, err := EncryptWithKeyProvider(filename, TokenKey(token), Options{})
+	if err != nil {
+		t.Fatalf("EncryptWithKeyProvider: %v", err)
+	}
+	if token.touches != 1 {
+		t.Fatalf("expected one touch to encrypt, got %d", token.touches)
+	}
+
+	plain, err := PlaintextWithKeyProvider(res.Output, TokenKey(token))
+	if err != nil || string(plain) != data {
+		t.Fatalf("PlaintextWithKeyProvider: %v", err)
+	}
+	if token.touches != 2 {
+		t.Fatalf("expected one touch to decrypt, got %d", token.touches)
+	}
+
+	other := &fakeToken{name: "yubikey", key: []byte("another key")}
+	if _, err := PlaintextWithKeyProvider(res.Output, TokenKey(other)); err == nil {
+		t.Fatalf("expected another token to fail")
+	}
+	renamed := &fakeToken{name: "fido2", key: token.key}
+	if _, err := PlaintextWithKeyProvider(res.Output, TokenKey(renamed)); err == nil {
+		t.Fatalf("expected a token with another name to fail")
+	}
+}
+
+func TestCommandToken(t *testing.T) {
+
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("no echo command")
+	}
+
+	// echo answers with the challenge itself, which is enough to check
+	// how the command is run
+	token, err := NewCommandToken("echo")
+	if err != nil {
+		t.Fatalf("NewCommandToken: %v", err)
+	}
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+	secret, err := token.Derive(context.Background(), challenge)
+	if err != nil || string(secret) != string(challenge) {
+		t.Fatalf("Derive: %q, %v", secret, err)
+	}
+
+	if _, err := NewCommandToken(" "); err == nil {
+		t.Fatalf("expected an error without a command")
+	}
+	if token, _ := NewCommandToken("/usr/bin/ykchalresp -2 -x"); token.Name() != "ykchalresp -2 -x" {
+		t.Fatalf("unexpected name %q", token.Name())
+	}
+}
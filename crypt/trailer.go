@@ -0,0 +1,91 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// ErrTruncated is returned when an encrypted file is shorter than it was
+// when written, e.g. after a failed copy.
+var ErrTruncated error = corruption("encrypted file is truncated")
+
+// the trailer is the last line of an encrypted file:
+// first 8 bytes = big endian length of everything before the trailer line
+// rest = nonce + sealed sha256 of everything before the trailer line
+//
+// the length is readable without the passphrase so truncation is reported
+// before key derivation, the sealed hash authenticates the whole file.
+func sealTrailer(aead cipher.AEAD, body []byte) (string, error) {
+
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(body)))
+
+	sum := sha256.Sum256(body)
+	nonce, err := random(aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, sum[:], nil)
+
+	return hex.EncodeToString(append(length[:], sealed...)), nil
+}
+
+// checks the length recorded in the trailer against the file body
+func checkTrailerLength(body []byte, trailer string) error {
+
+	decoded, err := hex.DecodeString(trailer)
+	if err != nil || len(decoded) < 8 {
+		return ErrTruncated
+	}
+
+	if binary.BigEndian.Uint64(decoded[:8]) != uint64(len(body)) {
+		return ErrTruncated
+	}
+
+	return nil
+}
+
+// authenticates the file body against the sealed hash in the trailer
+func openTrailer(aead cipher.AEAD, body []byte, trailer string) error {
+
+	err := checkTrailerLength(body, trailer)
+	if err != nil {
+		return err
+	}
+
+	decoded, _ := hex.DecodeString(trailer)
+	nonceSize := aead.NonceSize()
+
+	// the trailer itself was cut short
+	if len(decoded) != 8+nonceSize+sha256.Size+aead.Overhead() {
+		return ErrTruncated
+	}
+
+	sum, err := aead.Open(nil, decoded[8:8+nonceSize], decoded[8+nonceSize:], nil)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+
+	expected := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare(sum, expected[:]) != 1 {
+		return corrupt("encrypted file was modified")
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenTruncated(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-trailer")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "trailer.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+
+	if _, err := open(file, passphrase); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	// cut inside the data, the salt, the checksum and the trailer lines.
+	// a cut extension can look like a complete legacy file, so it is
+	// left out
+	cuts := []int{10, len(file) - 1}
+	offset := 0
+	for i, line := range strings.Split(string(file), "\n") {
+		if i != 2 {
+			cuts = append(cuts, offset+len(line)/2)
+		}
+		offset += len(line) + 1
+	}
+	for _, cut := range cuts {
+		if _, err := open(file[:cut], passphrase); err != ErrTruncated {
+			t.Fatalf("open truncated at %d of %d: expected ErrTruncated, got %v", cut, len(file), err)
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-trailer")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "trailer.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	file, _ := ioutil.ReadFile(res.Output)
+
+	// flip a nibble of the salt and extension lines, same length so not
+	// a truncation
+	lines := strings.Split(string(file), "\n")
+	saltStart := len(lines[0]) + 1
+	extStart := saltStart + len(lines[1]) + 1
+	for _, i := range []int{saltStart, extStart} {
+		tampered := append([]byte(nil), file...)
+		if tampered[i] == '0' {
+			tampered[i] = '1'
+		} else {
+			tampered[i] = '0'
+		}
+
+		_, err = open(tampered, passphrase)
+		if err == nil || err == ErrTruncated {
+			t.Fatalf("tampered byte %d: expected a tampering error, got %v", i, err)
+		}
+	}
+}
+
+func TestDecryptStripped(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-trailer")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "trailer.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := EncryptWithOptions(filename, passphrase, Options{Armor: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+
+	// without the checksum and trailer lines nothing seals the extension
+	file, _ := ioutil.ReadFile(res.Output)
+	lines := strings.Split(string(file), "\n")
+	lines[2] = hex.EncodeToString([]byte(".sh"))
+	stripped := filepath.Join(dir, "stripped")
+	ioutil.WriteFile(stripped, []byte(strings.Join(lines[:3], "\n")), 0644)
+
+	out := filepath.Join(dir, "out")
+	_, err = DecryptWithOptions(stripped, passphrase, Options{OutputPath: out})
+	if !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("expected ErrLegacyFormat, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("stripped file was decrypted")
+	}
+	if _, err := RekeyWithOptions(stripped, passphrase, passphrase, Options{}); !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("expected ErrLegacyFormat from rekey, got %v", err)
+	}
+
+	if _, err := DecryptWithOptions(stripped, passphrase, Options{AllowLegacy: true, OutputPath: out}); err != nil {
+		t.Fatalf("decrypt with AllowLegacy: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy is how symbolic links met while walking a directory tree
+// are handled.
+type SymlinkPolicy int
+
+const (
+	// links are archived as links, restored pointing where they pointed
+	PreserveSymlinks SymlinkPolicy = iota
+	// links are left out, so nothing outside the tree is reached through
+	// them
+	SkipSymlinks
+	// what links point to is taken as if it were in the tree, the
+	// directories they point to included. a link to a directory it is in
+	// is an error, as is a link pointing nowhere
+	FollowSymlinks
+)
+
+// an entry of a tree selected by walkTree
+type treeEntry struct {
+	rel  string
+	path string
+	fi   os.FileInfo
+}
+
+// walks the tree under dir in lexical order and calls fn with each entry
+// selected by opts.Include, opts.Exclude, opts.NoDotfiles and
+// opts.Symlinks, but not dir itself. rel is the slash separated path of
+// the entry under dir. a followed link is described by what it points to.
+// when opts.Include is set directories are only walked into, and given to
+// fn right before the first entry selected under them.
+func walkTree(dir string, opts Options, fn func(e treeEntry) error) error {
+
+	if err := opts.checkPatterns(); err != nil {
+		return err
+	}
+	root, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	var pending []treeEntry
+	return walkDir(dir, "", []os.FileInfo{root}, &pending, opts, fn)
+}
+
+func walkDir(dir, rel string, parents []os.FileInfo, pending *[]treeEntry, opts Options, fn func(e treeEntry) error) error {
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range entries {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		e := treeEntry{rel: path.Join(rel, fi.Name()), path: filepath.Join(dir, fi.Name()), fi: fi}
+
+		if opts.NoDotfiles && strings.HasPrefix(fi.Name(), ".") {
+			opts.trace("skipped, dotfile", "path", e.rel)
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			switch opts.Symlinks {
+			case SkipSymlinks:
+				opts.trace("skipped, symlink", "path", e.rel)
+				continue
+			case FollowSymlinks:
+				target, err := os.Stat(e.path)
+				if err != nil {
+					return err
+				}
+				for _, parent := range parents {
+					if os.SameFile(parent, target) {
+						return fmt.Errorf("%s links to a directory it is in, it can't be followed", e.path)
+					}
+				}
+				e.fi = target
+			}
+		}
+		if !opts.selects(e.rel, e.fi.IsDir()) {
+			opts.trace("skipped, filtered out", "path", e.rel)
+			continue
+		}
+
+		if !e.fi.IsDir() {
+			for _, p := range *pending {
+				if err := fn(p); err != nil {
+					return err
+				}
+			}
+			*pending = (*pending)[:0]
+			if err := fn(e); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(opts.Include) == 0 {
+			if err := fn(e); err != nil {
+				return err
+			}
+		} else {
+			*pending = append(*pending, e)
+		}
+		if err := walkDir(e.path, e.rel, append(parents, e.fi), pending, opts, fn); err != nil {
+			return err
+		}
+		// nothing was selected under it
+		if n := len(*pending); n > 0 && (*pending)[n-1].rel == e.rel {
+			*pending = (*pending)[:n-1]
+		}
+	}
+
+	return nil
+}
+
+// reports whether the entry at the slash separated path rel of a tree is
+// selected by opts.Include and opts.Exclude. an excluded directory leaves
+// out everything under it, Include only applies to files.
+func (o Options) selects(rel string, dir bool) bool {
+
+	if matchAny(o.Exclude, rel) {
+		return false
+	}
+	return dir || len(o.Include) == 0 || matchAny(o.Include, rel)
+}
+
+// a pattern without a slash matches the last element of rel, one with a
+// slash all of it
+func matchAny(patterns []string, rel string) bool {
+
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fails on the first malformed pattern of opts.Include or opts.Exclude,
+// which would otherwise never match
+func (o Options) checkPatterns() error {
+
+	for _, patterns := range [][]string{o.Include, o.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("malformed pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
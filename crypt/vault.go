@@ -0,0 +1,149 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// VaultTransit is a KeyProvider wrapping file keys with a key of the
+// transit secrets engine of HashiCorp Vault, which never leaves Vault.
+// the token needs the encrypt and decrypt capabilities on the key.
+type VaultTransit struct {
+	// address of the Vault server, such as https://vault:8200
+	Address string
+	Token   string
+	// optional Vault Enterprise namespace
+	Namespace string
+	// path the transit engine is mounted at, transit when empty
+	Mount string
+	// name of the transit key
+	Key string
+	// http.DefaultClient when nil
+	Client *http.Client
+}
+
+// NewVaultTransit returns a VaultTransit for key configured by the
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables, like
+// the vault command line.
+func NewVaultTransit(key string) (*VaultTransit, error) {
+
+	v := &VaultTransit{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Key:       key,
+	}
+	if v.Address == "" || v.Token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN are required to use vault")
+	}
+	if key == "" {
+		return nil, errors.New("the name of a vault transit key is required")
+	}
+	return v, nil
+}
+
+// Name is vault-transit: followed by the mount and key name.
+func (v *VaultTransit) Name() string {
+	return "vault-transit:" + v.mount() + "/" + v.Key
+}
+
+// WrapKey encrypts fileKey with the transit key, the result is the
+// ciphertext vault returns, such as vault:v1:...
+func (v *VaultTransit) WrapKey(ctx context.Context, fileKey []byte) ([]byte, error) {
+
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(fileKey)}
+	if err := v.call(ctx, "encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Ciphertext == "" {
+		return nil, errors.New("vault returned no ciphertext")
+	}
+	return []byte(resp.Ciphertext), nil
+}
+
+// UnwrapKey decrypts a key wrapped by WrapKey with any version of the
+// transit key vault still holds.
+func (v *VaultTransit) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	req := map[string]string{"ciphertext": string(wrapped)}
+	if err := v.call(ctx, "decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+func (v *VaultTransit) mount() string {
+	if v.Mount == "" {
+		return "transit"
+	}
+	return strings.Trim(v.Mount, "/")
+}
+
+// posts body to the encrypt or decrypt endpoint of the key and decodes
+// the data of the response into out
+func (v *VaultTransit) call(ctx context.Context, op string, body interface{}, out interface{}) error {
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(v.Address, "/") + "/v1/" + v.mount() + "/" + op + "/" + v.Key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("vault %s: %s: %v", op, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault %s: %s: %s", op, resp.Status, strings.Join(result.Errors, ", "))
+	}
+	return json.Unmarshal(result.Data, out)
+}
@@ -0,0 +1,104 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrMismatch is returned when decrypted data differs from the original file.
+var ErrMismatch = errors.New("decrypted data doesn't match the original file")
+
+// Verify authenticates the header, ciphertext and plaintext checksum of
+// the encrypted file at path without writing the plaintext anywhere, for
+// jobs that validate backups. the plaintext is only held in memory while
+// it is checked and zeroed afterwards.
+//
+// ErrNotEncrypted is returned for other files. ErrTruncated, ErrMalformed,
+// ErrHeaderModified and ErrChecksum report a damaged file, other errors a
+// wrong passphrase or a modified ciphertext, which can't be told apart.
+func Verify(path string, passphrase []byte) error {
+
+	plain, _, err := openPathWith(path, func(file []byte) (*plainFile, error) {
+		if !looksLikeCloak(file) {
+			return nil, ErrNotEncrypted
+		}
+		return open(file, passphrase)
+	})
+	if err != nil {
+		return err
+	}
+	defer wipe(plain.data)
+
+	if plain.checksum != nil && !checksumMatches(plain.data, plain.checksum) {
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+// reports whether file starts like any cloak file, unlike looksEncrypted
+// it accepts damaged files so Verify can say what is wrong with them
+func looksLikeCloak(file []byte) bool {
+
+	if isSigned(file) || isPEM(file) || isStream(file) || isBinary(file) {
+		return true
+	}
+
+	// armored files have the hex salt on their second line
+	lines := strings.SplitN(string(file), "\n", 3)
+	if len(lines) < 2 || len(lines[1]) != hex.EncodedLen(32) {
+		return false
+	}
+	_, err := hex.DecodeString(lines[1])
+	return err == nil
+}
+
+// VerifyEncrypted decrypts the encrypted file at path in memory and
+// compares a hash of the result against the plaintext file at original.
+// nothing is written to disk.
+func VerifyEncrypted(path, original string, passphrase []byte) error {
+
+	decrypted, err := Plaintext(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// the original is streamed, only the decrypted side is held in memory
+	f, err := os.Open(original)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+
+	expected := sha256.Sum256(decrypted)
+	if !bytes.Equal(h.Sum(nil), expected[:]) {
+		return ErrMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyEncrypted(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-verify")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "verify.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	if err := VerifyEncrypted(res.Output, filename, passphrase); err != nil {
+		t.Fatalf("VerifyEncrypted %s: %v", res.Output, err)
+	}
+
+	ioutil.WriteFile(filename, []byte("changed"), 0644)
+
+	if err := VerifyEncrypted(res.Output, filename, passphrase); err != ErrMismatch {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+
+	if err := VerifyEncrypted(res.Output, filename, []byte("wrong")); err == nil {
+		t.Fatalf("VerifyEncrypted accepted a wrong passphrase")
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-verify")
+	defer os.RemoveAll(dir)
+
+	for _, armor := range []bool{false, true} {
+		res, err := EncryptData([]byte(data), filepath.Join(dir, "verify.cloak"), passphrase, Options{Armor: armor, Overwrite: true})
+		if err != nil {
+			t.Fatalf("EncryptData: %v", err)
+		}
+
+		if err := Verify(res.Output, passphrase); err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if err := Verify(res.Output, []byte("wrong")); err == nil {
+			t.Fatalf("expected a wrong passphrase to fail")
+		}
+
+		sealed, _ := ioutil.ReadFile(res.Output)
+		damaged := filepath.Join(dir, "damaged.cloak")
+
+		corrupt := append([]byte(nil), sealed...)
+		corrupt[len(corrupt)/2] ^= 1
+		ioutil.WriteFile(damaged, corrupt, 0600)
+		if err := Verify(damaged, passphrase); err == nil {
+			t.Fatalf("expected a corrupted file to fail")
+		}
+
+		ioutil.WriteFile(damaged, sealed[:len(sealed)-3], 0600)
+		if err := Verify(damaged, passphrase); !errors.Is(err, ErrTruncated) && !errors.Is(err, ErrMalformed) {
+			t.Fatalf("expected a truncated file to be reported, got %v", err)
+		}
+	}
+
+	plain := filepath.Join(dir, "plain.txt")
+	ioutil.WriteFile(plain, []byte(data), 0644)
+	if err := Verify(plain, passphrase); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+	os.Remove(plain)
+
+	// nothing but the encrypted files was written
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected only the encrypted files, got %d entries", len(entries))
+	}
+}
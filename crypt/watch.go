@@ -0,0 +1,232 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watcher encrypts the files that appear or change in a directory, such
+// as a drop folder on an ingest server. the directory is polled rather
+// than watched for events, so it works the same on every platform and on
+// network filesystems. a file is only encrypted once its size and
+// modification time held still for a whole interval, so files still being
+// copied in are left alone.
+//
+// hidden files, symlinks, encrypted files and the temporary files outputs
+// are staged in are skipped, as are the files left out by Options.Include
+// and Options.Exclude.
+type Watcher struct {
+	Dir        string
+	Passphrase []byte
+
+	// options every file is encrypted with, such as ShredOriginal to
+	// remove the originals once their outputs are written. OutputPath is
+	// ignored, outputs are written next to the files.
+	Options Options
+
+	// time between two scans, one second when zero
+	Interval time.Duration
+
+	// called with the outcome of each file encrypted by Run, may be nil
+	OnResult func(BatchResult)
+
+	files map[string]watchedFile
+}
+
+// what the previous scan saw of a file
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	// encrypted, or failed, as it is now
+	done bool
+	// encrypted by an earlier scan, so its output can be replaced
+	encrypted bool
+}
+
+// Run scans the directory every Interval until ctx is done and returns
+// its error, or the error of a scan that failed.
+func (w *Watcher) Run(ctx context.Context) error {
+
+	if w.Passphrase == nil && w.Options.KeyFile == "" {
+		return errors.New("a passphrase or key file is required to watch a directory")
+	}
+
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results, err := w.Scan()
+		if err != nil {
+			return err
+		}
+		if w.OnResult != nil {
+			for _, r := range results {
+				w.OnResult(r)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan lists the directory once and encrypts the files that didn't change
+// since the previous scan and weren't encrypted yet, in name order. a
+// file that fails is reported and only tried again once it changes.
+func (w *Watcher) Scan() ([]BatchResult, error) {
+
+	if w.files == nil {
+		w.files = make(map[string]watchedFile)
+	}
+
+	if err := w.Options.checkPatterns(); err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool)
+	var settled []string
+	err := w.walk(func(path string, fi os.FileInfo, skipped string) error {
+		if skipped != "" {
+			return nil
+		}
+
+		present[path] = true
+		prev, seen := w.files[path]
+		now := watchedFile{size: fi.Size(), modTime: fi.ModTime(), encrypted: prev.encrypted}
+		if seen && prev.size == now.size && prev.modTime.Equal(now.modTime) {
+			if !prev.done {
+				settled = append(settled, path)
+			}
+			return nil
+		}
+		w.files[path] = now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for path := range w.files {
+		if !present[path] {
+			delete(w.files, path)
+		}
+	}
+
+	sort.Strings(settled)
+	results := make([]BatchResult, 0, len(settled))
+	for _, path := range settled {
+		f := w.files[path]
+		opts := w.Options
+		opts.OutputPath = ""
+		// a changed file replaces the output written for it before
+		opts.Overwrite = opts.Overwrite || f.encrypted
+
+		res, err := EncryptWithOptions(path, w.Passphrase, opts)
+		results = append(results, BatchResult{Path: path, Result: res, Err: err})
+
+		f.done = true
+		f.encrypted = f.encrypted || err == nil
+		w.files[path] = f
+	}
+
+	return results, nil
+}
+
+// Plan reports what the next scans would do with the files in the
+// directory once they held still, without touching any of them. the
+// files Scan leaves alone are listed as skipped with the reason, a hidden
+// or filtered out directory as one entry.
+func (w *Watcher) Plan() ([]PlanEntry, error) {
+
+	if err := w.Options.checkPatterns(); err != nil {
+		return nil, err
+	}
+
+	var plan []PlanEntry
+	err := w.walk(func(path string, fi os.FileInfo, skipped string) error {
+		if skipped != "" {
+			plan = append(plan, PlanEntry{Path: path, Action: PlanSkip, Reason: skipped})
+			return nil
+		}
+
+		opts := w.Options
+		opts.OutputPath = ""
+		opts.Overwrite = opts.Overwrite || w.files[path].encrypted
+		plan = append(plan, planFile(path, opts))
+		return nil
+	})
+	return plan, err
+}
+
+// walks the directory in name order, calling fn with the files to encrypt
+// and, with the reason, the files and directories left alone
+func (w *Watcher) walk(fn func(path string, fi os.FileInfo, skipped string) error) error {
+
+	return filepath.Walk(w.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// removed between listing and stat, such as by -shred
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		skip := func(reason string) error {
+			if err := fn(path, fi, reason); err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := fi.Name()
+		if path != w.Dir && strings.HasPrefix(name, ".") {
+			return skip("hidden")
+		}
+		rel, err := filepath.Rel(w.Dir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && !w.Options.selects(filepath.ToSlash(rel), fi.IsDir()) {
+			return skip("filtered out")
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return skip(fmt.Sprintf("not a regular file (%s)", fi.Mode().Type()))
+		}
+		if filepath.Ext(name) == Extension {
+			return skip("already encrypted")
+		}
+
+		return fn(path, fi, "")
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-watch")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "drop.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte(data), 0644)
+
+	w := &Watcher{Dir: dir, Passphrase: passphrase}
+
+	// a file is only encrypted once it held still between two scans
+	results, err := w.Scan()
+	if err != nil || len(results) != 0 {
+		t.Fatalf("expected nothing encrypted on the first scan, got %v, %v", results, err)
+	}
+	results, err = w.Scan()
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected %s encrypted, got %v, %v", filename, results, err)
+	}
+	output := results[0].Result.Output
+	if plain, _ := Plaintext(output, passphrase); string(plain) != data {
+		t.Fatalf("unexpected contents %q", plain)
+	}
+	if results, _ = w.Scan(); len(results) != 0 {
+		t.Fatalf("expected an unchanged file left alone, got %v", results)
+	}
+
+	// a changed file replaces its output
+	changed := data + " again"
+	ioutil.WriteFile(filename, []byte(changed), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filename, later, later)
+	w.Scan()
+	if results, _ = w.Scan(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected %s encrypted again, got %v", filename, results)
+	}
+	if plain, _ := Plaintext(output, passphrase); string(plain) != changed {
+		t.Fatalf("unexpected contents %q", plain)
+	}
+
+	filtered := &Watcher{Dir: dir, Passphrase: passphrase, Options: Options{Overwrite: true, Exclude: []string{"*.txt"}}}
+	filtered.Scan()
+	if results, _ = filtered.Scan(); len(results) != 0 {
+		t.Fatalf("expected excluded files left alone, got %v", results)
+	}
+
+	shred := &Watcher{Dir: dir, Passphrase: passphrase, Options: Options{ShredOriginal: true, Overwrite: true}}
+	shred.Scan()
+	if results, _ = shred.Scan(); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected %s encrypted, got %v", filename, results)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("expected %s shredded", filename)
+	}
+	if results, _ = shred.Scan(); len(results) != 0 {
+		t.Fatalf("expected nothing left to encrypt, got %v", results)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWeakParams is returned by strict decryption of a file sealed with
+// parameters below the recommended minimums.
+var ErrWeakParams = errors.New("file was encrypted with weak parameters")
+
+// ErrLegacyFormat is returned when decrypting an armored file without a
+// trailer unless Options.AllowLegacy is set. its salt and extension
+// aren't authenticated, so the trailer may have been stripped to forge
+// them. it matches ErrWeakParams.
+var ErrLegacyFormat = fmt.Errorf("%w: old file format without truncation detection or an authenticated extension", ErrWeakParams)
+
+// ErrHeaderModified is returned when the authenticated header of a binary
+// file doesn't match, such as when its parameters were downgraded.
+var ErrHeaderModified error = corruption("encrypted file header was modified")
+
+// MinKDFParams are the smallest scrypt parameters considered strong
+// enough, files derived with less are reported as weak.
+var MinKDFParams = KDFParams{KDF: Scrypt, N: 1 << 14, R: 8, P: 1}
+
+// MinArgon2idParams are the smallest argon2id costs considered strong
+// enough, the lowest OWASP recommendation.
+var MinArgon2idParams = KDFParams{KDF: Argon2id, Time: 2, Memory: 19 << 10, Threads: 1}
+
+// smallest key size considered strong enough
+const minKeySize = 32
+
+// WeakParams describes why the given parameters are below the recommended
+// minimums, it returns nil if they aren't. cipher is a registered cipher
+// name.
+func WeakParams(kdf KDFParams, cipher string) []string {
+
+	var warnings []string
+	switch kdf.KDF {
+	case RawKey:
+		// the key file is as strong as it is random, nothing to check
+	case Argon2id:
+		if kdf.Time < MinArgon2idParams.Time {
+			warnings = append(warnings, fmt.Sprintf("argon2id time %d is below %d", kdf.Time, MinArgon2idParams.Time))
+		}
+		if kdf.Memory < MinArgon2idParams.Memory {
+			warnings = append(warnings, fmt.Sprintf("argon2id memory %d KiB is below %d KiB", kdf.Memory, MinArgon2idParams.Memory))
+		}
+	default:
+		if kdf.N < MinKDFParams.N {
+			warnings = append(warnings, fmt.Sprintf("scrypt N %d is below %d", kdf.N, MinKDFParams.N))
+		}
+		if kdf.R < MinKDFParams.R {
+			warnings = append(warnings, fmt.Sprintf("scrypt r %d is below %d", kdf.R, MinKDFParams.R))
+		}
+		if kdf.P < MinKDFParams.P {
+			warnings = append(warnings, fmt.Sprintf("scrypt p %d is below %d", kdf.P, MinKDFParams.P))
+		}
+	}
+
+	if c := cipherByName(cipher); c == nil {
+		warnings = append(warnings, fmt.Sprintf("unknown cipher %q", cipher))
+	} else if c.KeySize() < minKeySize {
+		warnings = append(warnings, fmt.Sprintf("%s uses %d bit keys", cipher, c.KeySize()*8))
+	}
+
+	return warnings
+}
+
+// parameters of the decrypted file below the recommended minimums
+func (p *plainFile) weaknesses() []string {
+
+	// keys of files encrypted to recipients are random, not derived
+	kdf := p.kdf
+	if kdf == (KDFParams{}) {
+		kdf = MinKDFParams
+	}
+
+	warnings := WeakParams(kdf, p.cipher)
+	if !p.trailer {
+		warnings = append(warnings, "old file format without truncation detection or an authenticated extension")
+	}
+	return warnings
+}
+
+func cipherByName(name string) Cipher {
+	for _, id := range Ciphers() {
+		c, err := LookupCipher(id)
+		if err == nil && c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWeakParams(t *testing.T) {
+
+	if w := WeakParams(DefaultKDFParams, "secretbox"); len(w) != 0 {
+		t.Fatalf("default parameters reported as weak: %v", w)
+	}
+
+	if w := WeakParams(KDFParams{N: 1 << 10, R: 1, P: 1}, "secretbox"); len(w) != 2 {
+		t.Fatalf("expected warnings for N and r, got %v", w)
+	}
+
+	if w := WeakParams(DefaultArgon2idParams, "secretbox"); len(w) != 0 {
+		t.Fatalf("default argon2id parameters reported as weak: %v", w)
+	}
+
+	if w := WeakParams(KDFParams{KDF: Argon2id, Time: 1, Memory: 64, Threads: 1}, "secretbox"); len(w) != 2 {
+		t.Fatalf("expected warnings for argon2id time and memory, got %v", w)
+	}
+
+	if w := WeakParams(DefaultKDFParams, "rot13"); len(w) != 1 {
+		t.Fatalf("expected a warning for an unknown cipher, got %v", w)
+	}
+}
+
+func TestDecryptStrict(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-weak")
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "weak.txt")
+	ioutil.WriteFile(filename, []byte(data), 0644)
+
+	res, err := Encrypt(filename, passphrase)
+	if err != nil {
+		t.Fatalf("Encrypt %s: %v", filename, err)
+	}
+
+	out := filepath.Join(dir, "out.txt")
+	dec, err := DecryptWithOptions(res.Output, passphrase, Options{Strict: true, OutputPath: out})
+	if err != nil {
+		t.Fatalf("strict decrypt of a default file: %v", err)
+	}
+	if len(dec.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", dec.Warnings)
+	}
+	os.Remove(out)
+
+	// rewrite the header with a weaker N and the key derivation no
+	// longer matches, the authenticated header stops a silent downgrade
+	file, _ := ioutil.ReadFile(res.Output)
+	binary.BigEndian.PutUint32(file[len(binaryMagic)+3:], 1<<10)
+	if _, err := open(file, passphrase); err == nil {
+		t.Fatalf("expected an error for downgraded parameters")
+	}
+
+	// old armored files without a trailer are refused unless allowed,
+	// then reported. newer ones seal rotation metadata with the checksum
+	// and are refused when their trailer is stripped
+	armored, err := EncryptWithOptions(filename, passphrase, Options{Armor: true, Overwrite: true})
+	if err != nil {
+		t.Fatalf("EncryptWithOptions %s: %v", filename, err)
+	}
+	file, _ = ioutil.ReadFile(armored.Output)
+	lines := strings.Split(string(file), "\n")
+	stripped := filepath.Join(dir, "stripped")
+	ioutil.WriteFile(stripped, []byte(strings.Join(lines[:4], "\n")), 0644)
+	_, err = DecryptWithOptions(stripped, passphrase, Options{AllowLegacy: true, OutputPath: out})
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Fatalf("expected ErrCorruptFile for a stripped trailer, got %v", err)
+	}
+
+	legacy := filepath.Join(dir, "legacy")
+	ioutil.WriteFile(legacy, []byte(strings.Join(lines[:3], "\n")), 0644)
+
+	_, err = DecryptWithOptions(legacy, passphrase, Options{OutputPath: out})
+	if !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("expected ErrLegacyFormat, got %v", err)
+	}
+
+	dec, err = DecryptWithOptions(legacy, passphrase, Options{AllowLegacy: true, OutputPath: out})
+	if err != nil {
+		t.Fatalf("decrypt of a file without trailer: %v", err)
+	}
+	if len(dec.Warnings) != 1 {
+		t.Fatalf("expected one warning, got %v", dec.Warnings)
+	}
+	os.Remove(out)
+
+	_, err = DecryptWithOptions(legacy, passphrase, Options{Strict: true, AllowLegacy: true, OutputPath: out})
+	if !errors.Is(err, ErrWeakParams) {
+		t.Fatalf("expected ErrWeakParams, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("strict decrypt wrote %s", out)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package crypt
+
+// the diceware list PassphraseGenerator draws words from, common English
+// words of 3 to 9 letters, without ones that are unpleasant to type or
+// say
+const dicewareList = `
+abbey able about above abyss accent acid acorn acre acrobat
+actor adapt admit adobe adopt adult advent advice aerial afford
+afraid aft agate agenda agent agile agree ahead aim air
+airport aisle alarm album alder alert algae alien alley allow
+alloy almanac almond alpha alpine already also alter alto amber
+amigo amount amulet amuse anchor ancient angel angle animal anise
+ankle answer antenna antler anvil apart apple apricot april apron
+aqua arbor arcade arch archer arctic arena argue aria armor
+army aroma arrow artist ashes aspect aspen asset aster astro
+atlas atom atrium attic audio august aunt aurora autumn avenue
+avian avocado awake award aware axis axle azure baby bacon
+badge badger bagel bagpipe baker balance balcony ballad ballet balsa
+bamboo banana band banjo banner banquet barely barge barn baron
+barrel basil basket battle bayou bazaar beach beacon beagle beam
+bean bear beard beast beaver become bedroom beech beef beetle
+beetroot begin behave bellow belt bench benefit beret berry beyond
+bicycle bike binder bingo biology birch bird birdie biscuit bishop
+bison bitter blade blank blanket blast blaze blend blender bless
+blimp blind blink bliss block blond blossom blouse blue blueberry
+bluff blunt blur blush board boat bobcat body boil bold
+bolt bonfire bongo bonsai bonus book boost boot booth border
+bottle boulder bounce bouquet bowl boxer brain brake bramble branch
+brandy brass brave bravo bread breadbox breeze brick bridge brief
+bright brine brisk bristle broad broccoli bronze brook broom brother
+brown brownie brush bubble bucket buckeye buckle budget buffalo buggy
+bugle build bulb bulldog bumble bundle bunker bunny burden burger
+burrow burst bush butane butter buttercup button buyer buzz cabbage
+cabin cable cactus cadence cadet caffeine cage cake calf calico
+calm calypso camel camellia camera camp canal candle candor candy
+canoe canopy cantor canvas canyon caper capital captain caramel caravan
+carbon card cardinal cargo caribou carnival carol carpet carrot cart
+carve cascade case cash cashew castle casual catalog catch catfish
+cattle cave caviar cedar celery celeste cellar cello cement census
+cereal chair chalk champion change chapter charm chart chase cheap
+check cheek cheese chef cherry cherub chess chest chestnut chicken
+chickpea chief child chili chime chimney chipmunk chisel choice chorus
+chowder chrome cider cinder cinema cinnamon circle circus citizen citrus
+city civil claim clam clap clarify clarinet classic claw clay
+clean clerk clever click client cliff climb clinic clip cloak
+clock close cloth cloud clover clown club clue cluster coach
+coast cobalt cobra cobweb cocoa coconut code coffee coil coin
+collar colony color column combine comet comfort comic comma common
+compass compost concert condo condor cone confetti cookie coop copper
+coral core cork corn corner cornet cosmic cosmos cottage cotton
+couch cougar country couple course cousin cover coyote crab cradle
+craft crane crater crayon cream credit creek crew cricket crisp
+critic crocus crop cross crouton crow crowd crown crucial cruise
+crumb crunch crystal cube cuddle culture cupboard cupcake curious current
+curtain curve cushion custom cycle cymbal cypress dahlia daily dairy
+daisy damp dance danger dapper daring dash data dawn daylight
+dazzle deal debate decade decent decide decoy deer degree delay
+delight delta demand denim dense dentist depth deputy derby desert
+design desk detail device dew diamond diary diesel digital dingo
+dinner dinosaur dipper direct disco dish display distant diver divide
+doctor dodge dogwood dolphin domain domino donkey donut doodle door
+doorbell dormouse dose double dough dove dragon dragonfly drama drastic
+drawer dream dress drift drill drink drip drive drizzle drum
+dryer duck dumpling dune during dusk dust duty dwarf dynamic
+eager eagle early earmuff earth easel east easter easy ebony
+echo eclair eclipse ecology edge editor effort eggplant eight elbow
+elder electric elegant element elephant elevator elfin elite elk elm
+ember emblem emerald emotion empire empty emu enact encore endless
+energy engine enigma enjoy enough enrich entire entry envelope episode
+epoch equal equator equinox erase ermine erosion errand escape espresso
+essay estate eternal ether evening event evidence evolve exact exhibit
+exile exit exotic expand expert explore express extra fable fabric
+fabulous face faculty fade faint fair fairway falafel falcon fame
+family famous fancy fantasy farm fashion father fatigue fault favorite
+feast feather feature federal fence fern ferret ferry festival fetch
+fever fiber fiction fiddle field fiesta fig figure film filter
+final finale finch finger finish fire firm first fiscal fish
+fitness fjord flag flame flamingo flannel flapjack flash flat flavor
+fleet flicker flight flint flipper float flock floor flora flower
+fluid flute focus fog foil folder follow fondue food forest
+forge fork fortune forum fossil foster fountain fox foxglove fragile
+frame freckle fresh friend fringe frisbee fritter frog frolic front
+frost fruit fudge fuel fungus funny furnace future gable gadget
+galaxy galleon gallery game gamma gander garage garden garlic garment
+garnet gasket gather gauge gazebo gazelle gecko gelato gemstone general
+genius gentle genuine geode gesture geyser giant gift ginger gingham
+giraffe glacier glad glade glance glass glide glimpse glitter globe
+glory glove glow glue gnome goat goblet goblin golden golf
+gondola goose gopher gorge gorilla gospel gossip gourd govern gown
+grace grain granite granola grape graph grass gravel gravity gravy
+great green grid griffin grill grin grip grizzly grocery grotto
+group grove grow guard guava guess guide guitar gulf gumbo
+gumdrop guppy gust gym habit haiku halibut halo hammer hammock
+hamster hand happy harbor hard harp harvest hatch hatchet haven
+hawk hazel hazelnut head health heart heather heavy hedge hedgehog
+height helium helmet help hemlock hen herb hermit hero heron
+hibiscus hickory hidden high hill hint hip hippo history hobby
+hockey holiday hollow holly hologram honey honeybee hood hope hopscotch
+horizon horn hornet horse hospital host hotel hour hover hub
+huge human humble hummus humor hundred hungry hunter hurdle hurry
+husband hyacinth hybrid ibis ice iceberg icon idea identify idle
+igloo ignore iguana image impact impose improve impulse inch include
+income index indigo indoor infant inform inhale inject inkwell inner
+input insect inside inspire install intact invite iris iron island
+isle item ivory ivy jackal jacket jaguar jam jar jasmine
+javelin jazz jeans jelly jester jetty jewel jigsaw jingle job
+jockey join joke jolly journey joy jubilee judge juggler juice
+jump jungle junior juniper jupiter jury just kangaroo kayak keen
+kelp kernel ketchup kettle key keyboard keynote kick kimono kind
+kindle kingdom kinship kiosk kipper kitchen kite kitten kiwi knapsack
+knee knife knock knoll know koala kumquat label lacquer ladder
+ladle lady lagoon lake lambda lamp language lantern lanyard laptop
+larch large lark laser lasso later latte lattice laugh laundry
+lava lavender lawn layer leader leaf learn leather lecture legal
+legend leisure lemon lemur lend length lens lentil leopard lesson
+letter lettuce level liberty library license lichen light lilac limb
+limerick limit limpet linden linen lion liquid list little live
+lizard llama loaf lobster local lock locket locust lodge logic
+lollipop long loop lottery lotus loud lounge loyal lucky lullaby
+lumber lunar lunch lupine luxury lynx lyrics macaw machine magenta
+magnet magpie mahogany maid mail major mallard mammal manatee mandolin
+mango mansion mantis manual maple marble march margin marigold marina
+marine market marmot marsh marshal marzipan mascot mask master match
+material math matrix matter maximum meadow measure medal media meerkat
+melody melon melt member memory mentor menu mercy merge meringue
+merit mermaid merry mesh message metal meteor method middle midge
+midnight milk millet million mimic mind minimum minnow minor mint
+minute miracle mirror mistral misty mitten mixed mobile mocha model
+modify mohair molasses moment mongoose monitor monkey monster month moon
+moose moral morning morsel mosaic mosquito moss mother motion motor
+mountain mouse move movie muesli muffin muffler mulberry mule museum
+mushroom music muslin mussel mustard mutual myrtle myself mystery myth
+nacho napkin narrow nation nature navy near neck nectar needle
+neither nephew nerve nest nettle network neutral never news next
+nice nickel night nimbus noble noise nominee noodle normal north
+nose notable note nothing notice nougat novel number nurse nut
+nutmeg nylon oak oasis oatcake oatmeal object oblige oboe observe
+obtain ocean ocelot octopus odor offer office often okra olive
+olympic omelet omit onion online onyx opal open opera opinion
+optic orange orbit orca orchard orchid order oregano organ orient
+original orphan osprey ostrich other otter ottoman outdoor outer outpost
+output oval oven owner oxygen oyster ozone paddle page pagoda
+paisley palace palette palm panda panel panic panther papaya paper
+paprika parade parent park parrot parsley parsnip party pass pastel
+pastry patch path patio patrol pause pave peace peach peanut
+pear pebble pecan pelican pencil penguin peony people pepper perch
+perfect permit person pesto pet petal pewter pheasant phone photo
+phrase piano piccolo pickle picnic picture piece pig pigeon pilgrim
+pill pilot pinecone pink pinwheel pioneer pipe pistachio pitch pixel
+pizza place planet plastic plate play plaza please pledge plover
+pluck plug plum plume plunge poem poet point polar pole
+police polka pollen pond pony pool popcorn poppy popular porch
+porridge portion position possible possum potato pottery powder power practice
+praise predict prefer prepare present pretty pretzel prevent price pride
+primary primrose print priority prism private prize problem process produce
+profit program project promote proof property prosper protect proud provide
+public pudding puffin pull pulp pulsar pulse pumpkin punch pupil
+puppy purchase purity purpose purse push puzzle pylon pyramid quail
+quality quantum quarter quartz quasar question quick quiet quilt quince
+quit quiz quokka quote rabbit raccoon race rack radar radio
+radish raffle rail rain rainbow raise raisin rally rambler ramp
+ranch random range rapid raptor rare rate rather rattan raven
+ravioli razor ready real reason rebel rebuild recall receive recipe
+record recycle reduce reflect reform refuse region regret regular reindeer
+reject relax release relief relish rely remain remember remind remove
+render renew rent reopen repair repeat replace report require rescue
+resemble resist resource response result retire retreat return reunion reveal
+review reward rhubarb rhythm ribbon rice rich riddle ride ridge
+right rigid ring ripple risk ritual rival river road roast
+robin robot robust rocket rococo romance roof rookie room rose
+rosemary rotate rough round route royal rubber ruby rudder rug
+rule rumba rumor runway rural rustic saddle safari saffron sage
+sail salad salmon salon salsa salt salute samba same sample
+sand sandal sapphire sardine satchel satin satisfy sauce sausage savanna
+save scale scallop scan scarab scarf scatter scene scheme school
+science scissors scone scorpion scout scrap screen script scrub sea
+search season seat second secret section security seed seek segment
+select sell seminar senior sense sentence sequoia series service sesame
+session settle setup seven shadow shaft shallow shamrock share shed
+shell sherbet sheriff shield shift shine ship shiver shock shoe
+shoot shop short shortcake shoulder shove shrimp shrug shuffle sibling
+siege sierra sight sign silent silk silly silo silver similar
+simple since sing siren sister situate six size skate sketch
+ski skill skin skirt skull skylark slab slam sleep sleigh
+slender slice slide slight slim slipper slogan slot sloth slow
+slush small smart smile smoke smooth snack snake snap snapper
+sniff snorkel snow snowball soap soccer social sock soda soft
+solar soldier solid solution solve someone song soon sorbet sorry
+sort soul sound soup source south space spare sparrow spatial
+spawn speak special speed spell spend sphere spice spider spike
+spin spinach spirit split spoil sponsor spoon sport spot spray
+spread spring sprocket spruce spy square squash squeeze squirrel stable
+stadium staff stage stairs stamp stand starling start state stay
+steak steel stem step stereo stick still sting stingray stock
+stomach stone stool story stove strategy street strike strong strudel
+struggle student stuff stumble style subject submit subway success sudden
+suffer sugar suggest suit summer sun sundial sunflower sunny sunset
+super supply supreme sure surface surge surprise surround survey sustain
+swallow swamp swan swap swarm sweet swift swim swing switch
+sword sycamore symbol symptom syrup system table tackle taffy tag
+tahini tail talent talk tamale tambour tango tank tape tapioca
+target tarragon tartan task taste tattoo taxi teach teacup team
+teapot tell tempo ten tenant tennis tent term test text
+thank that theme then theory there they thimble thing this
+thistle thought three thrive throw thumb thunder thyme tiara ticket
+tide tiger tilt timber time timpani tiny tip tired tissue
+title toast today toddler toe toffee together token tomato tomorrow
+tone tongue tonight tool tooth top topaz topic topple torch
+tornado tortilla tortoise toss total toucan tourist toward tower town
+toy track trade traffic train transfer trap trash travel tray
+treat tree trellis trend trial tribe trick trifle trigger trim
+trip trophy trouble trout truck true truffle truly trumpet trust
+truth try tube tuition tulip tumble tuna tundra tunnel turkey
+turn turnip turquoise turtle tuxedo twelve twenty twice twig twin
+twist two type typical ukulele umber umbrella unable unaware uncle
+uncover under undo unfair unfold unhappy unicorn uniform unique unit
+universe unknown unlock until unusual unveil update upgrade uphold upon
+upper upset urban urchin urge usage use used useful usual
+utility vacant vacuum vague valet valid valley valve van vanilla
+vanish vapor various vast vault vehicle velcro velvet vendor venture
+venue verb verbena verify version vervain very vessel veteran viable
+vibrant victory video view viking village vintage vinyl viola violin
+viper vireo virtual visa visit visual vital vivid vocal voice
+void volcano volume vortex vote voyage waffle wage wagon wait
+walk wall walnut walrus wand want warbler warm warrior wasabi
+wash wasp waste water waterfall wave way wealth wear weasel
+weather web wedding weekend welcome west wet whale what wheat
+wheel when where whip whisper whistle wicket wide widget width
+wife wild will willow win window wine wing wink winner
+winter wire wisdom wise wish witness wolf woman wombat wonder
+wood wool word work world worry worth wrap wreck wren
+wrestle wrist write wrong yacht yak yard yarn year yellow
+yeti yodel yogurt you young youth yucca zebra zenith zephyr
+zeppelin zero zigzag zinnia zone zoo zucchini
+`
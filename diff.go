@@ -0,0 +1,46 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+
+	"github.com/drish/cloak/crypt"
+	"github.com/drish/cloak/internal/diff"
+)
+
+// decrypts both files in memory and prints a unified diff of their
+// contents, or a summary for binary files. reports whether they differ.
+func diffFiles(a, b string, passA, passB []byte, context int) (bool, error) {
+
+	plainA, err := crypt.Plaintext(a, passA)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", a, err)
+	}
+
+	plainB, err := crypt.Plaintext(b, passB)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", b, err)
+	}
+
+	var out string
+	if diff.IsBinary(plainA) || diff.IsBinary(plainB) {
+		out = diff.Binary(a, b, plainA, plainB)
+	} else {
+		out = diff.Unified(a, b, plainA, plainB, context)
+	}
+
+	fmt.Print(out)
+	return out != "", nil
+}
@@ -0,0 +1,198 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+)
+
+const (
+	findingOK   = "ok"
+	findingWarn = "warn"
+	findingFail = "fail"
+)
+
+type finding struct {
+	level   string
+	message string
+}
+
+// runs the environment checks and scans paths for encrypted files,
+// prints the findings and reports whether any check failed
+func doctor(paths []string) bool {
+
+	var findings []finding
+	findings = append(findings, checkEntropy())
+	findings = append(findings, checkPrivateDir())
+	findings = append(findings, checkRoundTrip())
+	for _, path := range paths {
+		findings = append(findings, checkFormats(path)...)
+	}
+
+	failed := false
+	for _, f := range findings {
+		fmt.Printf("[%s] %s\n", f.level, f.message)
+		if f.level == findingFail {
+			failed = true
+		}
+	}
+
+	return failed
+}
+
+// the system random source must work and not return constant output
+func checkEntropy() finding {
+
+	buf := make([]byte, 64)
+	if _, err := rand.Read(buf); err != nil {
+		return finding{findingFail, fmt.Sprintf("random source unavailable: %v", err)}
+	}
+
+	if bytes.Count(buf, buf[:1]) == len(buf) {
+		return finding{findingFail, "random source returned constant output, salts and nonces would repeat"}
+	}
+
+	if err := crypt.CheckEntropy(); err != nil {
+		return finding{findingFail, err.Error()}
+	}
+
+	return finding{findingOK, "random source is readable and passed the entropy checks"}
+}
+
+// cloak exec prefers memory backed storage for decrypted files
+func checkPrivateDir() finding {
+
+	dir := privateBaseDir()
+	if dir == os.TempDir() {
+		return finding{findingWarn, fmt.Sprintf("no memory backed directory found, cloak exec refuses to place decrypted files in %s without -allow-disk, set XDG_RUNTIME_DIR to a tmpfs", dir)}
+	}
+
+	return finding{findingOK, fmt.Sprintf("cloak exec will place decrypted files in %s", dir)}
+}
+
+// encrypts and decrypts a small file in a temporary directory
+func checkRoundTrip() finding {
+
+	dir, err := ioutil.TempDir("", "cloak-doctor")
+	if err != nil {
+		return finding{findingFail, fmt.Sprintf("temporary directory isn't writable: %v", err)}
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "doctor.txt")
+	content := []byte("cloak doctor")
+	if err := ioutil.WriteFile(filename, content, 0600); err != nil {
+		return finding{findingFail, fmt.Sprintf("temporary directory isn't writable: %v", err)}
+	}
+
+	start := time.Now()
+	res, err := crypt.Encrypt(filename, []byte("doctor"))
+	if err != nil {
+		return finding{findingFail, fmt.Sprintf("encryption failed: %v", err)}
+	}
+
+	plain, err := crypt.Plaintext(res.Output, []byte(res.Passphrase))
+	if err != nil {
+		return finding{findingFail, fmt.Sprintf("decryption failed: %v", err)}
+	}
+	elapsed := time.Since(start)
+
+	if !bytes.Equal(plain, content) {
+		return finding{findingFail, "decrypted data doesn't match the original"}
+	}
+
+	// two key derivations dominate the round trip
+	if elapsed > 5*time.Second {
+		return finding{findingWarn, fmt.Sprintf("encrypt/decrypt round trip took %v, key derivation is slow on this machine", elapsed)}
+	}
+
+	return finding{findingOK, fmt.Sprintf("encrypt/decrypt round trip took %v", elapsed.Round(time.Millisecond))}
+}
+
+// reports the format versions of encrypted files under root
+func checkFormats(root string) []finding {
+
+	supported := make(map[int]bool)
+	for _, v := range crypt.FormatVersions() {
+		supported[v] = true
+	}
+
+	var findings []finding
+	total, noChecksum, noTrailer := 0, 0, 0
+	versions := make(map[int]int)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			findings = append(findings, finding{findingWarn, err.Error()})
+			return nil
+		}
+		if info.IsDir() && crypt.IsVirtualPath(path) {
+			findings = append(findings, finding{findingWarn, fmt.Sprintf("skipped %s, it is a virtual filesystem", path)})
+			return filepath.SkipDir
+		}
+		if crypt.IsSpecial(info) {
+			findings = append(findings, finding{findingWarn, fmt.Sprintf("skipped special file %s", path)})
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		format, err := crypt.ReadFormat(path)
+		if err == crypt.ErrNotEncrypted {
+			return nil
+		}
+		if err != nil {
+			findings = append(findings, finding{findingWarn, fmt.Sprintf("%s: %v", path, err)})
+			return nil
+		}
+
+		total++
+		versions[format.Version]++
+		if !format.Checksum {
+			noChecksum++
+		}
+		if !format.Trailer {
+			noTrailer++
+		}
+		return nil
+	})
+	if err != nil {
+		return append(findings, finding{findingFail, err.Error()})
+	}
+
+	findings = append(findings, finding{findingOK, fmt.Sprintf("%s: %d encrypted files", root, total)})
+
+	for v, n := range versions {
+		if !supported[v] {
+			findings = append(findings, finding{findingFail, fmt.Sprintf("%s: %d files use format version %d which this build can't read", root, n, v)})
+		}
+	}
+	if noChecksum > 0 {
+		findings = append(findings, finding{findingWarn, fmt.Sprintf("%s: %d files have no plaintext checksum, run cloak migrate on them to detect corruption on restore", root, noChecksum)})
+	}
+	if noTrailer > 0 {
+		findings = append(findings, finding{findingWarn, fmt.Sprintf("%s: %d files have no trailer, run cloak migrate on them to detect truncation", root, noTrailer)})
+	}
+
+	return findings
+}
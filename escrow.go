@@ -0,0 +1,239 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// generates a recovery identity, writes one share of it per trustee to
+// dir and the public key files should be encrypted to next to them. the
+// identity itself is never written.
+func escrowCreate(dir string, total, threshold int, force bool) error {
+
+	id, err := crypt.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+	shares, err := crypt.SplitIdentity(id, total, threshold)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	pub := filepath.Join(dir, "recovery.pub")
+	paths := []string{pub}
+	for _, s := range shares {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("share-%d.txt", s.Index)))
+	}
+	for _, path := range paths {
+		if err := checkOverwrite(path, force); err != nil {
+			return err
+		}
+	}
+
+	created := time.Now().Format(time.RFC3339)
+	for i, s := range shares {
+		contents := fmt.Sprintf("# cloak escrow share %d of %d, any %d of them recover the key\n"+
+			"# created: %s\n# escrow: %s\n# public key: %s\n"+
+			"# keep it safe, bring it together with the other trustees' shares and run\n"+
+			"# cloak escrow assemble -o key.txt share files...\n%s\n",
+			s.Index, s.Total, s.Threshold, created, s.ID, s.Recipient, s)
+		if err := ioutil.WriteFile(paths[i+1], []byte(contents), 0600); err != nil {
+			return err
+		}
+	}
+
+	contents := fmt.Sprintf("# cloak escrow recovery key, %d of %d shares needed\n# created: %s\n# escrow: %s\n%s\n",
+		threshold, total, created, shares[0].ID, id.Recipient())
+	if err := ioutil.WriteFile(pub, []byte(contents), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("escrow %s: %d shares written to %s, any %d recover the key\n", shares[0].ID, total, dir, threshold)
+	fmt.Printf("public key: %s\n", id.Recipient())
+	fmt.Printf("encrypt files to it with cloak encrypt -R %s, then hand one share to each trustee\n", pub)
+	return nil
+}
+
+// splits passphrase and writes one share of it per trustee to dir
+func escrowSplit(passphrase []byte, dir string, total, threshold int, force bool) error {
+
+	shares, err := crypt.SplitPassphrase(passphrase, total, threshold)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, s := range shares {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("share-%d.txt", s.Index)))
+	}
+	for _, path := range paths {
+		if err := checkOverwrite(path, force); err != nil {
+			return err
+		}
+	}
+
+	created := time.Now().Format(time.RFC3339)
+	for i, s := range shares {
+		contents := fmt.Sprintf("# cloak escrow passphrase share %d of %d, any %d of them recover the passphrase\n"+
+			"# created: %s\n# escrow: %s\n"+
+			"# keep it safe, bring it together with the other trustees' shares and run\n"+
+			"# cloak escrow combine -o passphrase.txt share files...\n%s\n",
+			s.Index, s.Total, s.Threshold, created, s.ID, s)
+		if err := ioutil.WriteFile(paths[i], []byte(contents), 0600); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("escrow %s: %d passphrase shares written to %s, any %d recover it\n", shares[0].ID, total, dir, threshold)
+	fmt.Println("hand one share to each trustee")
+	return nil
+}
+
+// reads the shares of every file in paths
+func readShares(paths []string) ([]*crypt.Share, error) {
+
+	var shares []*crypt.Share
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s, err := crypt.ParseShares(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		shares = append(shares, s...)
+	}
+	return shares, nil
+}
+
+// prints which shares of an escrow are present and how many more are
+// needed, reports whether the key can be assembled
+func escrowStatus(paths []string) (bool, error) {
+
+	shares, err := readShares(paths)
+	if err != nil {
+		return false, err
+	}
+	status, err := crypt.CheckShares(shares)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("escrow: %s\n", status.ID)
+	if status.Recipient != nil {
+		fmt.Printf("public key: %s\n", status.Recipient)
+	} else {
+		fmt.Println("holds: passphrase")
+	}
+	fmt.Printf("shares: %d of %d present (%s), %d needed\n", len(status.Have), status.Total, joinInts(status.Have), status.Threshold)
+	if len(status.Missing) > 0 {
+		fmt.Printf("missing: %s\n", joinInts(status.Missing))
+	}
+	if !status.Ready() {
+		fmt.Printf("%d more share(s) needed before the key can be assembled\n", status.Threshold-len(status.Have))
+		return false, nil
+	}
+	if status.Recipient == nil {
+		fmt.Println("ready, run cloak escrow combine with these files")
+	} else {
+		fmt.Println("ready, run cloak escrow assemble with these files")
+	}
+	return true, nil
+}
+
+// combines the shares of paths into the recovery identity and writes it
+// to output, or to stdout when output is empty
+func escrowAssemble(paths []string, output string, force bool) error {
+
+	if err := checkOverwrite(output, force); err != nil {
+		return err
+	}
+
+	shares, err := readShares(paths)
+	if err != nil {
+		return err
+	}
+	id, err := crypt.AssembleIdentity(shares)
+	if err != nil {
+		return err
+	}
+
+	contents := fmt.Sprintf("# assembled: %s\n# escrow: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), shares[0].ID, id.Recipient(), id)
+	if output == "" {
+		fmt.Print(contents)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(output, []byte(contents), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recovery key written to %s, decrypt with cloak decrypt -i %s\n", output, output)
+	return nil
+}
+
+// combines the passphrase shares of paths and writes the passphrase to
+// output, or to stdout when output is empty
+func escrowCombine(paths []string, output string, force bool) error {
+
+	if err := checkOverwrite(output, force); err != nil {
+		return err
+	}
+
+	shares, err := readShares(paths)
+	if err != nil {
+		return err
+	}
+	passphrase, err := crypt.AssemblePassphrase(shares)
+	if err != nil {
+		return err
+	}
+
+	contents := append(passphrase, '\n')
+	if output == "" {
+		_, err := os.Stdout.Write(contents)
+		return err
+	}
+
+	if err := ioutil.WriteFile(output, contents, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "passphrase written to %s, decrypt with cloak decrypt -pass-file %s\n", output, output)
+	return nil
+}
+
+func joinInts(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ", ")
+}
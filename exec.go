@@ -0,0 +1,162 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// picks a memory backed directory for decrypted files when one is available
+func privateBaseDir() string {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return os.TempDir()
+}
+
+// decrypts every src=dst mapping into a private directory, links dst to
+// the decrypted file, runs the command and removes everything once it
+// exits. returns the exit code of the command. without a memory backed
+// directory the decrypted files would be written to disk, which is
+// refused unless allowDisk is set.
+func execWithFiles(mappings []string, passphrase []byte, command []string, allowDisk bool) (int, error) {
+
+	type mapping struct{ src, dst string }
+	var files []mapping
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return 1, fmt.Errorf("invalid -file %q, expected encrypted=target", m)
+		}
+		// nothing is decrypted unless every target is free
+		if _, err := os.Lstat(parts[1]); err == nil {
+			return 1, fmt.Errorf("%s already exists", parts[1])
+		}
+		files = append(files, mapping{src: parts[0], dst: parts[1]})
+	}
+
+	base := privateBaseDir()
+	if base == os.TempDir() && !allowDisk {
+		return 1, fmt.Errorf("no memory backed directory found, the decrypted files would be written to %s on disk, set XDG_RUNTIME_DIR to a tmpfs or pass -allow-disk", base)
+	}
+	if base == os.TempDir() {
+		log.Printf("warning: no memory backed directory found, the decrypted files are written to %s on disk", base)
+	}
+
+	dir, err := ioutil.TempDir(base, "cloak-exec-")
+	if err != nil {
+		return 1, err
+	}
+
+	var links []string
+	cleanup := func() {
+		for _, link := range links {
+			if err := os.Remove(link); err != nil {
+				log.Println(err)
+			}
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Println(err)
+		}
+	}
+	defer cleanup()
+
+	if err := os.Chmod(dir, 0700); err != nil {
+		return 1, err
+	}
+
+	for i, f := range files {
+		// one sub directory per file keeps the original names without clashes
+		sub := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.Mkdir(sub, 0700); err != nil {
+			return 1, err
+		}
+
+		plain, err := crypt.Plaintext(f.src, passphrase)
+		if err != nil {
+			return 1, fmt.Errorf("%s: %v", f.src, err)
+		}
+		target := filepath.Join(sub, filepath.Base(f.dst))
+		err = ioutil.WriteFile(target, plain, 0600)
+		wipe(plain)
+		if err != nil {
+			return 1, err
+		}
+
+		if err := os.Symlink(target, f.dst); err != nil {
+			return 1, err
+		}
+		links = append(links, f.dst)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "CLOAK_EXEC_DIR="+dir)
+
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+
+	// forward signals so the child can shut down and we can clean up
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus(), nil
+		}
+	}
+
+	return 1, err
+}
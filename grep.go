@@ -0,0 +1,176 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+type grepOptions struct {
+	filesOnly bool
+	context   int
+
+	// only files with all of these labels are searched
+	labels map[string]string
+}
+
+// searches every cloak file under paths for re, decrypting in memory.
+// reports whether anything matched and whether any file failed.
+func grepFiles(re *regexp.Regexp, paths []string, passphrase []byte, opts grepOptions) (bool, bool) {
+
+	matched := false
+	failed := walkEncrypted(paths, func(path string) error {
+		if len(opts.labels) > 0 {
+			labels, err := crypt.Labels(path, passphrase)
+			if err != nil {
+				return err
+			}
+			if !crypt.MatchLabels(labels, opts.labels) {
+				return nil
+			}
+		}
+
+		plain, err := crypt.Plaintext(path, passphrase)
+		if err != nil {
+			return err
+		}
+
+		if grepData(re, path, plain, opts) {
+			matched = true
+		}
+		return nil
+	})
+
+	return matched, failed
+}
+
+// calls fn for every cloak file under paths, skipping virtual filesystems
+// and special files. errors are logged, it reports whether any occurred.
+func walkEncrypted(paths []string, fn func(path string) error) bool {
+
+	failed := false
+
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Println(err)
+				failed = true
+				return nil
+			}
+
+			// reading a pipe or device could block forever
+			if info.IsDir() && crypt.IsVirtualPath(path) {
+				log.Printf("skipping %s, it is a virtual filesystem", path)
+				return filepath.SkipDir
+			}
+			if crypt.IsSpecial(info) {
+				log.Printf("skipping special file %s", path)
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			encrypted, err := crypt.IsEncrypted(path)
+			if err != nil {
+				log.Println(err)
+				failed = true
+				return nil
+			}
+			if !encrypted {
+				return nil
+			}
+
+			if err := fn(path); err != nil {
+				log.Printf("%s: %v", path, err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			log.Println(err)
+			failed = true
+		}
+	}
+
+	return failed
+}
+
+// prints the matches in data grep style, path:line:text for matching
+// lines and path-line-text for context lines
+func grepData(re *regexp.Regexp, path string, data []byte, opts grepOptions) bool {
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var hits []int
+	for i, line := range lines {
+		if re.MatchString(line) {
+			hits = append(hits, i)
+		}
+	}
+
+	if len(hits) == 0 {
+		return false
+	}
+
+	if opts.filesOnly {
+		fmt.Println(path)
+		return true
+	}
+
+	isHit := make(map[int]bool, len(hits))
+	for _, i := range hits {
+		isHit[i] = true
+	}
+
+	last := -1
+	for _, hit := range hits {
+		start := hit - opts.context
+		if start <= last {
+			start = last + 1
+		}
+		if start < 0 {
+			start = 0
+		}
+		if opts.context > 0 && last >= 0 && start > last+1 {
+			fmt.Println("--")
+		}
+
+		end := hit + opts.context
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+
+		for i := start; i <= end; i++ {
+			sep := "-"
+			if isHit[i] {
+				sep = ":"
+			}
+			fmt.Printf("%s%s%d%s%s\n", path, sep, i+1, sep, lines[i])
+		}
+		last = end
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/blake2b"
+	"lukechampine.com/blake3"
+)
+
+// supported hash algorithms for the hash command
+var hashes = map[string]func() hash.Hash{
+	"blake3":  newBlake3,
+	"blake2b": newBlake2b,
+	"sha256":  sha256.New,
+}
+
+// unkeyed BLAKE3 with the default 256 bit digest
+func newBlake3() hash.Hash {
+	return blake3.New(32, nil)
+}
+
+// unkeyed BLAKE2b-512, which can't fail
+func newBlake2b() hash.Hash {
+	h, _ := blake2b.New512(nil)
+	return h
+}
+
+// prints the checksum of every file in sha256sum compatible format
+func hashFiles(algorithm string, files []string) error {
+
+	newHash, ok := hashes[algorithm]
+	if !ok {
+		return fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+
+	for _, file := range files {
+		sum, err := hashFile(newHash(), file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s  %s\n", sum, file)
+	}
+
+	return nil
+}
+
+// streams the file through h and returns the hex encoded checksum
+func hashFile(h hash.Hash, path string) (string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
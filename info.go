@@ -0,0 +1,138 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// what info -json prints about an encrypted file
+type infoJSON struct {
+	Path       string  `json:"path"`
+	Layout     string  `json:"layout"`
+	Version    int     `json:"version"`
+	Cipher     string  `json:"cipher"`
+	KDF        kdfJSON `json:"kdf"`
+	Extension  string  `json:"extension,omitempty"`
+	ChunkSize  int     `json:"chunk_size,omitempty"`
+	Recipients int     `json:"recipients,omitempty"`
+	Checksum   bool    `json:"checksum"`
+	Trailer    bool    `json:"trailer"`
+	Size       int64   `json:"size"`
+	Signer     string  `json:"signer,omitempty"`
+}
+
+// key derivation parameters, only those of the function are set
+type kdfJSON struct {
+	Name    string `json:"name"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	Time    int    `json:"time,omitempty"`
+	Memory  int    `json:"memory_kib,omitempty"`
+	Threads int    `json:"threads,omitempty"`
+}
+
+// writes what Inspect reports about the encrypted files at paths as a
+// json array, or as key: value lines per file. files that can't be
+// inspected are logged and make it fail once the others are written.
+func printInfo(w io.Writer, paths []string, asJSON bool) error {
+
+	var failed int
+	list := []infoJSON{}
+	for i, path := range paths {
+		info, err := crypt.Inspect(path)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			failed++
+			continue
+		}
+		if asJSON {
+			list = append(list, infoJSONOf(path, info))
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "file: %s\n", path)
+		writeInfo(w, info)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(list); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files couldn't be inspected", failed, len(paths))
+	}
+	return nil
+}
+
+// writes info as key: value lines
+func writeInfo(w io.Writer, info crypt.FileInfo) {
+
+	fmt.Fprintf(w, "layout: %s\nversion: %d\ncipher: %s\nkdf: %s\n", info.Layout, info.Version, info.Cipher, kdfString(info.KDF))
+	if info.Ext != "" {
+		fmt.Fprintf(w, "extension: %s\n", info.Ext)
+	}
+	if info.ChunkSize > 0 {
+		fmt.Fprintf(w, "chunk size: %d\n", info.ChunkSize)
+	}
+	if info.Recipients > 0 {
+		fmt.Fprintf(w, "recipients: %d\n", info.Recipients)
+	}
+	fmt.Fprintf(w, "checksum: %t\ntrailer: %t\nsize: %d\n", info.Checksum, info.Trailer, info.Size)
+	if info.Signer != nil {
+		fmt.Fprintf(w, "signer: %s\n", info.Signer)
+	}
+}
+
+func infoJSONOf(path string, info crypt.FileInfo) infoJSON {
+
+	kdf := kdfJSON{Name: info.KDF.KDF.String()}
+	switch info.KDF.KDF {
+	case crypt.Scrypt:
+		kdf.N, kdf.R, kdf.P = info.KDF.N, info.KDF.R, info.KDF.P
+	case crypt.Argon2id:
+		kdf.Time, kdf.Memory, kdf.Threads = info.KDF.Time, info.KDF.Memory, info.KDF.Threads
+	}
+
+	var signer string
+	if info.Signer != nil {
+		signer = info.Signer.String()
+	}
+
+	return infoJSON{
+		Path:       path,
+		Layout:     info.Layout,
+		Version:    info.Version,
+		Cipher:     info.Cipher,
+		KDF:        kdf,
+		Extension:  info.Ext,
+		ChunkSize:  info.ChunkSize,
+		Recipients: info.Recipients,
+		Checksum:   info.Checksum,
+		Trailer:    info.Trailer,
+		Size:       info.Size,
+		Signer:     signer,
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bech32
+
+import (
+	"strings"
+	"testing"
+)
+
+// valid strings of BIP 173 whose data decodes to whole bytes
+func TestVectors(t *testing.T) {
+
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	} {
+		hrp, data, err := Decode(s)
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", s, err)
+		}
+		got, err := Encode(hrp, data)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if got != s {
+			t.Fatalf("Encode = %q, want %q", got, s)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+
+	for _, s := range []string{
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"a12UEL5L",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx",
+		"pzry9x0s0muk",
+	} {
+		if _, _, err := Decode(s); err == nil {
+			t.Fatalf("expected Decode(%q) to fail", s)
+		}
+	}
+
+	// age keys are longer than the 90 characters of BIP 173
+	long := make([]byte, 64)
+	s, err := Encode("age", long)
+	if err != nil || len(s) <= 90 || !strings.HasPrefix(s, "age1") {
+		t.Fatalf("Encode of 64 bytes = %q, %v", s, err)
+	}
+	if _, data, err := Decode(s); err != nil || len(data) != 64 {
+		t.Fatalf("Decode of a long string: %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff produces unified diffs of text and summaries of binary
+// differences.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type opKind int
+
+const (
+	equal opKind = iota
+	del
+	ins
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// IsBinary reports whether data looks like binary rather than text.
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+// Unified returns a unified diff between a and b with the given number of
+// context lines, or an empty string if they are equal.
+func Unified(aName, bName string, a, b []byte, context int) string {
+
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	for _, h := range hunks(ops, context) {
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+		}
+		out.WriteString(h)
+	}
+
+	return out.String()
+}
+
+// Binary returns a short summary of how a and b differ, or an empty string
+// if they are equal.
+func Binary(aName, bName string, a, b []byte) string {
+
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	first, changed := -1, 0
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			if first < 0 {
+				first = i
+			}
+			changed++
+		}
+	}
+	if first < 0 {
+		first = n
+	}
+
+	return fmt.Sprintf("binary files %s and %s differ\n"+
+		"  size: %d -> %d bytes\n"+
+		"  first difference at offset %d\n"+
+		"  %d of %d overlapping bytes differ\n",
+		aName, bName, len(a), len(b), first, changed, n)
+}
+
+// splits text into lines, keeping the line endings
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// computes the shortest edit script between a and b using Myers' algorithm
+func lineOps(a, b []string) []op {
+
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+2)
+
+	var trace [][]int
+
+outer:
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break outer
+			}
+		}
+	}
+
+	// walk the trace backwards to recover the edits
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{equal, a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{ins, b[y]})
+		} else {
+			x--
+			ops = append(ops, op{del, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, op{equal, a[x]})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	return ops
+}
+
+// groups edits and their surrounding context into unified diff hunks
+func hunks(ops []op, context int) []string {
+
+	var result []string
+
+	i := 0
+	for i < len(ops) {
+		// find the next change
+		for i < len(ops) && ops[i].kind == equal {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// extend the hunk while changes are closer than 2*context apart
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += context
+				if end > run {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+
+		// line numbers of the hunk start in a and b
+		aLine, bLine := 1, 1
+		for _, o := range ops[:start] {
+			if o.kind != ins {
+				aLine++
+			}
+			if o.kind != del {
+				bLine++
+			}
+		}
+
+		var body bytes.Buffer
+		aCount, bCount := 0, 0
+		for _, o := range ops[start:end] {
+			switch o.kind {
+			case equal:
+				body.WriteString(" ")
+				aCount++
+				bCount++
+			case del:
+				body.WriteString("-")
+				aCount++
+			case ins:
+				body.WriteString("+")
+				bCount++
+			}
+			body.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		if aCount == 0 {
+			aLine--
+		}
+		if bCount == 0 {
+			bLine--
+		}
+
+		result = append(result, fmt.Sprintf("@@ -%d,%d +%d,%d @@\n%s", aLine, aCount, bLine, bCount, body.String()))
+		i = end
+	}
+
+	return result
+}
@@ -0,0 +1,71 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\n"
+
+	// changes 6 lines apart share a hunk, like diff -u
+	want := "--- a\n+++ b\n" +
+		"@@ -1,10 +1,11 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n h\n i\n j\n+k\n"
+
+	if got := Unified("a", "b", []byte(a), []byte(b), 3); got != want {
+		t.Fatalf("Unified returned\n%s\nwant\n%s", got, want)
+	}
+
+	// one line further apart they don't
+	a = "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	b = "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	want = "--- a\n+++ b\n" +
+		"@@ -1,7 +1,7 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n" +
+		"@@ -9,3 +9,4 @@\n i\n j\n k\n+l\n"
+
+	if got := Unified("a", "b", []byte(a), []byte(b), 3); got != want {
+		t.Fatalf("Unified returned\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedEqual(t *testing.T) {
+
+	if got := Unified("a", "b", []byte("x\ny\n"), []byte("x\ny\n"), 3); got != "" {
+		t.Fatalf("expected no diff, got %q", got)
+	}
+}
+
+func TestUnifiedNoNewline(t *testing.T) {
+
+	got := Unified("a", "b", []byte("x"), []byte("y"), 3)
+	if !strings.Contains(got, "-x\n\\ No newline at end of file\n+y\n") {
+		t.Fatalf("unexpected diff %q", got)
+	}
+}
+
+func TestBinary(t *testing.T) {
+
+	if IsBinary([]byte("text\n")) || !IsBinary([]byte{0, 1, 2}) {
+		t.Fatalf("IsBinary misdetected input")
+	}
+
+	got := Binary("a", "b", []byte{1, 2, 3}, []byte{1, 9, 3, 4})
+	if !strings.Contains(got, "first difference at offset 1") || !strings.Contains(got, "1 of 3 overlapping bytes differ") {
+		t.Fatalf("unexpected summary %q", got)
+	}
+}
@@ -0,0 +1,511 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build linux
+// +build linux
+
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+)
+
+// the requests and replies below follow linux/fuse.h. their layouts
+// haven't changed since protocol 7.12, which is the oldest accepted.
+const (
+	kernelVersion = 7
+	minMinor      = 12
+	maxMinor      = 31
+
+	// largest write the kernel may send, requests fit in bufSize
+	maxWrite = 128 << 10
+	bufSize  = maxWrite + 4096
+
+	inHeaderSize  = 40
+	outHeaderSize = 16
+	attrSize      = 88
+	direntSize    = 24
+
+	// seconds the kernel caches names and attributes
+	attrValid = 1
+
+	rootID = 1
+
+	// reads bypass the page cache, so the kernel keeps no copy of the
+	// contents and needn't trust the sizes reported
+	fopenDirectIO = 1 << 0
+)
+
+const (
+	opLookup      = 1
+	opForget      = 2
+	opGetattr     = 3
+	opOpen        = 14
+	opRead        = 15
+	opStatfs      = 17
+	opRelease     = 18
+	opFlush       = 25
+	opInit        = 26
+	opOpendir     = 27
+	opReaddir     = 28
+	opReleasedir  = 29
+	opInterrupt   = 36
+	opDestroy     = 38
+	opBatchForget = 42
+)
+
+var ne = binary.NativeEndian
+
+// Conn is a file system mounted by Mount.
+type Conn struct {
+	dev *os.File
+	dir string
+	fs  FS
+
+	mu sync.Mutex
+	// node ids are handed out once per path and never forgotten, which
+	// costs little for browsing
+	ids    map[string]uint64
+	paths  map[uint64]string
+	files  map[uint64]File
+	dirs   map[uint64][]Dirent
+	nextFh uint64
+}
+
+func newConn(dev *os.File, dir string, fs FS) *Conn {
+	return &Conn{
+		dev:   dev,
+		dir:   dir,
+		fs:    fs,
+		ids:   map[string]uint64{".": rootID},
+		paths: map[uint64]string{rootID: "."},
+		files: make(map[uint64]File),
+		dirs:  make(map[uint64][]Dirent),
+	}
+}
+
+// a request read from the kernel
+type request struct {
+	opcode uint32
+	unique uint64
+	node   uint64
+	body   []byte
+}
+
+// Serve answers the kernel's requests, each in its own goroutine, until
+// the file system is unmounted. the files left open are closed on return.
+// the process serving a mount mustn't open files under it with os.Open,
+// registering them with the runtime poller waits for Serve to answer.
+func (c *Conn) Serve() error {
+
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		c.dev.Close()
+		for _, f := range c.files {
+			f.Close()
+		}
+	}()
+
+	for {
+		buf := make([]byte, bufSize)
+		n, err := c.dev.Read(buf)
+		switch {
+		case errors.Is(err, syscall.ENODEV):
+			// unmounted
+			return nil
+		case errors.Is(err, syscall.EINTR), errors.Is(err, syscall.ENOENT):
+			// interrupted before it was read
+			continue
+		case err != nil:
+			return err
+		}
+		if n < inHeaderSize {
+			return fmt.Errorf("short FUSE request of %d bytes", n)
+		}
+
+		req := request{
+			opcode: ne.Uint32(buf[4:]),
+			unique: ne.Uint64(buf[8:]),
+			node:   ne.Uint64(buf[16:]),
+			body:   buf[inHeaderSize:n],
+		}
+		switch req.opcode {
+		case opInit:
+			if err := c.init(req); err != nil {
+				return err
+			}
+		case opForget, opBatchForget, opInterrupt:
+			// take no reply
+		case opDestroy:
+			return nil
+		default:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.handle(req)
+			}()
+		}
+	}
+}
+
+func (c *Conn) init(req request) error {
+
+	if len(req.body) < 12 {
+		return errors.New("short FUSE init request")
+	}
+	major, minor := ne.Uint32(req.body), ne.Uint32(req.body[4:])
+	if major != kernelVersion || minor < minMinor {
+		c.reply(req.unique, nil, syscall.EPROTO)
+		return fmt.Errorf("unsupported FUSE protocol %d.%d", major, minor)
+	}
+	if minor > maxMinor {
+		minor = maxMinor
+	}
+
+	// the reply grew to 64 bytes in 7.23
+	out := make([]byte, 64)
+	if minor < 23 {
+		out = out[:24]
+	}
+	ne.PutUint32(out, kernelVersion)
+	ne.PutUint32(out[4:], minor)
+	// max_readahead as offered, no optional features
+	copy(out[8:12], req.body[8:12])
+	ne.PutUint16(out[16:], 16)
+	ne.PutUint16(out[18:], 12)
+	ne.PutUint32(out[20:], maxWrite)
+	if len(out) > 24 {
+		ne.PutUint32(out[24:], 1)
+	}
+	c.reply(req.unique, out, nil)
+	return nil
+}
+
+func (c *Conn) handle(req request) {
+
+	var out []byte
+	var err error
+	switch req.opcode {
+	case opLookup:
+		out, err = c.lookup(req)
+	case opGetattr:
+		out, err = c.getattr(req)
+	case opOpen:
+		out, err = c.open(req)
+	case opRead:
+		out, err = c.read(req)
+	case opRelease:
+		err = c.release(req)
+	case opOpendir:
+		out, err = c.opendir(req)
+	case opReaddir:
+		out, err = c.readdir(req)
+	case opReleasedir:
+		c.releasedir(req)
+	case opStatfs:
+		out = statfs()
+	case opFlush:
+	default:
+		err = syscall.ENOSYS
+	}
+	c.reply(req.unique, out, err)
+}
+
+func (c *Conn) reply(unique uint64, out []byte, err error) {
+
+	var errno syscall.Errno
+	if err != nil {
+		errno = errnoOf(err)
+		out = nil
+	}
+	b := make([]byte, outHeaderSize+len(out))
+	ne.PutUint32(b, uint32(len(b)))
+	ne.PutUint32(b[4:], uint32(-int32(errno)))
+	ne.PutUint64(b[8:], unique)
+	copy(b[outHeaderSize:], out)
+	// fails when the request was interrupted, nothing waits for it then
+	c.dev.Write(b)
+}
+
+func errnoOf(err error) syscall.Errno {
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EACCES
+	}
+	return syscall.EIO
+}
+
+// the path of a node id the kernel looked up before
+func (c *Conn) path(node uint64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.paths[node]
+	if !ok {
+		return "", syscall.ESTALE
+	}
+	return p, nil
+}
+
+// the node id of path, handed out the first time it's seen
+func (c *Conn) id(p string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[p]; ok {
+		return id
+	}
+	id := uint64(len(c.paths)) + 1
+	c.ids[p] = id
+	c.paths[id] = p
+	return id
+}
+
+func (c *Conn) lookup(req request) ([]byte, error) {
+
+	parent, err := c.path(req.node)
+	if err != nil {
+		return nil, err
+	}
+	name := req.body
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	p := path.Join(parent, string(name))
+	attr, err := c.fs.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	id := c.id(p)
+
+	// entry_out: node id, generation, entry and attribute validity, attr
+	out := make([]byte, 40+attrSize)
+	ne.PutUint64(out, id)
+	ne.PutUint64(out[16:], attrValid)
+	ne.PutUint64(out[24:], attrValid)
+	putAttr(out[40:], id, attr)
+	return out, nil
+}
+
+func (c *Conn) getattr(req request) ([]byte, error) {
+
+	p, err := c.path(req.node)
+	if err != nil {
+		return nil, err
+	}
+	attr, err := c.fs.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// attr_out: attribute validity, attr
+	out := make([]byte, 16+attrSize)
+	ne.PutUint64(out, attrValid)
+	putAttr(out[16:], req.node, attr)
+	return out, nil
+}
+
+func putAttr(b []byte, id uint64, a Attr) {
+
+	mode := uint32(a.Mode.Perm()) &^ 0222
+	nlink := uint32(1)
+	if a.Mode.IsDir() {
+		mode |= syscall.S_IFDIR
+		nlink = 2
+	} else {
+		mode |= syscall.S_IFREG
+	}
+	sec, nsec := uint64(a.ModTime.Unix()), uint32(a.ModTime.Nanosecond())
+
+	ne.PutUint64(b, id)
+	ne.PutUint64(b[8:], uint64(a.Size))
+	ne.PutUint64(b[16:], uint64(a.Size+511)/512)
+	for i := 0; i < 3; i++ {
+		ne.PutUint64(b[24+8*i:], sec)
+		ne.PutUint32(b[48+4*i:], nsec)
+	}
+	ne.PutUint32(b[60:], mode)
+	ne.PutUint32(b[64:], nlink)
+	ne.PutUint32(b[68:], uint32(os.Getuid()))
+	ne.PutUint32(b[72:], uint32(os.Getgid()))
+	ne.PutUint32(b[80:], 4096)
+}
+
+func (c *Conn) open(req request) ([]byte, error) {
+
+	if len(req.body) < 4 {
+		return nil, syscall.EINVAL
+	}
+	if ne.Uint32(req.body)&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return nil, syscall.EROFS
+	}
+	p, err := c.path(req.node)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.fs.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.nextFh++
+	fh := c.nextFh
+	c.files[fh] = f
+	c.mu.Unlock()
+
+	return openOut(fh, fopenDirectIO), nil
+}
+
+func openOut(fh uint64, flags uint32) []byte {
+	out := make([]byte, 16)
+	ne.PutUint64(out, fh)
+	ne.PutUint32(out[8:], flags)
+	return out
+}
+
+// the handle, offset and size of a read or readdir request
+func readIn(req request) (uint64, int64, int, error) {
+	if len(req.body) < 20 {
+		return 0, 0, 0, syscall.EINVAL
+	}
+	return ne.Uint64(req.body), int64(ne.Uint64(req.body[8:])), int(ne.Uint32(req.body[16:])), nil
+}
+
+func (c *Conn) read(req request) ([]byte, error) {
+
+	fh, off, size, err := readIn(req)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	f, ok := c.files[fh]
+	c.mu.Unlock()
+	if !ok {
+		return nil, syscall.EBADF
+	}
+
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, off)
+	if err != nil && err != io.EOF && n == 0 {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (c *Conn) release(req request) error {
+
+	if len(req.body) < 8 {
+		return syscall.EINVAL
+	}
+	fh := ne.Uint64(req.body)
+	c.mu.Lock()
+	f, ok := c.files[fh]
+	delete(c.files, fh)
+	c.mu.Unlock()
+	if !ok {
+		return syscall.EBADF
+	}
+	return f.Close()
+}
+
+func (c *Conn) opendir(req request) ([]byte, error) {
+
+	p, err := c.path(req.node)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.fs.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.nextFh++
+	fh := c.nextFh
+	c.dirs[fh] = entries
+	c.mu.Unlock()
+
+	return openOut(fh, 0), nil
+}
+
+// replies with the entries from the offset on that fit the size asked,
+// the offset of an entry is its index plus one
+func (c *Conn) readdir(req request) ([]byte, error) {
+
+	fh, off, size, err := readIn(req)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := c.path(req.node)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	entries, ok := c.dirs[fh]
+	c.mu.Unlock()
+	if !ok {
+		return nil, syscall.EBADF
+	}
+
+	var out []byte
+	for i := int(off); i >= 0 && i < len(entries); i++ {
+		e := entries[i]
+		n := (direntSize + len(e.Name) + 7) &^ 7
+		if len(out)+n > size {
+			break
+		}
+		typ := uint32(syscall.DT_REG)
+		if e.Dir {
+			typ = syscall.DT_DIR
+		}
+		b := make([]byte, n)
+		ne.PutUint64(b, c.id(path.Join(dir, e.Name)))
+		ne.PutUint64(b[8:], uint64(i+1))
+		ne.PutUint32(b[16:], uint32(len(e.Name)))
+		ne.PutUint32(b[20:], typ)
+		copy(b[direntSize:], e.Name)
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+func (c *Conn) releasedir(req request) {
+	if len(req.body) < 8 {
+		return
+	}
+	c.mu.Lock()
+	delete(c.dirs, ne.Uint64(req.body))
+	c.mu.Unlock()
+}
+
+// a file system without free space, with 4k blocks and 255 byte names
+func statfs() []byte {
+	out := make([]byte, 80)
+	ne.PutUint32(out[40:], 4096)
+	ne.PutUint32(out[44:], 255)
+	ne.PutUint32(out[48:], 4096)
+	return out
+}
@@ -0,0 +1,59 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package fuse serves read-only file systems to the Linux kernel over
+// /dev/fuse, implementing just enough of the FUSE protocol to browse
+// directories and read files. Mount returns an error on other platforms.
+package fuse
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnsupported is returned by Mount on platforms without FUSE.
+var ErrUnsupported = errors.New("FUSE mounts are only supported on Linux")
+
+// FS is a read-only file system served by Conn. paths are slash separated
+// and relative to its root, which is ".". errors wrapping os.ErrNotExist
+// and os.ErrPermission are reported as such, a syscall.Errno as itself
+// and other errors as I/O errors.
+type FS interface {
+	Stat(path string) (Attr, error)
+	ReadDir(path string) ([]Dirent, error)
+	Open(path string) (File, error)
+}
+
+// File is a file opened by FS.Open, it's closed once the kernel releases
+// it. reads may happen concurrently.
+type File interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// Attr describes a file or directory. only the permission bits and
+// os.ModeDir of Mode are used, write permissions are ignored as the file
+// system is mounted read-only.
+type Attr struct {
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+}
+
+// Dirent is an entry of a directory listed by FS.ReadDir.
+type Dirent struct {
+	Name string
+	Dir  bool
+}
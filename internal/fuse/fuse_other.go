@@ -0,0 +1,35 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build !linux
+// +build !linux
+
+package fuse
+
+// Conn is a mounted file system, it can't be created on this platform.
+type Conn struct{}
+
+// Mount returns ErrUnsupported, FUSE is only supported on Linux.
+func Mount(dir string, fs FS) (*Conn, error) {
+	return nil, ErrUnsupported
+}
+
+// Serve returns ErrUnsupported.
+func (c *Conn) Serve() error {
+	return ErrUnsupported
+}
+
+// Unmount returns ErrUnsupported.
+func (c *Conn) Unmount() error {
+	return ErrUnsupported
+}
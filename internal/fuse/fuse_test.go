@@ -0,0 +1,199 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build linux
+// +build linux
+
+package fuse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// a file system of files held in memory, directories are implied
+type mapFS map[string]string
+
+func (m mapFS) Stat(p string) (Attr, error) {
+	if data, ok := m[p]; ok {
+		return Attr{Mode: 0644, Size: int64(len(data)), ModTime: time.Unix(1500000000, 0)}, nil
+	}
+	for name := range m {
+		if p == "." || strings.HasPrefix(name, p+"/") {
+			return Attr{Mode: os.ModeDir | 0755}, nil
+		}
+	}
+	return Attr{}, os.ErrNotExist
+}
+
+func (m mapFS) ReadDir(p string) ([]Dirent, error) {
+	seen := make(map[string]bool)
+	var entries []Dirent
+	for name := range m {
+		rel := name
+		if p != "." {
+			if !strings.HasPrefix(name, p+"/") {
+				continue
+			}
+			rel = name[len(p)+1:]
+		}
+		first := strings.SplitN(rel, "/", 2)
+		if !seen[first[0]] {
+			seen[first[0]] = true
+			entries = append(entries, Dirent{Name: first[0], Dir: len(first) == 2})
+		}
+	}
+	return entries, nil
+}
+
+func (m mapFS) Open(p string) (File, error) {
+	if path.Base(p) == "locked" {
+		return nil, os.ErrPermission
+	}
+	data, ok := m[p]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return nopCloser{strings.NewReader(data)}, nil
+}
+
+type nopCloser struct {
+	*strings.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+// the process serving a mount can't use os.Open on it, the runtime
+// registering the file with its poller waits for Serve, so the helpers
+// below make the system calls themselves
+
+func readFile(name string) ([]byte, error) {
+	fd, err := syscall.Open(name, syscall.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	var data []byte
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return data, nil
+		}
+		data = append(data, buf[:n]...)
+	}
+}
+
+func readDir(name string) ([]string, error) {
+	fd, err := syscall.Open(name, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	var names []string
+	buf := make([]byte, 4096)
+	for {
+		n, err := syscall.ReadDirent(fd, buf)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			sort.Strings(names)
+			return names, nil
+		}
+		_, _, names = syscall.ParseDirent(buf[:n], -1, names)
+	}
+}
+
+func TestMount(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "cloak-fuse")
+	defer os.RemoveAll(dir)
+
+	big := strings.Repeat("0123456789", 50000)
+	fs := mapFS{
+		"hello.txt":        "hello",
+		"docs/big.txt":     big,
+		"docs/deep/a.md":   "a",
+		"docs/deep/locked": "secret",
+	}
+	conn, err := Mount(dir, fs)
+	if err != nil {
+		t.Skipf("can't mount here: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- conn.Serve()
+	}()
+	unmounted := false
+	defer func() {
+		if !unmounted {
+			conn.Unmount()
+		}
+	}()
+
+	if got, err := readFile(filepath.Join(dir, "hello.txt")); err != nil || string(got) != "hello" {
+		t.Fatalf("reading hello.txt: %q, %v", got, err)
+	}
+	if got, err := readFile(filepath.Join(dir, "docs", "big.txt")); err != nil || !bytes.Equal(got, []byte(big)) {
+		t.Fatalf("reading docs/big.txt: %d bytes, %v", len(got), err)
+	}
+	if names, err := readDir(filepath.Join(dir, "docs")); err != nil || strings.Join(names, ",") != "big.txt,deep" {
+		t.Fatalf("unexpected entries %v, %v", names, err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(dir, "docs", "big.txt"), &st); err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if st.Size != int64(len(big)) || st.Mode != syscall.S_IFREG|0444 || st.Mtim.Sec != 1500000000 {
+		t.Fatalf("unexpected attributes %+v", st)
+	}
+	if err := syscall.Stat(filepath.Join(dir, "docs", "deep"), &st); err != nil || st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		t.Fatalf("expected a directory, got mode %o, %v", st.Mode, err)
+	}
+
+	if err := syscall.Stat(filepath.Join(dir, "missing"), &st); err != syscall.ENOENT {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	if _, err := readFile(filepath.Join(dir, "docs", "deep", "locked")); err != syscall.EACCES {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+	if _, err := syscall.Open(filepath.Join(dir, "new.txt"), syscall.O_WRONLY|syscall.O_CREAT, 0644); err != syscall.EROFS {
+		t.Fatalf("expected a read-only file system, got %v", err)
+	}
+
+	if err := conn.Unmount(); err != nil {
+		t.Fatalf("Unmount: %v", err)
+	}
+	unmounted = true
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve didn't return after unmounting")
+	}
+}
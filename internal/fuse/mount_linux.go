@@ -0,0 +1,146 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build linux
+// +build linux
+
+package fuse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Mount mounts fs read-only on dir, which must be an existing directory,
+// and returns the connection serving it once Serve is called. the mount
+// is only accessible to the user mounting it. root mounts it directly,
+// other users through fusermount.
+func Mount(dir string, fs FS) (*Conn, error) {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	dev, err := mountDirect(dir)
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+		dev, err = fusermount(dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mounting %s: %w", dir, err)
+	}
+
+	return newConn(dev, dir, fs), nil
+}
+
+// mounts /dev/fuse on dir with mount(2), which needs root
+func mountDirect(dir string) (*os.File, error) {
+
+	dev, err := os.OpenFile("/dev/fuse", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d", dev.Fd(), syscall.S_IFDIR, os.Getuid(), os.Getgid())
+	err = syscall.Mount("cloak", dir, "fuse.cloak", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_RDONLY, data)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return dev, nil
+}
+
+// mounts dir with the setuid fusermount helper, which passes the opened
+// /dev/fuse back over a socket
+func fusermount(dir string) (*os.File, error) {
+
+	prog, err := fusermountPath()
+	if err != nil {
+		return nil, err
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fds[0])
+	theirs := os.NewFile(uintptr(fds[1]), "fusermount")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(prog, "-o", "ro,nosuid,nodev,fsname=cloak,subtype=cloak", "--", dir)
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.ExtraFiles = []*os.File{theirs}
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	theirs.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v %s", filepath.Base(prog), err, strings.TrimSpace(stderr.String()))
+	}
+
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(fds[0], buf, oob, 0)
+	if err != nil {
+		return nil, fmt.Errorf("receiving /dev/fuse from %s: %v", filepath.Base(prog), err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return nil, fmt.Errorf("%s didn't pass /dev/fuse back", filepath.Base(prog))
+	}
+	received, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(received) != 1 {
+		return nil, fmt.Errorf("%s didn't pass /dev/fuse back", filepath.Base(prog))
+	}
+	return os.NewFile(uintptr(received[0]), "/dev/fuse"), nil
+}
+
+func fusermountPath() (string, error) {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if prog, err := exec.LookPath(name); err == nil {
+			return prog, nil
+		}
+	}
+	return "", errors.New("mounting needs root or fusermount, install fuse3")
+}
+
+// Unmount unmounts the file system, which fails while files under it are
+// open. Serve returns once it's unmounted.
+func (c *Conn) Unmount() error {
+
+	err := syscall.Unmount(c.dir, 0)
+	if !errors.Is(err, syscall.EPERM) {
+		return err
+	}
+
+	prog, err := fusermountPath()
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command(prog, "-u", c.dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v %s", filepath.Base(prog), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package sandbox confines the calling process with a seccomp filter so
+// it can only compute on the file descriptors it already holds: it can't
+// open files, create sockets or run programs anymore. Restrict returns
+// an error on platforms without seccomp.
+package sandbox
+
+import "errors"
+
+// ErrUnsupported is returned by Restrict on platforms without seccomp.
+var ErrUnsupported = errors.New("the decryption sandbox is only supported on Linux on amd64 and arm64")
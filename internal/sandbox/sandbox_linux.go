@@ -0,0 +1,139 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package sandbox
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs = 38
+
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	// classic BPF opcodes
+	bpfLdWAbs = 0x20
+	bpfJeqK   = 0x15
+	bpfRetK   = 0x06
+
+	// offsets of the syscall number and architecture in seccomp_data
+	offsetNr   = 0
+	offsetArch = 4
+)
+
+// the system calls the Go runtime and a decryption between open file
+// descriptors make, everything else fails with EPERM
+var allowed = append([]uintptr{
+	syscall.SYS_READ,
+	syscall.SYS_WRITE,
+	syscall.SYS_PREAD64,
+	syscall.SYS_PWRITE64,
+	syscall.SYS_CLOSE,
+	syscall.SYS_FSTAT,
+	syscall.SYS_LSEEK,
+	syscall.SYS_FCNTL,
+	syscall.SYS_MMAP,
+	syscall.SYS_MUNMAP,
+	syscall.SYS_MPROTECT,
+	syscall.SYS_MADVISE,
+	syscall.SYS_BRK,
+	syscall.SYS_MLOCK,
+	syscall.SYS_MUNLOCK,
+	syscall.SYS_FUTEX,
+	syscall.SYS_CLONE,
+	syscall.SYS_SCHED_YIELD,
+	syscall.SYS_SCHED_GETAFFINITY,
+	syscall.SYS_NANOSLEEP,
+	syscall.SYS_CLOCK_GETTIME,
+	syscall.SYS_CLOCK_NANOSLEEP,
+	syscall.SYS_RT_SIGACTION,
+	syscall.SYS_RT_SIGPROCMASK,
+	syscall.SYS_RT_SIGRETURN,
+	syscall.SYS_SIGALTSTACK,
+	syscall.SYS_GETPID,
+	syscall.SYS_GETTID,
+	syscall.SYS_TGKILL,
+	syscall.SYS_EPOLL_CTL,
+	syscall.SYS_EPOLL_PWAIT,
+	syscall.SYS_EPOLL_CREATE1,
+	syscall.SYS_EVENTFD2,
+	syscall.SYS_PIPE2,
+	syscall.SYS_RESTART_SYSCALL,
+	syscall.SYS_EXIT,
+	syscall.SYS_EXIT_GROUP,
+	sysGetrandom,
+}, archAllowed...)
+
+// a classic BPF instruction, struct sock_filter
+type sockFilter struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+// struct sock_fprog
+type sockFprog struct {
+	len    uint16
+	filter *sockFilter
+}
+
+// the filter killing calls made for another architecture and allowing
+// only the allowed system calls
+func filter() []sockFilter {
+
+	prog := []sockFilter{
+		{code: bpfLdWAbs, k: offsetArch},
+		{code: bpfJeqK, jt: 1, k: auditArch},
+		{code: bpfRetK, k: seccompRetKillProcess},
+		{code: bpfLdWAbs, k: offsetNr},
+	}
+	for i, nr := range allowed {
+		// jumps over the remaining comparisons and the errno return
+		prog = append(prog, sockFilter{code: bpfJeqK, jt: uint8(len(allowed) - i), k: uint32(nr)})
+	}
+	return append(prog,
+		sockFilter{code: bpfRetK, k: seccompRetErrno | uint32(syscall.EPERM)},
+		sockFilter{code: bpfRetK, k: seccompRetAllow},
+	)
+}
+
+// Restrict confines every thread of the process, and the threads and
+// processes it starts afterwards, to the allowed system calls, for good.
+// files and pipes opened before can still be read and written.
+func Restrict() error {
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("restricting the process: %w", errno)
+	}
+
+	prog := filter()
+	fprog := sockFprog{len: uint16(len(prog)), filter: &prog[0]}
+	_, _, errno := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return fmt.Errorf("installing the seccomp filter: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sandbox
+
+import "syscall"
+
+const (
+	// AUDIT_ARCH_X86_64
+	auditArch = 0xc000003e
+
+	sysSeccomp   = 317
+	sysGetrandom = 318
+)
+
+// the calls amd64 has besides their generic counterparts
+var archAllowed = []uintptr{
+	syscall.SYS_EPOLL_WAIT,
+	syscall.SYS_ARCH_PRCTL,
+}
@@ -0,0 +1,27 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sandbox
+
+import "syscall"
+
+const (
+	// AUDIT_ARCH_AARCH64
+	auditArch = 0xc00000b7
+
+	sysSeccomp   = syscall.SYS_SECCOMP
+	sysGetrandom = syscall.SYS_GETRANDOM
+)
+
+// arm64 only has the generic calls
+var archAllowed []uintptr
@@ -0,0 +1,92 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package sandbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// set in the process TestRestrict runs restricted
+const childEnv = "SANDBOX_TEST_CHILD"
+
+func TestRestrict(t *testing.T) {
+
+	if raceEnabled {
+		t.Skip("the race detector needs system calls the filter denies")
+	}
+	if os.Getenv(childEnv) != "" {
+		restricted()
+		return
+	}
+
+	in, err := ioutil.TempFile("", "cloak-sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(in.Name())
+	in.WriteString("ciphertext")
+	in.Seek(0, 0)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestrict$")
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	cmd.Stdin = in
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("restricted process: %v\n%s", err, stderr.String())
+	}
+	if got := stdout.String(); !strings.HasPrefix(got, "ciphertext\nopen denied\nsocket denied\nexec denied\n") {
+		t.Fatalf("unexpected output of the restricted process %q, %s", got, stderr.String())
+	}
+}
+
+// reads stdin to stdout once restricted, and reports what it was denied
+func restricted() {
+
+	fail := func(err error) {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	if err := Restrict(); err != nil {
+		fail(err)
+	}
+
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fail(err)
+	}
+	os.Stdout.Write(append(data, '\n'))
+
+	if _, err := os.Open("/etc/passwd"); os.IsPermission(err) {
+		os.Stdout.WriteString("open denied\n")
+	}
+	if _, err := net.Dial("tcp", "127.0.0.1:1"); err != nil && strings.Contains(err.Error(), syscall.EPERM.Error()) {
+		os.Stdout.WriteString("socket denied\n")
+	}
+	if err := exec.Command("/bin/true").Run(); err != nil {
+		os.Stdout.WriteString("exec denied\n")
+	}
+}
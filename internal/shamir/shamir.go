@@ -0,0 +1,157 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shamir splits secrets into shares with Shamir's secret sharing
+// over GF(256), so any threshold of them recovers the secret and fewer
+// reveal nothing about it.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// MaxShares is the largest number of shares a secret can be split into
+const MaxShares = 255
+
+var (
+	errParams    = errors.New("shamir: threshold must be between 2 and the number of shares, at most 255")
+	errEmpty     = errors.New("shamir: secret is empty")
+	errShares    = errors.New("shamir: at least two shares of the same length are needed")
+	errDuplicate = errors.New("shamir: shares have duplicate or invalid indexes")
+)
+
+// exp and log tables of GF(256) with the AES polynomial and generator 3
+var expTable, logTable [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		x = x ^ xtime(x)
+	}
+	expTable[255] = expTable[0]
+}
+
+// multiplies by 2 modulo x^8 + x^4 + x^3 + x + 1
+func xtime(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b
+	}
+	return x << 1
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Split returns n shares of secret, any k of which recover it. each share
+// is the secret's length plus one byte, its last byte being its index.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+
+	if len(secret) == 0 {
+		return nil, errEmpty
+	}
+	if k < 2 || k > n || n > MaxShares {
+		return nil, errParams
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// one random polynomial of degree k-1 per byte, the secret byte being
+	// its constant term
+	coeffs := make([]byte, k)
+	for b, s := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		coeffs[0] = s
+		for _, share := range shares {
+			share[b] = eval(coeffs, share[len(secret)])
+		}
+	}
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+
+	return shares, nil
+}
+
+// evaluates the polynomial at x with Horner's method
+func eval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// Combine recovers the secret from shares made by Split. given fewer
+// shares than the threshold it returns garbage rather than an error, so
+// callers should check the result.
+func Combine(shares [][]byte) ([]byte, error) {
+
+	if len(shares) < 2 {
+		return nil, errShares
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errShares
+		}
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, errDuplicate
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// lagrange interpolation at x = 0
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		basis := byte(1)
+		for j, x := range xs {
+			if j != i {
+				basis = mul(basis, div(x, x^xs[i]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(share[b], basis)
+		}
+	}
+
+	return secret, nil
+}
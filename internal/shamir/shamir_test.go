@@ -0,0 +1,91 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+
+	secret := []byte("correct horse battery staple, 32")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("got %d shares, want 5", len(shares))
+	}
+
+	// every combination of three shares recovers the secret
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				got, err := Combine([][]byte{shares[a], shares[b], shares[c]})
+				if err != nil {
+					t.Fatalf("Combine: %v", err)
+				}
+				if !bytes.Equal(got, secret) {
+					t.Fatalf("shares %d,%d,%d recovered %q", a, b, c, got)
+				}
+			}
+		}
+	}
+
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatalf("Combine: %v", err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Fatalf("two shares recovered the secret with a threshold of three")
+	}
+}
+
+func TestInvalid(t *testing.T) {
+
+	if _, err := Split([]byte("x"), 3, 1); err == nil {
+		t.Fatalf("Split accepted a threshold of 1")
+	}
+	if _, err := Split([]byte("x"), 3, 4); err == nil {
+		t.Fatalf("Split accepted a threshold above the number of shares")
+	}
+	if _, err := Split(nil, 3, 2); err == nil {
+		t.Fatalf("Split accepted an empty secret")
+	}
+
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	if _, err := Combine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Fatalf("Combine accepted the same share twice")
+	}
+	if _, err := Combine([][]byte{shares[0], shares[1][1:]}); err == nil {
+		t.Fatalf("Combine accepted shares of different lengths")
+	}
+}
+
+func TestField(t *testing.T) {
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if got := div(mul(byte(a), byte(b)), byte(b)); got != byte(a) {
+				t.Fatalf("%d*%d/%d = %d", a, b, b, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package term reads passphrases and secrets from a terminal without
+// echoing them.
+package term
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotTerminal is returned when the file descriptor isn't a terminal.
+var ErrNotTerminal = errors.New("not a terminal")
+
+// IsTerminal reports whether fd refers to a terminal.
+func IsTerminal(fd int) bool {
+	_, err := getState(fd)
+	return err == nil
+}
+
+// ReadPassword reads a line from the terminal fd with echo turned off and
+// returns it without the line ending. the terminal state is restored
+// before returning.
+func ReadPassword(fd int) ([]byte, error) {
+
+	old, err := getState(fd)
+	if err != nil {
+		return nil, ErrNotTerminal
+	}
+
+	if err := disableEcho(fd, old); err != nil {
+		return nil, err
+	}
+	defer setState(fd, old)
+
+	return readLine(fdReader(fd))
+}
+
+// reads up to a new line one byte at a time, so nothing after it is
+// consumed from the terminal
+func readLine(r io.Reader) ([]byte, error) {
+
+	var line []byte
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n > 0 {
+			switch b[0] {
+			case '\n':
+				return line, nil
+			case '\r':
+				// dropped, terminals in raw-ish modes send \r\n
+			default:
+				line = append(line, b[0])
+			}
+			continue
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return nil, io.EOF
+			}
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package term
+
+import "io"
+
+type state struct{}
+
+func getState(fd int) (*state, error) {
+	return nil, ErrNotTerminal
+}
+
+func setState(fd int, s *state) error {
+	return ErrNotTerminal
+}
+
+func disableEcho(fd int, old *state) error {
+	return ErrNotTerminal
+}
+
+type fdReader int
+
+func (r fdReader) Read(b []byte) (int, error) {
+	return 0, io.EOF
+}
@@ -0,0 +1,61 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package term
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+
+	cases := map[string]string{
+		"hunter2\n":       "hunter2",
+		"hunter2\r\n":     "hunter2",
+		"no newline":      "no newline",
+		"first\nsecond\n": "first",
+	}
+
+	for in, want := range cases {
+		got, err := readLine(strings.NewReader(in))
+		if err != nil || string(got) != want {
+			t.Fatalf("readLine(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+
+	if _, err := readLine(strings.NewReader("")); err != io.EOF {
+		t.Fatalf("expected io.EOF for empty input, got %v", err)
+	}
+}
+
+func TestNotTerminal(t *testing.T) {
+
+	f, err := ioutil.TempFile("", "cloak-term")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if IsTerminal(int(f.Fd())) {
+		t.Fatalf("a regular file reported as a terminal")
+	}
+
+	if _, err := ReadPassword(int(f.Fd())); err != ErrNotTerminal {
+		t.Fatalf("expected ErrNotTerminal, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package term
+
+import (
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+type state struct {
+	termios syscall.Termios
+}
+
+func getState(fd int) (*state, error) {
+	var s state
+	if err := ioctl(fd, ioctlGetTermios, &s.termios); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func setState(fd int, s *state) error {
+	return ioctl(fd, ioctlSetTermios, &s.termios)
+}
+
+// keeps canonical mode so line editing still works, only echo is off
+func disableEcho(fd int, old *state) error {
+	s := *old
+	s.termios.Lflag &^= syscall.ECHO
+	s.termios.Lflag |= syscall.ICANON | syscall.ISIG
+	return setState(fd, &s)
+}
+
+func ioctl(fd int, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+type fdReader int
+
+func (r fdReader) Read(b []byte) (int, error) {
+	n, err := syscall.Read(int(r), b)
+	if n < 0 {
+		n = 0
+	}
+	if n == 0 && err == nil {
+		return 0, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+// the OS keychain service generated passphrases are stored under
+const keyringService = "cloak"
+
+// errNotInKeyring is returned when the keychain holds no passphrase for a
+// file, or there is no keychain to ask
+var errNotInKeyring = errors.New("no passphrase in the keychain")
+
+// the keychain account of an encrypted file, the checksum of its contents
+// so the passphrase follows the file when it is renamed or copied
+func keyringAccount(path string) (string, error) {
+	sum, err := hashFile(sha256.New(), path)
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + sum, nil
+}
+
+// stores the passphrase of the encrypted file at path in the keychain
+func storeInKeyring(path string, passphrase []byte) error {
+	account, err := keyringAccount(path)
+	if err != nil {
+		return err
+	}
+	return keyringStore(account, passphrase)
+}
+
+// the passphrase stored in the keychain for the encrypted file at path,
+// errNotInKeyring when there is none
+func lookupInKeyring(path string) ([]byte, error) {
+	account, err := keyringAccount(path)
+	if err != nil {
+		// decrypting reports why the file can't be read
+		return nil, errNotInKeyring
+	}
+	return keyringLookup(account)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// stores secret in the login keychain with security(1). the command is
+// written to its standard input so the secret never shows up in the
+// process list.
+func keyringStore(account string, secret []byte) error {
+
+	if _, err := exec.LookPath("security"); err != nil {
+		return fmt.Errorf("%w: %v", errNotInKeyring, err)
+	}
+
+	var cmd bytes.Buffer
+	fmt.Fprintf(&cmd, "add-generic-password -U -s %s -a %s -w %s\n", keyringService, account, secret)
+	c := exec.Command("security", "-i")
+	c.Stdin = &cmd
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("storing the passphrase in the keychain: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// looks secret up in the login keychain with security(1)
+func keyringLookup(account string) ([]byte, error) {
+
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil, errNotInKeyring
+	}
+
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", account, "-w").Output()
+	if err != nil {
+		return nil, errNotInKeyring
+	}
+	out = bytes.TrimRight(out, "\n")
+	if len(out) == 0 {
+		return nil, errNotInKeyring
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build dragonfly || freebsd || linux || netbsd || openbsd
+// +build dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// stores secret with the Secret Service, such as GNOME Keyring or
+// KWallet, through secret-tool(1) of libsecret. the secret is written to
+// its standard input so it never shows up in the process list.
+func keyringStore(account string, secret []byte) error {
+
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return fmt.Errorf("%w: %v", errNotInKeyring, err)
+	}
+
+	c := exec.Command("secret-tool", "store", "--label=cloak passphrase", "service", keyringService, "account", account)
+	c.Stdin = bytes.NewReader(secret)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("storing the passphrase in the keychain: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// looks secret up with secret-tool(1), which fails without output when
+// nothing is stored
+func keyringLookup(account string) ([]byte, error) {
+
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, errNotInKeyring
+	}
+
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", account).Output()
+	if err != nil {
+		return nil, errNotInKeyring
+	}
+	out = bytes.TrimRight(out, "\n")
+	if len(out) == 0 {
+		return nil, errNotInKeyring
+	}
+	return out, nil
+}
@@ -0,0 +1,196 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// generates an identity and writes it to output, or to stdout when output
+// is empty. the public key is printed either way. age encodes the keys
+// like age-keygen.
+func keygen(output string, force, age, sign bool) error {
+
+	if age && sign {
+		return errors.New("-age and -sign can't be combined, age has no signing keys")
+	}
+	if err := checkOverwrite(output, force); err != nil {
+		return err
+	}
+
+	var public, secret string
+	if sign {
+		key, err := crypt.GenerateSigningKey()
+		if err != nil {
+			return err
+		}
+		public, secret = key.Public().String(), key.String()
+	} else {
+		id, err := crypt.GenerateIdentity()
+		if err != nil {
+			return err
+		}
+		public, secret = id.Recipient().String(), id.String()
+		if age {
+			public, secret = id.Recipient().AgeString(), id.AgeString()
+		}
+	}
+	contents := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), public, secret)
+	if output == "" {
+		fmt.Print(contents)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(output, []byte(contents), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "public key: %s\n", public)
+	return nil
+}
+
+// parses -r recipients and the recipients listed in -R files, one per
+// line with # comments
+func readRecipients(values, files []string) ([]*crypt.Recipient, error) {
+
+	var recipients []*crypt.Recipient
+	for _, v := range values {
+		r, err := crypt.ParseRecipient(v)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			r, err := crypt.ParseRecipient(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			recipients = append(recipients, r)
+		}
+	}
+
+	return recipients, nil
+}
+
+// reads the identities of a file written by keygen, or an SSH private
+// key, prompting for its passphrase when it's encrypted
+func readIdentities(path string) ([]*crypt.Identity, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := crypt.ParseIdentities(b)
+	if errors.Is(err, crypt.ErrSSHKeyEncrypted) {
+		passphrase, err := promptHidden("passphrase of "+path, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		defer wipe(passphrase)
+		id, err := crypt.ParseSSHIdentity(b, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return []*crypt.Identity{id}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ids, nil
+}
+
+// reads the signing key of a file written by keygen -sign, nil when path
+// is empty
+func readSigningKey(path string) (*crypt.SigningKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypt.ParseSigningKey(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// parses -signer values, each a public key printed by keygen -sign or a
+// file listing them one per line with # comments
+func readSigners(values []string) ([]*crypt.VerifyingKey, error) {
+
+	var signers []*crypt.VerifyingKey
+	for _, v := range values {
+		if key, err := crypt.ParseVerifyingKey(v); err == nil {
+			signers = append(signers, key)
+			continue
+		}
+		b, err := ioutil.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("-signer %q is neither a public key nor a readable file", v)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, err := crypt.ParseVerifyingKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", v, err)
+			}
+			signers = append(signers, key)
+		}
+	}
+
+	return signers, nil
+}
+
+// the key provider wrapping the file key, a vault transit key or a
+// hardware token, nil when neither is given
+func keyProvider(vaultKey, token string) (crypt.KeyProvider, error) {
+	switch {
+	case vaultKey != "" && token != "":
+		return nil, errors.New("-vault-key and -token can't be combined")
+	case vaultKey != "":
+		vault, err := crypt.NewVaultTransit(vaultKey)
+		if err != nil {
+			return nil, err
+		}
+		return vault, nil
+	case token != "":
+		t, err := crypt.NewCommandToken(token)
+		if err != nil {
+			return nil, err
+		}
+		return crypt.TokenKey(t), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,70 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// turns repeated -label key=value flags into a map
+func parseLabelFlags(list stringList) (map[string]string, error) {
+
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(list))
+	for _, s := range list {
+		key, value, err := crypt.ParseLabel(s)
+		if err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
+// formats labels as sorted key=value pairs separated by commas
+func formatLabels(labels map[string]string) string {
+
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// prints the labels of every cloak file under paths that matches selector,
+// reports whether any file failed
+func listLabels(paths []string, passphrase []byte, selector map[string]string) bool {
+
+	return walkEncrypted(paths, func(path string) error {
+		labels, err := crypt.Labels(path, passphrase)
+		if err != nil {
+			return err
+		}
+		if !crypt.MatchLabels(labels, selector) {
+			return nil
+		}
+		fmt.Printf("%s: %s\n", path, formatLabels(labels))
+		return nil
+	})
+}
@@ -0,0 +1,204 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/drish/cloak/crypt"
+)
+
+type metaFlag struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+type metaExitCode struct {
+	Code    int    `json:"code"`
+	Meaning string `json:"meaning"`
+}
+
+type metaCommand struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Flags       []metaFlag     `json:"flags"`
+	ExitCodes   []metaExitCode `json:"exit_codes"`
+}
+
+type metaSchema struct {
+	Name     string        `json:"name"`
+	Commands []metaCommand `json:"commands"`
+}
+
+var commandDescriptions = map[string]string{
+	"encrypt":          "encrypts file",
+	"decrypt":          "decrypts file",
+	"hash":             "prints checksums of files",
+	"diff":             "shows changes between two encrypted files",
+	"grep":             "searches encrypted files",
+	"compare":          "checks that an encrypted file matches a plaintext file",
+	"exec":             "runs a command with decrypted files",
+	"doctor":           "checks the environment and encrypted files",
+	"audit-randomness": "finds salts and nonces repeated across encrypted files",
+	"verify":           "authenticates encrypted files without writing the plaintext",
+	"labels":           "prints the labels of encrypted files matching a selector",
+	"rekey":            "encrypts files again with a new passphrase",
+	"migrate":          "rewrites encrypted files in an old format in the current one",
+	"wipe":             "overwrites files with random data and removes them",
+	"prompt":           "asks for a secret without echoing it and writes it encrypted",
+	"pack":             "encrypts several files as named streams of one container",
+	"extract":          "writes or lists the streams of a container",
+	"archive":          "encrypts a directory tree into one file",
+	"unarchive":        "restores a directory tree written by archive",
+	"audit":            "checks an archive against its manifest",
+	"watch":            "encrypts files as they appear in a directory",
+	"mount":            "presents encrypted files decrypted on a mount point",
+	"serve":            "serves encrypt, decrypt and verify over HTTP",
+	"passgen":          "generates random passphrases",
+	"keygen":           "generates an X25519 identity to encrypt files to",
+	"escrow":           "splits a recovery key or passphrase among trustees and assembles it again",
+	"meta":             "describes commands, flags and exit codes",
+	"spec":             "describes the encrypted file formats",
+	"conform":          "checks that encrypted files follow their format",
+	"info":             "describes encrypted files without the passphrase",
+	"completion":       "prints a shell completion script",
+	"shell":            "runs several commands with keys unlocked once",
+}
+
+var (
+	exitOK    = metaExitCode{0, "success"}
+	exitError = metaExitCode{1, "error or missing required flags"}
+	exitFlags = metaExitCode{2, "invalid flags"}
+
+	// failures of encrypt and decrypt scripts can tell apart, by the
+	// crypt.ErrorKind of the error. the codes don't change.
+	kindExitCodes = map[string]metaExitCode{
+		crypt.ErrorKindWrongKey:        {3, "wrong passphrase or key"},
+		crypt.ErrorKindCorrupt:         {4, "corrupt, modified or unsupported encrypted file"},
+		crypt.ErrorKindUntrustedSigner: {5, "file isn't signed by a trusted key"},
+		crypt.ErrorKindOutputExists:    {6, "output file already exists"},
+		crypt.ErrorKindNotFound:        {7, "file not found"},
+		crypt.ErrorKindPermission:      {8, "permission denied"},
+		crypt.ErrorKindWeak:            {9, "passphrase or key derivation parameters refused as too weak"},
+	}
+
+	// commands mimicking diff(1), grep(1) and cmp(1)
+	commandExitCodes = map[string][]metaExitCode{
+		"diff":             {{0, "files are identical"}, {1, "files differ"}, {2, "error"}},
+		"grep":             {{0, "a line matched"}, {1, "no line matched"}, {2, "error"}},
+		"compare":          {{0, "files are identical"}, {1, "files differ"}, {2, "error"}},
+		"audit-randomness": {{0, "nothing was reused"}, {1, "a salt or nonce was reused"}, {2, "error"}},
+		"audit":            {{0, "the archive matches its manifest"}, {1, "files are missing, altered or extra"}, {2, "error"}},
+		"migrate":          {{0, "success, or nothing to migrate with -n"}, {1, "error, or files to migrate with -n"}, {2, "invalid flags"}},
+		"exec":             {{0, "command succeeded"}, {1, "error"}, {2, "invalid flags"}, {-1, "otherwise the exit code of the command"}},
+	}
+)
+
+// describes the given commands and their flags
+func buildMeta(commands []*flag.FlagSet) metaSchema {
+
+	schema := metaSchema{Name: "cloak"}
+
+	for _, cmd := range commands {
+		mc := metaCommand{
+			Name:        cmd.Name(),
+			Description: commandDescriptions[cmd.Name()],
+			Flags:       []metaFlag{},
+			ExitCodes:   commandExitCodes[cmd.Name()],
+		}
+		if mc.ExitCodes == nil {
+			mc.ExitCodes = []metaExitCode{exitOK, exitError, exitFlags}
+		}
+		if cmd.Name() == "encrypt" || cmd.Name() == "decrypt" {
+			mc.ExitCodes = append(mc.ExitCodes, sortedExitCodes(kindExitCodes)...)
+		}
+
+		cmd.VisitAll(func(f *flag.Flag) {
+			mc.Flags = append(mc.Flags, metaFlag{
+				Name:    f.Name,
+				Type:    flagType(f),
+				Default: f.DefValue,
+				Usage:   f.Usage,
+			})
+		})
+
+		schema.Commands = append(schema.Commands, mc)
+	}
+
+	return schema
+}
+
+// the exit codes of m in increasing order
+func sortedExitCodes(m map[string]metaExitCode) []metaExitCode {
+
+	codes := make([]metaExitCode, 0, len(m))
+	for _, c := range m {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// the exit code of encrypt or decrypt failing with err
+func exitCode(err error) int {
+	if c, ok := kindExitCodes[crypt.ErrorKind(err)]; ok {
+		return c.Code
+	}
+	return exitError.Code
+}
+
+func flagType(f *flag.Flag) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "string"
+	}
+	switch getter.Get().(type) {
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	default:
+		return "string"
+	}
+}
+
+// writes the schema as json or as a human readable listing
+func printMeta(w io.Writer, commands []*flag.FlagSet, asJSON bool) error {
+
+	schema := buildMeta(commands)
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(schema)
+	}
+
+	for _, cmd := range schema.Commands {
+		fmt.Fprintf(w, "%s\t%s\n", cmd.Name, cmd.Description)
+		for _, f := range cmd.Flags {
+			fmt.Fprintf(w, "  -%s %s\t%s\n", f.Name, f.Type, f.Usage)
+		}
+		for _, c := range cmd.ExitCodes {
+			fmt.Fprintf(w, "  exit %d\t%s\n", c.Code, c.Meaning)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// upgrades the encrypted files in an old format among paths, walking
+// directories, or only lists them with dryRun. it reports whether any were
+// outdated and whether any failed.
+func migrateFiles(paths []string, passphrase []byte, dryRun bool, opts crypt.Options) (outdated, failed bool) {
+
+	migrate := func(path string, named bool) {
+		why, err := crypt.Outdated(path)
+		if err == crypt.ErrNotEncrypted && !named {
+			return
+		}
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed = true
+			return
+		}
+		if why == "" {
+			if named {
+				fmt.Printf("%s: current\n", path)
+			}
+			return
+		}
+		outdated = true
+		if dryRun {
+			fmt.Printf("%s: %s\n", path, why)
+			return
+		}
+		if _, err := crypt.Migrate(path, passphrase, opts); err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed = true
+			return
+		}
+		fmt.Printf("%s: migrated from the %s\n", path, why)
+	}
+
+	for _, root := range paths {
+		fi, err := os.Stat(root)
+		if err != nil {
+			fmt.Printf("%s: %v\n", root, err)
+			failed = true
+			continue
+		}
+		if !fi.IsDir() {
+			migrate(root, true)
+			continue
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				failed = true
+				return nil
+			}
+			if info.IsDir() && crypt.IsVirtualPath(path) {
+				return filepath.SkipDir
+			}
+			if info.Mode().IsRegular() {
+				migrate(path, false)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("%s: %v\n", root, err)
+			failed = true
+		}
+	}
+
+	return outdated, failed
+}
@@ -0,0 +1,499 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+	"github.com/drish/cloak/internal/fuse"
+)
+
+// mounts the files encrypted under dir decrypted on mountpoint, or only
+// their metadata and verification status when audit is set, until
+// interrupted. an interrupt while files under the mount are open leaves
+// it mounted, the next one tries again.
+func mount(dir, mountpoint string, passphrase []byte, audit bool) error {
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if within(dir, mountpoint) {
+		return errors.New("the mount point can't be inside the encrypted directory")
+	}
+
+	var fs fuse.FS = newDecryptedFS(dir, passphrase)
+	if audit {
+		fs = newAuditFS(dir, passphrase)
+	}
+	conn, err := fuse.Mount(mountpoint, fs)
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		for range sigs {
+			if err := conn.Unmount(); err != nil {
+				log.Printf("%v, close the files under %s and interrupt again", err, mountpoint)
+			}
+		}
+	}()
+
+	log.Println("mounted on: ", mountpoint)
+	return conn.Serve()
+}
+
+// reports whether path is dir or below it
+func within(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// presents the files encrypted under root decrypted. names come from
+// the headers, so listing a directory needs no key derivation. contents
+// are decrypted in memory when a file is opened and wiped once its last
+// handle is closed, plaintext is never written to disk. files that aren't
+// encrypted and hidden files are left out.
+type decryptedFS struct {
+	root       string
+	passphrase []byte
+
+	mu   sync.Mutex
+	dirs map[string]*mountedDir
+	// plaintexts shared by the handles of an encrypted file
+	plain map[string]*openPlain
+	// plaintext sizes of the files decrypted before, their encrypted
+	// size is reported until then
+	sizes map[string]plainSize
+}
+
+// a directory as listed when it had modTime
+type mountedDir struct {
+	modTime time.Time
+	entries map[string]mountedEntry
+	list    []fuse.Dirent
+}
+
+// the encrypted file or directory presented under a name
+type mountedEntry struct {
+	path string
+	dir  bool
+}
+
+type openPlain struct {
+	data []byte
+	refs int
+}
+
+type plainSize struct {
+	modTime time.Time
+	size    int64
+}
+
+func newDecryptedFS(root string, passphrase []byte) *decryptedFS {
+	return &decryptedFS{
+		root:       root,
+		passphrase: passphrase,
+		dirs:       make(map[string]*mountedDir),
+		plain:      make(map[string]*openPlain),
+		sizes:      make(map[string]plainSize),
+	}
+}
+
+// lists the directory at the slash separated path under root, again only
+// when it changed
+func (fs *decryptedFS) list(dir string) (*mountedDir, error) {
+
+	real := filepath.Join(fs.root, filepath.FromSlash(dir))
+	fi, err := os.Stat(real)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	d, ok := fs.dirs[dir]
+	fs.mu.Unlock()
+	if ok && d.modTime.Equal(fi.ModTime()) {
+		return d, nil
+	}
+
+	infos, err := ioutil.ReadDir(real)
+	if err != nil {
+		return nil, err
+	}
+	d = &mountedDir{modTime: fi.ModTime(), entries: make(map[string]mountedEntry)}
+	for _, fi := range infos {
+		name := fi.Name()
+		p := filepath.Join(real, name)
+		// hidden files and the temporary files outputs are staged in
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if fi.IsDir() {
+			d.entries[name] = mountedEntry{path: p, dir: true}
+			d.list = append(d.list, fuse.Dirent{Name: name, Dir: true})
+			continue
+		}
+		if !fi.Mode().IsRegular() || filepath.Ext(name) != crypt.Extension {
+			continue
+		}
+		info, err := crypt.ReadFormat(p)
+		if err != nil {
+			continue
+		}
+		// streams don't record the extension
+		plain := strings.TrimSuffix(name, crypt.Extension) + info.Ext
+		if _, taken := d.entries[plain]; taken {
+			continue
+		}
+		d.entries[plain] = mountedEntry{path: p}
+		d.list = append(d.list, fuse.Dirent{Name: plain})
+	}
+
+	fs.mu.Lock()
+	fs.dirs[dir] = d
+	fs.mu.Unlock()
+	return d, nil
+}
+
+// the entry presented at the slash separated path
+func (fs *decryptedFS) lookup(p string) (mountedEntry, error) {
+
+	if p == "." {
+		return mountedEntry{path: fs.root, dir: true}, nil
+	}
+	d, err := fs.list(path.Dir(p))
+	if err != nil {
+		return mountedEntry{}, err
+	}
+	e, ok := d.entries[path.Base(p)]
+	if !ok {
+		return mountedEntry{}, os.ErrNotExist
+	}
+	return e, nil
+}
+
+func (fs *decryptedFS) Stat(p string) (fuse.Attr, error) {
+
+	e, err := fs.lookup(p)
+	if err != nil {
+		return fuse.Attr{}, err
+	}
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return fuse.Attr{}, err
+	}
+	if e.dir {
+		return fuse.Attr{Mode: os.ModeDir | fi.Mode().Perm(), ModTime: fi.ModTime()}, nil
+	}
+
+	size := fi.Size()
+	fs.mu.Lock()
+	if s, ok := fs.sizes[e.path]; ok && s.modTime.Equal(fi.ModTime()) {
+		size = s.size
+	}
+	fs.mu.Unlock()
+	return fuse.Attr{Mode: fi.Mode().Perm(), Size: size, ModTime: fi.ModTime()}, nil
+}
+
+func (fs *decryptedFS) ReadDir(p string) ([]fuse.Dirent, error) {
+
+	d, err := fs.list(p)
+	if err != nil {
+		return nil, err
+	}
+	return d.list, nil
+}
+
+func (fs *decryptedFS) Open(p string) (fuse.File, error) {
+
+	e, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if e.dir {
+		return nil, syscall.EISDIR
+	}
+
+	fs.mu.Lock()
+	if op, ok := fs.plain[e.path]; ok {
+		op.refs++
+		fs.mu.Unlock()
+		return &plainHandle{fs: fs, path: e.path, plain: op}, nil
+	}
+	fs.mu.Unlock()
+
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := crypt.Plaintext(e.path, fs.passphrase)
+	if err != nil {
+		log.Printf("%s: %v", p, err)
+		if errors.Is(err, crypt.ErrWrongPassphrase) || errors.Is(err, crypt.ErrRecipients) || errors.Is(err, crypt.ErrKeyFileRequired) {
+			return nil, os.ErrPermission
+		}
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// opened meanwhile
+	if op, ok := fs.plain[e.path]; ok {
+		wipe(data)
+		op.refs++
+		return &plainHandle{fs: fs, path: e.path, plain: op}, nil
+	}
+	op := &openPlain{data: data, refs: 1}
+	fs.plain[e.path] = op
+	fs.sizes[e.path] = plainSize{modTime: fi.ModTime(), size: int64(len(data))}
+	return &plainHandle{fs: fs, path: e.path, plain: op}, nil
+}
+
+// a handle on a decrypted file
+type plainHandle struct {
+	fs    *decryptedFS
+	path  string
+	plain *openPlain
+}
+
+func (h *plainHandle) ReadAt(b []byte, off int64) (int, error) {
+	return bytes.NewReader(h.plain.data).ReadAt(b, off)
+}
+
+func (h *plainHandle) Close() error {
+	h.fs.mu.Lock()
+	defer h.fs.mu.Unlock()
+	h.plain.refs--
+	if h.plain.refs == 0 {
+		wipe(h.plain.data)
+		delete(h.fs.plain, h.path)
+	}
+	return nil
+}
+
+// presents the files encrypted under root as directories of two virtual
+// files, for audits that mustn't expose any plaintext: info holds what
+// cloak info reports and status whether the file conforms to its format
+// and, when a passphrase is given, decrypts. the plaintext of a check is
+// only held in memory and wiped. a status is checked when it's first
+// looked at and again once the file changed.
+type auditFS struct {
+	root       string
+	passphrase []byte
+
+	mu sync.Mutex
+	// contents of the virtual files by the path of their file
+	files map[string]auditFiles
+}
+
+// the virtual files of an encrypted file as it was at modTime
+type auditFiles struct {
+	modTime time.Time
+	info    []byte
+	status  []byte
+}
+
+func newAuditFS(root string, passphrase []byte) *auditFS {
+	return &auditFS{root: root, passphrase: passphrase, files: make(map[string]auditFiles)}
+}
+
+// reports whether fi is listed, directories and encrypted files that
+// aren't hidden
+func (fs *auditFS) listed(p string, fi os.FileInfo) bool {
+
+	if strings.HasPrefix(fi.Name(), ".") {
+		return false
+	}
+	if fi.IsDir() {
+		return true
+	}
+	if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != crypt.Extension {
+		return false
+	}
+	_, err := crypt.ReadFormat(p)
+	return err == nil
+}
+
+// the file under root at the slash separated path p and the name of the
+// virtual file below it, if any
+func (fs *auditFS) lookup(p string) (string, os.FileInfo, string, error) {
+
+	real := filepath.Join(fs.root, filepath.FromSlash(p))
+	fi, err := os.Stat(real)
+	if p == "." {
+		return real, fi, "", err
+	}
+	if err == nil {
+		if !fs.listed(real, fi) {
+			return "", nil, "", os.ErrNotExist
+		}
+		return real, fi, "", nil
+	}
+
+	// a virtual file of an encrypted file
+	name := path.Base(p)
+	if name != "info" && name != "status" {
+		return "", nil, "", os.ErrNotExist
+	}
+	real = filepath.Dir(real)
+	fi, err = os.Stat(real)
+	if err != nil || fi.IsDir() || !fs.listed(real, fi) {
+		return "", nil, "", os.ErrNotExist
+	}
+	return real, fi, name, nil
+}
+
+// the contents of the virtual file name of the encrypted file at p
+func (fs *auditFS) contents(p string, fi os.FileInfo, name string) []byte {
+
+	fs.mu.Lock()
+	files, ok := fs.files[p]
+	fs.mu.Unlock()
+	if !ok || !files.modTime.Equal(fi.ModTime()) {
+		files = auditFiles{modTime: fi.ModTime()}
+	}
+	if name == "info" && files.info == nil {
+		files.info = fs.info(p)
+	}
+	if name == "status" && files.status == nil {
+		files.status = fs.status(p)
+	}
+
+	fs.mu.Lock()
+	fs.files[p] = files
+	fs.mu.Unlock()
+	if name == "info" {
+		return files.info
+	}
+	return files.status
+}
+
+// what cloak info reports about the encrypted file at p
+func (fs *auditFS) info(p string) []byte {
+
+	info, err := crypt.Inspect(p)
+	if err != nil {
+		return []byte(fmt.Sprintf("error: %v\n", err))
+	}
+	var b bytes.Buffer
+	writeInfo(&b, info)
+	return b.Bytes()
+}
+
+// verified, conforms without a passphrase or failed with the reason
+func (fs *auditFS) status(p string) []byte {
+
+	err := crypt.Conform(p)
+	if err == nil && fs.passphrase != nil {
+		err = crypt.Verify(p, fs.passphrase)
+	}
+	switch {
+	case err != nil:
+		return []byte(fmt.Sprintf("failed: %v\n", err))
+	case fs.passphrase == nil:
+		return []byte("conforms\n")
+	}
+	return []byte("verified\n")
+}
+
+func (fs *auditFS) Stat(p string) (fuse.Attr, error) {
+
+	real, fi, name, err := fs.lookup(p)
+	if err != nil {
+		return fuse.Attr{}, err
+	}
+	switch {
+	case fi.IsDir():
+		return fuse.Attr{Mode: os.ModeDir | fi.Mode().Perm(), ModTime: fi.ModTime()}, nil
+	case name == "":
+		// an encrypted file is listed as a directory of its virtual files
+		return fuse.Attr{Mode: os.ModeDir | 0500, ModTime: fi.ModTime()}, nil
+	}
+	size := len(fs.contents(real, fi, name))
+	return fuse.Attr{Mode: 0400, Size: int64(size), ModTime: fi.ModTime()}, nil
+}
+
+func (fs *auditFS) ReadDir(p string) ([]fuse.Dirent, error) {
+
+	real, fi, name, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		return nil, syscall.ENOTDIR
+	}
+	if !fi.IsDir() {
+		return []fuse.Dirent{{Name: "info"}, {Name: "status"}}, nil
+	}
+
+	infos, err := ioutil.ReadDir(real)
+	if err != nil {
+		return nil, err
+	}
+	var list []fuse.Dirent
+	for _, fi := range infos {
+		if fs.listed(filepath.Join(real, fi.Name()), fi) {
+			list = append(list, fuse.Dirent{Name: fi.Name(), Dir: true})
+		}
+	}
+	return list, nil
+}
+
+func (fs *auditFS) Open(p string) (fuse.File, error) {
+
+	real, fi, name, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, syscall.EISDIR
+	}
+	return auditFile{bytes.NewReader(fs.contents(real, fi, name))}, nil
+}
+
+// a handle on a virtual file of auditFS
+type auditFile struct {
+	*bytes.Reader
+}
+
+func (auditFile) Close() error {
+	return nil
+}
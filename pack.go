@@ -0,0 +1,80 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// reads name=path arguments into container streams, a bare path is
+// stored under its base name
+func readStreams(args []string) ([]crypt.Stream, error) {
+
+	streams := make([]crypt.Stream, 0, len(args))
+	for _, arg := range args {
+		name, path := filepath.Base(arg), arg
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 {
+			name, path = parts[0], parts[1]
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, crypt.Stream{Name: name, Data: data})
+	}
+	return streams, nil
+}
+
+// prints the names and sizes of the streams of a container
+func listStreams(path string, passphrase []byte) error {
+
+	streams, err := crypt.OpenContainer(path, passphrase)
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		fmt.Printf("%s\t%d\n", s.Name, len(s.Data))
+	}
+	return nil
+}
+
+// writes the named stream of a container to output, or to a file named
+// after the stream, readable by the owner only like decrypted files
+func extractStream(path string, passphrase []byte, name, output string, force bool) error {
+
+	if output == "" {
+		output = name
+	}
+	if err := checkOverwrite(output, force); err != nil {
+		return err
+	}
+
+	data, err := crypt.ExtractStream(path, passphrase, name)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(output, data, 0600); err != nil {
+		return err
+	}
+	log.Println("output file: ", output)
+	return nil
+}
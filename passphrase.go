@@ -0,0 +1,328 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// environment variable holding the passphrase when no passphrase flag is
+// given, so scripts don't have to name it with -pass-env
+const passphraseEnv = "CLOAK_PASSPHRASE"
+
+// longest passphrase read from a file descriptor
+const maxPassphraseSize = 4096
+
+// the ways a command can be given a passphrase, at most one may be used
+type passphraseSource struct {
+	// prefix of the flag names, such as new-, and what is prompted for
+	prefix string
+	what   string
+	value  *string
+	env    *string
+	file   *string
+	fd     *int
+	prompt *bool
+}
+
+// registers -pass-env, -pass-file, -passphrase-fd and -prompt next to an
+// existing -p flag
+func addPassphraseFlags(fs *flag.FlagSet, value *string) *passphraseSource {
+	return addPrefixedPassphraseFlags(fs, value, "", "passphrase")
+}
+
+// like addPassphraseFlags but names the flags with prefix, for commands
+// taking a second passphrase described as what
+func addPrefixedPassphraseFlags(fs *flag.FlagSet, value *string, prefix, what string) *passphraseSource {
+	return &passphraseSource{
+		prefix: prefix,
+		what:   what,
+		value:  value,
+		env:    fs.String(prefix+"pass-env", "", "[optional] reads the "+what+" from the named environment variable"),
+		file:   fs.String(prefix+"pass-file", "", "[optional] reads the "+what+" from the first line of a file"),
+		fd:     fs.Int(prefix+"passphrase-fd", -1, "[optional] reads the "+what+" from the first line of an open file descriptor, such as 3"),
+		prompt: fs.Bool(prefix+"prompt", false, "[optional] prompts for the "+what+" without echoing it"),
+	}
+}
+
+// reports whether any of the passphrase flags was given
+func (s *passphraseSource) given() bool {
+	return *s.value != "" || *s.env != "" || *s.file != "" || *s.fd >= 0 || *s.prompt
+}
+
+// returns the passphrase from whichever source was set, or nil if none
+// was. confirm asks twice when prompting. when no flag was given and
+// useEnv is set the passphrase is read from CLOAK_PASSPHRASE instead, if
+// it is set.
+func (s *passphraseSource) resolve(confirm, useEnv bool) ([]byte, error) {
+
+	set := 0
+	for _, v := range []bool{*s.value != "", *s.env != "", *s.file != "", *s.fd >= 0, *s.prompt} {
+		if v {
+			set++
+		}
+	}
+	if set > 1 {
+		p := s.prefix
+		return nil, fmt.Errorf("only one of -%sp, -%spass-env, -%spass-file, -%spassphrase-fd and -%sprompt can be used", p, p, p, p, p)
+	}
+
+	switch {
+	case *s.value != "":
+		return []byte(*s.value), nil
+
+	case *s.env != "":
+		v := os.Getenv(*s.env)
+		if v == "" {
+			return nil, fmt.Errorf("environment variable %s is empty or not set", *s.env)
+		}
+		return []byte(v), nil
+
+	case *s.file != "":
+		return readPassphraseFile(*s.file)
+
+	case *s.fd >= 0:
+		return readPassphraseFd(*s.fd)
+
+	case *s.prompt:
+		return promptHidden(s.what, confirm)
+	}
+
+	if !useEnv {
+		return nil, nil
+	}
+	if v, ok := os.LookupEnv(passphraseEnv); ok {
+		if v == "" {
+			return nil, fmt.Errorf("environment variable %s is set but empty", passphraseEnv)
+		}
+		return []byte(v), nil
+	}
+
+	return nil, nil
+}
+
+// how commands choosing a passphrase check it, -weak-passphrase says
+// whether a passphrase below the policy is refused, only warned about, or
+// allowed
+type passphrasePolicy struct {
+	action     *string
+	minEntropy *int
+	denyList   *string
+}
+
+// registers -weak-passphrase, -min-entropy and -deny-list
+func addPolicyFlags(fs *flag.FlagSet) *passphrasePolicy {
+	return &passphrasePolicy{
+		action:     fs.String("weak-passphrase", "warn", "[optional] warn, refuse or allow a passphrase weaker than -min-entropy or on the -deny-list"),
+		minEntropy: fs.Int("min-entropy", int(crypt.DefaultPassphrasePolicy.MinEntropy), "[optional] least estimated entropy of a passphrase in bits"),
+		denyList:   fs.String("deny-list", "", "[optional] file of refused passphrases, one per line, also counted as words when estimating the strength"),
+	}
+}
+
+// checks a passphrase chosen by the user against the policy, logging a
+// warning or returning the reason it is refused. nil, when no passphrase
+// was given, is never checked.
+func (p *passphrasePolicy) check(passphrase []byte) error {
+
+	if passphrase == nil {
+		return nil
+	}
+	switch *p.action {
+	case "allow":
+		return nil
+	case "warn", "refuse":
+	default:
+		return fmt.Errorf("unknown -weak-passphrase %q, supported: warn, refuse, allow", *p.action)
+	}
+
+	policy := crypt.PassphrasePolicy{MinEntropy: float64(*p.minEntropy)}
+	if *p.denyList != "" {
+		b, err := ioutil.ReadFile(*p.denyList)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSuffix(line, "\r"); line != "" {
+				policy.Deny = append(policy.Deny, line)
+			}
+		}
+	}
+
+	err := policy.Check(passphrase)
+	if err != nil && *p.action == "warn" {
+		log.Printf("warning: %v", err)
+		return nil
+	}
+	return err
+}
+
+// how a passphrase is generated, the flags are named with a prefix such
+// as gen- on commands that generate one when none is given
+type generatorFlags struct {
+	words   *int
+	length  *int
+	charset *string
+	sep     *string
+}
+
+// registers -words, -length, -charset and -sep with prefix
+func addGeneratorFlags(fs *flag.FlagSet, prefix string) *generatorFlags {
+	return &generatorFlags{
+		words:   fs.Int(prefix+"words", 0, "[optional] generates a diceware phrase of this many common words, about 11 bits each, instead of characters"),
+		length:  fs.Int(prefix+"length", 0, "[optional] number of characters of the generated passphrase, defaults to 32"),
+		charset: fs.String(prefix+"charset", "", "[optional] characters of the generated passphrase, hex, alnum, printable or the characters themselves, defaults to hex"),
+		sep:     fs.String(prefix+"sep", "", "[optional] separator between the words of a generated diceware phrase, defaults to -"),
+	}
+}
+
+// reports whether any of the generator flags was given
+func (g *generatorFlags) given() bool {
+	return *g.words != 0 || *g.length != 0 || *g.charset != "" || *g.sep != ""
+}
+
+// the generator described by the flags
+func (g *generatorFlags) generator() (crypt.PassphraseGenerator, error) {
+
+	charset := *g.charset
+	switch charset {
+	case "hex":
+		charset = crypt.HexCharset
+	case "alnum":
+		charset = crypt.AlphanumericCharset
+	case "printable":
+		charset = crypt.PrintableCharset
+	}
+	gen := crypt.PassphraseGenerator{Words: *g.words, Separator: *g.sep, Length: *g.length, Charset: charset}
+	if *g.sep != "" && *g.words == 0 {
+		return gen, errors.New("a separator only goes between the words of a diceware phrase")
+	}
+	// checks the combination before anything is encrypted
+	if _, err := gen.Generate(); err != nil {
+		return gen, err
+	}
+	return gen, nil
+}
+
+// prints count passphrases generated by gen, one per line, or as json
+// lines with their entropy
+func passgen(gen crypt.PassphraseGenerator, count int, asJSON bool) error {
+
+	enc := json.NewEncoder(os.Stdout)
+	for i := 0; i < count; i++ {
+		p, err := gen.Generate()
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			err = enc.Encode(struct {
+				Passphrase string  `json:"passphrase"`
+				Bits       float64 `json:"entropy_bits"`
+			}{string(p), math.Round(gen.Entropy()*10) / 10})
+		} else {
+			_, err = fmt.Printf("%s\n", p)
+		}
+		wipe(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reads the passphrase on the first line of file
+func readPassphraseFile(file string) ([]byte, error) {
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return firstLine(b, "passphrase file "+file)
+}
+
+// reads the passphrase on the first line of the open file descriptor fd,
+// such as a pipe set up by the calling script, and closes it
+func readPassphraseFd(fd int) ([]byte, error) {
+
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+
+	// stops at the first line, the writer may keep the pipe open
+	line, err := bufio.NewReader(io.LimitReader(f, maxPassphraseSize)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading the passphrase from fd %d: %v", fd, err)
+	}
+	return firstLine([]byte(line), fmt.Sprintf("fd %d", fd))
+}
+
+// the first line of b, without its line ending. what names the source in
+// errors.
+func firstLine(b []byte, what string) ([]byte, error) {
+
+	line := strings.SplitN(string(b), "\n", 2)[0]
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" {
+		return nil, fmt.Errorf("%s is empty", what)
+	}
+	return []byte(line), nil
+}
+
+// reads the passphrase of each file
+func readPassphraseFiles(files []string) ([][]byte, error) {
+
+	var passphrases [][]byte
+	for _, f := range files {
+		p, err := readPassphraseFile(f)
+		if err != nil {
+			return nil, err
+		}
+		passphrases = append(passphrases, p)
+	}
+	return passphrases, nil
+}
+
+// the file argument of encrypt and decrypt, either -f or the first
+// positional argument
+func fileArg(fs *flag.FlagSet, f string) string {
+	if f != "" {
+		return f
+	}
+	return fs.Arg(0)
+}
+
+// fails unless force is set when path already exists, standard output
+// is never replaced
+func checkOverwrite(path string, force bool) error {
+	if force || path == "" || path == crypt.Stdio {
+		return nil
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%w: %s, use -force to overwrite it", crypt.ErrOutputExists, path)
+	}
+	return nil
+}
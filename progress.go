@@ -0,0 +1,80 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+)
+
+const progressWidth = 30
+
+// draws a progress bar on one line of w, redrawn at most every 100ms
+type progressBar struct {
+	w     io.Writer
+	label string
+	last  time.Time
+	drawn bool
+}
+
+func newProgressBar(w io.Writer, label string) *progressBar {
+	return &progressBar{w: w, label: label}
+}
+
+// the callback to pass as crypt.Options.Progress
+func (p *progressBar) report() crypt.ProgressFunc {
+
+	return func(done, total int64) {
+		if time.Since(p.last) < 100*time.Millisecond && done != total {
+			return
+		}
+		p.last = time.Now()
+		p.drawn = true
+
+		if total <= 0 {
+			fmt.Fprintf(p.w, "\r%s %s", p.label, formatBytes(done))
+			return
+		}
+		filled := int(done * progressWidth / total)
+		fmt.Fprintf(p.w, "\r%s [%s%s] %3d%% %s of %s", p.label,
+			strings.Repeat("#", filled), strings.Repeat(" ", progressWidth-filled),
+			done*100/total, formatBytes(done), formatBytes(total))
+	}
+}
+
+// ends the line of the bar so later output starts on its own
+func (p *progressBar) finish() {
+	if p.drawn {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// formats n bytes with a binary unit, such as 1.5 GiB
+func formatBytes(n int64) string {
+
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
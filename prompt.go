@@ -0,0 +1,97 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/drish/cloak/crypt"
+	"github.com/drish/cloak/internal/term"
+)
+
+// asks for a value on the terminal without echoing it, twice when confirm
+// is set
+func promptHidden(label string, confirm bool) ([]byte, error) {
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errors.New("prompting requires a terminal on stdin")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	value, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("%s can't be empty", label)
+	}
+
+	if confirm {
+		fmt.Fprintf(os.Stderr, "confirm %s: ", label)
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(again)
+		if !bytes.Equal(value, again) {
+			wipe(value)
+			return nil, fmt.Errorf("%s doesn't match", label)
+		}
+	}
+
+	return value, nil
+}
+
+// shows a passphrase encrypt generated because none was given, on stderr
+// rather than through the log so it doesn't end up in log files
+func showGenerated(given []byte, res *crypt.Result) {
+	if given == nil && res.Secret != nil {
+		fmt.Fprintf(os.Stderr, "generated passphrase: %s\n", res.Secret.Reveal())
+	}
+}
+
+// prompts for a secret and writes it encrypted to out, the secret is
+// never written to disk or the environment in the clear
+func promptToFile(out string, passphrase []byte, opts crypt.Options) error {
+
+	secret, err := promptHidden("secret", true)
+	if err != nil {
+		return err
+	}
+	defer wipe(secret)
+
+	if len(passphrase) == 0 {
+		passphrase, err = promptHidden("passphrase", true)
+		if err != nil {
+			return err
+		}
+		defer wipe(passphrase)
+	}
+
+	_, err = crypt.EncryptData(secret, out, passphrase, opts)
+	return err
+}
+
+// overwrites b with zeros
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
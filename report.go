@@ -0,0 +1,38 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// writes the report of operation on path as json, for -json
+func writeReport(w io.Writer, operation, path string, res *crypt.Result, err error) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(crypt.NewReport(operation, path, res, err))
+}
+
+// ends an encrypt or decrypt of path that failed with err, already
+// logged, with the exit code of err, printing its report first with -json
+func failAndExit(operation, path string, res *crypt.Result, err error, asJSON bool) {
+	if asJSON {
+		writeReport(os.Stdout, operation, path, res, err)
+	}
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// encrypts path as a stream to opts.OutputPath, or the file with its
+// extension replaced by .cloak, recording its progress in statePath, and
+// returns the output written
+func encryptResumable(path, statePath string, passphrase []byte, opts crypt.Options) (string, error) {
+
+	output := opts.OutputPath
+	if output == "" {
+		output = crypt.EncryptedName(path)
+	}
+	logResuming(statePath)
+	return output, crypt.EncryptResumable(path, output, statePath, passphrase, opts)
+}
+
+// decrypts the stream at path to output, or out as streams record no
+// extension, recording its progress in statePath, and returns the output
+// written
+func decryptResumable(path, statePath string, passphrase []byte, output string, force bool, mode string, progress bool) (string, error) {
+
+	if output == "" {
+		output = "out"
+	}
+	m, err := parseMode(mode)
+	if err != nil {
+		return output, err
+	}
+
+	opts := crypt.Options{Mode: m, Overwrite: force}
+	bar := newProgressBar(os.Stderr, "decrypting")
+	if progress {
+		opts.Progress = bar.report()
+	}
+	logResuming(statePath)
+	err = crypt.DecryptResumable(path, output, statePath, passphrase, opts)
+	bar.finish()
+	return output, err
+}
+
+func logResuming(statePath string) {
+	if _, err := os.Stat(statePath); err == nil {
+		log.Println("resuming from ", statePath)
+	}
+}
+
+// encrypts path in place and renames it to opts.OutputPath, or the file
+// with its extension replaced by .cloak, and returns the output written
+func encryptInPlace(path string, passphrase []byte, opts crypt.Options) (string, error) {
+
+	output := opts.OutputPath
+	if output == "" {
+		output = crypt.EncryptedName(path)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".journal")); err == nil {
+		log.Println("completing from the journal of ", path)
+	}
+	return output, crypt.EncryptInPlace(path, passphrase, opts)
+}
@@ -0,0 +1,214 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+	"github.com/drish/cloak/internal/sandbox"
+)
+
+// set in the environment of the child decryptSandboxed starts
+const sandboxEnv = "CLOAK_SANDBOXED"
+
+// what the parent sends the sandboxed child on descriptor 3
+type sandboxRequest struct {
+	Passphrase  []byte `json:"passphrase"`
+	Strict      bool   `json:"strict"`
+	AllowLegacy bool   `json:"allow_legacy"`
+}
+
+// decrypts the file at path with passphrase in a child process confined
+// with seccomp, so a flaw in parsing the untrusted file can't reach
+// anything but the descriptors it's given: the file on its standard
+// input, the plaintext streamed back on its standard output and its
+// report on descriptor 4. the parent never parses the file, so output
+// defaults to out without the recorded extension and no metadata is
+// restored. the output only appears once the child succeeded.
+func decryptSandboxed(path, output string, passphrase []byte, force, strict, allowLegacy bool, mode os.FileMode) (crypt.Report, error) {
+
+	if output == "" {
+		output = "out"
+	}
+	report := crypt.Report{Operation: "decrypt", Input: path, Output: output}
+	if err := checkOverwrite(output, force); err != nil {
+		return report, err
+	}
+
+	in := os.Stdin
+	if path != crypt.Stdio {
+		f, err := os.Open(path)
+		if err != nil {
+			return report, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	out := os.Stdout
+	if output != crypt.Stdio {
+		tmp, err := ioutil.TempFile(filepath.Dir(output), ".cloak-sandbox-")
+		if err != nil {
+			return report, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		out = tmp
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return report, err
+	}
+	reqR, reqW, err := os.Pipe()
+	if err != nil {
+		return report, err
+	}
+	defer reqR.Close()
+	defer reqW.Close()
+	resR, resW, err := os.Pipe()
+	if err != nil {
+		return report, err
+	}
+	defer resR.Close()
+	defer resW.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(), sandboxEnv+"=1")
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	cmd.ExtraFiles = []*os.File{reqR, resW}
+	if err := cmd.Start(); err != nil {
+		return report, err
+	}
+	reqR.Close()
+	resW.Close()
+
+	req, _ := json.Marshal(sandboxRequest{Passphrase: passphrase, Strict: strict, AllowLegacy: allowLegacy})
+	reqW.Write(req)
+	wipe(req)
+	reqW.Close()
+
+	decodeErr := json.NewDecoder(resR).Decode(&report)
+	waitErr := cmd.Wait()
+	report.Input, report.Output = path, output
+	switch {
+	case decodeErr != nil || waitErr != nil && report.OK:
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" && waitErr != nil {
+			msg = waitErr.Error()
+		}
+		return report, fmt.Errorf("the sandboxed decryption failed: %s", msg)
+	case !report.OK:
+		return report, &sandboxError{msg: report.Error, kind: report.ErrorKind}
+	}
+
+	if out == os.Stdout {
+		return report, nil
+	}
+	if mode == 0 {
+		mode = 0600
+	}
+	if err := out.Chmod(mode); err != nil {
+		return report, err
+	}
+	if err := out.Sync(); err != nil {
+		return report, err
+	}
+	if err := out.Close(); err != nil {
+		return report, err
+	}
+	return report, os.Rename(out.Name(), output)
+}
+
+// the error a sandboxed decryption reported, it matches the sentinel of
+// its kind so it's reported and exits like the original error
+type sandboxError struct {
+	msg, kind string
+}
+
+func (e *sandboxError) Error() string {
+	return e.msg
+}
+
+func (e *sandboxError) Is(target error) bool {
+	return sandboxKinds[e.kind] == target
+}
+
+// an error of each kind crypt.ErrorKind reports
+var sandboxKinds = map[string]error{
+	crypt.ErrorKindWrongKey:        crypt.ErrWrongPassphrase,
+	crypt.ErrorKindCorrupt:         crypt.ErrCorruptFile,
+	crypt.ErrorKindUntrustedSigner: crypt.ErrUntrustedSigner,
+	crypt.ErrorKindOutputExists:    crypt.ErrOutputExists,
+	crypt.ErrorKindNotFound:        os.ErrNotExist,
+	crypt.ErrorKindPermission:      os.ErrPermission,
+	crypt.ErrorKindWeak:            crypt.ErrWeakParams,
+}
+
+// runs in the child started by decryptSandboxed: reads the request,
+// confines itself and decrypts its standard input to its standard output,
+// then reports how it went
+func sandboxedChild() {
+
+	results := os.NewFile(4, "results")
+	var req sandboxRequest
+	err := json.NewDecoder(os.NewFile(3, "request")).Decode(&req)
+	if err == nil {
+		err = sandbox.Restrict()
+	}
+
+	var res *crypt.Result
+	if err == nil {
+		opts := crypt.Options{OutputPath: crypt.Stdio, Strict: req.Strict, AllowLegacy: req.AllowLegacy, NoMetadata: true}
+		res, err = crypt.DecryptWithOptions(crypt.Stdio, req.Passphrase, opts)
+	}
+	wipe(req.Passphrase)
+
+	if err := json.NewEncoder(results).Encode(crypt.NewReport("decrypt", crypt.Stdio, res, err)); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// logs the signer and warnings of a sandboxed decryption like decrypt
+// does, and prints its report with -json
+func reportSandboxed(report crypt.Report, asJSON bool) {
+
+	if report.Signer != "" {
+		log.Println("signed by: ", report.Signer)
+	}
+	for _, w := range report.Warnings {
+		log.Printf("warning: %s", w)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	}
+}
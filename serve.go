@@ -0,0 +1,272 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// the header requests send their passphrase in, the server's own is used
+// when it's missing
+const passphraseHeader = "Cloak-Passphrase"
+
+// serves encrypt, decrypt and verify over HTTP on the unix socket, or on
+// addr when set, until interrupted. bodies are the stream format of
+// EncryptStream, so they're never held in memory. passphrase is used for
+// requests that don't send one, it may be nil, and kdf derives the key of
+// the streams encrypted.
+func serve(socket, addr string, passphrase []byte, cipher crypt.CipherID, kdf crypt.KDFParams) error {
+
+	l, err := listen(socket, addr)
+	if err != nil {
+		return err
+	}
+
+	s := &server{passphrase: passphrase, cipher: cipher, kdf: kdf}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/encrypt", post(s.encrypt))
+	mux.HandleFunc("/v1/decrypt", post(s.decrypt))
+	mux.HandleFunc("/v1/verify", post(s.verify))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// lets the requests in flight finish
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	log.Println("serving on: ", l.Addr())
+	err = srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// the socket used when serve isn't given one, private to the user when
+// XDG_RUNTIME_DIR is set
+func defaultSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "cloak.sock")
+}
+
+// reports whether the tcp address addr only accepts connections from this
+// host. an empty host listens on every interface
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listens on addr over tcp when set, on socket otherwise. the socket is
+// only accessible to the user, as whoever connects can use the server's
+// passphrase.
+func listen(socket, addr string) (net.Listener, error) {
+
+	if addr != "" {
+		return net.Listen("tcp", addr)
+	}
+
+	if fi, err := os.Lstat(socket); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", socket)
+		}
+		if c, err := net.Dial("unix", socket); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another server", socket)
+		}
+		// left behind by a server that didn't exit cleanly
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// refuses requests to h with another method than POST
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			replyError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s takes POST requests", r.URL.Path))
+			return
+		}
+		h(w, r)
+	}
+}
+
+type server struct {
+	passphrase []byte
+	cipher     crypt.CipherID
+	kdf        crypt.KDFParams
+}
+
+// the passphrase and options of r, replying with an error and returning
+// false when they're invalid
+func (s *server) request(w http.ResponseWriter, r *http.Request) ([]byte, crypt.Options, bool) {
+
+	passphrase := s.passphrase
+	if p := r.Header.Get(passphraseHeader); p != "" {
+		passphrase = []byte(p)
+	}
+	if passphrase == nil {
+		replyError(w, http.StatusBadRequest, fmt.Errorf("a passphrase is required, send it in the %s header", passphraseHeader))
+		return nil, crypt.Options{}, false
+	}
+
+	opts := crypt.Options{Cipher: s.cipher, KDF: s.kdf}
+	if name := r.URL.Query().Get("cipher"); name != "" {
+		cipher, err := parseCipher(name)
+		if err != nil {
+			replyError(w, http.StatusBadRequest, err)
+			return nil, crypt.Options{}, false
+		}
+		opts.Cipher = cipher
+	}
+
+	// the body is still read while the response is written
+	http.NewResponseController(w).EnableFullDuplex()
+	// reading before the response is started answers clients waiting
+	// for 100 Continue, their body is refused otherwise
+	body := bufio.NewReader(r.Body)
+	body.Peek(1)
+	r.Body = ioutil.NopCloser(body)
+
+	return passphrase, opts, true
+}
+
+// POST /v1/encrypt replies with the encrypted stream of the body
+func (s *server) encrypt(w http.ResponseWriter, r *http.Request) {
+
+	passphrase, opts, ok := s.request(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	out := &responseWriter{ResponseWriter: w}
+	s.finish(out, r, crypt.EncryptStreamWithOptions(r.Body, out, passphrase, opts))
+}
+
+// POST /v1/decrypt replies with the plaintext of the encrypted stream in
+// the body
+func (s *server) decrypt(w http.ResponseWriter, r *http.Request) {
+
+	passphrase, opts, ok := s.request(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	out := &responseWriter{ResponseWriter: w}
+	s.finish(out, r, crypt.DecryptStreamWithOptions(r.Body, out, passphrase, opts))
+}
+
+// POST /v1/verify authenticates the encrypted stream in the body without
+// replying with its plaintext
+func (s *server) verify(w http.ResponseWriter, r *http.Request) {
+
+	passphrase, opts, ok := s.request(w, r)
+	if !ok {
+		return
+	}
+	err := crypt.DecryptStreamWithOptions(r.Body, ioutil.Discard, passphrase, opts)
+	if err != nil {
+		s.finish(&responseWriter{ResponseWriter: w}, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+// replies with err unless the response was already started, in which
+// case the connection is dropped so the client can't take the truncated
+// body for a complete one
+func (s *server) finish(w *responseWriter, r *http.Request, err error) {
+
+	if err == nil {
+		return
+	}
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	if w.wrote {
+		panic(http.ErrAbortHandler)
+	}
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, crypt.ErrWrongPassphrase):
+		status = http.StatusForbidden
+	case errors.Is(err, crypt.ErrCorruptFile), errors.Is(err, crypt.ErrNotEncrypted), errors.Is(err, crypt.ErrUnsupportedVersion):
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Del("Content-Type")
+	replyError(w, status, err)
+}
+
+func replyError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// records whether a body was written, after which the status can't change
+type responseWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// lets http.ResponseController reach the connection
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
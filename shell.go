@@ -0,0 +1,180 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/drish/cloak/crypt"
+)
+
+var shellHelp = `commands:
+  encrypt file [output]	encrypts file with the session passphrase or to the session identities
+  decrypt file [output]	decrypts file, refusing to overwrite output
+  inspect file		prints the format of an encrypted file
+  help			prints this help
+  exit			ends the session and forgets the passphrase
+`
+
+// the keys a shell session was unlocked with, either a passphrase or the
+// identities of a keygen file
+type shellSession struct {
+	passphrase []byte
+	identities []*crypt.Identity
+}
+
+// reads commands from in until exit or end of input. lines are never kept
+// or written to a history file, and passphrases are only asked for once
+// when the session starts so they never appear in a command line.
+func runShell(in io.Reader, out io.Writer, s *shellSession, interactive bool) {
+
+	defer wipe(s.passphrase)
+
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			fmt.Fprint(out, "cloak> ")
+		}
+		if !scanner.Scan() {
+			if interactive {
+				fmt.Fprintln(out)
+			}
+			return
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return
+		}
+		if err := s.run(out, args); err != nil {
+			fmt.Fprintf(out, "%s: %v\n", args[0], err)
+		}
+	}
+}
+
+// runs one shell command
+func (s *shellSession) run(out io.Writer, args []string) error {
+
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "help":
+		fmt.Fprint(out, shellHelp)
+		return nil
+	case "encrypt", "decrypt", "inspect":
+	default:
+		return fmt.Errorf("unknown command, try help")
+	}
+
+	if len(args) == 0 || len(args) > 2 || (cmd == "inspect" && len(args) > 1) {
+		return fmt.Errorf("wrong number of arguments, try help")
+	}
+	path, output := args[0], ""
+	if len(args) == 2 {
+		output = args[1]
+	}
+
+	switch cmd {
+	case "encrypt":
+		return s.encrypt(out, path, output)
+	case "decrypt":
+		return s.decrypt(out, path, output)
+	}
+	return inspect(out, path)
+}
+
+func (s *shellSession) encrypt(out io.Writer, path, output string) error {
+
+	opts := crypt.Options{OutputPath: output}
+
+	var res *crypt.Result
+	var err error
+	if s.identities != nil {
+		var recipients []*crypt.Recipient
+		for _, id := range s.identities {
+			recipients = append(recipients, id.Recipient())
+		}
+		res, err = crypt.EncryptToRecipients(path, recipients, opts)
+	} else {
+		res, err = crypt.EncryptWithOptions(path, s.passphrase, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "output file: %s\n", res.Output)
+	return nil
+}
+
+func (s *shellSession) decrypt(out io.Writer, path, output string) error {
+
+	target := output
+	if target == "" {
+		if info, err := crypt.ReadFormat(path); err == nil {
+			target = "out" + info.Ext
+		}
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+
+	opts := crypt.Options{OutputPath: output}
+
+	var res *crypt.Result
+	var err error
+	if s.identities != nil {
+		res, err = crypt.DecryptWithIdentities(path, s.identities, opts)
+	} else {
+		res, err = crypt.DecryptWithOptions(path, s.passphrase, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, w := range res.Warnings {
+		fmt.Fprintf(out, "warning: %s\n", w)
+	}
+	fmt.Fprintf(out, "output file: %s\n", res.Output)
+	return nil
+}
+
+// prints what Inspect reports about an encrypted file
+func inspect(out io.Writer, path string) error {
+
+	info, err := crypt.Inspect(path)
+	if err != nil {
+		return err
+	}
+	writeInfo(out, info)
+	return nil
+}
+
+// formats key derivation parameters like the -scrypt and -argon2id flags
+func kdfString(p crypt.KDFParams) string {
+	if p.KDF == crypt.RawKey {
+		return p.KDF.String()
+	}
+	if p.KDF == crypt.Argon2id {
+		return fmt.Sprintf("%s %d,%d,%d", p.KDF, p.Time, p.Memory, p.Threads)
+	}
+	return fmt.Sprintf("%s %d,%d,%d", p.KDF, p.N, p.R, p.P)
+}
@@ -0,0 +1,70 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// writes the format specification as json or as a human readable listing
+func printSpec(w io.Writer, asJSON bool) error {
+
+	spec := crypt.Spec()
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(spec)
+	}
+
+	for _, l := range spec.Formats {
+		fmt.Fprintf(w, "version %d\t%s\tencoding: %s\n", l.Version, l.Name, l.Encoding)
+		for _, f := range l.Fields {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", position(f.Offset), position(f.Size), f.Name, f.Description)
+		}
+	}
+
+	for _, group := range []struct {
+		name string
+		ids  []crypt.Algorithm
+	}{
+		{"cipher", spec.Ciphers},
+		{"kdf", spec.KDFs},
+		{"compressor", spec.Compressors},
+		{"stanza", spec.Stanzas},
+		{"record", spec.Records},
+	} {
+		for _, a := range group.ids {
+			fmt.Fprintf(w, "%s %d\t%s\n", group.name, a.ID, a.Name)
+		}
+	}
+	for _, wrapper := range spec.Wrappers {
+		fmt.Fprintf(w, "wrapper\t%s\n", wrapper)
+	}
+
+	return nil
+}
+
+// an offset or size, "-" when it varies
+func position(n int) string {
+	if n < 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
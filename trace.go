@@ -0,0 +1,34 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"log/slog"
+)
+
+// a logger for Options.Logger that writes every decision of encrypt and
+// decrypt to w, as text or as json lines, or nil when neither is set
+func traceLogger(w io.Writer, text, json bool) *slog.Logger {
+
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch {
+	case json:
+		return slog.New(slog.NewJSONHandler(w, opts))
+	case text:
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return nil
+}
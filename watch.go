@@ -0,0 +1,111 @@
+// Copyright © 2017 carlos derich <carlosderich@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/drish/cloak/crypt"
+)
+
+// encrypts the files dropped in dir until interrupted, logging each one.
+// a file that fails is logged and watching goes on.
+func watch(dir string, passphrase []byte, interval time.Duration, opts crypt.Options) error {
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := &crypt.Watcher{
+		Dir:        dir,
+		Passphrase: passphrase,
+		Options:    opts,
+		Interval:   interval,
+		OnResult: func(r crypt.BatchResult) {
+			if r.Err != nil {
+				log.Printf("%s: %v", r.Path, r.Err)
+				return
+			}
+			log.Println("output file: ", r.Result.Output)
+			if opts.ShredOriginal {
+				log.Println("shredded original file: ", r.Path)
+			}
+		},
+	}
+
+	log.Println("watching: ", dir)
+	err = w.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// prints what watching dir would do with the files in it, as json or one
+// line per file, without encrypting anything
+func planWatch(w io.Writer, dir string, opts crypt.Options, asJSON bool) error {
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	plan, err := (&crypt.Watcher{Dir: dir, Options: opts}).Plan()
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if plan == nil {
+			plan = []crypt.PlanEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+
+	for _, e := range plan {
+		switch {
+		case e.Action == crypt.PlanSkip:
+			_, err = fmt.Fprintf(w, "skip\t%s: %s\n", e.Path, e.Reason)
+		case e.Shred:
+			_, err = fmt.Fprintf(w, "%s\t%s -> %s, shredding the original\n", e.Action, e.Path, e.Output)
+		default:
+			_, err = fmt.Fprintf(w, "%s\t%s -> %s\n", e.Action, e.Path, e.Output)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}